@@ -0,0 +1,33 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminOnly serves the handler only to requests which carry the admin token
+// as a bearer token in the Authorization header. Other requests are rejected
+// with 401.
+func (s *httpServer) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// WithAdminToken enables admin endpoints, which export and import tracked
+// wallets and control chain subscribers. Requests to them must carry Token as
+// a bearer token. Default is disabled, an empty Token keeps them disabled.
+type WithAdminToken struct {
+	Token string
+}
+
+func (w WithAdminToken) Apply(s *httpServer) {
+	s.adminToken = w.Token
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "1.2.3.4:5555",
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "untrusted proxy forwarded headers are ignored",
+			remoteAddr: "1.2.3.4:5555",
+			headers: map[string]string{
+				"X-Forwarded-For": "5.6.7.8",
+				"X-Real-IP":       "5.6.7.8",
+			},
+			want: "1.2.3.4",
+		},
+		{
+			name:       "trusted proxy x-forwarded-for",
+			remoteAddr: "10.0.0.5:5555",
+			headers: map[string]string{
+				"X-Forwarded-For": "5.6.7.8",
+			},
+			want: "5.6.7.8",
+		},
+		{
+			name:       "trusted proxy chain skips trusted hops",
+			remoteAddr: "10.0.0.5:5555",
+			headers: map[string]string{
+				"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 192.168.1.1",
+			},
+			want: "5.6.7.8",
+		},
+		{
+			name:       "trusted proxy x-real-ip",
+			remoteAddr: "192.168.1.1:5555",
+			headers: map[string]string{
+				"X-Real-IP": "5.6.7.8",
+			},
+			want: "5.6.7.8",
+		},
+		{
+			name:       "trusted proxy malformed x-forwarded-for",
+			remoteAddr: "10.0.0.5:5555",
+			headers: map[string]string{
+				"X-Forwarded-For": "not-an-ip",
+			},
+			want: "10.0.0.5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, clientIP(r, trusted))
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies("")
+	assert.NoError(t, err)
+	assert.Len(t, nets, 0)
+
+	_, err = ParseTrustedProxies("10.0.0.0/8,nope")
+	assert.Error(t, err)
+}
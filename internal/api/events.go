@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/gorilla/websocket"
+)
+
+// eventWriteTimeout bounds writing a single event to a streaming client
+const eventWriteTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// eventFilter reports whether a streamed event is delivered to the client.
+type eventFilter func(event *chain.TrackedWalletEvent) bool
+
+// parseEventFilter parses optional chain and user_id query parameters of
+// event streaming requests.
+func parseEventFilter(r *http.Request) (eventFilter, error) {
+	chainName := chain.ChainName(r.URL.Query().Get("chain"))
+
+	userID, filterUser := 0, r.URL.Query().Has("user_id")
+	if filterUser {
+		id, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id: %w", err)
+		}
+		userID = id
+	}
+
+	return func(event *chain.TrackedWalletEvent) bool {
+		if chainName != "" && event.ChainName != chainName {
+			return false
+		}
+		if filterUser && event.UserID != userID {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// streamEventsWS streams tracked wallet events as JSON text frames over a
+// websocket connection. Events can be filtered with chain and user_id query
+// parameters.
+func (s *httpServer) streamEventsWS(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, http.StatusNotImplemented, errorResponse{Error: "event streaming is not enabled"})
+		return
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader responds to the client
+		slog.Warn("failed to upgrade event stream connection", slog.Any("error", err))
+		return
+	}
+	defer conn.Close()
+
+	client := clientIP(r, s.trustedProxies)
+	events, unsubscribe := s.events.Subscribe("websocket " + client)
+	defer unsubscribe()
+
+	// Messages from the client are discarded, reading only processes control
+	// frames and detects a closed connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Unsubscribed by the stream, e.g. the client is too slow
+				conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "event stream closed"),
+					time.Now().Add(eventWriteTimeout),
+				)
+				return
+			}
+			if !filter(event) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				slog.Warn("failed to write event to websocket client",
+					slog.String("client_ip", client),
+					slog.Any("error", err),
+				)
+				return
+			}
+		}
+	}
+}
+
+// streamEventsSSE streams tracked wallet events as server-sent events with
+// JSON data. Events can be filtered with chain and user_id query parameters.
+// The stream ends when the client disconnects.
+func (s *httpServer) streamEventsSSE(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, http.StatusNotImplemented, errorResponse{Error: "event streaming is not enabled"})
+		return
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	client := clientIP(r, s.trustedProxies)
+	events, unsubscribe := s.events.Subscribe("sse " + client)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		slog.Error("event stream response can't be flushed", slog.Any("error", err))
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Unsubscribed by the stream, e.g. the client is too slow
+				return
+			}
+			if !filter(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("failed to marshal streamed event", slog.Any("error", err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				slog.Warn("failed to flush event to sse client",
+					slog.String("client_ip", client),
+					slog.Any("error", err),
+				)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEventStream hands out a single channel per subscriber which the test
+// publishes to.
+type fakeEventStream struct {
+	subscribed chan chan *chain.TrackedWalletEvent
+	// Receives names of unsubscribed subscribers
+	unsubscribed chan string
+}
+
+func newFakeEventStream() *fakeEventStream {
+	return &fakeEventStream{
+		subscribed:   make(chan chan *chain.TrackedWalletEvent, 1),
+		unsubscribed: make(chan string, 10),
+	}
+}
+
+func (f *fakeEventStream) Subscribe(name string) (<-chan *chain.TrackedWalletEvent, func()) {
+	ch := make(chan *chain.TrackedWalletEvent, 10)
+	f.subscribed <- ch
+	return ch, func() { f.unsubscribed <- name }
+}
+
+// subscriber waits for the next subscription.
+func (f *fakeEventStream) subscriber(t *testing.T) chan *chain.TrackedWalletEvent {
+	t.Helper()
+	select {
+	case ch := <-f.subscribed:
+		return ch
+	case <-time.After(time.Second):
+		t.Fatal("expected a subscription")
+		return nil
+	}
+}
+
+func TestStreamEventsWS(t *testing.T) {
+	stream := newFakeEventStream()
+	s := &httpServer{ethereumChain: chain.EthereumMainnet, events: stream}
+	router := http.NewServeMux()
+	s.registerRoutes(router)
+	// Connection is upgraded through the response writer wrappers
+	ts := httptest.NewServer(s.accessLog(gzipHandler(router, 0)))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/events/ws"
+
+	btcEvent := &chain.TrackedWalletEvent{
+		ChainName: chain.Bitcoin,
+		TxHash:    "btc-tx",
+		Wallet:    testBtcWallet,
+		Amount:    big.NewInt(10),
+		Fees:      big.NewInt(1),
+		UserID:    7,
+	}
+	solEvent := &chain.TrackedWalletEvent{
+		ChainName: chain.SolanaMainnet,
+		TxHash:    "sol-tx",
+		Wallet:    testSolWallet,
+		Amount:    big.NewInt(20),
+		Fees:      big.NewInt(0),
+	}
+
+	// last marks the end of the stream and must pass the filter
+	last := func(event *chain.TrackedWalletEvent) *chain.TrackedWalletEvent {
+		e := *event
+		e.TxHash = "last"
+		return &e
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		last   *chain.TrackedWalletEvent
+		wantTx []string
+	}{
+		{name: "all events", query: "", last: last(solEvent), wantTx: []string{"btc-tx", "sol-tx"}},
+		{name: "chain filter", query: "?chain=solana_mainnet", last: last(solEvent), wantTx: []string{"sol-tx"}},
+		{name: "user filter", query: "?user_id=7", last: last(btcEvent), wantTx: []string{"btc-tx"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Accept-Encoding": []string{"gzip"}}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.query, header)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+			assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+			events := stream.subscriber(t)
+			events <- btcEvent
+			events <- solEvent
+			events <- tt.last
+
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			got := []string{}
+			for {
+				event := &chain.TrackedWalletEvent{}
+				if !assert.NoError(t, conn.ReadJSON(event)) {
+					return
+				}
+				if event.TxHash == "last" {
+					break
+				}
+				got = append(got, event.TxHash)
+				if event.TxHash == "btc-tx" {
+					assert.Equal(t, btcEvent, event)
+				}
+			}
+			assert.Equal(t, tt.wantTx, got)
+		})
+	}
+
+	t.Run("closed stream closes the connection", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		close(stream.subscriber(t))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	})
+
+	t.Run("invalid user id", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/v1/events/ws?user_id=abc")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, decodeError(t, resp).Error, "invalid user_id")
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		router := http.NewServeMux()
+		(&httpServer{}).registerRoutes(router)
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		resp, err := http.Get(ts.URL + "/v1/events/ws")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		assert.Equal(t, "event streaming is not enabled", decodeError(t, resp).Error)
+	})
+}
+
+func TestStreamEventsSSE(t *testing.T) {
+	stream := newFakeEventStream()
+	s := &httpServer{ethereumChain: chain.EthereumMainnet, events: stream}
+	router := http.NewServeMux()
+	s.registerRoutes(router)
+	// Streamed events must not wait for the gzip threshold
+	ts := httptest.NewServer(s.accessLog(gzipHandler(router, 1024)))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v1/events/stream?chain=bitcoin", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	events := stream.subscriber(t)
+	events <- &chain.TrackedWalletEvent{ChainName: chain.SolanaMainnet, TxHash: "sol-tx"}
+	events <- &chain.TrackedWalletEvent{ChainName: chain.Bitcoin, TxHash: "btc-tx", Amount: big.NewInt(10)}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	select {
+	case line := <-lines:
+		data, ok := strings.CutPrefix(line, "data: ")
+		assert.True(t, ok, line)
+		event := &chain.TrackedWalletEvent{}
+		assert.NoError(t, json.Unmarshal([]byte(data), event))
+		assert.Equal(t, "btc-tx", event.TxHash)
+		assert.Equal(t, big.NewInt(10), event.Amount)
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+	}
+
+	// Handler unsubscribes once the client disconnects
+	cancel()
+	select {
+	case name := <-stream.unsubscribed:
+		assert.Equal(t, "sse 127.0.0.1", name)
+	case <-time.After(time.Second):
+		t.Fatal("expected the client to be unsubscribed")
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// gzipHandler compresses responses of at least minSize bytes for clients
+// which accept gzip encoding. Smaller responses are sent as is.
+func gzipHandler(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			minSize:        minSize,
+			status:         http.StatusOK,
+		}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		// Ignore quality values, e.g. gzip;q=0.8
+		name, q, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(q, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the response until minSize bytes are written.
+// Once the threshold is reached the response is compressed, otherwise the
+// buffered response is written uncompressed on Close.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status        int
+	headerWritten bool
+	buf           []byte
+	gz            *gzip.Writer
+	// Connection was taken over by the handler, e.g. a websocket
+	hijacked bool
+	// Response was flushed before reaching minSize, e.g. an event stream,
+	// and is written uncompressed
+	passthrough bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	// Delayed until it is known whether the response is compressed
+	g.status = status
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	if g.passthrough {
+		return g.ResponseWriter.Write(b)
+	}
+
+	g.buf = append(g.buf, b...)
+	if len(g.buf) < g.minSize {
+		return len(b), nil
+	}
+
+	h := g.ResponseWriter.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	g.writeHeader()
+	g.gz = gzip.NewWriter(g.ResponseWriter)
+	if _, err := g.gz.Write(g.buf); err != nil {
+		return 0, err
+	}
+	g.buf = nil
+	return len(b), nil
+}
+
+// FlushError sends buffered data to the client. Responses flushed before
+// compression started are sent uncompressed, so that streamed responses are
+// not delayed until minSize bytes are written.
+func (g *gzipResponseWriter) FlushError() error {
+	if g.gz != nil {
+		if err := g.gz.Flush(); err != nil {
+			return err
+		}
+	} else if !g.passthrough {
+		g.passthrough = true
+		g.writeHeader()
+		if len(g.buf) > 0 {
+			if _, err := g.ResponseWriter.Write(g.buf); err != nil {
+				return err
+			}
+			g.buf = nil
+		}
+	}
+	return http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Hijack lets websocket handlers take over the connection. The response is
+// no longer written by the gzip writer once hijacked.
+func (g *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(g.ResponseWriter).Hijack()
+	if err == nil {
+		g.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Close flushes the compressed stream or the buffered uncompressed response.
+func (g *gzipResponseWriter) Close() error {
+	if g.hijacked || g.passthrough {
+		return nil
+	}
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	g.writeHeader()
+	if len(g.buf) > 0 {
+		_, err := g.ResponseWriter.Write(g.buf)
+		return err
+	}
+	return nil
+}
+
+func (g *gzipResponseWriter) writeHeader() {
+	if !g.headerWritten {
+		g.headerWritten = true
+		g.ResponseWriter.WriteHeader(g.status)
+	}
+}
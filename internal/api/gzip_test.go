@@ -0,0 +1,100 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipHandler(t *testing.T) {
+	large := strings.Repeat(`{"wallet":"0x9642b23Ed1E01Df1092B92641051881a322F5D4E"},`, 100)
+	small := "OK"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		// Written in chunks to cross the threshold mid response
+		for i := 0; i < len(large); i += 100 {
+			io.WriteString(w, large[i:min(i+100, len(large))])
+		}
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(small))
+	})
+	server := httptest.NewServer(gzipHandler(mux, 1024))
+	defer server.Close()
+
+	// Disable transparent decompression of the default transport
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantGzip       bool
+		wantStatus     int
+		wantBody       string
+	}{
+		{
+			name:           "large response is gzipped when requested",
+			path:           "/large",
+			acceptEncoding: "deflate, gzip;q=0.9",
+			wantGzip:       true,
+			wantStatus:     http.StatusCreated,
+			wantBody:       large,
+		},
+		{
+			name:       "large response is not gzipped when not requested",
+			path:       "/large",
+			wantStatus: http.StatusCreated,
+			wantBody:   large,
+		},
+		{
+			name:           "gzip explicitly refused",
+			path:           "/large",
+			acceptEncoding: "gzip;q=0",
+			wantStatus:     http.StatusCreated,
+			wantBody:       large,
+		},
+		{
+			name:           "small response is not gzipped",
+			path:           "/small",
+			acceptEncoding: "gzip",
+			wantStatus:     http.StatusOK,
+			wantBody:       small,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			assert.NoError(t, err)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			resp, err := client.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+
+			var body io.Reader = resp.Body
+			if tt.wantGzip {
+				assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+				gz, err := gzip.NewReader(resp.Body)
+				assert.NoError(t, err)
+				body = gz
+			} else {
+				assert.Empty(t, resp.Header.Get("Content-Encoding"))
+			}
+			got, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(got))
+		})
+	}
+}
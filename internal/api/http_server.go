@@ -1,23 +1,38 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/big"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 )
 
-func NewHttpServer(addr, port string, txTracker chain.WalletTransactionTracker) *httpServer {
-	return &httpServer{
-		addr:      addr,
-		port:      port,
-		txTracker: txTracker,
+func NewHttpServer(addr, port string, txTracker chain.WalletTransactionTracker, opts ...HttpServerOption) *httpServer {
+	s := &httpServer{
+		addr:          addr,
+		port:          port,
+		txTracker:     txTracker,
+		ethereumChain: chain.EthereumMainnet,
+		legacyRoutes:  true,
 	}
+
+	for _, opt := range opts {
+		opt.Apply(s)
+	}
+
+	return s
 }
 
 type httpServer struct {
@@ -25,6 +40,35 @@ type httpServer struct {
 	port string
 
 	txTracker chain.WalletTransactionTracker
+	// EVM chain of ethereum wallets in requests
+	ethereumChain chain.ChainName
+	// Optional, enables admin chain control endpoints
+	chains chain.ChainController
+	// Optional, enables per wallet webhooks
+	webhooks WebhookRegistry
+	// Optional, enables ENS names in place of ethereum wallets
+	ens ENSRegistry
+	// Optional, enables event streaming endpoints
+	events EventStream
+	// Optional, enables the stats endpoint
+	stats StatsProvider
+
+	// Proxies which are trusted to report the client ip via forwarding
+	// headers
+	trustedProxies []*net.IPNet
+
+	// Responses of at least gzipMinSize bytes are compressed if enabled
+	gzipEnabled bool
+	gzipMinSize int
+
+	// Whether routes are also served without the api version prefix
+	legacyRoutes bool
+
+	// Optional, limits track, untrack and admin requests per client ip
+	rateLimiter *rateLimiter
+
+	// Optional, enables admin endpoints authorized with the token
+	adminToken string
 
 	l net.Listener
 }
@@ -32,33 +76,216 @@ type httpServer struct {
 func (s *httpServer) Serve() error {
 	router := http.NewServeMux()
 	s.registerRoutes(router)
-	return s.startServer(router)
+
+	var handler http.Handler = router
+	if s.gzipEnabled {
+		handler = gzipHandler(handler, s.gzipMinSize)
+	}
+	return s.startServer(s.accessLog(handler))
 }
 
-func (s *httpServer) startServer(r *http.ServeMux) error {
+func (s *httpServer) Listen() error {
 	bindAddr := net.JoinHostPort(s.addr, s.port)
 
 	l, err := net.Listen("tcp", bindAddr)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to listen on %s: %w", bindAddr, err)
 	}
+	s.l = l
 	s.port = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
 
+	return nil
+}
+
+func (s *httpServer) startServer(r http.Handler) error {
+	if s.l == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
+
 	slog.Info("starting http api server",
 		slog.String("addr", s.addr),
 		slog.String("port", s.port),
 	)
 
-	return http.Serve(l, r)
+	return http.Serve(s.l, r)
 }
 
 func (s *httpServer) Close() error {
 	return s.l.Close()
 }
 
+// accessLog logs every handled request together with the resolved client ip.
+func (s *httpServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		slog.Info("handled http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.String("client_ip", clientIP(r, s.trustedProxies)),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// FlushError lets streaming handlers flush the wrapped writer.
+func (r *statusRecorder) FlushError() error {
+	return http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack lets websocket handlers take over the connection.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// apiVersionPrefix prefixes the api routes, so that breaking changes can be
+// introduced under a new version.
+const apiVersionPrefix = "/v1"
+
 func (s *httpServer) registerRoutes(r *http.ServeMux) {
-	r.HandleFunc("POST /tracked-wallets", s.trackWallet)
-	r.HandleFunc("DELETE /tracked-wallets", s.untrackWallet)
+	handle := func(method, path string, handler http.HandlerFunc) {
+		r.HandleFunc(method+" "+apiVersionPrefix+path, handler)
+		if s.legacyRoutes {
+			r.HandleFunc(method+" "+path, handler)
+		}
+	}
+	handle("GET", "/tracked-wallets", s.listTrackedWallets)
+	handle("POST", "/tracked-wallets", s.rateLimited(s.trackWallet))
+	handle("PUT", "/tracked-wallets", s.rateLimited(s.replaceWallets))
+	handle("DELETE", "/tracked-wallets", s.rateLimited(s.untrackWallet))
+	handle("POST", "/muted-wallets", s.muteWallet)
+	handle("DELETE", "/muted-wallets", s.unmuteWallet)
+	if s.adminToken != "" {
+		admin := func(handler http.HandlerFunc) http.HandlerFunc {
+			return s.rateLimited(s.adminOnly(handler))
+		}
+		handle("GET", "/admin/tracked-wallets/export", admin(s.exportWallets))
+		handle("POST", "/admin/tracked-wallets/import", admin(s.importWallets))
+		handle("POST", "/admin/chains/{chain}/stop", admin(s.stopChain))
+	}
+	handle("GET", "/events/ws", s.streamEventsWS)
+	handle("GET", "/events/stream", s.streamEventsSSE)
+	handle("GET", "/stats", s.getStats)
+	handle("GET", "/stats/subscribers", s.getSubscriberStats)
+	// Scraped by monitoring, not versioned with the api
+	r.Handle("GET /metrics", metrics.Default.Handler())
+}
+
+type HttpServerOption interface {
+	Apply(*httpServer)
+}
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-For and X-Real-IP
+// headers are used to resolve the client ip.
+type WithTrustedProxies struct {
+	Proxies []*net.IPNet
+}
+
+func (w WithTrustedProxies) Apply(s *httpServer) {
+	s.trustedProxies = w.Proxies
+}
+
+// WithChainController enables admin endpoints which control chain
+// subscribers. Admin endpoints must be enabled with WithAdminToken.
+type WithChainController struct {
+	Controller chain.ChainController
+}
+
+func (w WithChainController) Apply(s *httpServer) {
+	s.chains = w.Controller
+}
+
+// WithWebhookRegistry enables per wallet webhooks supplied in track
+// requests.
+type WithWebhookRegistry struct {
+	Registry WebhookRegistry
+}
+
+func (w WithWebhookRegistry) Apply(s *httpServer) {
+	s.webhooks = w.Registry
+}
+
+// WithENSRegistry enables ENS names in place of ethereum wallet addresses in
+// track and untrack requests.
+type WithENSRegistry struct {
+	Registry ENSRegistry
+}
+
+func (w WithENSRegistry) Apply(s *httpServer) {
+	s.ens = w.Registry
+}
+
+// WithEventStream enables streaming of tracked wallet events to API clients.
+type WithEventStream struct {
+	Stream EventStream
+}
+
+func (w WithEventStream) Apply(s *httpServer) {
+	s.events = w.Stream
+}
+
+// WithStatsProvider enables the stats endpoint.
+type WithStatsProvider struct {
+	Provider StatsProvider
+}
+
+func (w WithStatsProvider) Apply(s *httpServer) {
+	s.stats = w.Provider
+}
+
+// WithEthereumChain sets the EVM chain ethereum wallets of requests are
+// tracked on. Default is ethereum mainnet.
+type WithEthereumChain struct {
+	Name chain.ChainName
+}
+
+func (w WithEthereumChain) Apply(s *httpServer) {
+	if w.Name != "" {
+		s.ethereumChain = w.Name
+	}
+}
+
+// WithGzip enables gzip compression of responses of at least MinSize bytes
+// for clients which accept it.
+type WithGzip struct {
+	Enabled bool
+	MinSize int
+}
+
+func (w WithGzip) Apply(s *httpServer) {
+	s.gzipEnabled = w.Enabled
+	s.gzipMinSize = w.MinSize
+}
+
+// WithLegacyRoutes sets whether routes are also served without the api
+// version prefix, e.g. /tracked-wallets in addition to /v1/tracked-wallets.
+// Default is true.
+type WithLegacyRoutes struct {
+	Enabled bool
+}
+
+func (w WithLegacyRoutes) Apply(s *httpServer) {
+	s.legacyRoutes = w.Enabled
 }
 
 type TrackWalletRequest struct {
@@ -66,92 +293,708 @@ type TrackWalletRequest struct {
 	EthereumWallet string `json:"ethereum_wallet"`
 	BitcoinWallet  string `json:"bitcoin_wallet"`
 	SolanaWallet   string `json:"solana_wallet"`
+	// Optional lists of wallets tracked in addition to the singular fields.
+	// With lists, each wallet is tracked independently and the result of
+	// each is reported in TrackWalletsResponse. Only supported when tracking.
+	EthereumWallets []string `json:"ethereum_wallets"`
+	BitcoinWallets  []string `json:"bitcoin_wallets"`
+	SolanaWallets   []string `json:"solana_wallets"`
+	// Optional webhook which receives events of the wallets in the request
+	WebhookURL string `json:"webhook_url"`
+	// Optional number of block confirmations required before events of the
+	// wallets in the request are emitted. By default events are emitted once
+	// the transaction is included in a block.
+	Confirmations uint64 `json:"confirmations"`
+	// Optional minimum amounts of transfers emitted for the wallet of each
+	// chain, as decimal integers in the chain's base units, i.e. wei,
+	// satoshi and lamports. Smaller transfers, e.g. dust, are dropped.
+	EthereumMinAmount string `json:"ethereum_min_amount"`
+	BitcoinMinAmount  string `json:"bitcoin_min_amount"`
+	SolanaMinAmount   string `json:"solana_min_amount"`
+	// Optional direction of transfers emitted for the wallets in the
+	// request: incoming, outgoing or both. Default is both.
+	Direction string `json:"direction"`
+}
+
+// errorResponse is the body of failed API requests.
+type errorResponse struct {
+	Error  string          `json:"error"`
+	Chain  chain.ChainName `json:"chain,omitempty"`
+	Wallet string          `json:"wallet,omitempty"`
+	// Request fields which failed validation
+	InvalidFields []fieldError `json:"invalid_fields,omitempty"`
+}
+
+type fieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, resp errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("failed to write error response", slog.Any("error", err))
+	}
+}
+
+// validateWallets validates all non empty wallets of the request and returns
+// errors of the invalid ones.
+func (s *httpServer) validateWallets(req *TrackWalletRequest) []fieldError {
+	fields := []struct {
+		name   string
+		wallet string
+		chain  chain.ChainName
+	}{
+		{"ethereum_wallet", req.EthereumWallet, s.ethereumChain},
+		{"bitcoin_wallet", req.BitcoinWallet, chain.Bitcoin},
+		{"solana_wallet", req.SolanaWallet, chain.SolanaMainnet},
+	}
+
+	invalid := []fieldError{}
+	for _, f := range fields {
+		if f.wallet == "" {
+			continue
+		}
+		if _, err := chain.NormalizeWallet(f.chain, f.wallet); err != nil {
+			invalid = append(invalid, fieldError{Field: f.name, Error: err.Error()})
+		}
+	}
+	return invalid
+}
+
+// trackSettings are settings a track request applies to its wallets.
+type trackSettings struct {
+	confirmations uint64
+	// nil - not changed
+	minAmount *big.Int
+	direction chain.Direction
+	// Empty - no webhook
+	webhookURL string
+}
+
+// trackFailure describes why a wallet of a track request was not tracked.
+type trackFailure struct {
+	status int
+	reason string
+}
+
+// trackUserWallet applies the settings to the wallet, tracks it for the user
+// and registers its webhook. Settings are applied to the user's wallet before
+// tracking, so that no events are emitted without them. The previous ones are
+// restored if the wallet is not tracked, e.g. when the user already tracks
+// it. On success it returns undo, which untracks the wallet again and
+// restores the previous settings.
+func (s *httpServer) trackUserWallet(userID int, wallet string, chainName chain.ChainName, settings trackSettings) (func(), *trackFailure) {
+	fail := func(status int, reason, msg string, err error) *trackFailure {
+		slog.Error(msg,
+			slog.String("chain", string(chainName)),
+			slog.Any("error", err),
+		)
+		return &trackFailure{status: status, reason: reason}
+	}
+
+	previous := defaultWalletSettings
+	if settings.confirmations > 0 || settings.minAmount != nil || settings.direction != chain.DirectionBoth {
+		var err error
+		if previous, err = s.walletSettings(userID, wallet, chainName); err != nil {
+			return nil, fail(http.StatusBadRequest, "failed to get wallet settings", "failed to get wallet settings", err)
+		}
+	}
+	// Restores of the applied settings
+	restores := []func(){}
+	restore := func() {
+		for _, r := range restores {
+			r()
+		}
+	}
+	if settings.confirmations > 0 {
+		if err := s.txTracker.SetWalletConfirmations(userID, wallet, chainName, settings.confirmations); err != nil {
+			return nil, fail(http.StatusBadRequest, "failed to set confirmations", "failed to set wallet confirmations", err)
+		}
+		restores = append(restores, func() {
+			s.txTracker.SetWalletConfirmations(userID, wallet, chainName, previous.Confirmations)
+		})
+	}
+	if settings.minAmount != nil {
+		if err := s.txTracker.SetWalletMinAmount(userID, wallet, chainName, settings.minAmount); err != nil {
+			restore()
+			return nil, fail(http.StatusBadRequest, "failed to set minimum amount", "failed to set wallet minimum amount", err)
+		}
+		restores = append(restores, func() {
+			s.txTracker.SetWalletMinAmount(userID, wallet, chainName, previous.MinAmount)
+		})
+	}
+	if settings.direction != chain.DirectionBoth {
+		if err := s.txTracker.SetWalletDirection(userID, wallet, chainName, settings.direction); err != nil {
+			restore()
+			return nil, fail(http.StatusBadRequest, "failed to set direction", "failed to set wallet direction", err)
+		}
+		restores = append(restores, func() {
+			s.txTracker.SetWalletDirection(userID, wallet, chainName, previous.Direction)
+		})
+	}
+
+	if err := s.txTracker.TrackUserWallet(userID, wallet, chainName); err != nil {
+		restore()
+		if errors.Is(err, chain.ErrWalletAlreadyTracked) {
+			return nil, fail(http.StatusConflict, "wallet is already tracked", "failed to track wallet", err)
+		}
+		return nil, fail(http.StatusBadRequest, "failed to register wallet tracking", "failed to track wallet", err)
+	}
+	undo := func() {
+		restore()
+		if err := s.txTracker.UntrackUserWallet(userID, wallet, chainName); err != nil {
+			slog.Error("failed to roll back wallet tracking",
+				slog.String("chain", string(chainName)),
+				slog.Any("error", err),
+			)
+		}
+		if settings.webhookURL != "" {
+			s.webhooks.RemoveWebhook(userID, wallet, chainName)
+		}
+	}
+	if settings.webhookURL != "" {
+		if err := s.webhooks.SetWebhook(userID, wallet, chainName, settings.webhookURL); err != nil {
+			undo()
+			return nil, fail(http.StatusBadRequest, "failed to register webhook", "failed to set wallet webhook", err)
+		}
+	}
+
+	slog.Info("registered wallet for tracking",
+		slog.String("chain", string(chainName)),
+		slog.String("wallet", wallet),
+	)
+	return undo, nil
+}
+
+// isENSName reports whether the wallet of the chain is an ENS name which is
+// tracked as the address it resolves to.
+func (s *httpServer) isENSName(wallet string, chainName chain.ChainName) bool {
+	return s.ens != nil && chainName == s.ethereumChain && chain.IsENSName(wallet)
+}
+
+// resolveENSName returns the address the ENS name resolves to.
+func (s *httpServer) resolveENSName(name string) (string, *trackFailure) {
+	address, err := s.ens.Resolve(name)
+	if err != nil {
+		slog.Error("failed to resolve ens name",
+			slog.String("name", name),
+			slog.Any("error", err),
+		)
+		if errors.Is(err, chain.ErrENSNameNotResolved) {
+			return "", &trackFailure{status: http.StatusBadRequest, reason: "ens name does not resolve to an address"}
+		}
+		return "", &trackFailure{status: http.StatusInternalServerError, reason: "failed to resolve ens name"}
+	}
+	return address, nil
+}
+
+// defaultWalletSettings are settings of wallets which are not tracked.
+var defaultWalletSettings = chain.WalletSettings{Direction: chain.DirectionBoth}
+
+// walletSettings returns current settings of the wallet of the user, or the
+// defaults if the user does not track it.
+func (s *httpServer) walletSettings(userID int, wallet string, chainName chain.ChainName) (chain.WalletSettings, error) {
+	settings, err := s.txTracker.WalletSettings(userID, wallet, chainName)
+	if errors.Is(err, chain.ErrWalletNotTracked) {
+		return defaultWalletSettings, nil
+	}
+	return settings, err
+}
+
+// parseMinAmounts parses non empty minimum amounts of the request per chain
+// and returns errors of the invalid ones.
+func (s *httpServer) parseMinAmounts(req *TrackWalletRequest) (map[chain.ChainName]*big.Int, []fieldError) {
+	fields := []struct {
+		name   string
+		amount string
+		chain  chain.ChainName
+	}{
+		{"ethereum_min_amount", req.EthereumMinAmount, s.ethereumChain},
+		{"bitcoin_min_amount", req.BitcoinMinAmount, chain.Bitcoin},
+		{"solana_min_amount", req.SolanaMinAmount, chain.SolanaMainnet},
+	}
+
+	minAmounts := make(map[chain.ChainName]*big.Int)
+	invalid := []fieldError{}
+	for _, f := range fields {
+		if f.amount == "" {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(f.amount, 10)
+		if !ok || amount.Sign() < 0 {
+			invalid = append(invalid, fieldError{Field: f.name, Error: "must be a non-negative integer"})
+			continue
+		}
+		if amount.Sign() > 0 {
+			minAmounts[f.chain] = amount
+		}
+	}
+	return minAmounts, invalid
+}
+
+// TrackedWalletsResponse lists currently tracked wallets per chain.
+type TrackedWalletsResponse struct {
+	Wallets map[chain.ChainName][]string `json:"wallets"`
+}
+
+func (s *httpServer) listTrackedWallets(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(&TrackedWalletsResponse{
+		Wallets: s.txTracker.TrackedWallets(),
+	})
+	if err != nil {
+		slog.Error("failed to marshal tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to list tracked wallets"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// ReplaceWalletsRequest is the complete set of wallets per chain tracked for
+// the user.
+type ReplaceWalletsRequest struct {
+	UserID  int                          `json:"user_id"`
+	Wallets map[chain.ChainName][]string `json:"wallets"`
+}
+
+// replaceWallets reconciles wallets tracked for the user with the requested
+// set: missing wallets are tracked and wallets no longer present, including
+// those of chains absent from the request, are untracked.
+func (s *httpServer) replaceWallets(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("failed to read request body", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to read request body"})
+		return
+	}
+
+	req := &ReplaceWalletsRequest{}
+	if err := json.Unmarshal(reqBytes, req); err != nil {
+		slog.Error("failed to parse request", slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to parse request"})
+		return
+	}
+
+	// Response lists the set in the canonical form wallets are tracked as
+	normalized := make(map[chain.ChainName][]string, len(req.Wallets))
+	invalid := []fieldError{}
+	for chainName, wallets := range req.Wallets {
+		for _, wallet := range wallets {
+			n, err := chain.NormalizeWallet(chainName, wallet)
+			if err != nil {
+				invalid = append(invalid, fieldError{Field: "wallets." + string(chainName), Error: err.Error()})
+				continue
+			}
+			if !slices.Contains(normalized[chainName], n) {
+				normalized[chainName] = append(normalized[chainName], n)
+			}
+		}
+		slices.Sort(normalized[chainName])
+	}
+	if len(invalid) > 0 {
+		slices.SortFunc(invalid, func(a, b fieldError) int { return strings.Compare(a.Field, b.Field) })
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid wallet addresses",
+			InvalidFields: invalid,
+		})
+		return
+	}
+
+	if err := s.txTracker.ReplaceUserWallets(req.UserID, normalized); err != nil {
+		slog.Error("failed to replace user wallets",
+			slog.Int("user_id", req.UserID),
+			slog.Any("error", err),
+		)
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to replace tracked wallets"})
+		return
+	}
+	slog.Info("replaced tracked wallets of user", slog.Int("user_id", req.UserID))
+
+	resp, err := json.Marshal(&TrackedWalletsResponse{Wallets: normalized})
+	if err != nil {
+		slog.Error("failed to marshal tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to list tracked wallets"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// WalletsExport is the configuration of all tracked wallets, returned by the
+// export endpoint and accepted by the import endpoint.
+type WalletsExport struct {
+	Wallets []chain.TrackedWalletConfig `json:"wallets"`
+}
+
+// exportWallets returns the configuration of all tracked wallets, e.g. as a
+// backup.
+func (s *httpServer) exportWallets(w http.ResponseWriter, r *http.Request) {
+	configs, err := s.txTracker.ExportWallets()
+	if err != nil {
+		slog.Error("failed to export tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to export tracked wallets"})
+		return
+	}
+	resp, err := json.Marshal(&WalletsExport{Wallets: configs})
+	if err != nil {
+		slog.Error("failed to marshal tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to export tracked wallets"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// importWallets tracks wallets of an export, e.g. to restore a backup.
+func (s *httpServer) importWallets(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("failed to read request body", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to read request body"})
+		return
+	}
+
+	req := &WalletsExport{}
+	if err := json.Unmarshal(reqBytes, req); err != nil {
+		slog.Error("failed to parse request", slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to parse request"})
+		return
+	}
+
+	if err := s.txTracker.ImportWallets(req.Wallets); err != nil {
+		slog.Error("failed to import tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error: fmt.Sprintf("failed to import tracked wallets: %s", err),
+		})
+		return
+	}
+	slog.Info("imported tracked wallets", slog.Int("wallets", len(req.Wallets)))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// TrackWalletResponse lists wallets tracked by a track request per chain, in
+// the canonical form they are tracked as, e.g. EIP-55 checksummed for EVM
+// chains.
+type TrackWalletResponse struct {
+	Wallets map[chain.ChainName]string `json:"wallets"`
 }
 
 func (s *httpServer) trackWallet(w http.ResponseWriter, r *http.Request) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		slog.Error("failed to read request body", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to read request body"})
+		return
+	}
+
+	req := &TrackWalletRequest{}
+	if err := json.Unmarshal(reqBytes, req); err != nil {
+		slog.Error("failed to parse request", slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to parse request"})
+		return
+	}
+	if req.hasWalletLists() {
+		s.trackWalletLists(w, req)
+		return
+	}
+
+	// ENS names are tracked as the addresses they resolve to
+	ensName := ""
+	if s.isENSName(req.EthereumWallet, s.ethereumChain) {
+		address, failure := s.resolveENSName(req.EthereumWallet)
+		if failure != nil {
+			writeError(w, failure.status, errorResponse{
+				Error:  failure.reason,
+				Chain:  s.ethereumChain,
+				Wallet: req.EthereumWallet,
+			})
+			return
+		}
+		ensName, req.EthereumWallet = req.EthereumWallet, address
+	}
+
+	// Validate all wallets before tracking any of them, so that the request
+	// is applied completely or not at all
+	if invalid := s.validateWallets(req); len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid wallet addresses",
+			InvalidFields: invalid,
+		})
+		return
+	}
+	minAmounts, invalid := s.parseMinAmounts(req)
+	if len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid minimum amounts",
+			InvalidFields: invalid,
+		})
+		return
+	}
+	direction, err := chain.ParseDirectionFilter(req.Direction)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid direction",
+			InvalidFields: []fieldError{{Field: "direction", Error: err.Error()}},
+		})
+		return
+	}
+	if req.WebhookURL != "" && s.webhooks == nil {
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "wallet webhooks are not enabled"})
+		return
+	}
+
+	walletsToTrack := [][2]string{
+		{req.EthereumWallet, string(s.ethereumChain)},
+		{req.BitcoinWallet, string(chain.Bitcoin)},
+		{req.SolanaWallet, string(chain.SolanaMainnet)},
+	}
+
+	settings := trackSettings{
+		confirmations: req.Confirmations,
+		direction:     direction,
+		webhookURL:    req.WebhookURL,
+	}
+	// Wallets tracked by this request, untracked again if a later wallet
+	// fails
+	type trackedWallet struct {
+		wallet string
+		chain  chain.ChainName
+		undo   func()
+	}
+	tracked := []trackedWallet{}
+	for _, tuple := range walletsToTrack {
+		chainName := chain.ChainName(tuple[1])
+		wallet := tuple[0]
+		if len(wallet) > 0 {
+			settings.minAmount = minAmounts[chainName]
+			undo, failure := s.trackUserWallet(req.UserID, wallet, chainName, settings)
+			if failure != nil {
+				for _, t := range tracked {
+					t.undo()
+				}
+				writeError(w, failure.status, errorResponse{
+					Error:  fmt.Sprintf("%s for %s", failure.reason, chainName),
+					Chain:  chainName,
+					Wallet: wallet,
+				})
+				return
+			}
+			tracked = append(tracked, trackedWallet{wallet, chainName, undo})
+		}
+	}
+	if ensName != "" {
+		s.ens.Watch(ensName, req.EthereumWallet)
+	}
+
+	trackResp := &TrackWalletResponse{Wallets: make(map[chain.ChainName]string, len(tracked))}
+	for _, t := range tracked {
+		// Wallets were validated before tracking
+		normalized, _ := chain.NormalizeWallet(t.chain, t.wallet)
+		trackResp.Wallets[t.chain] = normalized
+	}
+	resp, err := json.Marshal(trackResp)
+	if err != nil {
+		slog.Error("failed to marshal tracked wallets", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to list tracked wallets"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (s *httpServer) untrackWallet(w http.ResponseWriter, r *http.Request) {
+	reqBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("failed to read request body", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to read request body"})
 		return
 	}
 
 	req := &TrackWalletRequest{}
 	if err := json.Unmarshal(reqBytes, req); err != nil {
 		slog.Error("failed to parse request", slog.Any("error", err))
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed to parse request"))
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to parse request"})
 		return
 	}
 
+	// ENS names are untracked as the addresses they were tracked as
+	ensName := ""
+	if s.ens != nil && chain.IsENSName(req.EthereumWallet) {
+		address, ok := s.ens.Unwatch(req.EthereumWallet)
+		if !ok {
+			writeError(w, http.StatusBadRequest, errorResponse{
+				Error:  "ens name is not tracked",
+				Chain:  s.ethereumChain,
+				Wallet: req.EthereumWallet,
+			})
+			return
+		}
+		ensName, req.EthereumWallet = req.EthereumWallet, address
+	}
+
 	walletsToTrack := [][2]string{
-		{req.EthereumWallet, string(chain.EthereumMainnet)},
+		{req.EthereumWallet, string(s.ethereumChain)},
 		{req.BitcoinWallet, string(chain.Bitcoin)},
 		{req.SolanaWallet, string(chain.SolanaMainnet)},
 	}
 
+	// Wallets untracked by this request with their settings before it,
+	// tracked again if a later wallet fails
+	type untrackedWallet struct {
+		wallet   string
+		chain    chain.ChainName
+		previous chain.WalletSettings
+	}
+	untracked := []untrackedWallet{}
 	for _, tuple := range walletsToTrack {
 		chainName := chain.ChainName(tuple[1])
 		wallet := tuple[0]
 		if len(wallet) > 0 {
-			if err := s.txTracker.TrackWallet(wallet, chainName); err != nil {
-				slog.Error("failed to track wallet",
+			// Untracking clears the user's settings of the wallet
+			previous, err := s.walletSettings(req.UserID, wallet, chainName)
+			if err == nil {
+				err = s.txTracker.UntrackUserWallet(req.UserID, wallet, chainName)
+			}
+			if err != nil {
+				slog.Error("failed to untrack a wallet",
 					slog.String("chain", string(chainName)),
 					slog.Any("error", err),
 				)
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "failed to register wallet tracking for %s", chainName)
+				for _, done := range untracked {
+					s.retrackWallet(req.UserID, done.wallet, done.chain, done.previous)
+				}
+				if ensName != "" {
+					s.ens.Watch(ensName, req.EthereumWallet)
+				}
+				if errors.Is(err, chain.ErrWalletNotTracked) {
+					writeError(w, http.StatusNotFound, errorResponse{
+						Error:  fmt.Sprintf("wallet is not tracked for %s", chainName),
+						Chain:  chainName,
+						Wallet: wallet,
+					})
+					return
+				}
+				writeError(w, http.StatusBadRequest, errorResponse{
+					Error:  fmt.Sprintf("failed to deregister wallet tracking for %s", chainName),
+					Chain:  chainName,
+					Wallet: wallet,
+				})
 				return
 			}
-			slog.Info("registered wallet for tracking",
-				slog.String("chain", string(chainName)),
-				slog.String("wallet", wallet),
-			)
+			untracked = append(untracked, untrackedWallet{wallet, chainName, previous})
 		}
+	}
 
+	// Webhooks are removed only once all wallets are untracked, so that
+	// rolled back wallets keep their webhooks
+	for _, u := range untracked {
+		if s.webhooks != nil {
+			if err := s.webhooks.RemoveWebhook(req.UserID, u.wallet, u.chain); err != nil {
+				slog.Warn("failed to remove wallet webhook",
+					slog.String("chain", string(u.chain)),
+					slog.Any("error", err),
+				)
+			}
+		}
+		slog.Info("deregistered wallet from tracking",
+			slog.String("chain", string(u.chain)),
+			slog.String("wallet", u.wallet),
+		)
 	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
+}
 
+// retrackWallet tracks the wallet untracked by a failed request again for
+// the user. Its previous settings are applied before tracking, as untracking
+// cleared them.
+func (s *httpServer) retrackWallet(userID int, wallet string, chainName chain.ChainName, previous chain.WalletSettings) {
+	err := errors.Join(
+		s.txTracker.SetWalletConfirmations(userID, wallet, chainName, previous.Confirmations),
+		s.txTracker.SetWalletMinAmount(userID, wallet, chainName, previous.MinAmount),
+		s.txTracker.SetWalletDirection(userID, wallet, chainName, previous.Direction),
+		s.txTracker.TrackUserWallet(userID, wallet, chainName),
+	)
+	if err == nil && previous.Muted {
+		err = s.txTracker.MuteWallet(wallet, chainName)
+	}
+	if err != nil {
+		slog.Error("failed to roll back wallet untracking",
+			slog.String("chain", string(chainName)),
+			slog.Any("error", err),
+		)
+	}
 }
 
-func (s *httpServer) untrackWallet(w http.ResponseWriter, r *http.Request) {
+// muteWallet suppresses events of the wallets in the request without
+// untracking them.
+func (s *httpServer) muteWallet(w http.ResponseWriter, r *http.Request) {
+	s.applyToWallets(w, r, chain.WalletTransactionTracker.MuteWallet, "mute")
+}
+
+// unmuteWallet resumes event emission for the wallets in the request.
+func (s *httpServer) unmuteWallet(w http.ResponseWriter, r *http.Request) {
+	s.applyToWallets(w, r, chain.WalletTransactionTracker.UnmuteWallet, "unmute")
+}
+
+// applyToWallets parses TrackWalletRequest and calls fn for every non empty
+// wallet in it. action is used in logs and error responses.
+func (s *httpServer) applyToWallets(
+	w http.ResponseWriter,
+	r *http.Request,
+	fn func(t chain.WalletTransactionTracker, wallet string, chain chain.ChainName) error,
+	action string,
+) {
 	reqBytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		slog.Error("failed to read request body", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to read request body"})
 		return
 	}
 
 	req := &TrackWalletRequest{}
 	if err := json.Unmarshal(reqBytes, req); err != nil {
 		slog.Error("failed to parse request", slog.Any("error", err))
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed to parse request"))
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "failed to parse request"})
 		return
 	}
 
-	walletsToTrack := [][2]string{
-		{req.EthereumWallet, string(chain.EthereumMainnet)},
+	wallets := [][2]string{
+		{req.EthereumWallet, string(s.ethereumChain)},
 		{req.BitcoinWallet, string(chain.Bitcoin)},
 		{req.SolanaWallet, string(chain.SolanaMainnet)},
 	}
 
-	for _, tuple := range walletsToTrack {
+	for _, tuple := range wallets {
 		chainName := chain.ChainName(tuple[1])
 		wallet := tuple[0]
 		if len(wallet) > 0 {
-			if err := s.txTracker.UntrackWallet(tuple[0], chainName); err != nil {
-				slog.Error("failed to untrack a wallet",
+			if err := fn(s.txTracker, wallet, chainName); err != nil {
+				slog.Error("failed to "+action+" a wallet",
 					slog.String("chain", string(chainName)),
 					slog.Any("error", err),
 				)
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "failed to deregister wallet tracking for %s", chainName)
+				writeError(w, http.StatusBadRequest, errorResponse{
+					Error:  fmt.Sprintf("failed to %s wallet for %s", action, chainName),
+					Chain:  chainName,
+					Wallet: wallet,
+				})
 				return
 			}
-			slog.Info("deregistered wallet from tracking",
+			slog.Info(action+"d wallet",
 				slog.String("chain", string(chainName)),
 				slog.String("wallet", wallet),
 			)
@@ -161,3 +1004,32 @@ func (s *httpServer) untrackWallet(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// stopChain stops a single chain subscriber. Other chains keep running.
+func (s *httpServer) stopChain(w http.ResponseWriter, r *http.Request) {
+	if s.chains == nil {
+		writeError(w, http.StatusNotImplemented, errorResponse{Error: "chain control is not enabled"})
+		return
+	}
+
+	chainName := chain.ChainName(r.PathValue("chain"))
+	if err := s.chains.StopChain(chainName); err != nil {
+		slog.Error("failed to stop chain",
+			slog.String("chain", string(chainName)),
+			slog.Any("error", err),
+		)
+		status := http.StatusInternalServerError
+		if errors.Is(err, chain.ErrNoSubscriber) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, errorResponse{
+			Error: fmt.Sprintf("failed to stop chain %s", chainName),
+			Chain: chainName,
+		})
+		return
+	}
+	slog.Info("stopped chain subscriber", slog.String("chain", string(chainName)))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
@@ -2,21 +2,104 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Mantelijo/deblock-backend/internal/chain"
 	"github.com/Mantelijo/deblock-backend/internal/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
+type fakeWebhookRegistry struct {
+	// Keyed by hookKey of the user and wallet
+	hooks map[chain.ChainName]map[string]string
+}
+
+func hookKey(userID int, wallet string) string {
+	return fmt.Sprintf("%d:%s", userID, wallet)
+}
+
+func (f *fakeWebhookRegistry) SetWebhook(userID int, wallet string, c chain.ChainName, webhookUrl string) error {
+	if f.hooks[c] == nil {
+		f.hooks[c] = map[string]string{}
+	}
+	f.hooks[c][hookKey(userID, wallet)] = webhookUrl
+	return nil
+}
+
+func (f *fakeWebhookRegistry) RemoveWebhook(userID int, wallet string, c chain.ChainName) error {
+	delete(f.hooks[c], hookKey(userID, wallet))
+	return nil
+}
+
+// fakeENSRegistry resolves names from a fixed map.
+type fakeENSRegistry struct {
+	addresses map[string]string
+	watched   map[string]string
+}
+
+func (f *fakeENSRegistry) Resolve(name string) (string, error) {
+	address, ok := f.addresses[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", chain.ErrENSNameNotResolved, name)
+	}
+	return address, nil
+}
+
+func (f *fakeENSRegistry) Watch(name, address string) {
+	f.watched[name] = address
+}
+
+func (f *fakeENSRegistry) Unwatch(name string) (string, bool) {
+	address, ok := f.watched[name]
+	delete(f.watched, name)
+	return address, ok
+}
+
+const (
+	testEthWallet = "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	testBtcWallet = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	testSolWallet = "AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW"
+)
+
+// decodeError decodes JSON error response body.
+func decodeError(t *testing.T, resp *http.Response) errorResponse {
+	t.Helper()
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	errResp := errorResponse{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+	return errResp
+}
+
+const testAdminToken = "test-admin-token"
+
+// adminRequest sends a request to the admin endpoint at path, authorized with
+// testAdminToken.
+func adminRequest(t *testing.T, server *httptest.Server, method, path string, body io.Reader) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, body)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return server.Client().Do(req)
+}
+
 func TestHttpApiServer(t *testing.T) {
 
 	makeServer := func() (*httptest.Server, *httpServer) {
 		s := &httpServer{
-			txTracker: nil,
+			txTracker:     nil,
+			ethereumChain: chain.EthereumMainnet,
+			legacyRoutes:  true,
+			adminToken:    testAdminToken,
 		}
 		router := http.NewServeMux()
 		s.registerRoutes(router)
@@ -32,6 +115,7 @@ func TestHttpApiServer(t *testing.T) {
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{Error: "failed to parse request"}, decodeError(t, resp))
 	})
 	t.Run("post /tracked-wallets - failed to register wallet", func(t *testing.T) {
 		server, s := makeServer()
@@ -39,8 +123,9 @@ func TestHttpApiServer(t *testing.T) {
 
 		mockTracker := mocks.NewWalletTransactionTracker(t)
 		mockTracker.EXPECT().
-			TrackWallet(
-				"bb",
+			TrackUserWallet(
+				43,
+				testSolWallet,
 				chain.SolanaMainnet,
 			).
 			Return(
@@ -53,20 +138,55 @@ func TestHttpApiServer(t *testing.T) {
 				"user_id": 43,
 				"ethereum_wallet": "",
 				"bitcoin_wallet": "",
-				"solana_wallet": "bb"
+				"solana_wallet": "`+testSolWallet+`"
 				}
 				`)),
 		)
 		assert.NoError(t, err)
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
-		respText, err := io.ReadAll(resp.Body)
-		assert.NoError(t, err)
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		assert.Contains(
-			t, string(respText),
-			"failed to register wallet tracking for solana_mainnet",
+		assert.Equal(t, errorResponse{
+			Error:  "failed to register wallet tracking for solana_mainnet",
+			Chain:  chain.SolanaMainnet,
+			Wallet: testSolWallet,
+		}, decodeError(t, resp))
+	})
+
+	t.Run("post /tracked-wallets - already tracked", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testSolWallet, chain.SolanaMainnet).
+			Return(chain.ErrWalletAlreadyTracked)
+		// Wallets tracked by the request are rolled back
+		mockTracker.EXPECT().
+			UntrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`",
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
 		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "wallet is already tracked for solana_mainnet",
+			Chain:  chain.SolanaMainnet,
+			Wallet: testSolWallet,
+		}, decodeError(t, resp))
 	})
 
 	t.Run("post /tracked-wallets - success", func(t *testing.T) {
@@ -75,24 +195,27 @@ func TestHttpApiServer(t *testing.T) {
 
 		mockTracker := mocks.NewWalletTransactionTracker(t)
 		mockTracker.EXPECT().
-			TrackWallet(
-				"aa",
+			TrackUserWallet(
+				43,
+				testEthWallet,
 				chain.EthereumMainnet,
 			).
 			Return(
 				nil,
 			)
 		mockTracker.EXPECT().
-			TrackWallet(
-				"bb",
+			TrackUserWallet(
+				43,
+				testBtcWallet,
 				chain.Bitcoin,
 			).
 			Return(
 				nil,
 			)
 		mockTracker.EXPECT().
-			TrackWallet(
-				"cc",
+			TrackUserWallet(
+				43,
+				testSolWallet,
 				chain.SolanaMainnet,
 			).
 			Return(
@@ -104,120 +227,1263 @@ func TestHttpApiServer(t *testing.T) {
 		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
 			bytes.NewBuffer([]byte(`{
 				"user_id": 43,
-				"ethereum_wallet": "aa",
-				"bitcoin_wallet": "bb",
-				"solana_wallet": "cc"
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"solana_wallet": "`+testSolWallet+`"
 				}
 				`)),
 		)
 		assert.NoError(t, err)
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
-		respText, err := io.ReadAll(resp.Body)
-		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
-		assert.Contains(
-			t, string(respText),
-			"OK",
-		)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		trackResp := TrackWalletResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&trackResp))
+		assert.Equal(t, map[chain.ChainName]string{
+			chain.EthereumMainnet: testEthWallet,
+			chain.Bitcoin:         testBtcWallet,
+			chain.SolanaMainnet:   testSolWallet,
+		}, trackResp.Wallets)
 	})
-	t.Run("delete /tracked-wallets - bad request", func(t *testing.T) {
-		server, _ := makeServer()
+	t.Run("post /tracked-wallets - normalized wallets", func(t *testing.T) {
+		server, s := makeServer()
 		defer server.Close()
 
-		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets", nil)
+		lowercase := strings.ToLower(testEthWallet)
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, lowercase, chain.EthereumMainnet).
+			Return(nil)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, strings.ToUpper(testBtcWallet), chain.Bitcoin).
+			Return(nil)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+lowercase+`",
+				"bitcoin_wallet": "`+strings.ToUpper(testBtcWallet)+`"
+				}
+				`)),
+		)
 		assert.NoError(t, err)
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		trackResp := TrackWalletResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&trackResp))
+		// EIP-55 checksummed, lowercase bech32
+		assert.Equal(t, map[chain.ChainName]string{
+			chain.EthereumMainnet: "0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+			chain.Bitcoin:         testBtcWallet,
+		}, trackResp.Wallets)
 	})
-	t.Run("delete /tracked-wallets - failed to deregister wallet", func(t *testing.T) {
+	t.Run("post /tracked-wallets - ethereum testnet", func(t *testing.T) {
 		server, s := makeServer()
 		defer server.Close()
 
 		mockTracker := mocks.NewWalletTransactionTracker(t)
 		mockTracker.EXPECT().
-			UntrackWallet(
-				"bb",
-				chain.SolanaMainnet,
+			TrackUserWallet(
+				43,
+				testEthWallet,
+				chain.EthereumSepolia,
 			).
 			Return(
-				assert.AnError,
+				nil,
 			)
+
 		s.txTracker = mockTracker
+		WithEthereumChain{Name: chain.EthereumSepolia}.Apply(s)
 
-		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
 			bytes.NewBuffer([]byte(`{
 				"user_id": 43,
-				"ethereum_wallet": "",
-				"bitcoin_wallet": "",
-				"solana_wallet": "bb"
+				"ethereum_wallet": "`+testEthWallet+`"
 				}
 				`)),
 		)
 		assert.NoError(t, err)
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
-		respText, err := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - with confirmations", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(0, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
+		mockTracker.EXPECT().
+			SetWalletConfirmations(0, testEthWallet, chain.EthereumMainnet, uint64(12)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"confirmations": 12
+				}
+				`)),
+		)
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		assert.Contains(
-			t, string(respText),
-			"failed to deregister wallet tracking for solana_mainnet",
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - failed to set confirmations", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		// The ethereum wallet is tracked by another user
+		mockTracker.EXPECT().
+			WalletSettings(0, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{Confirmations: 6, Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			WalletSettings(0, testBtcWallet, chain.Bitcoin).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
+		mockTracker.EXPECT().
+			SetWalletConfirmations(0, testEthWallet, chain.EthereumMainnet, uint64(3)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			SetWalletConfirmations(0, testBtcWallet, chain.Bitcoin, uint64(3)).
+			Return(assert.AnError).
+			Once()
+		// Rollback of the ethereum wallet restores confirmations of the
+		// other user
+		mockTracker.EXPECT().
+			SetWalletConfirmations(0, testEthWallet, chain.EthereumMainnet, uint64(6)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			UntrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"confirmations": 3
+				}
+				`)),
 		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "failed to set confirmations for bitcoin",
+			Chain:  chain.Bitcoin,
+			Wallet: testBtcWallet,
+		}, decodeError(t, resp))
 	})
+	t.Run("post /tracked-wallets - already tracked with confirmations", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
 
-	t.Run("delete /tracked-wallets - success", func(t *testing.T) {
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(43, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{Confirmations: 6, Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			SetWalletConfirmations(43, testEthWallet, chain.EthereumMainnet, uint64(12)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(chain.ErrWalletAlreadyTracked)
+		// Confirmations shared with other users of the wallet are restored
+		mockTracker.EXPECT().
+			SetWalletConfirmations(43, testEthWallet, chain.EthereumMainnet, uint64(6)).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{"user_id": 43, "ethereum_wallet": "`+testEthWallet+`", "confirmations": 12}`),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - with minimum amounts", func(t *testing.T) {
 		server, s := makeServer()
 		defer server.Close()
 
 		mockTracker := mocks.NewWalletTransactionTracker(t)
 		mockTracker.EXPECT().
-			UntrackWallet(
-				"aa",
-				chain.EthereumMainnet,
-			).
-			Return(
-				nil,
-			)
+			WalletSettings(0, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
 		mockTracker.EXPECT().
-			UntrackWallet(
-				"bb",
-				chain.Bitcoin,
-			).
-			Return(
-				nil,
-			)
+			SetWalletMinAmount(0, testEthWallet, chain.EthereumMainnet, mock.MatchedBy(func(amount *big.Int) bool {
+				return amount.String() == "1000000000000000000000"
+			})).
+			Return(nil).
+			Once()
 		mockTracker.EXPECT().
-			UntrackWallet(
-				"cc",
-				chain.SolanaMainnet,
-			).
-			Return(
-				nil,
-			)
+			TrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		// Zero minimum amount doesn't filter anything
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testBtcWallet, chain.Bitcoin).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"ethereum_min_amount": "1000000000000000000000",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"bitcoin_min_amount": "0"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - invalid minimum amounts", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"ethereum_min_amount": "0.5",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"bitcoin_min_amount": "-1"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error: "invalid minimum amounts",
+			InvalidFields: []fieldError{
+				{Field: "ethereum_min_amount", Error: "must be a non-negative integer"},
+				{Field: "bitcoin_min_amount", Error: "must be a non-negative integer"},
+			},
+		}, decodeError(t, resp))
+	})
+	t.Run("post /tracked-wallets - failed to track wallet with minimum amount", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
 
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(0, testBtcWallet, chain.Bitcoin).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
+		mockTracker.EXPECT().
+			SetWalletMinAmount(0, testBtcWallet, chain.Bitcoin, big.NewInt(546)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testBtcWallet, chain.Bitcoin).
+			Return(assert.AnError).
+			Once()
+		// The minimum amount of the untracked wallet is cleared again
+		mockTracker.EXPECT().
+			SetWalletMinAmount(0, testBtcWallet, chain.Bitcoin, (*big.Int)(nil)).
+			Return(nil).
+			Once()
 		s.txTracker = mockTracker
 
-		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
 			bytes.NewBuffer([]byte(`{
-				"user_id": 43,
-				"ethereum_wallet": "aa",
-				"bitcoin_wallet": "bb",
-				"solana_wallet": "cc"
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"bitcoin_min_amount": "546"
 				}
 				`)),
 		)
 		assert.NoError(t, err)
 		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
-		respText, err := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - already tracked with minimum amount", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(43, testBtcWallet, chain.Bitcoin).
+			Return(chain.WalletSettings{MinAmount: big.NewInt(1000), Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			SetWalletMinAmount(43, testBtcWallet, chain.Bitcoin, big.NewInt(546)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testBtcWallet, chain.Bitcoin).
+			Return(chain.ErrWalletAlreadyTracked)
+		// Minimum amount shared with other users of the wallet is restored
+		mockTracker.EXPECT().
+			SetWalletMinAmount(43, testBtcWallet, chain.Bitcoin, big.NewInt(1000)).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{"user_id": 43, "bitcoin_wallet": "`+testBtcWallet+`", "bitcoin_min_amount": "546"}`),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("post /tracked-wallets - with direction", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(0, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
+		mockTracker.EXPECT().
+			SetWalletDirection(0, testEthWallet, chain.EthereumMainnet, chain.DirectionIncoming).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"direction": "incoming"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
-		assert.Contains(
-			t, string(respText),
-			"OK",
+	})
+	t.Run("post /tracked-wallets - already tracked with direction", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(43, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{Direction: chain.DirectionOutgoing}, nil)
+		mockTracker.EXPECT().
+			SetWalletDirection(43, testEthWallet, chain.EthereumMainnet, chain.DirectionIncoming).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(chain.ErrWalletAlreadyTracked)
+		// Direction shared with other users of the wallet is restored
+		mockTracker.EXPECT().
+			SetWalletDirection(43, testEthWallet, chain.EthereumMainnet, chain.DirectionOutgoing).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{"user_id": 43, "ethereum_wallet": "`+testEthWallet+`", "direction": "incoming"}`),
 		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
 	})
+	t.Run("post /tracked-wallets - invalid direction", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
 
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"direction": "deposits"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error: "invalid direction",
+			InvalidFields: []fieldError{
+				{Field: "direction", Error: `unsupported direction "deposits"`},
+			},
+		}, decodeError(t, resp))
+	})
+	t.Run("delete /tracked-wallets - bad request", func(t *testing.T) {
+		server, _ := makeServer()
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets", nil)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{Error: "failed to parse request"}, decodeError(t, resp))
+	})
+	t.Run("delete /tracked-wallets - failed to deregister wallet", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			UntrackUserWallet(
+				43,
+				testSolWallet,
+				chain.SolanaMainnet,
+			).
+			Return(
+				assert.AnError,
+			)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "",
+				"bitcoin_wallet": "",
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "failed to deregister wallet tracking for solana_mainnet",
+			Chain:  chain.SolanaMainnet,
+			Wallet: testSolWallet,
+		}, decodeError(t, resp))
+	})
+
+	t.Run("delete /tracked-wallets - not tracked", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			UntrackUserWallet(43, testSolWallet, chain.SolanaMainnet).
+			Return(fmt.Errorf("untracking: %w", chain.ErrWalletNotTracked))
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "wallet is not tracked for solana_mainnet",
+			Chain:  chain.SolanaMainnet,
+			Wallet: testSolWallet,
+		}, decodeError(t, resp))
+	})
+
+	t.Run("delete /tracked-wallets - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			UntrackUserWallet(
+				43,
+				testEthWallet,
+				chain.EthereumMainnet,
+			).
+			Return(
+				nil,
+			)
+		mockTracker.EXPECT().
+			UntrackUserWallet(
+				43,
+				testBtcWallet,
+				chain.Bitcoin,
+			).
+			Return(
+				nil,
+			)
+		mockTracker.EXPECT().
+			UntrackUserWallet(
+				43,
+				testSolWallet,
+				chain.SolanaMainnet,
+			).
+			Return(
+				nil,
+			)
+
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		respText, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(
+			t, string(respText),
+			"OK",
+		)
+	})
+
+	t.Run("post /muted-wallets - failed to mute wallet", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			MuteWallet(
+				testSolWallet,
+				chain.SolanaMainnet,
+			).
+			Return(
+				chain.ErrWalletNotTracked,
+			)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/muted-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "failed to mute wallet for solana_mainnet",
+			Chain:  chain.SolanaMainnet,
+			Wallet: testSolWallet,
+		}, decodeError(t, resp))
+	})
+
+	t.Run("post /muted-wallets - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			MuteWallet(
+				testEthWallet,
+				chain.EthereumMainnet,
+			).
+			Return(
+				nil,
+			)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/muted-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("delete /muted-wallets - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			UnmuteWallet(
+				testEthWallet,
+				chain.EthereumMainnet,
+			).
+			Return(
+				nil,
+			)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/muted-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("put /tracked-wallets - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		// Wallets are normalized and deduplicated, chains absent from the
+		// request are replaced with an empty set
+		mockTracker.EXPECT().
+			ReplaceUserWallets(43, map[chain.ChainName][]string{
+				chain.EthereumMainnet: {testEthWallet},
+				chain.Bitcoin:         {testBtcWallet},
+			}).
+			Return(nil)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{
+				"user_id": 43,
+				"wallets": {
+					"ethereum_mainnet": ["`+strings.ToLower(testEthWallet)+`", "`+testEthWallet+`"],
+					"bitcoin": ["`+testBtcWallet+`"]
+				}
+			}`),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body := TrackedWalletsResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, map[chain.ChainName][]string{
+			chain.EthereumMainnet: {testEthWallet},
+			chain.Bitcoin:         {testBtcWallet},
+		}, body.Wallets)
+	})
+
+	t.Run("put /tracked-wallets - invalid wallets", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{
+				"user_id": 43,
+				"wallets": {
+					"ethereum_mainnet": ["`+testEthWallet+`"],
+					"solana_mainnet": ["`+testEthWallet+`"]
+				}
+			}`),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		errResp := decodeError(t, resp)
+		assert.Equal(t, "invalid wallet addresses", errResp.Error)
+		if assert.Len(t, errResp.InvalidFields, 1) {
+			assert.Equal(t, "wallets.solana_mainnet", errResp.InvalidFields[0].Field)
+		}
+	})
+
+	t.Run("put /tracked-wallets - failed to replace", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			ReplaceUserWallets(43, mock.Anything).
+			Return(assert.AnError)
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/tracked-wallets",
+			bytes.NewBufferString(`{"user_id": 43, "wallets": {"bitcoin": ["`+testBtcWallet+`"]}}`),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{Error: "failed to replace tracked wallets"}, decodeError(t, resp))
+	})
+
+	t.Run("get /admin/tracked-wallets/export - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			ExportWallets().
+			Return([]chain.TrackedWalletConfig{
+				{Chain: chain.EthereumMainnet, Wallet: testEthWallet, UserIDs: []int{43}, Confirmations: 12, MinAmount: "1000"},
+				{Chain: chain.Bitcoin, Wallet: testBtcWallet, UserIDs: []int{0}, Muted: true, Direction: chain.DirectionIncoming},
+			}, nil)
+		s.txTracker = mockTracker
+
+		resp, err := adminRequest(t, server, http.MethodGet, "/admin/tracked-wallets/export", nil)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"wallets": [
+			{"chain": "ethereum_mainnet", "wallet": "`+testEthWallet+`", "user_ids": [43], "confirmations": 12, "min_amount": "1000"},
+			{"chain": "bitcoin", "wallet": "`+testBtcWallet+`", "user_ids": [0], "muted": true, "direction": "incoming"}
+		]}`, string(body))
+	})
+
+	t.Run("post /admin/tracked-wallets/import - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			ImportWallets([]chain.TrackedWalletConfig{
+				{Chain: chain.EthereumMainnet, Wallet: testEthWallet, UserIDs: []int{43}, MinAmount: "1000"},
+			}).
+			Return(nil)
+		s.txTracker = mockTracker
+
+		resp, err := adminRequest(t, server, http.MethodPost, "/admin/tracked-wallets/import",
+			bytes.NewBufferString(`{"wallets": [
+				{"chain": "ethereum_mainnet", "wallet": "`+testEthWallet+`", "user_ids": [43], "min_amount": "1000"}
+			]}`),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("post /admin/tracked-wallets/import - failed", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			ImportWallets(mock.Anything).
+			Return(assert.AnError)
+		s.txTracker = mockTracker
+
+		resp, err := adminRequest(t, server, http.MethodPost, "/admin/tracked-wallets/import",
+			bytes.NewBufferString(`{"wallets": [{"chain": "dogecoin", "wallet": "D", "user_ids": [1]}]}`),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error: "failed to import tracked wallets: " + assert.AnError.Error(),
+		}, decodeError(t, resp))
+	})
+
+	t.Run("post /admin/chains/{chain}/stop - not enabled", func(t *testing.T) {
+		server, _ := makeServer()
+		defer server.Close()
+
+		resp, err := adminRequest(t, server, http.MethodPost, "/admin/chains/bitcoin/stop", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+
+	t.Run("post /admin/chains/{chain}/stop - unknown chain", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockChains := mocks.NewChainController(t)
+		mockChains.EXPECT().
+			StopChain(chain.ChainName("dogecoin")).
+			Return(fmt.Errorf("%w dogecoin", chain.ErrNoSubscriber))
+		s.chains = mockChains
+
+		resp, err := adminRequest(t, server, http.MethodPost, "/admin/chains/dogecoin/stop", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error: "failed to stop chain dogecoin",
+			Chain: "dogecoin",
+		}, decodeError(t, resp))
+	})
+
+	t.Run("post /admin/chains/{chain}/stop - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockChains := mocks.NewChainController(t)
+		mockChains.EXPECT().
+			StopChain(chain.Bitcoin).
+			Return(nil)
+		s.chains = mockChains
+
+		resp, err := adminRequest(t, server, http.MethodPost, "/admin/chains/bitcoin/stop", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("admin endpoints - unauthorized", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		// Mocks fail on any call
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+		s.chains = mocks.NewChainController(t)
+
+		for _, auth := range []string{"", "Bearer wrong-token", testAdminToken} {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/admin/chains/bitcoin/stop", nil)
+			assert.NoError(t, err)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			resp, err := server.Client().Do(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, auth)
+			assert.Equal(t, errorResponse{Error: "unauthorized"}, decodeError(t, resp))
+		}
+
+		resp, err := server.Client().Get(server.URL + "/admin/tracked-wallets/export")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("admin endpoints - disabled", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+		s.adminToken = ""
+		router := http.NewServeMux()
+		s.registerRoutes(router)
+		server.Config.Handler = router
+
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+		resp, err := adminRequest(t, server, http.MethodGet, "/admin/tracked-wallets/export", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("post /tracked-wallets - with webhook", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil)
+		mockTracker.EXPECT().
+			UntrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil)
+		s.txTracker = mockTracker
+		registry := &fakeWebhookRegistry{hooks: map[chain.ChainName]map[string]string{}}
+		s.webhooks = registry
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`",
+				"webhook_url": "https://example.com/hook"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "https://example.com/hook", registry.hooks[chain.EthereumMainnet][hookKey(43, testEthWallet)])
+
+		req, err = http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"user_id": 43, "ethereum_wallet": "`+testEthWallet+`"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err = server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, registry.hooks[chain.EthereumMainnet])
+	})
+
+	t.Run("post /tracked-wallets - ens name", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			UntrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+		registry := &fakeENSRegistry{
+			addresses: map[string]string{"deblock.eth": testEthWallet},
+			watched:   map[string]string{},
+		}
+		s.ens = registry
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"user_id": 43, "ethereum_wallet": "deblock.eth"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, map[string]string{"deblock.eth": testEthWallet}, registry.watched)
+
+		req, err = http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"user_id": 43, "ethereum_wallet": "deblock.eth"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err = server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, registry.watched)
+
+		// Names which are not tracked can't be untracked
+		req, err = http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"user_id": 43, "ethereum_wallet": "deblock.eth"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err = server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "ens name is not tracked",
+			Chain:  chain.EthereumMainnet,
+			Wallet: "deblock.eth",
+		}, decodeError(t, resp))
+	})
+
+	t.Run("post /tracked-wallets - unresolvable ens name", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+		registry := &fakeENSRegistry{addresses: map[string]string{}, watched: map[string]string{}}
+		s.ens = registry
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"user_id": 43, "ethereum_wallet": "unknown.eth"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "ens name does not resolve to an address",
+			Chain:  chain.EthereumMainnet,
+			Wallet: "unknown.eth",
+		}, decodeError(t, resp))
+		assert.Empty(t, registry.watched)
+	})
+
+	t.Run("post /tracked-wallets - rollback on partial failure", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(43, testBtcWallet, chain.Bitcoin).
+			Return(assert.AnError).
+			Once()
+		// Ethereum wallet tracked by the same request is untracked again
+		mockTracker.EXPECT().
+			UntrackUserWallet(43, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "`+testBtcWallet+`",
+				"solana_wallet": "`+testSolWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, errorResponse{
+			Error:  "failed to register wallet tracking for bitcoin",
+			Chain:  chain.Bitcoin,
+			Wallet: testBtcWallet,
+		}, decodeError(t, resp))
+	})
+
+	t.Run("delete /tracked-wallets - rollback on partial failure", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		previous := chain.WalletSettings{
+			Muted:         true,
+			Confirmations: 6,
+			MinAmount:     big.NewInt(1000),
+			Direction:     chain.DirectionIncoming,
+		}
+		mockTracker.EXPECT().
+			WalletSettings(0, testEthWallet, chain.EthereumMainnet).
+			Return(previous, nil)
+		mockTracker.EXPECT().
+			WalletSettings(0, testBtcWallet, chain.Bitcoin).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			UntrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			UntrackUserWallet(0, testBtcWallet, chain.Bitcoin).
+			Return(assert.AnError).
+			Once()
+		// Settings cleared by untracking are restored before tracking again
+		mockTracker.EXPECT().
+			SetWalletConfirmations(0, testEthWallet, chain.EthereumMainnet, uint64(6)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			SetWalletMinAmount(0, testEthWallet, chain.EthereumMainnet, big.NewInt(1000)).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			SetWalletDirection(0, testEthWallet, chain.EthereumMainnet, chain.DirectionIncoming).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			TrackUserWallet(0, testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		mockTracker.EXPECT().
+			MuteWallet(testEthWallet, chain.EthereumMainnet).
+			Return(nil).
+			Once()
+		s.txTracker = mockTracker
+		registry := &fakeWebhookRegistry{hooks: map[chain.ChainName]map[string]string{
+			chain.EthereumMainnet: {hookKey(0, testEthWallet): "https://example.com/hook"},
+		}}
+		s.webhooks = registry
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "`+testBtcWallet+`"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		// Re-tracked wallet keeps its webhook
+		assert.Equal(t, "https://example.com/hook", registry.hooks[chain.EthereumMainnet][hookKey(0, testEthWallet)])
+	})
+
+	t.Run("post /tracked-wallets - invalid wallets", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		// No subscriber is mutated if any wallet is invalid
+		s.txTracker = mocks.NewWalletTransactionTracker(t)
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{
+				"user_id": 43,
+				"ethereum_wallet": "`+testEthWallet+`",
+				"bitcoin_wallet": "not-a-btc-address",
+				"solana_wallet": "0OIl"
+				}
+				`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		errResp := decodeError(t, resp)
+		assert.Equal(t, "invalid wallet addresses", errResp.Error)
+		fields := []string{}
+		for _, f := range errResp.InvalidFields {
+			fields = append(fields, f.Field)
+			assert.NotEmpty(t, f.Error)
+		}
+		assert.Equal(t, []string{"bitcoin_wallet", "solana_wallet"}, fields)
+	})
+
+	t.Run("versioned and legacy routes", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			legacyRoutes bool
+			path         string
+			wantStatus   int
+		}{
+			{name: "versioned", legacyRoutes: true, path: "/v1/tracked-wallets", wantStatus: http.StatusOK},
+			{name: "legacy", legacyRoutes: true, path: "/tracked-wallets", wantStatus: http.StatusOK},
+			{name: "versioned without legacy", path: "/v1/tracked-wallets", wantStatus: http.StatusOK},
+			{name: "legacy disabled", path: "/tracked-wallets", wantStatus: http.StatusNotFound},
+			{name: "metrics are not versioned", path: "/metrics", wantStatus: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockTracker := mocks.NewWalletTransactionTracker(t)
+				if tt.wantStatus == http.StatusOK && tt.path != "/metrics" {
+					mockTracker.EXPECT().
+						TrackedWallets().
+						Return(map[chain.ChainName][]string{chain.Bitcoin: {testBtcWallet}})
+				}
+				s := NewHttpServer("", "", mockTracker, WithLegacyRoutes{Enabled: tt.legacyRoutes})
+				router := http.NewServeMux()
+				s.registerRoutes(router)
+				server := httptest.NewServer(router)
+				defer server.Close()
+
+				resp, err := server.Client().Get(server.URL + tt.path)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			})
+		}
+	})
+
+	t.Run("get /tracked-wallets - success", func(t *testing.T) {
+		server, s := makeServer()
+		defer server.Close()
+
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(mock.Anything, mock.Anything, mock.Anything).
+			Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+		mockTracker.EXPECT().
+			TrackedWallets().
+			Return(map[chain.ChainName][]string{
+				chain.EthereumMainnet: {"0x9642b23Ed1E01Df1092B92641051881a322F5D4E"},
+				chain.SolanaMainnet:   {"AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW"},
+				chain.Bitcoin:         {},
+			}).
+			Once()
+		mockTracker.EXPECT().
+			UntrackUserWallet(0, "0x9642b23Ed1E01Df1092B92641051881a322F5D4E", chain.EthereumMainnet).
+			Return(nil)
+		mockTracker.EXPECT().
+			TrackedWallets().
+			Return(map[chain.ChainName][]string{
+				chain.EthereumMainnet: {},
+				chain.SolanaMainnet:   {"AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW"},
+				chain.Bitcoin:         {},
+			}).
+			Once()
+		s.txTracker = mockTracker
+
+		list := func() map[string]any {
+			resp, err := server.Client().Get(server.URL + "/tracked-wallets")
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			body := map[string]any{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			return body
+		}
+
+		assert.Equal(t, map[string]any{
+			"wallets": map[string]any{
+				"ethereum_mainnet": []any{"0x9642b23Ed1E01Df1092B92641051881a322F5D4E"},
+				"solana_mainnet":   []any{"AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW"},
+				"bitcoin":          []any{},
+			},
+		}, list())
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/tracked-wallets",
+			bytes.NewBuffer([]byte(`{"ethereum_wallet": "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"}`)),
+		)
+		assert.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, map[string]any{
+			"wallets": map[string]any{
+				"ethereum_mainnet": []any{},
+				"solana_mainnet":   []any{"AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW"},
+				"bitcoin":          []any{},
+			},
+		}, list())
+	})
+}
+
+func TestHttpServerListen(t *testing.T) {
+	t.Run("port in use", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer l.Close()
+		_, port, err := net.SplitHostPort(l.Addr().String())
+		assert.NoError(t, err)
+
+		s := NewHttpServer("127.0.0.1", port, nil)
+		err = s.Listen()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to listen on 127.0.0.1:"+port)
+		// Serve listens itself when Listen was not successful
+		assert.Error(t, s.Serve())
+	})
+
+	t.Run("serve on bound listener", func(t *testing.T) {
+		s := NewHttpServer("127.0.0.1", "0", nil)
+		assert.NoError(t, s.Listen())
+		defer s.Close()
+		assert.NotEqual(t, "0", s.port)
+
+		go s.Serve()
+		resp, err := http.Post("http://"+net.JoinHostPort("127.0.0.1", s.port)+"/tracked-wallets", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
 }
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket rate limiter per client. Buckets hold up to
+// burst tokens and are refilled with rate tokens per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// Buckets which are full again are forgotten at most once per refill of
+	// a bucket
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token of the client. If there is none, it returns false and
+// the time until the next token is available.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets which have been refilled completely, so that clients
+// seen once don't accumulate.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimited limits requests of each client ip to the handler, if rate
+// limiting is enabled. Limited requests are rejected with 429 and the number
+// of seconds to wait in the Retry-After header.
+func (s *httpServer) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := s.rateLimiter.allow(clientIP(r, s.trustedProxies))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, errorResponse{Error: "rate limit exceeded"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// WithRateLimit limits track, untrack and admin requests of each client ip to
+// Rate requests per second with bursts of up to Burst requests. Default is no
+// limit.
+type WithRateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (w WithRateLimit) Apply(s *httpServer) {
+	if w.Rate <= 0 {
+		s.rateLimiter = nil
+		return
+	}
+	s.rateLimiter = newRateLimiter(w.Rate, w.Burst)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1730000000, 0)
+	l := newRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	// Burst is allowed, then requests wait for the refill
+	for range 3 {
+		ok, _ := l.allow("10.0.0.1")
+		assert.True(t, ok)
+	}
+	ok, retryAfter := l.allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// Clients are limited independently
+	ok, _ = l.allow("10.0.0.2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow("10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = l.allow("10.0.0.1")
+	assert.False(t, ok)
+
+	// Refilled buckets are forgotten
+	now = now.Add(2 * time.Second)
+	ok, _ = l.allow("10.0.0.3")
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestRateLimitedEndpoints(t *testing.T) {
+	mockTracker := mocks.NewWalletTransactionTracker(t)
+	mockTracker.EXPECT().
+		TrackUserWallet(43, testBtcWallet, mock.Anything).
+		Return(nil)
+	mockTracker.EXPECT().
+		UntrackUserWallet(43, testBtcWallet, mock.Anything).
+		Return(nil)
+	mockTracker.EXPECT().
+		TrackedWallets().
+		Return(nil)
+	mockTracker.EXPECT().
+		WalletSettings(43, testBtcWallet, mock.Anything).
+		Return(chain.WalletSettings{Direction: chain.DirectionBoth}, nil)
+	s := NewHttpServer("", "", mockTracker, WithRateLimit{Rate: 0.001, Burst: 5})
+	router := http.NewServeMux()
+	s.registerRoutes(router)
+
+	request := func(method, path, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"user_id": 43, "bitcoin_wallet": "`+testBtcWallet+`"}`))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// Track and untrack requests share the limit of the client, on both
+	// versioned and legacy routes
+	for i := range 5 {
+		method, path := http.MethodPost, "/v1/tracked-wallets"
+		if i%2 == 1 {
+			method, path = http.MethodDelete, "/tracked-wallets"
+		}
+		assert.Equal(t, http.StatusOK, request(method, path, "10.0.0.1:1234").Code)
+	}
+	for range 10 {
+		w := request(http.MethodPost, "/v1/tracked-wallets", "10.0.0.1:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+	}
+	w := request(http.MethodDelete, "/tracked-wallets", "10.0.0.1:4321")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, errorResponse{Error: "rate limit exceeded"}, decodeError(t, w.Result()))
+
+	// Other clients and endpoints are not limited
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/v1/tracked-wallets", "10.0.0.2:1234").Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/v1/tracked-wallets", "10.0.0.1:1234").Code)
+}
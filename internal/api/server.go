@@ -1,7 +1,14 @@
 package api
 
+import "github.com/Mantelijo/deblock-backend/internal/chain"
+
 // Server is API layer that accepts requests to track/untrack wallets
 type Server interface {
+	// Listen binds the server to its address, so that address conflicts are
+	// reported before Serve is started. Listen is optional, Serve listens if
+	// it was not called.
+	Listen() error
+
 	// Serve starts the API server. Serve blocks until the server is stopped or
 	// an error is encoutered.
 	Serve() error
@@ -9,3 +16,52 @@ type Server interface {
 	// Close stops the server and cleans up any resources.
 	Close() error
 }
+
+// WebhookRegistry stores per wallet webhooks which receive events of the
+// wallet in addition to the global sinks.
+type WebhookRegistry interface {
+	// SetWebhook routes events of the wallet emitted for the user to the
+	// given webhook url.
+	SetWebhook(userID int, wallet string, chain chain.ChainName, webhookUrl string) error
+
+	// RemoveWebhook stops routing events of the user's wallet to its
+	// webhook. Webhooks of other users of the wallet are kept.
+	RemoveWebhook(userID int, wallet string, chain chain.ChainName) error
+}
+
+// ENSRegistry resolves ENS names supplied instead of ethereum wallet
+// addresses and keeps tracking in line with the addresses the names resolve
+// to.
+type ENSRegistry interface {
+	// Resolve returns the address the name currently resolves to. Errors of
+	// names without an address wrap chain.ErrENSNameNotResolved.
+	Resolve(name string) (string, error)
+
+	// Watch periodically re-resolves the name, which is tracked as address,
+	// and moves the tracking once the name resolves to a different address.
+	Watch(name, address string)
+
+	// Unwatch stops re-resolving the name and returns the address it is
+	// tracked as. ok is false if the name is not watched.
+	Unwatch(name string) (address string, ok bool)
+}
+
+// EventStream fans out tracked wallet events to API clients.
+type EventStream interface {
+	// Subscribe returns a channel receiving all tracked wallet events and a
+	// function which unsubscribes. The channel is closed once the
+	// subscriber is unsubscribed or can't keep up with the events.
+	Subscribe(name string) (<-chan *chain.TrackedWalletEvent, func())
+}
+
+// StatsProvider reports runtime statistics of chain subscribers.
+type StatsProvider interface {
+	// ChainTips returns the latest known chain tip per chain, 0 if unknown.
+	ChainTips() map[chain.ChainName]uint64
+
+	// DroppedEvents returns the number of dropped events per chain.
+	DroppedEvents() map[chain.ChainName]uint64
+
+	// SubscriberStats returns processing statistics per chain.
+	SubscriberStats() map[chain.ChainName]chain.SubscriberStats
+}
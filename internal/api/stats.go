@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// StatsResponse reports runtime statistics per chain.
+type StatsResponse struct {
+	Chains map[chain.ChainName]ChainStats `json:"chains"`
+}
+
+type ChainStats struct {
+	// Latest block height, slot for solana, received from the provider.
+	// Omitted until the subscriber receives it.
+	Tip           uint64 `json:"tip,omitempty"`
+	DroppedEvents uint64 `json:"dropped_events"`
+}
+
+func (s *httpServer) getStats(w http.ResponseWriter, r *http.Request) {
+	if s.stats == nil {
+		writeError(w, http.StatusNotImplemented, errorResponse{Error: "stats are not enabled"})
+		return
+	}
+
+	stats := &StatsResponse{Chains: map[chain.ChainName]ChainStats{}}
+	for chainName, tip := range s.stats.ChainTips() {
+		stats.Chains[chainName] = ChainStats{Tip: tip}
+	}
+	for chainName, dropped := range s.stats.DroppedEvents() {
+		chainStats := stats.Chains[chainName]
+		chainStats.DroppedEvents = dropped
+		stats.Chains[chainName] = chainStats
+	}
+
+	resp, err := json.Marshal(stats)
+	if err != nil {
+		slog.Error("failed to marshal stats", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to get stats"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// SubscriberStatsResponse reports processing statistics per chain
+// subscriber.
+type SubscriberStatsResponse struct {
+	Subscribers map[chain.ChainName]SubscriberStats `json:"subscribers"`
+}
+
+// SubscriberStats are processing statistics of a chain subscriber. Heights
+// are slots for solana and 0 while unknown.
+type SubscriberStats struct {
+	LastProcessedBlock uint64 `json:"last_processed_block"`
+	ChainTip           uint64 `json:"chain_tip"`
+	// Number of blocks the subscriber is behind the chain tip
+	Lag                   uint64  `json:"lag"`
+	EventsEmitted         uint64  `json:"events_emitted"`
+	TransactionsProcessed uint64  `json:"transactions_processed"`
+	RPCErrors             uint64  `json:"rpc_errors"`
+	UptimeSeconds         float64 `json:"uptime_seconds"`
+}
+
+func (s *httpServer) getSubscriberStats(w http.ResponseWriter, r *http.Request) {
+	if s.stats == nil {
+		writeError(w, http.StatusNotImplemented, errorResponse{Error: "stats are not enabled"})
+		return
+	}
+
+	stats := &SubscriberStatsResponse{Subscribers: map[chain.ChainName]SubscriberStats{}}
+	for chainName, sub := range s.stats.SubscriberStats() {
+		stats.Subscribers[chainName] = SubscriberStats{
+			LastProcessedBlock:    sub.LastProcessedBlock,
+			ChainTip:              sub.ChainTip,
+			Lag:                   sub.Lag,
+			EventsEmitted:         sub.EventsEmitted,
+			TransactionsProcessed: sub.TxsProcessed,
+			RPCErrors:             sub.RPCErrors,
+			UptimeSeconds:         sub.Uptime.Seconds(),
+		}
+	}
+
+	resp, err := json.Marshal(stats)
+	if err != nil {
+		slog.Error("failed to marshal subscriber stats", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to get stats"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
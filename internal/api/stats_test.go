@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatsProvider struct {
+	tips        map[chain.ChainName]uint64
+	dropped     map[chain.ChainName]uint64
+	subscribers map[chain.ChainName]chain.SubscriberStats
+}
+
+func (f *fakeStatsProvider) ChainTips() map[chain.ChainName]uint64     { return f.tips }
+func (f *fakeStatsProvider) DroppedEvents() map[chain.ChainName]uint64 { return f.dropped }
+func (f *fakeStatsProvider) SubscriberStats() map[chain.ChainName]chain.SubscriberStats {
+	return f.subscribers
+}
+
+func TestGetStats(t *testing.T) {
+	s := &httpServer{stats: &fakeStatsProvider{
+		tips:    map[chain.ChainName]uint64{chain.Bitcoin: 870000, chain.SolanaMainnet: 0},
+		dropped: map[chain.ChainName]uint64{chain.SolanaMainnet: 3},
+	}}
+	router := http.NewServeMux()
+	s.registerRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/stats")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := map[string]any{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]any{
+		"chains": map[string]any{
+			"bitcoin": map[string]any{"tip": float64(870000), "dropped_events": float64(0)},
+			// Unknown tip is omitted
+			"solana_mainnet": map[string]any{"dropped_events": float64(3)},
+		},
+	}, body)
+
+	t.Run("not enabled", func(t *testing.T) {
+		router := http.NewServeMux()
+		(&httpServer{}).registerRoutes(router)
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		resp, err := http.Get(ts.URL + "/v1/stats")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		assert.Equal(t, "stats are not enabled", decodeError(t, resp).Error)
+	})
+}
+
+func TestGetSubscriberStats(t *testing.T) {
+	s := &httpServer{stats: &fakeStatsProvider{
+		subscribers: map[chain.ChainName]chain.SubscriberStats{
+			chain.Bitcoin: {
+				LastProcessedBlock: 869998,
+				ChainTip:           870000,
+				Lag:                2,
+				EventsEmitted:      7,
+				TxsProcessed:       12000,
+				RPCErrors:          1,
+				Uptime:             90 * time.Second,
+			},
+			// Not started yet
+			chain.SolanaMainnet: {},
+		},
+	}}
+	router := http.NewServeMux()
+	s.registerRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/stats/subscribers")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	body := map[string]any{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]any{
+		"subscribers": map[string]any{
+			"bitcoin": map[string]any{
+				"last_processed_block":   float64(869998),
+				"chain_tip":              float64(870000),
+				"lag":                    float64(2),
+				"events_emitted":         float64(7),
+				"transactions_processed": float64(12000),
+				"rpc_errors":             float64(1),
+				"uptime_seconds":         float64(90),
+			},
+			"solana_mainnet": map[string]any{
+				"last_processed_block":   float64(0),
+				"chain_tip":              float64(0),
+				"lag":                    float64(0),
+				"events_emitted":         float64(0),
+				"transactions_processed": float64(0),
+				"rpc_errors":             float64(0),
+				"uptime_seconds":         float64(0),
+			},
+		},
+	}, body)
+
+	t.Run("not enabled", func(t *testing.T) {
+		router := http.NewServeMux()
+		(&httpServer{}).registerRoutes(router)
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		resp, err := http.Get(ts.URL + "/v1/stats/subscribers")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		assert.Equal(t, "stats are not enabled", decodeError(t, resp).Error)
+	})
+}
+
+func TestGetMetrics(t *testing.T) {
+	router := http.NewServeMux()
+	(&httpServer{}).registerRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	metrics.BlocksProcessed.Inc(string(chain.Bitcoin))
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	for _, family := range []string{
+		"blocks_processed_total",
+		"events_emitted_total",
+		"rpc_errors_total",
+		"block_fetch_duration_seconds",
+		"tx_processing_duration_seconds",
+	} {
+		assert.Contains(t, string(body), "# TYPE "+family+" ")
+	}
+	assert.Contains(t, string(body), `blocks_processed_total{chain="bitcoin"} `)
+}
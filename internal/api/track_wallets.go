@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// TrackWalletsResponse reports the result of every wallet of a track request
+// with wallet lists. Wallets are tracked independently, so that invalid or
+// failing wallets don't prevent tracking of the others.
+type TrackWalletsResponse struct {
+	Results []TrackWalletResult `json:"results"`
+	Tracked int                 `json:"tracked"`
+	Failed  int                 `json:"failed"`
+}
+
+type TrackWalletResult struct {
+	Chain chain.ChainName `json:"chain"`
+	// Wallet as supplied in the request
+	Wallet string `json:"wallet"`
+	// Canonical form the wallet is tracked as, empty if it failed
+	TrackedAs string `json:"tracked_as,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// hasWalletLists reports whether the request lists wallets in the array
+// fields.
+func (req *TrackWalletRequest) hasWalletLists() bool {
+	return len(req.EthereumWallets) > 0 || len(req.BitcoinWallets) > 0 || len(req.SolanaWallets) > 0
+}
+
+// trackWalletLists tracks the wallets of the array and singular fields of the
+// request one by one and reports the result of each. Only request wide
+// settings fail the whole request.
+func (s *httpServer) trackWalletLists(w http.ResponseWriter, req *TrackWalletRequest) {
+	minAmounts, invalid := s.parseMinAmounts(req)
+	if len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid minimum amounts",
+			InvalidFields: invalid,
+		})
+		return
+	}
+	direction, err := chain.ParseDirectionFilter(req.Direction)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errorResponse{
+			Error:         "invalid direction",
+			InvalidFields: []fieldError{{Field: "direction", Error: err.Error()}},
+		})
+		return
+	}
+	if req.WebhookURL != "" && s.webhooks == nil {
+		writeError(w, http.StatusBadRequest, errorResponse{Error: "wallet webhooks are not enabled"})
+		return
+	}
+
+	lists := []struct {
+		chain    chain.ChainName
+		singular string
+		wallets  []string
+	}{
+		{s.ethereumChain, req.EthereumWallet, req.EthereumWallets},
+		{chain.Bitcoin, req.BitcoinWallet, req.BitcoinWallets},
+		{chain.SolanaMainnet, req.SolanaWallet, req.SolanaWallets},
+	}
+
+	settings := trackSettings{
+		confirmations: req.Confirmations,
+		direction:     direction,
+		webhookURL:    req.WebhookURL,
+	}
+	trackResp := &TrackWalletsResponse{Results: []TrackWalletResult{}}
+	for _, list := range lists {
+		wallets := list.wallets
+		if list.singular != "" {
+			wallets = append([]string{list.singular}, wallets...)
+		}
+		settings.minAmount = minAmounts[list.chain]
+		// Canonical wallets of the chain already handled by this request
+		seen := make(map[string]bool, len(wallets))
+		for _, wallet := range wallets {
+			result := TrackWalletResult{Chain: list.chain, Wallet: wallet}
+			trackedAs, err := s.trackListedWallet(req.UserID, wallet, list.chain, settings, seen)
+			if err != nil {
+				result.Error = err.Error()
+				trackResp.Failed++
+			} else {
+				result.TrackedAs = trackedAs
+				trackResp.Tracked++
+			}
+			trackResp.Results = append(trackResp.Results, result)
+		}
+	}
+
+	resp, err := json.Marshal(trackResp)
+	if err != nil {
+		slog.Error("failed to marshal track results", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, errorResponse{Error: "failed to list tracked wallets"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// trackListedWallet tracks the wallet like a wallet of a track request
+// without lists. It returns the canonical form the wallet is tracked as.
+func (s *httpServer) trackListedWallet(
+	userID int,
+	wallet string,
+	chainName chain.ChainName,
+	settings trackSettings,
+	seen map[string]bool,
+) (string, error) {
+	// ENS names are tracked as the addresses they resolve to
+	ensName := ""
+	if s.isENSName(wallet, chainName) {
+		address, failure := s.resolveENSName(wallet)
+		if failure != nil {
+			return "", errors.New(failure.reason)
+		}
+		ensName, wallet = wallet, address
+	}
+
+	normalized, err := chain.NormalizeWallet(chainName, wallet)
+	if err != nil {
+		return "", err
+	}
+	if seen[normalized] {
+		return "", errors.New("wallet is listed more than once")
+	}
+	seen[normalized] = true
+
+	if _, failure := s.trackUserWallet(userID, wallet, chainName, settings); failure != nil {
+		return "", errors.New(failure.reason)
+	}
+	if ensName != "" {
+		s.ens.Watch(ensName, wallet)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackWalletLists(t *testing.T) {
+	const (
+		otherEthWallet = "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+		otherBtcWallet = "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	)
+	makeServer := func(tracker chain.WalletTransactionTracker) *httptest.Server {
+		s := NewHttpServer("", "", tracker)
+		router := http.NewServeMux()
+		s.registerRoutes(router)
+		return httptest.NewServer(router)
+	}
+
+	t.Run("partial results", func(t *testing.T) {
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).Return(nil)
+		mockTracker.EXPECT().TrackUserWallet(43, strings.ToLower(otherEthWallet), chain.EthereumMainnet).Return(nil)
+		mockTracker.EXPECT().TrackUserWallet(43, testBtcWallet, chain.Bitcoin).Return(nil)
+		mockTracker.EXPECT().TrackUserWallet(43, otherBtcWallet, chain.Bitcoin).Return(chain.ErrWalletAlreadyTracked)
+		mockTracker.EXPECT().TrackUserWallet(43, testSolWallet, chain.SolanaMainnet).Return(nil)
+		server := makeServer(mockTracker)
+		defer server.Close()
+
+		resp, err := server.Client().Post(server.URL+"/v1/tracked-wallets", "application/json",
+			bytes.NewBufferString(`{
+				"user_id": 43,
+				"ethereum_wallets": ["`+testEthWallet+`", "0xinvalid", "`+strings.ToLower(otherEthWallet)+`", "`+otherEthWallet+`"],
+				"bitcoin_wallets": ["`+testBtcWallet+`", "`+otherBtcWallet+`"],
+				"solana_wallet": "`+testSolWallet+`"
+			}`),
+		)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body := TrackWalletsResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 4, body.Tracked)
+		assert.Equal(t, 3, body.Failed)
+		if assert.Len(t, body.Results, 7) {
+			assert.Equal(t, TrackWalletResult{Chain: chain.EthereumMainnet, Wallet: testEthWallet, TrackedAs: testEthWallet}, body.Results[0])
+			assert.Equal(t, chain.EthereumMainnet, body.Results[1].Chain)
+			assert.Equal(t, "0xinvalid", body.Results[1].Wallet)
+			assert.NotEmpty(t, body.Results[1].Error)
+			assert.Empty(t, body.Results[1].TrackedAs)
+			assert.Equal(t, TrackWalletResult{
+				Chain:     chain.EthereumMainnet,
+				Wallet:    strings.ToLower(otherEthWallet),
+				TrackedAs: otherEthWallet,
+			}, body.Results[2])
+			assert.Equal(t, TrackWalletResult{
+				Chain:  chain.EthereumMainnet,
+				Wallet: otherEthWallet,
+				Error:  "wallet is listed more than once",
+			}, body.Results[3])
+			assert.Equal(t, TrackWalletResult{Chain: chain.Bitcoin, Wallet: testBtcWallet, TrackedAs: testBtcWallet}, body.Results[4])
+			assert.Equal(t, TrackWalletResult{
+				Chain:  chain.Bitcoin,
+				Wallet: otherBtcWallet,
+				Error:  "wallet is already tracked",
+			}, body.Results[5])
+			assert.Equal(t, TrackWalletResult{Chain: chain.SolanaMainnet, Wallet: testSolWallet, TrackedAs: testSolWallet}, body.Results[6])
+		}
+	})
+
+	t.Run("settings of failed wallets are restored", func(t *testing.T) {
+		mockTracker := mocks.NewWalletTransactionTracker(t)
+		mockTracker.EXPECT().
+			WalletSettings(43, testEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{}, chain.ErrWalletNotTracked)
+		// Tracked by other users with their own settings
+		mockTracker.EXPECT().
+			WalletSettings(43, otherEthWallet, chain.EthereumMainnet).
+			Return(chain.WalletSettings{Confirmations: 6, Direction: chain.DirectionOutgoing}, nil)
+		mockTracker.EXPECT().
+			WalletSettings(43, testBtcWallet, chain.Bitcoin).
+			Return(chain.WalletSettings{Confirmations: 1, Direction: chain.DirectionBoth}, nil)
+		for _, wallet := range []string{testEthWallet, otherEthWallet} {
+			mockTracker.EXPECT().SetWalletConfirmations(43, wallet, chain.EthereumMainnet, uint64(3)).Return(nil).Once()
+			mockTracker.EXPECT().SetWalletDirection(43, wallet, chain.EthereumMainnet, chain.DirectionIncoming).Return(nil).Once()
+		}
+		mockTracker.EXPECT().SetWalletConfirmations(43, testBtcWallet, chain.Bitcoin, uint64(3)).Return(nil).Once()
+		mockTracker.EXPECT().SetWalletDirection(43, testBtcWallet, chain.Bitcoin, chain.DirectionIncoming).Return(nil).Once()
+		mockTracker.EXPECT().TrackUserWallet(43, testEthWallet, chain.EthereumMainnet).Return(nil)
+		mockTracker.EXPECT().TrackUserWallet(43, otherEthWallet, chain.EthereumMainnet).Return(assert.AnError)
+		mockTracker.EXPECT().TrackUserWallet(43, testBtcWallet, chain.Bitcoin).Return(chain.ErrWalletAlreadyTracked)
+		mockTracker.EXPECT().SetWalletConfirmations(43, otherEthWallet, chain.EthereumMainnet, uint64(6)).Return(nil).Once()
+		mockTracker.EXPECT().SetWalletDirection(43, otherEthWallet, chain.EthereumMainnet, chain.DirectionOutgoing).Return(nil).Once()
+		mockTracker.EXPECT().SetWalletConfirmations(43, testBtcWallet, chain.Bitcoin, uint64(1)).Return(nil).Once()
+		mockTracker.EXPECT().SetWalletDirection(43, testBtcWallet, chain.Bitcoin, chain.DirectionBoth).Return(nil).Once()
+		server := makeServer(mockTracker)
+		defer server.Close()
+
+		resp, err := server.Client().Post(server.URL+"/tracked-wallets", "application/json",
+			bytes.NewBufferString(`{
+				"user_id": 43,
+				"confirmations": 3,
+				"direction": "incoming",
+				"ethereum_wallets": ["`+testEthWallet+`", "`+otherEthWallet+`"],
+				"bitcoin_wallets": ["`+testBtcWallet+`"]
+			}`),
+		)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body := TrackWalletsResponse{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, TrackWalletsResponse{
+			Results: []TrackWalletResult{
+				{Chain: chain.EthereumMainnet, Wallet: testEthWallet, TrackedAs: testEthWallet},
+				{Chain: chain.EthereumMainnet, Wallet: otherEthWallet, Error: "failed to register wallet tracking"},
+				{Chain: chain.Bitcoin, Wallet: testBtcWallet, Error: "wallet is already tracked"},
+			},
+			Tracked: 1,
+			Failed:  2,
+		}, body)
+	})
+
+	t.Run("invalid request settings", func(t *testing.T) {
+		server := makeServer(mocks.NewWalletTransactionTracker(t))
+		defer server.Close()
+
+		resp, err := server.Client().Post(server.URL+"/tracked-wallets", "application/json",
+			bytes.NewBufferString(`{
+				"user_id": 43,
+				"direction": "sideways",
+				"ethereum_wallets": ["`+testEthWallet+`"]
+			}`),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "invalid direction", decodeError(t, resp).Error)
+	})
+}
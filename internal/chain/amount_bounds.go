@@ -0,0 +1,37 @@
+package chain
+
+import (
+	"log/slog"
+	"math/big"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+)
+
+// WithAmountBounds sets the maximum plausible amount of events per chain, in
+// the chain's base units, e.g. the total supply. Events exceeding it likely
+// result from a processing bug, they are logged, counted and emitted with
+// Implausible set. Chains without a bound are not checked.
+type WithAmountBounds struct {
+	Max map[ChainName]*big.Int
+}
+
+func (w WithAmountBounds) Apply(m *mapSubManager) {
+	m.maxAmounts = w.Max
+}
+
+// flagImplausible sets Implausible of the event if its amount exceeds the
+// bound of its chain.
+func (m *mapSubManager) flagImplausible(event *TrackedWalletEvent) {
+	bound, ok := m.maxAmounts[event.ChainName]
+	if !ok || event.Amount == nil || event.Amount.Cmp(bound) <= 0 {
+		return
+	}
+	event.Implausible = true
+	metrics.ImplausibleAmounts.Inc(string(event.ChainName))
+	slog.Warn("event amount exceeds the plausible maximum",
+		slog.String("chain", string(event.ChainName)),
+		slog.String("tx_hash", event.TxHash),
+		slog.String("amount", event.Amount.String()),
+		slog.String("max", bound.String()),
+	)
+}
@@ -0,0 +1,61 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriberManagerAmountBounds(t *testing.T) {
+	// Unique chains keep counters of the test apart
+	implausibleChain, plausibleChain := ChainName(t.Name()+"_btc"), ChainName(t.Name()+"_sol")
+	totalSupply := big.NewInt(2_100_000_000_000_000)
+	m := NewSubsciberManager(WithAmountBounds{Max: map[ChainName]*big.Int{
+		implausibleChain: totalSupply,
+		plausibleChain:   totalSupply,
+	}})
+	implausible, plausible := newFakeSubscriber(implausibleChain), newFakeSubscriber(plausibleChain)
+	implausible.amount = new(big.Int).Add(totalSupply, big.NewInt(1))
+	plausible.amount = totalSupply
+	assert.NoError(t, m.RegisterSubscribers(implausible, plausible))
+	defer m.Stop(context.Background())
+
+	flagged := metrics.ImplausibleAmounts.Value(string(implausibleChain))
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+
+	seen := map[ChainName]bool{}
+	for len(seen) < 2 {
+		select {
+		case event := <-sink:
+			// Flagged events are still emitted
+			assert.Equal(t, event.ChainName == implausibleChain, event.Implausible)
+			seen[event.ChainName] = true
+		case <-time.After(time.Second):
+			t.Fatal("expected events of both chains")
+		}
+	}
+	assert.Greater(t, metrics.ImplausibleAmounts.Value(string(implausibleChain)), flagged)
+	assert.Zero(t, metrics.ImplausibleAmounts.Value(string(plausibleChain)))
+}
+
+func TestSubscriberManagerWithoutAmountBounds(t *testing.T) {
+	m := NewSubsciberManager()
+	sub := newFakeSubscriber(ChainName(t.Name()))
+	sub.amount = new(big.Int).Lsh(big.NewInt(1), 256)
+	assert.NoError(t, m.RegisterSubscribers(sub))
+	defer m.Stop(context.Background())
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+	select {
+	case event := <-sink:
+		assert.False(t, event.Implausible)
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+	}
+}
@@ -0,0 +1,57 @@
+package chain
+
+import (
+	"math/big"
+	"sync"
+)
+
+// amountFilter drops transfer events of user wallets whose amount is below
+// the minimum set for the user wallet, e.g. dust transfers. Reverts of such
+// transfers are dropped as well. Other event types and events of user
+// wallets without a minimum pass through.
+type amountFilter struct {
+	// User wallet -> minimum amount in the chain's base units
+	min map[userWallet]*big.Int
+	mu  sync.RWMutex
+}
+
+func newAmountFilter() *amountFilter {
+	return &amountFilter{
+		min: make(map[userWallet]*big.Int),
+	}
+}
+
+// set sets the minimum amount of transfer events of the user wallet. nil or
+// 0 clears it.
+func (f *amountFilter) set(key userWallet, minAmount *big.Int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if minAmount == nil || minAmount.Sign() <= 0 {
+		delete(f.min, key)
+		return
+	}
+	f.min[key] = new(big.Int).Set(minAmount)
+}
+
+// get returns the minimum amount of transfer events of the user wallet, nil
+// if not set.
+func (f *amountFilter) get(key userWallet) *big.Int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if minAmount, ok := f.min[key]; ok {
+		return new(big.Int).Set(minAmount)
+	}
+	return nil
+}
+
+// below reports whether the event is a transfer, or its revert, whose amount
+// is below the minimum amount of its user wallet.
+func (f *amountFilter) below(event *TrackedWalletEvent) bool {
+	if (event.Type != "" && event.Type != EventReverted) || event.Amount == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	minAmount, ok := f.min[eventUserWallet(event)]
+	return ok && event.Amount.Cmp(minAmount) < 0
+}
@@ -0,0 +1,99 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAmountFilter(t *testing.T) {
+	f := newAmountFilter()
+	a := userWallet{1, "a", Bitcoin}
+	f.set(a, big.NewInt(100))
+
+	event := func(wallet string, userID int, amount int64) *TrackedWalletEvent {
+		return &TrackedWalletEvent{ChainName: Bitcoin, Wallet: wallet, UserID: userID, Amount: big.NewInt(amount)}
+	}
+	assert.True(t, f.below(event("a", 1, 99)))
+	assert.False(t, f.below(event("a", 1, 100)))
+	assert.False(t, f.below(event("a", 1, 101)))
+	assert.False(t, f.below(event("b", 1, 1)))
+	// Minimum is set per user
+	assert.False(t, f.below(event("a", 2, 1)))
+	// Only transfers and their reverts are filtered
+	assert.True(t, f.below(&TrackedWalletEvent{ChainName: Bitcoin, Wallet: "a", UserID: 1, Type: EventReverted, Amount: big.NewInt(1)}))
+	assert.False(t, f.below(&TrackedWalletEvent{ChainName: Bitcoin, Wallet: "a", UserID: 1, Type: EventLog, Amount: big.NewInt(1)}))
+	assert.False(t, f.below(&TrackedWalletEvent{ChainName: Bitcoin, Wallet: "a", UserID: 1}))
+
+	// Cleared minimum
+	f.set(a, big.NewInt(0))
+	assert.False(t, f.below(event("a", 1, 1)))
+	f.set(a, big.NewInt(100))
+	f.set(a, nil)
+	assert.False(t, f.below(event("a", 1, 1)))
+}
+
+func TestSubscriberManagerUserMinAmount(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	signer := types.NewLondonSigner(params.MainnetChainConfig.ChainID)
+	tracked := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+
+	block := func(number int64, values ...int64) *types.Block {
+		txs := []*types.Transaction{}
+		for i, value := range values {
+			tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+				ChainID:   params.MainnetChainConfig.ChainID,
+				Nonce:     uint64(number*10) + uint64(i),
+				GasTipCap: big.NewInt(1),
+				GasFeeCap: big.NewInt(20),
+				Gas:       21000,
+				To:        &tracked,
+				Value:     big.NewInt(value),
+			})
+			assert.NoError(t, err)
+			txs = append(txs, tx)
+		}
+		return types.NewBlockWithHeader(&types.Header{
+			Number:  big.NewInt(number),
+			Time:    1730000000,
+			BaseFee: big.NewInt(10),
+		}).WithBody(types.Body{Transactions: txs})
+	}
+	// amounts returns amounts of events emitted for the block per user
+	amounts := func(m *mapSubManager, e *ethereumMainnetSubscriber, b *types.Block) map[int][]int64 {
+		out := make(chan *TrackedWalletEvent, 10)
+		assert.True(t, e.processBlock(b, out))
+		emitted := map[int][]int64{}
+		for _, event := range fanOut(m, e, takeEvents(out)) {
+			emitted[event.UserID] = append(emitted[event.UserID], event.Amount.Int64())
+		}
+		return emitted
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = e
+	assert.NoError(t, m.TrackUserWallet(1, tracked.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, tracked.Hex(), EthereumMainnet))
+	assert.Error(t, m.SetWalletMinAmount(1, "invalid", EthereumMainnet, big.NewInt(1)))
+	assert.ErrorIs(t, m.SetWalletMinAmount(1, tracked.Hex(), Bitcoin, big.NewInt(1)), ErrNoSubscriber)
+	assert.NoError(t, m.SetWalletMinAmount(1, tracked.Hex(), EthereumMainnet, big.NewInt(1000)))
+	assert.Equal(t, map[int][]int64{
+		1: {1000, 5000},
+		2: {1, 999, 1000, 5000},
+	}, amounts(m, e, block(21000000, 1, 999, 1000, 5000)))
+
+	// Untracking clears the minimum
+	assert.NoError(t, m.UntrackUserWallet(1, tracked.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(1, tracked.Hex(), EthereumMainnet))
+	assert.Equal(t, map[int][]int64{
+		1: {1, 999},
+		2: {1, 999},
+	}, amounts(m, e, block(21000001, 1, 999)))
+}
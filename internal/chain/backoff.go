@@ -0,0 +1,19 @@
+package chain
+
+import "time"
+
+// BackoffDelay returns exponential backoff delay base*2^attempt capped at max.
+// attempt starts at 0.
+func BackoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for range attempt {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,17 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	assert.Equal(t, 100*time.Millisecond, BackoffDelay(0, base, max))
+	assert.Equal(t, 200*time.Millisecond, BackoffDelay(1, base, max))
+	assert.Equal(t, 800*time.Millisecond, BackoffDelay(3, base, max))
+	assert.Equal(t, time.Second, BackoffDelay(4, base, max))
+	assert.Equal(t, time.Second, BackoffDelay(1000, base, max))
+}
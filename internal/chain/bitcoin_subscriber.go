@@ -1,38 +1,123 @@
 package chain
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"math/big"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/txscript"
-	"golang.org/x/exp/slog"
+	"github.com/btcsuite/btcd/wire"
 )
 
-func NewBitcoinSubscriber(rpcUrl string) *bitcoinSubscriber {
-	return &bitcoinSubscriber{
+func NewBitcoinSubscriber(rpcUrl string, opts ...BitcoinSubscriberOption) *bitcoinSubscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &bitcoinSubscriber{
 		rpcUrl: rpcUrl,
-		// Wallets are stored as lowercase strings
-		registeredWallets: make(map[string]bool),
+		logger: slog.Default(),
+		// Wallets are keyed by lowercase strings
+		registeredWallets: make(map[string]string),
+		walletRefs:        make(map[string]int),
+		mutedWallets:      make(map[string]bool),
+		network:           &chaincfg.MainNetParams,
+		pollInterval:      15 * time.Second,
+		maxCatchUpBlocks:  6,
+		workers:           8,
+		prevTxCacheSize:   10_000,
+		errLogs:           newErrorLogLimiter(defaultErrorLogInterval),
+		ctx:               ctx,
+		cancel:            cancel,
 	}
+
+	for _, opt := range opts {
+		opt.Apply(b)
+	}
+	b.logger = b.logger.With(slog.String("chain", string(b.Name())))
+
+	b.prevTxs = newBtcPrevTxCache(b.prevTxCacheSize, func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return b.getRawTransaction(hash)
+	})
+
+	return b
 }
 
-var _ TransactionSubscriber = (*solanaMainnetSubscriber)(nil)
+var _ TransactionSubscriber = (*bitcoinSubscriber)(nil)
+
+type getBlockCountFn func() (int64, error)
+type getBlockHashFn func(number int64) (*chainhash.Hash, error)
+type getBtcBlockFn func(hash *chainhash.Hash) (*wire.MsgBlock, error)
+type getRawTransactionFn func(hash *chainhash.Hash) (*btcutil.Tx, error)
 
 type bitcoinSubscriber struct {
 	rpcUrl string
 	c      *rpcclient.Client
-
-	registeredWallets map[string]bool
-	// registeredWallets mutex
+	logger *slog.Logger
+	// Collapses repeated identical error logs
+	errLogs *errorLogLimiter
+	// Network of tracked addresses and output scripts
+	network *chaincfg.Params
+
+	// Rpc client functions, replaced in tests
+	getBlockCount     getBlockCountFn
+	getBlockHash      getBlockHashFn
+	getBlock          getBtcBlockFn
+	getRawTransaction getRawTransactionFn
+
+	// Lowercase address -> canonical address
+	registeredWallets map[string]string
+	// Number of TrackWallet calls not yet matched by UntrackWallet, a wallet
+	// stays registered until its last reference is released
+	walletRefs map[string]int
+	// Tracked wallets whose events are suppressed
+	mutedWallets map[string]bool
+	// registeredWallets, walletRefs and mutedWallets mutex
 	mu sync.RWMutex
 
 	lastBlockNum int64
+	// Latest block whose transactions were all processed, readable outside
+	// of the Start goroutine
+	processedBlockNum atomic.Int64
+	// Latest block of the last poll, blocks behind it are historical
+	latestBlockNum atomic.Int64
+	// Bitcoin block time is ~10 minutes, so polling every 15s for new
+	// blocks should be more than fine.
+	pollInterval time.Duration
+	// Maximum number of blocks processed after the subscriber lags behind,
+	// older ones are skipped. 0 means no limit.
+	maxCatchUpBlocks int64
+
+	// Number of goroutines processing transactions of a block concurrently
+	workers int
+	// Maximum number of transactions of a block processed per poll, the rest
+	// is deferred to subsequent polls. 0 means no limit.
+	maxTxsPerBlock int
+	// Block whose transactions exceed maxTxsPerBlock, only accessed by the
+	// Start goroutine
+	pending *pendingBtcBlock
+
+	// Whether outputs of a transaction to the same wallet are emitted as a
+	// single event
+	aggregateOutputs bool
+
+	// Previous transactions spent by inputs of processed blocks
+	prevTxs         *btcPrevTxCache
+	prevTxCacheSize int
+
+	// Cancelled when the subscriber is stopped. In-flight RPC calls of Start
+	// goroutines are cancelled as well.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
 }
 
 func (b *bitcoinSubscriber) Init() error {
@@ -41,171 +126,713 @@ func (b *bitcoinSubscriber) Init() error {
 		HTTPPostMode: true,
 		User:         "none",
 		Pass:         "none",
+		Params:       b.network.Name,
 	}, nil)
 	if err != nil {
 		return err
 	}
 	b.c = client
+	b.getBlockCount = client.GetBlockCount
+	b.getBlockHash = client.GetBlockHash
+	b.getBlock = client.GetBlock
+	b.getRawTransaction = client.GetRawTransaction
 
-	latestBlock, err := b.c.GetBlockCount()
-	if err != nil {
-		return fmt.Errorf("failed to get initial block count: %v", err)
+	if err := b.initLastBlock(); err != nil {
+		return err
 	}
-	// sub 1 for first time run
-	b.lastBlockNum = latestBlock - 1
 
-	slog.Info("initialized bitcoin subscriber",
+	b.logger.Info("initialized bitcoin subscriber",
 		slog.String("rpc_url", b.rpcUrl),
+		slog.String("network", b.network.Name),
 	)
 
 	return nil
 }
 
+// initLastBlock sets lastBlockNum so that the latest block is processed on the
+// first poll. On a chain without blocks other than the genesis block, no
+// block is processed until a new one is mined.
+func (b *bitcoinSubscriber) initLastBlock() error {
+	latestBlock, err := b.getBlockCount()
+	if err != nil {
+		return fmt.Errorf("failed to get initial block count: %v", err)
+	}
+	// sub 1 for first time run
+	b.lastBlockNum = max(latestBlock-1, 0)
+	return nil
+}
+
 func (b *bitcoinSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan error) {
 	outEvents := make(chan *TrackedWalletEvent)
 	outErrs := make(chan error)
 
 	go func() {
-		// Bitcoin block time is ~10 minutes, so polling every 15s for new
-		// blocks should be more than fine.
-		for range time.Tick(15 * time.Second) {
-			latestBlock, err := b.c.GetBlockCount()
-			if err != nil {
-				outErrs <- fmt.Errorf("failed to get block count: %w", err)
-			}
+		defer close(outErrs)
+		defer close(outEvents)
 
-			// Make sure we don't repeatedly process the same block
-			if b.lastBlockNum < latestBlock {
-				b.lastBlockNum = latestBlock
-			} else {
-				continue
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-ticker.C:
 			}
 
-			blockHash, err := b.c.GetBlockHash(latestBlock)
+			latestBlock, err := b.getBlockCount()
 			if err != nil {
-				outErrs <- fmt.Errorf("failed to get block hash: %w", err)
+				metrics.RPCErrors.Inc(string(b.Name()))
+				if !send(outErrs, fmt.Errorf("failed to get block count: %w", err), b.ctx.Done()) {
+					return
+				}
+				continue
 			}
-			start := time.Now()
-			fullBlock, err := b.c.GetBlock(blockHash)
-			if err != nil {
-				outErrs <- fmt.Errorf("failed to get block info: %w", err)
+			b.latestBlockNum.Store(latestBlock)
+			recordLag(b.logger, metrics.ChainHeadLagBlocks, b.Name(), uint64(latestBlock), uint64(b.lastBlockNum))
+
+			// Finish the block deferred by previous polls before newer ones
+			if b.pending != nil {
+				done, ok := b.processPending(outEvents)
+				if !ok {
+					return
+				}
+				if !done {
+					continue
+				}
 			}
-			slog.Info("fetched full bitcoin block",
-				slog.String("block_hash", blockHash.String()),
-				slog.Duration("duration", time.Since(start)),
-				slog.Int("num_tx", len(fullBlock.Transactions)),
-			)
 
-			// TODO: potential improvement is to use a pool of worker goroutines
-			// to process txs
-			for _, tx := range fullBlock.Transactions {
-				tx.TxHash()
-
-				inAmountTotal := int64(0)
-				outAmounts := []int64{}
-				outAmountTotal := int64(0)
-
-				inWallets := []string{}
-				outWallets := []string{}
-
-				// Parse input transactions, fetch wallets from prev out,
-				// amounts, etc.
-				for _, txIn := range tx.TxIn {
-					prevIndex := txIn.PreviousOutPoint.Index
-					prevHash := txIn.PreviousOutPoint.Hash
-					prevTx, err := b.c.GetRawTransaction(&prevHash)
-					if err != nil {
-						slog.Error("failed to get raw bitcoin transaction", slog.Any("error", err))
-						continue
-					}
-					prevTxOut := prevTx.MsgTx().TxOut[prevIndex]
-					_, addrs, _, err := txscript.ExtractPkScriptAddrs(prevTxOut.PkScript, &chaincfg.MainNetParams)
-					if err != nil || len(addrs) < 1 {
-						continue
+			// Process every block mined since the last poll. A block which
+			// can't be fetched is retried on the next poll.
+			for number := b.catchUpStart(latestBlock); number <= latestBlock; number++ {
+				block, err := b.fetchBlock(number)
+				if err != nil {
+					metrics.RPCErrors.Inc(string(b.Name()))
+					if !send(outErrs, err, b.ctx.Done()) {
+						return
 					}
-					inAmountTotal += prevTxOut.Value
-					inWallets = append(inWallets, addrs[0].String())
+					break
 				}
-
-				// Same for outputs
-				for _, txOut := range tx.TxOut {
-					_, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, &chaincfg.MainNetParams)
-					if err != nil || len(addrs) < 1 {
-						continue
-					}
-					outAmounts = append(outAmounts, txOut.Value)
-					outAmountTotal += txOut.Value
-					outWallets = append(outWallets, addrs[0].String())
+				b.pending = &pendingBtcBlock{number: number, block: block}
+				done, ok := b.processPending(outEvents)
+				if !ok {
+					return
 				}
+				if !done {
+					break
+				}
+			}
+		}
+	}()
 
-				fees := inAmountTotal - outAmountTotal
-
-				// For each out wallet, let's send a TrackedWalletEvent
-				sources := strings.Join(inWallets, ",")
-				for i, outWallet := range outWallets {
-					b.mu.RLock()
-					_, ok := b.registeredWallets[strings.ToLower(outWallet)]
-					b.mu.RUnlock()
-
-					if ok {
-						// Calculate fractional fee and total amount for current
-						// out wallet
-						currentOutputAmount := int64(0)
-						currentOutputFees := int64(0)
-						if outAmountTotal > 0 && outAmounts[i] > 0 {
-							p := float64(outAmounts[i]) / float64(outAmountTotal)
-							currentOutputAmount = int64(float64(outAmountTotal) * p)
-							currentOutputFees = int64(float64(fees) * p)
-						}
-
-						outEvents <- &TrackedWalletEvent{
-							ChainName:   Bitcoin,
-							Source:      sources,
-							Destination: outWallet,
-							Amount:      big.NewInt(currentOutputAmount),
-							Fees:        big.NewInt(currentOutputFees),
-						}
-					}
+	return outEvents, outErrs
+}
+
+// catchUpStart returns the first block to process when catching up from
+// lastBlockNum to latest. If the gap exceeds maxCatchUpBlocks, older blocks are
+// skipped.
+func (b *bitcoinSubscriber) catchUpStart(latest int64) int64 {
+	start := b.lastBlockNum + 1
+	if b.maxCatchUpBlocks == 0 || latest-start < b.maxCatchUpBlocks {
+		return start
+	}
+
+	skipTo := latest - b.maxCatchUpBlocks + 1
+	b.logger.Warn("catch-up gap exceeds the limit, skipping older blocks",
+		slog.Int64("from_block", start),
+		slog.Int64("skipped_until_block", skipTo),
+		slog.Int64("max_catch_up_blocks", b.maxCatchUpBlocks),
+	)
+	return skipTo
+}
+
+// fetchBlock fetches the full block at the given height.
+func (b *bitcoinSubscriber) fetchBlock(number int64) (*wire.MsgBlock, error) {
+	start := time.Now()
+	blockHash, err := b.getBlockHash(number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block hash: %w", err)
+	}
+	block, err := b.getBlock(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block info: %w", err)
+	}
+	metrics.BlockFetchDuration.Observe(string(b.Name()), time.Since(start).Seconds())
+	b.logger.Info("fetched full bitcoin block",
+		slog.Int64("block_number", number),
+		slog.String("block_hash", blockHash.String()),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int("num_tx", len(block.Transactions)),
+	)
+	return block, nil
+}
+
+// pendingBtcBlock is a block whose transactions are processed over several
+// polls.
+type pendingBtcBlock struct {
+	number int64
+	block  *wire.MsgBlock
+	// Index of the next transaction to process
+	next int
+}
+
+// processPending processes up to maxTxsPerBlock transactions of the pending
+// block. It reports whether the block was completed and clears it, and
+// returns ok false if the subscriber was stopped.
+func (b *bitcoinSubscriber) processPending(outEvents chan<- *TrackedWalletEvent) (done bool, ok bool) {
+	p := b.pending
+	end := len(p.block.Transactions)
+	if b.maxTxsPerBlock > 0 {
+		end = min(end, p.next+b.maxTxsPerBlock)
+	}
+	if !b.processTxs(p.number, p.block, p.next, end, outEvents) {
+		return false, false
+	}
+	p.next = end
+
+	if remaining := len(p.block.Transactions) - end; remaining > 0 {
+		b.logger.Warn("block exceeds max transactions per poll, deferring the rest",
+			slog.Int64("block_number", p.number),
+			slog.Int("processed", end),
+			slog.Int("remaining", remaining),
+			slog.Int("max_txs_per_block", b.maxTxsPerBlock),
+		)
+		return false, true
+	}
+	if !b.finishBlock(p.number, outEvents) {
+		return false, false
+	}
+	b.lastBlockNum = p.number
+	b.pending = nil
+	return true, true
+}
+
+// processBlock emits events of tracked wallets for all transactions in the
+// block. It returns false if the subscriber was stopped.
+func (b *bitcoinSubscriber) processBlock(number int64, block *wire.MsgBlock, outEvents chan<- *TrackedWalletEvent) bool {
+	return b.processTxs(number, block, 0, len(block.Transactions), outEvents) &&
+		b.finishBlock(number, outEvents)
+}
+
+// processTxs emits events of tracked wallets for transactions [from, to) of
+// the block. Transactions are processed by a pool of workers, events are
+// emitted in the order of transactions within the block. It returns false if
+// the subscriber was stopped.
+func (b *bitcoinSubscriber) processTxs(number int64, block *wire.MsgBlock, from, to int, outEvents chan<- *TrackedWalletEvent) bool {
+	start := time.Now()
+	blockTime := block.Header.Timestamp.UTC()
+	// Blocks behind the latest one are processed while catching up
+	historical := number < b.latestBlockNum.Load()
+
+	// Each transaction has its own result slot, so that events are emitted
+	// in order while the following transactions are being processed
+	results := make([]chan []*TrackedWalletEvent, to-from)
+	for i := range results {
+		results[i] = make(chan []*TrackedWalletEvent, 1)
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range results {
+			select {
+			case jobs <- i:
+			case <-b.ctx.Done():
+				return
+			}
+		}
+	}()
+	for range max(b.workers, 1) {
+		go func() {
+			for i := range jobs {
+				txIndex := from + i
+				results[i] <- b.txEvents(block.Transactions[txIndex], uint64(number), uint64(txIndex), blockTime)
+			}
+		}()
+	}
+
+	for _, result := range results {
+		select {
+		case events := <-result:
+			for _, event := range events {
+				event.Historical = historical
+				if !send(outEvents, event, b.ctx.Done()) {
+					return false
 				}
+			}
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+	metrics.TxsProcessed.Add(string(b.Name()), float64(to-from))
+	metrics.TxProcessingDuration.Observe(string(b.Name()), time.Since(start).Seconds())
+	return true
+}
+
+// finishBlock marks the block as processed. It returns false if the
+// subscriber was stopped.
+func (b *bitcoinSubscriber) finishBlock(number int64, outEvents chan<- *TrackedWalletEvent) bool {
+	b.processedBlockNum.Store(number)
+	metrics.BlocksProcessed.Inc(string(b.Name()))
+	return true
+}
+
+// txEvents returns events of tracked wallets which spent inputs or received
+// outputs of tx. Outgoing events of spenders precede incoming events. Fees are
+// paid by input owners, so when a tracked wallet spends inputs, the fee is
+// attributed to outgoing events weighted by the value of inputs each spender
+// owns, and incoming events carry no fees. Otherwise fees are prorated across
+// outputs.
+func (b *bitcoinSubscriber) txEvents(tx *wire.MsgTx, blockNumber, txIndex uint64, blockTime time.Time) []*TrackedWalletEvent {
+	txHash := tx.TxHash().String()
+
+	inAmountTotal := int64(0)
+	outAmounts := []int64{}
+	outAmountTotal := int64(0)
+
+	inWallets := []string{}
+	// Input owner -> value of its inputs
+	inValues := map[string]int64{}
+	outWallets := []string{}
+
+	// Parse input transactions, fetch wallets from prev out,
+	// amounts, etc.
+	for _, txIn := range tx.TxIn {
+		// Coinbase inputs do not spend any previous output
+		if isCoinbaseInput(txIn) {
+			continue
+		}
+		prevTx, err := b.prevTxs.get(txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			metrics.RPCErrors.Inc(string(b.Name()))
+			b.errLogs.Log(b.logger, slog.LevelError, "failed to get raw bitcoin transaction", err)
+			continue
+		}
+		prevTxOut, err := prevOutput(prevTx, txIn.PreviousOutPoint.Index)
+		if err != nil {
+			b.errLogs.Log(b.logger, slog.LevelError, "failed to resolve bitcoin previous output", err,
+				slog.String("tx_hash", txHash),
+			)
+			continue
+		}
+		addr, ok := extractBtcAddress(prevTxOut.PkScript, b.network)
+		if !ok {
+			continue
+		}
+		inAmountTotal += prevTxOut.Value
+		inWallets = append(inWallets, addr)
+		inValues[addr] += prevTxOut.Value
+	}
 
+	// Same for outputs
+	for _, txOut := range tx.TxOut {
+		addr, ok := extractBtcAddress(txOut.PkScript, b.network)
+		if !ok {
+			continue
+		}
+		outAmounts = append(outAmounts, txOut.Value)
+		outAmountTotal += txOut.Value
+		outWallets = append(outWallets, addr)
+	}
+
+	// Coinbase and unresolved inputs would otherwise yield negative fees
+	fees := max(inAmountTotal-outAmountTotal, 0)
+
+	events := b.outgoingEvents(txHash, blockNumber, txIndex, blockTime, inWallets, inValues, inAmountTotal, outWallets, outAmounts, fees)
+	if len(events) > 0 {
+		// Fees are attributed to spenders
+		fees = 0
+	}
+
+	// For each out wallet, let's create a TrackedWalletEvent
+	// Out wallet -> its event, used when outputs are aggregated
+	walletEvents := map[string]*TrackedWalletEvent{}
+	sources := strings.Join(inWallets, ",")
+	for i, outWallet := range outWallets {
+		key := strings.ToLower(outWallet)
+		b.mu.RLock()
+		ok := b.registeredWallets[key] != "" && !b.mutedWallets[key]
+		b.mu.RUnlock()
+
+		if ok {
+			// Calculate fractional fee and total amount for current
+			// out wallet
+			currentOutputAmount := int64(0)
+			currentOutputFees := int64(0)
+			if outAmountTotal > 0 && outAmounts[i] > 0 {
+				p := float64(outAmounts[i]) / float64(outAmountTotal)
+				currentOutputAmount = int64(float64(outAmountTotal) * p)
+				currentOutputFees = int64(float64(fees) * p)
 			}
 
+			if event, ok := walletEvents[outWallet]; ok && b.aggregateOutputs {
+				event.Amount.Add(event.Amount, big.NewInt(currentOutputAmount))
+				event.Fees.Add(event.Fees, big.NewInt(currentOutputFees))
+				continue
+			}
+
+			event := &TrackedWalletEvent{
+				ChainName:      Bitcoin,
+				TxHash:         txHash,
+				Wallet:         outWallet,
+				Source:         sources,
+				Destination:    outWallet,
+				Amount:         big.NewInt(currentOutputAmount),
+				Fees:           big.NewInt(currentOutputFees),
+				IdempotencyKey: idempotencyKey(Bitcoin, txHash, outWallet, DirectionIncoming, NativeAssetID),
+				BlockNumber:    blockNumber,
+				TxIndex:        txIndex,
+				BlockTime:      blockTime,
+				ObservedAt:     time.Now().UTC(),
+				direction:      DirectionIncoming,
+			}
+			walletEvents[outWallet] = event
+			events = append(events, event)
 		}
-	}()
+	}
+	return events
+}
 
-	return outEvents, outErrs
+// outgoingEvents returns an outgoing event of every tracked input owner of
+// the transaction, in order of their first input. The amount is the value of
+// the owner's inputs less outputs returning to it and its fee share.
+func (b *bitcoinSubscriber) outgoingEvents(
+	txHash string, blockNumber, txIndex uint64, blockTime time.Time,
+	inWallets []string, inValues map[string]int64, inAmountTotal int64,
+	outWallets []string, outAmounts []int64, fees int64,
+) []*TrackedWalletEvent {
+	events := []*TrackedWalletEvent{}
+	for _, inWallet := range inWallets {
+		key := strings.ToLower(inWallet)
+		b.mu.RLock()
+		ok := b.registeredWallets[key] != "" && !b.mutedWallets[key]
+		b.mu.RUnlock()
+		if !ok || slices.ContainsFunc(events, func(e *TrackedWalletEvent) bool { return e.Wallet == inWallet }) {
+			continue
+		}
+
+		// Fee share weighted by the value of inputs the wallet owns
+		walletFees := big.NewInt(0)
+		if inAmountTotal > 0 {
+			walletFees.Mul(big.NewInt(fees), big.NewInt(inValues[inWallet]))
+			walletFees.Div(walletFees, big.NewInt(inAmountTotal))
+		}
+		change := int64(0)
+		recipients := []string{}
+		for i, outWallet := range outWallets {
+			if outWallet == inWallet {
+				change += outAmounts[i]
+				continue
+			}
+			recipients = append(recipients, outWallet)
+		}
+		if len(recipients) == 0 {
+			// Consolidation of the wallet's own outputs
+			recipients = append(recipients, inWallet)
+		}
+		amount := max(inValues[inWallet]-change-walletFees.Int64(), 0)
+
+		events = append(events, &TrackedWalletEvent{
+			ChainName:      Bitcoin,
+			TxHash:         txHash,
+			Wallet:         inWallet,
+			Source:         inWallet,
+			Destination:    strings.Join(recipients, ","),
+			Amount:         big.NewInt(amount),
+			Fees:           walletFees,
+			IdempotencyKey: idempotencyKey(Bitcoin, txHash, inWallet, DirectionOutgoing, NativeAssetID),
+			BlockNumber:    blockNumber,
+			TxIndex:        txIndex,
+			BlockTime:      blockTime,
+			ObservedAt:     time.Now().UTC(),
+			direction:      DirectionOutgoing,
+		})
+	}
+	return events
 }
 
 func (b *bitcoinSubscriber) TrackWallet(wallet string) error {
-	a, err := validateBtcAddress(wallet)
+	if b.registeredWallets == nil {
+		return ErrSubscriberNotInitialized
+	}
+	a, err := validateBtcAddress(wallet, b.network)
 	if err != nil {
 		return fmt.Errorf("invalid btc address: %w", err)
 	}
 
+	key := strings.ToLower(a.String())
 	b.mu.Lock()
-	b.registeredWallets[strings.ToLower(a.String())] = true
+	b.registeredWallets[key] = a.EncodeAddress()
+	b.walletRefs[key]++
 	b.mu.Unlock()
 
 	return nil
 }
 
 func (b *bitcoinSubscriber) UntrackWallet(wallet string) error {
-	a, err := validateBtcAddress(wallet)
+	a, err := validateBtcAddress(wallet, b.network)
+	if err != nil {
+		return fmt.Errorf("invalid btc address: %w", err)
+	}
+
+	key := strings.ToLower(a.String())
+	b.mu.Lock()
+	if b.walletRefs[key] == 0 {
+		b.mu.Unlock()
+		return ErrWalletNotTracked
+	}
+	if b.walletRefs[key] > 1 {
+		// Still tracked for other references
+		b.walletRefs[key]--
+		b.mu.Unlock()
+		return nil
+	}
+	delete(b.registeredWallets, key)
+	delete(b.walletRefs, key)
+	delete(b.mutedWallets, key)
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (b *bitcoinSubscriber) MuteWallet(wallet string) error {
+	a, err := validateBtcAddress(wallet, b.network)
+	if err != nil {
+		return fmt.Errorf("invalid btc address: %w", err)
+	}
+
+	key := strings.ToLower(a.String())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.registeredWallets[key] == "" {
+		return ErrWalletNotTracked
+	}
+	b.mutedWallets[key] = true
+
+	return nil
+}
+
+func (b *bitcoinSubscriber) UnmuteWallet(wallet string) error {
+	a, err := validateBtcAddress(wallet, b.network)
 	if err != nil {
 		return fmt.Errorf("invalid btc address: %w", err)
 	}
 
 	b.mu.Lock()
-	delete(b.registeredWallets, strings.ToLower(a.String()))
+	delete(b.mutedWallets, strings.ToLower(a.String()))
 	b.mu.Unlock()
 
 	return nil
 }
 
+func (b *bitcoinSubscriber) WalletMuted(wallet string) (bool, error) {
+	a, err := validateBtcAddress(wallet, b.network)
+	if err != nil {
+		return false, fmt.Errorf("invalid btc address: %w", err)
+	}
+
+	key := strings.ToLower(a.String())
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.walletRefs[key] == 0 {
+		return false, ErrWalletNotTracked
+	}
+	return b.mutedWallets[key], nil
+}
+
+func (b *bitcoinSubscriber) TrackedWallets() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	wallets := make([]string, 0, len(b.registeredWallets))
+	for _, address := range b.registeredWallets {
+		wallets = append(wallets, address)
+	}
+	slices.Sort(wallets)
+	return wallets
+}
+
 func (b *bitcoinSubscriber) Name() ChainName {
 	return Bitcoin
 }
 
-func validateBtcAddress(address string) (btcutil.Address, error) {
-	return btcutil.DecodeAddress(address, &chaincfg.MainNetParams)
+func (b *bitcoinSubscriber) ChainTip() (uint64, error) {
+	tip := b.latestBlockNum.Load()
+	if tip <= 0 {
+		return 0, ErrChainTipUnknown
+	}
+	return uint64(tip), nil
+}
+
+func (b *bitcoinSubscriber) LastProcessedBlock() uint64 {
+	return uint64(max(b.processedBlockNum.Load(), 0))
+}
+
+func (b *bitcoinSubscriber) Stop() error {
+	b.stopOnce.Do(func() {
+		b.cancel()
+		if b.c != nil {
+			b.c.Shutdown()
+		}
+	})
+	return nil
+}
+
+type BitcoinSubscriberOption interface {
+	Apply(*bitcoinSubscriber)
+}
+
+// WithTxWorkers sets the number of goroutines processing transactions of a
+// block concurrently. Default is 8.
+type WithTxWorkers struct {
+	Workers int
+}
+
+func (w WithTxWorkers) Apply(b *bitcoinSubscriber) {
+	if w.Workers > 0 {
+		b.workers = w.Workers
+	}
+}
+
+// WithPrevTxCacheSize sets the number of previous transactions cached across
+// blocks, so that outputs spent repeatedly are fetched once. Default is 10000.
+type WithPrevTxCacheSize struct {
+	Size int
+}
+
+func (w WithPrevTxCacheSize) Apply(b *bitcoinSubscriber) {
+	if w.Size > 0 {
+		b.prevTxCacheSize = w.Size
+	}
+}
+
+// WithBlockPollInterval sets how often the latest block is polled, e.g. to
+// stay within rate limits of the RPC provider. Default is 15s.
+type WithBlockPollInterval struct {
+	Interval time.Duration
+}
+
+func (w WithBlockPollInterval) Apply(b *bitcoinSubscriber) {
+	if w.Interval > 0 {
+		b.pollInterval = w.Interval
+	}
+}
+
+// WithMaxCatchUpBlocks limits the number of blocks processed when the
+// subscriber lags behind the chain tip, e.g. after RPC failures. Older blocks
+// are skipped. 0 means no limit. Default is 6.
+type WithMaxCatchUpBlocks struct {
+	Blocks int64
+}
+
+func (w WithMaxCatchUpBlocks) Apply(b *bitcoinSubscriber) {
+	b.maxCatchUpBlocks = w.Blocks
+}
+
+// WithMaxTxsPerBlock bounds the work of a single poll on large blocks. At
+// most Txs transactions of a block are processed per poll, the rest is
+// processed by subsequent polls before newer blocks. 0 - no limit.
+type WithMaxTxsPerBlock struct {
+	Txs int
+}
+
+func (w WithMaxTxsPerBlock) Apply(b *bitcoinSubscriber) {
+	b.maxTxsPerBlock = max(w.Txs, 0)
+}
+
+// WithAggregatedOutputs emits a single event per tracked wallet and
+// transaction, with amounts and fees of all outputs to the wallet summed up.
+// By default, every output emits its own event and the events share the
+// idempotency key.
+type WithAggregatedOutputs struct {
+	Enabled bool
+}
+
+func (w WithAggregatedOutputs) Apply(b *bitcoinSubscriber) {
+	b.aggregateOutputs = w.Enabled
+}
+
+// WithNetwork sets the bitcoin network whose addresses are tracked, see
+// BitcoinNetwork. Default is mainnet.
+type WithNetwork struct {
+	Params *chaincfg.Params
+}
+
+func (w WithNetwork) Apply(b *bitcoinSubscriber) {
+	if w.Params != nil {
+		b.network = w.Params
+	}
+}
+
+// WithBitcoinLogger sets the logger of the subscriber, e.g. one with instance
+// attributes attached. The chain attribute is added by the subscriber.
+// Default is slog.Default().
+type WithBitcoinLogger struct {
+	Logger *slog.Logger
+}
+
+func (w WithBitcoinLogger) Apply(b *bitcoinSubscriber) {
+	if w.Logger != nil {
+		b.logger = w.Logger
+	}
+}
+
+// bitcoinNetworks are the networks supported by the bitcoin subscriber
+var bitcoinNetworks = []*chaincfg.Params{
+	&chaincfg.MainNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.SigNetParams,
+	&chaincfg.RegressionNetParams,
+}
+
+// BitcoinNetwork returns parameters of the bitcoin network with the given
+// name: mainnet, testnet3, signet or regtest.
+func BitcoinNetwork(name string) (*chaincfg.Params, error) {
+	for _, params := range bitcoinNetworks {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported bitcoin network %q", name)
+}
+
+// validateBtcAddress decodes address and checks that it belongs to network.
+func validateBtcAddress(address string, network *chaincfg.Params) (btcutil.Address, error) {
+	a, err := btcutil.DecodeAddress(address, network)
+	if err != nil {
+		return nil, err
+	}
+	// Segwit addresses of any known network are decoded regardless of the
+	// given one
+	if !a.IsForNet(network) {
+		return nil, fmt.Errorf("address is not for %s network", network.Name)
+	}
+	return a, nil
+}
+
+// extractBtcAddress returns the encoded address of a standard output script.
+// Legacy (P2PKH, P2SH) as well as segwit (P2WPKH, P2WSH) and taproot (P2TR)
+// scripts are supported. Multisig and non standard scripts are ignored.
+func extractBtcAddress(pkScript []byte, network *chaincfg.Params) (string, bool) {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, network)
+	if err != nil || len(addrs) != 1 || class == txscript.MultiSigTy {
+		return "", false
+	}
+	return addrs[0].EncodeAddress(), true
+}
+
+// prevOutput returns the output of prevTx spent by an input referencing index.
+func prevOutput(prevTx *wire.MsgTx, index uint32) (*wire.TxOut, error) {
+	if int(index) >= len(prevTx.TxOut) {
+		return nil, fmt.Errorf(
+			"previous output index %d out of range for tx %s with %d outputs",
+			index, prevTx.TxHash(), len(prevTx.TxOut),
+		)
+	}
+	return prevTx.TxOut[index], nil
+}
+
+func isCoinbaseInput(txIn *wire.TxIn) bool {
+	return txIn.PreviousOutPoint.Index == wire.MaxPrevOutIndex &&
+		txIn.PreviousOutPoint.Hash == (chainhash.Hash{})
 }
@@ -0,0 +1,923 @@
+package chain
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustBtcPkScript(t testing.TB, address string) []byte {
+	t.Helper()
+	a, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams)
+	assert.NoError(t, err)
+	script, err := txscript.PayToAddrScript(a)
+	assert.NoError(t, err)
+	return script
+}
+
+func TestExtractBtcAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{name: "p2pkh", address: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{name: "p2sh", address: "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"},
+		{name: "p2wpkh", address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{name: "p2wsh", address: "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"},
+		{name: "p2tr", address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, ok := extractBtcAddress(mustBtcPkScript(t, tt.address), &chaincfg.MainNetParams)
+			assert.True(t, ok)
+			assert.Equal(t, tt.address, addr)
+		})
+	}
+
+	t.Run("null data", func(t *testing.T) {
+		script, err := txscript.NullDataScript([]byte("deblock"))
+		assert.NoError(t, err)
+		_, ok := extractBtcAddress(script, &chaincfg.MainNetParams)
+		assert.False(t, ok)
+	})
+}
+
+func TestBitcoinNetwork(t *testing.T) {
+	for _, name := range []string{"mainnet", "testnet3", "signet", "regtest"} {
+		params, err := BitcoinNetwork(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, params.Name)
+	}
+	_, err := BitcoinNetwork("testnet4")
+	assert.Error(t, err)
+}
+
+func TestBtcAddressNetworks(t *testing.T) {
+	regtest, err := btcutil.NewAddressWitnessPubKeyHash(make([]byte, 20), &chaincfg.RegressionNetParams)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		address string
+		network *chaincfg.Params
+		wantErr bool
+	}{
+		{name: "mainnet p2wpkh on mainnet", address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", network: &chaincfg.MainNetParams},
+		{name: "testnet p2wpkh on testnet", address: "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", network: &chaincfg.TestNet3Params},
+		{name: "testnet p2pkh on testnet", address: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", network: &chaincfg.TestNet3Params},
+		{name: "regtest p2wpkh on regtest", address: regtest.EncodeAddress(), network: &chaincfg.RegressionNetParams},
+		{name: "testnet p2wpkh on mainnet", address: "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", network: &chaincfg.MainNetParams, wantErr: true},
+		{name: "testnet p2pkh on mainnet", address: "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", network: &chaincfg.MainNetParams, wantErr: true},
+		{name: "mainnet p2wpkh on testnet", address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", network: &chaincfg.TestNet3Params, wantErr: true},
+		{name: "regtest p2wpkh on testnet", address: regtest.EncodeAddress(), network: &chaincfg.TestNet3Params, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := validateBtcAddress(tt.address, tt.network)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			script, err := txscript.PayToAddrScript(a)
+			assert.NoError(t, err)
+			addr, ok := extractBtcAddress(script, tt.network)
+			assert.True(t, ok)
+			assert.Equal(t, tt.address, addr)
+		})
+	}
+}
+
+func TestBitcoinTestnetSubscriber(t *testing.T) {
+	tracked := "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+	b := NewBitcoinSubscriber("dummy", WithNetwork{Params: &chaincfg.TestNet3Params})
+	assert.NoError(t, b.TrackWallet(tracked))
+	assert.Error(t, b.TrackWallet("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"))
+	assert.Equal(t, []string{tracked}, b.TrackedWallets())
+
+	a, err := btcutil.DecodeAddress(tracked, &chaincfg.TestNet3Params)
+	assert.NoError(t, err)
+	script, err := txscript.PayToAddrScript(a)
+	assert.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex}})
+	tx.AddTxOut(wire.NewTxOut(5000, script))
+
+	events := b.txEvents(tx, 100, 0, time.Unix(1730000000, 0))
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, tracked, events[0].Wallet)
+		assert.Equal(t, int64(5000), events[0].Amount.Int64())
+	}
+
+	// Normalization accepts addresses of every supported network, the
+	// subscriber enforces its own
+	normalized, err := NormalizeWallet(Bitcoin, strings.ToUpper(tracked))
+	assert.NoError(t, err)
+	assert.Equal(t, tracked, normalized)
+}
+
+func TestBtcTrackSegwitWalletMatchesExtractedAddress(t *testing.T) {
+	b := NewBitcoinSubscriber("dummy")
+	// Bech32 addresses may be supplied in upper case
+	err := b.TrackWallet("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4")
+	assert.NoError(t, err)
+
+	addr, ok := extractBtcAddress(mustBtcPkScript(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"), &chaincfg.MainNetParams)
+	assert.True(t, ok)
+	assert.Equal(t, addr, b.registeredWallets[strings.ToLower(addr)])
+}
+
+func TestPrevOutput(t *testing.T) {
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0},
+		Witness:          wire.TxWitness{[]byte{0x30, 0x44}, []byte{0x02, 0x79}},
+	})
+	prevTx.AddTxOut(wire.NewTxOut(1000, mustBtcPkScript(t, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")))
+	prevTx.AddTxOut(wire.NewTxOut(2500, mustBtcPkScript(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")))
+
+	out, err := prevOutput(prevTx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2500), out.Value)
+	addr, ok := extractBtcAddress(out.PkScript, &chaincfg.MainNetParams)
+	assert.True(t, ok)
+	assert.Equal(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", addr)
+
+	_, err = prevOutput(prevTx, 2)
+	assert.Error(t, err)
+}
+
+func TestIsCoinbaseInput(t *testing.T) {
+	assert.True(t, isCoinbaseInput(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+	}))
+	assert.False(t, isCoinbaseInput(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0},
+	}))
+}
+
+// btcTestBlock returns a block of n transactions, each spending an output of
+// one of prevs shared previous transactions and paying to the given addresses
+// in turn.
+func btcTestBlock(t testing.TB, n, prevs int, addresses []string) (*wire.MsgBlock, map[chainhash.Hash]*btcutil.Tx) {
+	prevTxs := map[chainhash.Hash]*btcutil.Tx{}
+	prevHashes := []chainhash.Hash{}
+	for i := range prevs {
+		prev := wire.NewMsgTx(wire.TxVersion)
+		prev.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i), byte(i >> 8), 1}}})
+		prev.AddTxOut(wire.NewTxOut(int64(100_000*(i+1)), mustBtcPkScript(t, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")))
+		prevTxs[prev.TxHash()] = btcutil.NewTx(prev)
+		prevHashes = append(prevHashes, prev.TxHash())
+	}
+
+	block := &wire.MsgBlock{Header: wire.BlockHeader{Timestamp: time.Unix(1730000000, 0)}}
+	for i := range n {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prevHashes[i%prevs]}})
+		// Distinct amounts make transaction hashes unique
+		tx.AddTxOut(wire.NewTxOut(int64(1000+i), mustBtcPkScript(t, addresses[i%len(addresses)])))
+		block.AddTransaction(tx)
+	}
+	return block, prevTxs
+}
+
+func TestBitcoinProcessBlockConcurrently(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	other := "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	block, prevTxs := btcTestBlock(t, 50, 2, []string{tracked, other})
+
+	var fetchesMu sync.Mutex
+	fetches := map[chainhash.Hash]int{}
+	b := NewBitcoinSubscriber("dummy", WithTxWorkers{Workers: 4})
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		fetchesMu.Lock()
+		fetches[*hash]++
+		fetchesMu.Unlock()
+		// Let the workers overlap
+		time.Sleep(time.Millisecond)
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+
+	events := make(chan *TrackedWalletEvent, len(block.Transactions))
+	assert.True(t, b.processBlock(100, block, events))
+	close(events)
+
+	// Events of every other transaction, in block order
+	i := 0
+	for event := range events {
+		tx := block.Transactions[i]
+		assert.Equal(t, tx.TxHash().String(), event.TxHash)
+		assert.Equal(t, uint64(i), event.TxIndex)
+		assert.Equal(t, tracked, event.Destination)
+		assert.Equal(t, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", event.Source)
+		assert.Equal(t, tx.TxOut[0].Value, event.Amount.Int64())
+		assert.Equal(t, int64(100_000*(i%2+1))-tx.TxOut[0].Value, event.Fees.Int64())
+		i += 2
+	}
+	assert.Equal(t, 50, i)
+
+	// Previous transactions are fetched once per block
+	assert.Len(t, fetches, 2)
+	for _, n := range fetches {
+		assert.Equal(t, 1, n)
+	}
+}
+
+func TestBitcoinProcessBlockStopped(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 10, 2, []string{tracked})
+	b := NewBitcoinSubscriber("dummy")
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+	assert.NoError(t, b.Stop())
+
+	// Nobody reads the events
+	assert.False(t, b.processBlock(100, block, make(chan *TrackedWalletEvent)))
+}
+
+func TestBitcoinRepeatedOutputs(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	other := "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+
+	prev := wire.NewMsgTx(wire.TxVersion)
+	prev.AddTxOut(wire.NewTxOut(10_000, mustBtcPkScript(t, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")))
+	// Two outputs to the tracked wallet, 1000 sat fee
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev.TxHash()}})
+	tx.AddTxOut(wire.NewTxOut(3000, mustBtcPkScript(t, tracked)))
+	tx.AddTxOut(wire.NewTxOut(4000, mustBtcPkScript(t, other)))
+	tx.AddTxOut(wire.NewTxOut(2000, mustBtcPkScript(t, tracked)))
+	block := &wire.MsgBlock{Header: wire.BlockHeader{Timestamp: time.Unix(1730000000, 0)}}
+	block.AddTransaction(tx)
+
+	process := func(opts ...BitcoinSubscriberOption) []*TrackedWalletEvent {
+		b := NewBitcoinSubscriber("dummy", opts...)
+		b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+			return btcutil.NewTx(prev), nil
+		}
+		assert.NoError(t, b.TrackWallet(tracked))
+
+		out := make(chan *TrackedWalletEvent, 10)
+		assert.True(t, b.processBlock(100, block, out))
+		close(out)
+		events := []*TrackedWalletEvent{}
+		for event := range out {
+			assert.Equal(t, tx.TxHash().String(), event.TxHash)
+			assert.Equal(t, tracked, event.Wallet)
+			events = append(events, event)
+		}
+		return events
+	}
+
+	// An event per output by default
+	events := process()
+	assert.Len(t, events, 2)
+	assert.Equal(t, int64(3000), events[0].Amount.Int64())
+	assert.Equal(t, int64(333), events[0].Fees.Int64())
+	assert.Equal(t, int64(2000), events[1].Amount.Int64())
+	assert.Equal(t, int64(222), events[1].Fees.Int64())
+
+	events = process(WithAggregatedOutputs{Enabled: true})
+	assert.Len(t, events, 1)
+	assert.Equal(t, int64(5000), events[0].Amount.Int64())
+	assert.Equal(t, int64(555), events[0].Fees.Int64())
+}
+
+func TestBitcoinProcessesEveryNewBlock(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	// Block at every height pays to the tracked wallet
+	blocks := map[chainhash.Hash]*wire.MsgBlock{}
+	prevTxs := map[chainhash.Hash]*btcutil.Tx{}
+	for number := int64(101); number <= 110; number++ {
+		block, prev := btcTestBlock(t, 1, 1, []string{tracked})
+		block.Transactions[0].TxOut[0].Value = number
+		blocks[chainhash.Hash{byte(number)}] = block
+		for hash, tx := range prev {
+			prevTxs[hash] = tx
+		}
+	}
+
+	tests := []struct {
+		name        string
+		maxCatchUp  int64
+		latest      int64
+		wantAmounts []int64
+	}{
+		{name: "three new blocks", maxCatchUp: 6, latest: 103, wantAmounts: []int64{101, 102, 103}},
+		{name: "gap exceeds the limit", maxCatchUp: 2, latest: 105, wantAmounts: []int64{104, 105}},
+		{name: "no limit", maxCatchUp: 0, latest: 104, wantAmounts: []int64{101, 102, 103, 104}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBitcoinSubscriber("dummy", WithMaxCatchUpBlocks{Blocks: tt.maxCatchUp})
+			b.pollInterval = time.Millisecond
+			b.lastBlockNum = 100
+			b.getBlockCount = func() (int64, error) {
+				return tt.latest, nil
+			}
+			b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+				return &chainhash.Hash{byte(number)}, nil
+			}
+			b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+				return blocks[*hash], nil
+			}
+			b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+				return prevTxs[*hash], nil
+			}
+			assert.NoError(t, b.TrackWallet(tracked))
+
+			events, _ := b.Start()
+			defer b.Stop()
+			for _, amount := range tt.wantAmounts {
+				select {
+				case event := <-events:
+					assert.Equal(t, amount, event.Amount.Int64())
+				case <-time.After(time.Second):
+					t.Fatalf("block with amount %d was not processed", amount)
+				}
+			}
+			// Blocks are not processed again
+			select {
+			case event := <-events:
+				t.Fatalf("unexpected event %+v", event)
+			case <-time.After(20 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestBitcoinRpcErrorsDoNotStopPolling(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	tests := []struct {
+		name string
+		// failing is called with a subscriber whose rpc functions succeed and
+		// makes one of them fail once
+		failing func(b *bitcoinSubscriber, fail func() bool)
+	}{
+		{
+			name: "block count",
+			failing: func(b *bitcoinSubscriber, fail func() bool) {
+				getBlockCount := b.getBlockCount
+				b.getBlockCount = func() (int64, error) {
+					if fail() {
+						return 0, assert.AnError
+					}
+					return getBlockCount()
+				}
+			},
+		},
+		{
+			name: "block hash",
+			failing: func(b *bitcoinSubscriber, fail func() bool) {
+				getBlockHash := b.getBlockHash
+				b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+					if fail() {
+						return nil, assert.AnError
+					}
+					return getBlockHash(number)
+				}
+			},
+		},
+		{
+			name: "block",
+			failing: func(b *bitcoinSubscriber, fail func() bool) {
+				getBlock := b.getBlock
+				b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+					if fail() {
+						return nil, assert.AnError
+					}
+					return getBlock(hash)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, prevTxs := btcTestBlock(t, 1, 1, []string{tracked})
+			b := NewBitcoinSubscriber("dummy")
+			b.pollInterval = time.Millisecond
+			b.lastBlockNum = 100
+			b.getBlockCount = func() (int64, error) { return 101, nil }
+			b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+				return &chainhash.Hash{byte(number)}, nil
+			}
+			b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+				return block, nil
+			}
+			b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+				return prevTxs[*hash], nil
+			}
+			failed := false
+			tt.failing(b, func() bool {
+				if failed {
+					return false
+				}
+				failed = true
+				return true
+			})
+			assert.NoError(t, b.TrackWallet(tracked))
+
+			events, errs := b.Start()
+			defer b.Stop()
+			assert.ErrorIs(t, <-errs, assert.AnError)
+			select {
+			case event := <-events:
+				assert.Equal(t, block.Transactions[0].TxHash().String(), event.TxHash)
+			case <-time.After(time.Second):
+				t.Fatal("polling did not continue after the error")
+			}
+		})
+	}
+}
+
+func TestBitcoinEmptyChain(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 1, 1, []string{tracked})
+
+	b := NewBitcoinSubscriber("dummy")
+	b.pollInterval = time.Millisecond
+	// Fresh regtest node, only the genesis block
+	var count atomic.Int64
+	b.getBlockCount = func() (int64, error) { return count.Load(), nil }
+	b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+		assert.Equal(t, int64(1), number)
+		return &chainhash.Hash{byte(number)}, nil
+	}
+	b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+		return block, nil
+	}
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+
+	assert.NoError(t, b.initLastBlock())
+	assert.Equal(t, int64(0), b.lastBlockNum)
+
+	events, _ := b.Start()
+	defer b.Stop()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// First mined block is processed
+	count.Store(1)
+	select {
+	case event := <-events:
+		assert.Equal(t, uint64(1), event.BlockNumber)
+	case <-time.After(time.Second):
+		t.Fatal("first mined block was not processed")
+	}
+}
+
+func TestBitcoinTxEvents(t *testing.T) {
+	a1 := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	a2 := "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"
+	a3 := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	blockTime := time.Unix(1730000000, 0).UTC()
+
+	nullData, err := txscript.NullDataScript([]byte("deblock"))
+	assert.NoError(t, err)
+
+	prev1 := wire.NewMsgTx(wire.TxVersion)
+	prev1.AddTxOut(wire.NewTxOut(5000, mustBtcPkScript(t, a1)))
+	prev1.AddTxOut(wire.NewTxOut(3000, mustBtcPkScript(t, a2)))
+	prev2 := wire.NewMsgTx(wire.TxVersion)
+	prev2.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 1}})
+	prev2.AddTxOut(wire.NewTxOut(2000, mustBtcPkScript(t, a1)))
+
+	// 10000 sat in, 9000 sat out to addresses, 1000 sat fee
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev1.TxHash(), Index: 0}})
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev1.TxHash(), Index: 1}})
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev2.TxHash(), Index: 0}})
+	tx.AddTxOut(wire.NewTxOut(6000, mustBtcPkScript(t, a3)))
+	tx.AddTxOut(wire.NewTxOut(0, nullData))
+	tx.AddTxOut(wire.NewTxOut(3000, mustBtcPkScript(t, a2)))
+	txHash := tx.TxHash().String()
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x03, 0x01, 0x02, 0x03},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(312_500_000, mustBtcPkScript(t, a3)))
+	coinbaseHash := coinbase.TxHash().String()
+
+	tests := []struct {
+		name            string
+		tx              *wire.MsgTx
+		prevTxs         []*wire.MsgTx
+		wantEvents      []*TrackedWalletEvent
+		registerWallets []string
+		muteWallets     []string
+	}{
+		{
+			name:    "fees are prorated across outputs without tracked spenders",
+			tx:      tx,
+			prevTxs: []*wire.MsgTx{prev1, prev2},
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a3,
+					Source:         strings.Join([]string{a1, a2, a1}, ","),
+					Destination:    a3,
+					Amount:         big.NewInt(6000),
+					Fees:           big.NewInt(666),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a3, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+			},
+			registerWallets: []string{a3},
+		},
+		{
+			name:    "fees are weighted by input ownership of tracked spenders",
+			tx:      tx,
+			prevTxs: []*wire.MsgTx{prev1, prev2},
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a1,
+					Source:         a1,
+					Destination:    strings.Join([]string{a3, a2}, ","),
+					Amount:         big.NewInt(6300),
+					Fees:           big.NewInt(700),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a1, DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+				{
+					ChainName:   Bitcoin,
+					TxHash:      txHash,
+					Wallet:      a2,
+					Source:      a2,
+					Destination: a3,
+					// Its whole input returns to it as change
+					Amount:         big.NewInt(0),
+					Fees:           big.NewInt(300),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a2, DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a3,
+					Source:         strings.Join([]string{a1, a2, a1}, ","),
+					Destination:    a3,
+					Amount:         big.NewInt(6000),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a3, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a2,
+					Source:         strings.Join([]string{a1, a2, a1}, ","),
+					Destination:    a2,
+					Amount:         big.NewInt(3000),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a2, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+			},
+			registerWallets: []string{a1, a2, a3},
+		},
+		{
+			name:            "no events for non-tracked wallets",
+			tx:              tx,
+			prevTxs:         []*wire.MsgTx{prev1, prev2},
+			wantEvents:      []*TrackedWalletEvent{},
+			registerWallets: []string{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},
+		},
+		{
+			name:    "no events for muted wallet",
+			tx:      tx,
+			prevTxs: []*wire.MsgTx{prev1, prev2},
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a3,
+					Source:         strings.Join([]string{a1, a2, a1}, ","),
+					Destination:    a3,
+					Amount:         big.NewInt(6000),
+					Fees:           big.NewInt(666),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a3, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+			},
+			registerWallets: []string{a2, a3},
+			muteWallets:     []string{a2},
+		},
+		{
+			name:    "inputs of failed previous transaction fetches are skipped",
+			tx:      tx,
+			prevTxs: []*wire.MsgTx{prev1},
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      Bitcoin,
+					TxHash:         txHash,
+					Wallet:         a3,
+					Source:         strings.Join([]string{a1, a2}, ","),
+					Destination:    a3,
+					Amount:         big.NewInt(6000),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(Bitcoin, txHash, a3, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+			},
+			registerWallets: []string{a3},
+		},
+		{
+			name: "coinbase transaction has no source and fees",
+			tx:   coinbase,
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      Bitcoin,
+					TxHash:         coinbaseHash,
+					Wallet:         a3,
+					Source:         "",
+					Destination:    a3,
+					Amount:         big.NewInt(312_500_000),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(Bitcoin, coinbaseHash, a3, DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    100,
+					BlockTime:      blockTime,
+				},
+			},
+			registerWallets: []string{a3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBitcoinSubscriber("dummy")
+			prevTxs := map[chainhash.Hash]*wire.MsgTx{}
+			for _, prev := range tt.prevTxs {
+				prevTxs[prev.TxHash()] = prev
+			}
+			b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+				prev, ok := prevTxs[*hash]
+				if !ok {
+					return nil, assert.AnError
+				}
+				return btcutil.NewTx(prev), nil
+			}
+
+			for _, w := range tt.registerWallets {
+				assert.NoError(t, b.TrackWallet(w))
+			}
+			for _, w := range tt.muteWallets {
+				assert.NoError(t, b.MuteWallet(w))
+			}
+
+			events := b.txEvents(tt.tx, 100, 0, blockTime)
+			for _, event := range events {
+				assert.False(t, event.ObservedAt.IsZero())
+				event.ObservedAt = time.Time{}
+			}
+			assert.Equal(t, tt.wantEvents, events)
+		})
+	}
+}
+
+func TestBitcoinSpenderFees(t *testing.T) {
+	spender := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	recipient := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	prev := wire.NewMsgTx(wire.TxVersion)
+	prev.AddTxOut(wire.NewTxOut(10_000, mustBtcPkScript(t, spender)))
+	// 6000 sat payment, 3000 sat change, 1000 sat fee
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev.TxHash()}})
+	tx.AddTxOut(wire.NewTxOut(6000, mustBtcPkScript(t, recipient)))
+	tx.AddTxOut(wire.NewTxOut(3000, mustBtcPkScript(t, spender)))
+
+	b := NewBitcoinSubscriber("dummy")
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return btcutil.NewTx(prev), nil
+	}
+	assert.NoError(t, b.TrackWallet(spender))
+	assert.NoError(t, b.TrackWallet(recipient))
+
+	events := b.txEvents(tx, 100, 0, time.Unix(1730000000, 0).UTC())
+	if !assert.Len(t, events, 3) {
+		return
+	}
+	// The sole spender pays the full fee
+	outgoing := events[0]
+	assert.NoError(t, outgoing.Validate())
+	assert.Equal(t, spender, outgoing.Wallet)
+	assert.Equal(t, spender, outgoing.Source)
+	assert.Equal(t, recipient, outgoing.Destination)
+	assert.Equal(t, int64(6000), outgoing.Amount.Int64())
+	assert.Equal(t, int64(1000), outgoing.Fees.Int64())
+	assert.Equal(t, idempotencyKey(Bitcoin, tx.TxHash().String(), spender, DirectionOutgoing, NativeAssetID), outgoing.IdempotencyKey)
+
+	// Payment and change are not charged again
+	assert.Equal(t, recipient, events[1].Wallet)
+	assert.Equal(t, int64(6000), events[1].Amount.Int64())
+	assert.Zero(t, events[1].Fees.Sign())
+	assert.Equal(t, spender, events[2].Wallet)
+	assert.Equal(t, int64(3000), events[2].Amount.Int64())
+	assert.Zero(t, events[2].Fees.Sign())
+}
+
+func TestBitcoinPollInterval(t *testing.T) {
+	assert.Equal(t, 15*time.Second, NewBitcoinSubscriber("dummy").pollInterval)
+
+	b := NewBitcoinSubscriber("dummy", WithBlockPollInterval{Interval: 10 * time.Millisecond})
+	var polls atomic.Int64
+	b.getBlockCount = func() (int64, error) {
+		polls.Add(1)
+		return 0, nil
+	}
+
+	b.Start()
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, b.Stop())
+
+	// ~20 polls, with a margin for slow CI machines
+	assert.GreaterOrEqual(t, polls.Load(), int64(5))
+	assert.LessOrEqual(t, polls.Load(), int64(21))
+}
+
+func TestBitcoinLogger(t *testing.T) {
+	logger, buf := newTestLogger()
+	b := NewBitcoinSubscriber("dummy", WithBitcoinLogger{Logger: logger}, WithMaxCatchUpBlocks{Blocks: 6})
+	b.lastBlockNum = 100
+
+	assert.Equal(t, int64(195), b.catchUpStart(200))
+	assertLogged(t, buf, Bitcoin, "catch-up gap exceeds the limit, skipping older blocks")
+}
+
+func TestBitcoinChainTip(t *testing.T) {
+	b := NewBitcoinSubscriber("dummy")
+	b.pollInterval = time.Millisecond
+	_, err := b.ChainTip()
+	assert.ErrorIs(t, err, ErrChainTipUnknown)
+
+	var count atomic.Int64
+	count.Store(100)
+	b.lastBlockNum = 100
+	b.getBlockCount = func() (int64, error) { return count.Load(), nil }
+	b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+		return &chainhash.Hash{byte(number)}, nil
+	}
+	b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+		return &wire.MsgBlock{}, nil
+	}
+
+	b.Start()
+	defer b.Stop()
+	tipIs := func(want uint64) func() bool {
+		return func() bool {
+			tip, err := b.ChainTip()
+			return err == nil && tip == want
+		}
+	}
+	assert.Eventually(t, tipIs(100), time.Second, time.Millisecond)
+	count.Store(102)
+	assert.Eventually(t, tipIs(102), time.Second, time.Millisecond)
+}
+
+func TestBitcoinHistoricalEvents(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 1, 1, []string{tracked})
+
+	b := NewBitcoinSubscriber("dummy")
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+	b.latestBlockNum.Store(101)
+
+	events := make(chan *TrackedWalletEvent, 2)
+	// Caught up block behind the latest one
+	assert.True(t, b.processBlock(100, block, events))
+	// The latest block
+	assert.True(t, b.processBlock(101, block, events))
+	close(events)
+
+	assert.True(t, (<-events).Historical)
+	assert.False(t, (<-events).Historical)
+}
+
+func TestBitcoinMaxTxsPerBlock(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 25, 1, []string{tracked})
+
+	logger, buf := newTestLogger()
+	b := NewBitcoinSubscriber("dummy", WithMaxTxsPerBlock{Txs: 10}, WithBitcoinLogger{Logger: logger})
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+	b.lastBlockNum = 99
+	b.pending = &pendingBtcBlock{number: 100, block: block}
+
+	// Every poll processes at most 10 transactions, every transaction pays
+	// to the tracked wallet
+	next := 0
+	for _, want := range []int{10, 10, 5} {
+		out := make(chan *TrackedWalletEvent, len(block.Transactions))
+		done, ok := b.processPending(out)
+		assert.True(t, ok)
+		close(out)
+
+		assert.Len(t, out, want)
+		for event := range out {
+			assert.Equal(t, uint64(next), event.TxIndex)
+			next++
+		}
+		assert.Equal(t, next == len(block.Transactions), done)
+		if !done {
+			// Block is not completed yet
+			assert.Equal(t, int64(99), b.lastBlockNum)
+		}
+	}
+	assert.Equal(t, int64(100), b.lastBlockNum)
+	assert.Nil(t, b.pending)
+	assertLogged(t, buf, Bitcoin, "block exceeds max transactions per poll, deferring the rest")
+}
+
+func TestBitcoinMaxTxsPerBlockPolls(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	large, prevTxs := btcTestBlock(t, 25, 1, []string{tracked})
+	small, _ := btcTestBlock(t, 1, 1, []string{tracked})
+	// Distinct from the first transaction of the large block
+	small.Transactions[0].TxOut[0].Value = 5000
+	blocks := map[chainhash.Hash]*wire.MsgBlock{{101}: large, {102}: small}
+
+	b := NewBitcoinSubscriber("dummy", WithMaxTxsPerBlock{Txs: 10})
+	b.pollInterval = time.Millisecond
+	b.lastBlockNum = 100
+	b.getBlockCount = func() (int64, error) {
+		return 102, nil
+	}
+	b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+		return &chainhash.Hash{byte(number)}, nil
+	}
+	b.getBlock = func(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+		return blocks[*hash], nil
+	}
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+
+	events, _ := b.Start()
+	defer b.Stop()
+	// The newer block is processed only after the large one is completed
+	for i := range 26 {
+		select {
+		case event := <-events:
+			if i < 25 {
+				assert.Equal(t, large.Transactions[i].TxHash().String(), event.TxHash)
+			} else {
+				assert.Equal(t, small.Transactions[0].TxHash().String(), event.TxHash)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d was not emitted", i)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/blocto/solana-go-sdk/client"
+	solcommon "github.com/blocto/solana-go-sdk/common"
+	soltypes "github.com/blocto/solana-go-sdk/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Block processing benchmarks of every chain subscriber. Fixtures are
+// generated from a fixed seed, so that results are comparable across runs.
+// Every benchmark is run for each combination of block size and number of
+// tracked wallets. Every benchTrackedEvery-th transaction involves a tracked
+// wallet.
+//
+//	go test ./internal/chain -run '^$' -bench 'ProcessBlock' -benchmem
+
+var (
+	benchBlockSizes     = []int{100, 1000, 5000}
+	benchTrackedWallets = []int{1, 100, 10_000}
+)
+
+const (
+	benchSeed         = 1
+	benchTrackedEvery = 10
+)
+
+// benchCases runs fn for each block size and tracked wallet count.
+func benchCases(b *testing.B, fn func(b *testing.B, txs, tracked int)) {
+	// Per block logs would dominate the measurements
+	defer func(orig *slog.Logger) { slog.SetDefault(orig) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, txs := range benchBlockSizes {
+		for _, tracked := range benchTrackedWallets {
+			b.Run(fmt.Sprintf("txs=%d/tracked=%d", txs, tracked), func(b *testing.B) {
+				fn(b, txs, tracked)
+			})
+		}
+	}
+}
+
+// drainEvents consumes events until the returned stop function is called.
+func drainEvents() (chan *TrackedWalletEvent, func()) {
+	events, done := make(chan *TrackedWalletEvent), make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-events:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return events, func() { close(done) }
+}
+
+func BenchmarkEthereumProcessBlock(b *testing.B) {
+	benchCases(b, func(b *testing.B, txCount, trackedCount int) {
+		rnd := rand.New(rand.NewSource(benchSeed))
+		randomAddress := func() common.Address {
+			var a common.Address
+			rnd.Read(a[:])
+			return a
+		}
+
+		e := NewEthereumMainnetSubscriber("http://dummy.net")
+		tracked := make([]common.Address, trackedCount)
+		for i := range tracked {
+			tracked[i] = randomAddress()
+			e.registeredWallets[tracked[i]] = true
+		}
+
+		keys := make([]*ecdsa.PrivateKey, 16)
+		for i := range keys {
+			seed := make([]byte, 32)
+			rnd.Read(seed)
+			key, err := crypto.ToECDSA(seed)
+			if err != nil {
+				b.Fatal(err)
+			}
+			keys[i] = key
+		}
+
+		signer := types.LatestSigner(params.MainnetChainConfig)
+		header := &types.Header{
+			Number:  big.NewInt(21000000),
+			Time:    1730000000,
+			BaseFee: big.NewInt(10),
+		}
+		encoded := make([][]byte, txCount)
+		for i := range encoded {
+			to := randomAddress()
+			if i%benchTrackedEvery == 0 {
+				to = tracked[i%len(tracked)]
+			}
+			tx, err := types.SignNewTx(keys[i%len(keys)], signer, &types.DynamicFeeTx{
+				ChainID:   params.MainnetChainConfig.ChainID,
+				Nonce:     uint64(i),
+				GasTipCap: big.NewInt(1),
+				GasFeeCap: big.NewInt(20),
+				Gas:       21000,
+				To:        &to,
+				Value:     big.NewInt(int64(i + 1)),
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if encoded[i], err = tx.MarshalBinary(); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		// Senders are cached within transactions, so every iteration
+		// processes freshly decoded ones
+		decodeBlock := func() *types.Block {
+			txs := make([]*types.Transaction, len(encoded))
+			for i, raw := range encoded {
+				txs[i] = new(types.Transaction)
+				if err := txs[i].UnmarshalBinary(raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+			return types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+		}
+
+		events, stop := drainEvents()
+		defer stop()
+		b.ResetTimer()
+		for range b.N {
+			b.StopTimer()
+			block := decodeBlock()
+			b.StartTimer()
+			e.processBlock(block, events)
+		}
+	})
+}
+
+func BenchmarkSolanaProcessBlock(b *testing.B) {
+	benchCases(b, func(b *testing.B, txCount, trackedCount int) {
+		rnd := rand.New(rand.NewSource(benchSeed))
+		randomAccount := func() solcommon.PublicKey {
+			var a solcommon.PublicKey
+			rnd.Read(a[:])
+			return a
+		}
+
+		s := NewSolanaMainnetSubscriber("http://dummy.net")
+		tracked := make([]solcommon.PublicKey, trackedCount)
+		for i := range tracked {
+			tracked[i] = randomAccount()
+			s.registeredWallets[tracked[i]] = true
+		}
+
+		blockTime := time.Unix(1730000000, 0)
+		block := &client.Block{BlockTime: &blockTime}
+		for i := range txCount {
+			// Fee payer, recipient and two accounts without balance changes
+			accounts := []solcommon.PublicKey{
+				randomAccount(), randomAccount(), randomAccount(), solcommon.SystemProgramID,
+			}
+			if i%benchTrackedEvery == 0 {
+				accounts[1] = tracked[i%len(tracked)]
+			}
+			signature := make(soltypes.Signature, 64)
+			rnd.Read(signature)
+			block.Transactions = append(block.Transactions, client.BlockTransaction{
+				Meta: &client.TransactionMeta{
+					Fee:          5000,
+					PreBalances:  []int64{1_000_000, 0, 10, 1},
+					PostBalances: []int64{1_000_000 - 5000 - int64(i+1), int64(i + 1), 10, 1},
+				},
+				Transaction: soltypes.Transaction{
+					Signatures: []soltypes.Signature{signature},
+					Message:    soltypes.Message{Accounts: accounts},
+				},
+			})
+		}
+		s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+			return block, nil
+		}
+
+		events, stop := drainEvents()
+		defer stop()
+		b.ResetTimer()
+		for range b.N {
+			if err := s.fetchBlock(1, events); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkBitcoinProcessBlock(b *testing.B) {
+	benchCases(b, func(b *testing.B, txCount, trackedCount int) {
+		rnd := rand.New(rand.NewSource(benchSeed))
+		randomScript := func() ([]byte, string) {
+			hash := make([]byte, 20)
+			rnd.Read(hash)
+			a, err := btcutil.NewAddressWitnessPubKeyHash(hash, &chaincfg.MainNetParams)
+			if err != nil {
+				b.Fatal(err)
+			}
+			script, err := txscript.PayToAddrScript(a)
+			if err != nil {
+				b.Fatal(err)
+			}
+			return script, a.EncodeAddress()
+		}
+
+		// Minimal cache, so that every iteration fetches previous
+		// transactions like a new block would
+		s := NewBitcoinSubscriber("dummy", WithPrevTxCacheSize{Size: 1})
+		trackedScripts := make([][]byte, trackedCount)
+		for i := range trackedScripts {
+			script, address := randomScript()
+			if err := s.TrackWallet(address); err != nil {
+				b.Fatal(err)
+			}
+			trackedScripts[i] = script
+		}
+
+		// Every transaction spends a distinct previous transaction
+		prevTxs := map[chainhash.Hash]*btcutil.Tx{}
+		block := &wire.MsgBlock{Header: wire.BlockHeader{Timestamp: time.Unix(1730000000, 0)}}
+		for i := range txCount {
+			prevScript, _ := randomScript()
+			prev := wire.NewMsgTx(wire.TxVersion)
+			prev.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: uint32(i)}})
+			prev.AddTxOut(wire.NewTxOut(100_000, prevScript))
+			prevTxs[prev.TxHash()] = btcutil.NewTx(prev)
+
+			script, _ := randomScript()
+			if i%benchTrackedEvery == 0 {
+				script = trackedScripts[i%len(trackedScripts)]
+			}
+			tx := wire.NewMsgTx(wire.TxVersion)
+			tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: prev.TxHash()}})
+			tx.AddTxOut(wire.NewTxOut(90_000, script))
+			block.AddTransaction(tx)
+		}
+		// Simulated RPC latency
+		s.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+			time.Sleep(50 * time.Microsecond)
+			return prevTxs[*hash], nil
+		}
+
+		events, stop := drainEvents()
+		defer stop()
+		b.ResetTimer()
+		for range b.N {
+			s.processBlock(100, block, events)
+		}
+	})
+}
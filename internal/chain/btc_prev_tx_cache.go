@@ -0,0 +1,79 @@
+package chain
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// btcPrevTxCache is a LRU cache of previous transactions spent by block
+// inputs, shared across blocks. Concurrent gets of the same hash wait for a
+// single fetch.
+type btcPrevTxCache struct {
+	fetch getRawTransactionFn
+	size  int
+
+	// Most recently used entries are at the front
+	lru     *list.List
+	entries map[chainhash.Hash]*list.Element
+	mu      sync.Mutex
+}
+
+type btcPrevTxEntry struct {
+	hash chainhash.Hash
+	once sync.Once
+	tx   *wire.MsgTx
+	err  error
+}
+
+func newBtcPrevTxCache(size int, fetch getRawTransactionFn) *btcPrevTxCache {
+	return &btcPrevTxCache{
+		fetch:   fetch,
+		size:    max(size, 1),
+		lru:     list.New(),
+		entries: make(map[chainhash.Hash]*list.Element),
+	}
+}
+
+// get returns the transaction with the given hash. Failed fetches are not
+// cached, the following get fetches the transaction again.
+func (c *btcPrevTxCache) get(hash chainhash.Hash) (*wire.MsgTx, error) {
+	c.mu.Lock()
+	var entry *btcPrevTxEntry
+	if el, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(el)
+		entry = el.Value.(*btcPrevTxEntry)
+	} else {
+		entry = &btcPrevTxEntry{hash: hash}
+		c.entries[hash] = c.lru.PushFront(entry)
+		if c.lru.Len() > c.size {
+			oldest := c.lru.Back()
+			c.lru.Remove(oldest)
+			delete(c.entries, oldest.Value.(*btcPrevTxEntry).hash)
+		}
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		tx, err := c.fetch(&hash)
+		if err != nil {
+			entry.err = err
+			c.remove(entry)
+			return
+		}
+		entry.tx = tx.MsgTx()
+	})
+	return entry.tx, entry.err
+}
+
+// remove removes entry unless it was already evicted.
+func (c *btcPrevTxCache) remove(entry *btcPrevTxEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.hash]; ok && el.Value == entry {
+		c.lru.Remove(el)
+		delete(c.entries, entry.hash)
+	}
+}
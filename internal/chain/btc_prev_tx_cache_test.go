@@ -0,0 +1,88 @@
+package chain
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBtcPrevTxCache(t *testing.T) {
+	prevTxs := map[chainhash.Hash]*btcutil.Tx{}
+	hashes := []chainhash.Hash{}
+	for i := range 3 {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxOut(wire.NewTxOut(int64(i+1), nil))
+		prevTxs[tx.TxHash()] = btcutil.NewTx(tx)
+		hashes = append(hashes, tx.TxHash())
+	}
+
+	var callsMu sync.Mutex
+	calls := map[chainhash.Hash]int{}
+	fail := false
+	c := newBtcPrevTxCache(2, func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		callsMu.Lock()
+		defer callsMu.Unlock()
+		calls[*hash]++
+		if fail {
+			return nil, assert.AnError
+		}
+		return prevTxs[*hash], nil
+	})
+
+	// Two inputs spending the same previous tx concurrently
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx, err := c.get(hashes[0])
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), tx.TxOut[0].Value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls[hashes[0]])
+
+	// hashes[1] is evicted as the least recently used one
+	c.get(hashes[1])
+	c.get(hashes[0])
+	c.get(hashes[2])
+	c.get(hashes[0])
+	c.get(hashes[1])
+	assert.Equal(t, map[chainhash.Hash]int{hashes[0]: 1, hashes[1]: 2, hashes[2]: 1}, calls)
+
+	// Failures are not cached
+	fail = true
+	_, err := c.get(hashes[0])
+	assert.NoError(t, err, "cached tx is not fetched")
+	c = newBtcPrevTxCache(2, c.fetch)
+	_, err = c.get(hashes[0])
+	assert.ErrorIs(t, err, assert.AnError)
+	fail = false
+	_, err = c.get(hashes[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls[hashes[0]])
+}
+
+func TestBitcoinPrevTxCachedAcrossBlocks(t *testing.T) {
+	tracked := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 4, 2, []string{tracked})
+
+	calls := 0
+	b := NewBitcoinSubscriber("dummy", WithTxWorkers{Workers: 1})
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		calls++
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(tracked))
+
+	for range 2 {
+		events := make(chan *TrackedWalletEvent, len(block.Transactions))
+		assert.True(t, b.processBlock(100, block, events))
+	}
+	assert.Equal(t, 2, calls)
+}
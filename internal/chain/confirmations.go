@@ -0,0 +1,116 @@
+package chain
+
+import (
+	"sort"
+	"sync"
+)
+
+// confirmationGate delays events of user wallets which require more than one
+// confirmation until the block containing the transaction is deep enough.
+// Block containing the transaction counts as the first confirmation. Events
+// of other user wallets pass through.
+type confirmationGate struct {
+	// User wallet -> required confirmations
+	required map[userWallet]uint64
+	// Held events per chain, ordered by the block at which they are released
+	pending map[ChainName][]heldEvent
+	mu      sync.Mutex
+}
+
+type heldEvent struct {
+	releaseAt uint64
+	event     *TrackedWalletEvent
+}
+
+func newConfirmationGate() *confirmationGate {
+	return &confirmationGate{
+		required: make(map[userWallet]uint64),
+		pending:  make(map[ChainName][]heldEvent),
+	}
+}
+
+// set sets the confirmations required for events of the user wallet. 0 and 1
+// emit events as soon as their block is processed.
+func (g *confirmationGate) set(key userWallet, confirmations uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if confirmations <= 1 {
+		delete(g.required, key)
+		return
+	}
+	g.required[key] = confirmations
+}
+
+// get returns the confirmations required for events of the user wallet, 0 if
+// events are not delayed.
+func (g *confirmationGate) get(key userWallet) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.required[key]
+}
+
+// hold returns true if the event must wait for more confirmations. Held
+// events are returned by release. A held event with the same idempotency key,
+// e.g. of a transaction included again after a reorg, is replaced.
+func (g *confirmationGate) hold(event *TrackedWalletEvent) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	required := g.required[eventUserWallet(event)]
+	if required <= 1 {
+		return false
+	}
+
+	g.remove(event.ChainName, event.IdempotencyKey)
+	pending := g.pending[event.ChainName]
+	releaseAt := event.BlockNumber + required - 1
+	i := sort.Search(len(pending), func(i int) bool {
+		return pending[i].releaseAt > releaseAt
+	})
+	pending = append(pending, heldEvent{})
+	copy(pending[i+1:], pending[i:])
+	pending[i] = heldEvent{releaseAt: releaseAt, event: event}
+	g.pending[event.ChainName] = pending
+	return true
+}
+
+// release returns held events of the chain which have enough confirmations
+// once the block tip is processed.
+func (g *confirmationGate) release(chain ChainName, tip uint64) []*TrackedWalletEvent {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pending := g.pending[chain]
+	n := sort.Search(len(pending), func(i int) bool {
+		return pending[i].releaseAt > tip
+	})
+	if n == 0 {
+		return nil
+	}
+
+	released := make([]*TrackedWalletEvent, n)
+	for i, held := range pending[:n] {
+		released[i] = held.event
+	}
+	g.pending[chain] = pending[n:]
+	return released
+}
+
+// discard removes the held event of the chain with the idempotency key, e.g.
+// one orphaned by a reorg. It returns false if no such event is held.
+func (g *confirmationGate) discard(chain ChainName, key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.remove(chain, key)
+}
+
+// remove removes the held event of the chain with the idempotency key. It
+// must be called with mu held.
+func (g *confirmationGate) remove(chain ChainName, key string) bool {
+	pending := g.pending[chain]
+	for i, held := range pending {
+		if held.event.IdempotencyKey == key {
+			g.pending[chain] = append(pending[:i], pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmationGate(t *testing.T) {
+	g := newConfirmationGate()
+	a, b, c := userWallet{1, "a", Bitcoin}, userWallet{1, "b", Bitcoin}, userWallet{1, "c", Bitcoin}
+	g.set(a, 3)
+	g.set(b, 2)
+	g.set(c, 1)
+
+	event := func(wallet string, userID int, block uint64) *TrackedWalletEvent {
+		return &TrackedWalletEvent{
+			ChainName:      Bitcoin,
+			Wallet:         wallet,
+			UserID:         userID,
+			BlockNumber:    block,
+			IdempotencyKey: fmt.Sprintf("%s-%d", wallet, block),
+		}
+	}
+	a10, b10, c10, b11 := event("a", 1, 10), event("b", 1, 10), event("c", 1, 10), event("b", 1, 11)
+	assert.True(t, g.hold(a10))
+	assert.True(t, g.hold(b10))
+	assert.False(t, g.hold(c10))
+	assert.False(t, g.hold(event("unknown", 1, 10)))
+	// Settings are per user
+	assert.False(t, g.hold(event("a", 2, 10)))
+	assert.True(t, g.hold(b11))
+
+	assert.Empty(t, g.release(Bitcoin, 10))
+	// Held events are released per chain
+	assert.Empty(t, g.release(SolanaMainnet, 11))
+	assert.Equal(t, []*TrackedWalletEvent{b10}, g.release(Bitcoin, 11))
+	assert.Equal(t, []*TrackedWalletEvent{a10, b11}, g.release(Bitcoin, 12))
+	assert.Empty(t, g.release(Bitcoin, 13))
+
+	// Event with the key of a held one replaces it
+	assert.True(t, g.hold(a10))
+	a12 := *a10
+	a12.BlockNumber = 12
+	assert.True(t, g.hold(&a12))
+	assert.Empty(t, g.release(Bitcoin, 13))
+	assert.Equal(t, []*TrackedWalletEvent{&a12}, g.release(Bitcoin, 14))
+
+	assert.True(t, g.hold(a10))
+	assert.False(t, g.discard(Bitcoin, b10.IdempotencyKey))
+	assert.True(t, g.discard(Bitcoin, a10.IdempotencyKey))
+	assert.Empty(t, g.release(Bitcoin, 20))
+
+	// Cleared requirement
+	g.set(a, 0)
+	assert.False(t, g.hold(event("a", 1, 20)))
+}
+
+func TestSubscriberManagerUserConfirmations(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	signer := types.NewLondonSigner(params.MainnetChainConfig.ChainID)
+	fast := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	shared := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+
+	block := func(number int64, recipients ...common.Address) *types.Block {
+		txs := []*types.Transaction{}
+		for i, to := range recipients {
+			tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+				ChainID:   params.MainnetChainConfig.ChainID,
+				Nonce:     uint64(number*10) + uint64(i),
+				GasTipCap: big.NewInt(1),
+				GasFeeCap: big.NewInt(20),
+				Gas:       21000,
+				To:        &to,
+				Value:     big.NewInt(1),
+			})
+			assert.NoError(t, err)
+			txs = append(txs, tx)
+		}
+		return types.NewBlockWithHeader(&types.Header{
+			Number:  big.NewInt(number),
+			Time:    1730000000,
+			BaseFee: big.NewInt(10),
+		}).WithBody(types.Body{Transactions: txs})
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = e
+	// User 1 waits for 3 confirmations of the shared wallet, user 2 doesn't
+	assert.NoError(t, m.TrackUserWallet(1, fast.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(1, shared.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, shared.Hex(), EthereumMainnet))
+	assert.NoError(t, m.SetWalletConfirmations(1, fast.Hex(), EthereumMainnet, 1))
+	assert.NoError(t, m.SetWalletConfirmations(1, shared.Hex(), EthereumMainnet, 3))
+
+	// process returns wallets, users and blocks of events emitted for the
+	// block
+	process := func(b *types.Block) [][3]any {
+		out := make(chan *TrackedWalletEvent, 10)
+		assert.True(t, e.processBlock(b, out))
+		emitted := [][3]any{}
+		for _, event := range fanOut(m, e, takeEvents(out)) {
+			emitted = append(emitted, [3]any{event.Wallet, event.UserID, event.BlockNumber})
+		}
+		return emitted
+	}
+
+	assert.Equal(t, [][3]any{
+		{fast.Hex(), 1, uint64(21000000)},
+		{shared.Hex(), 2, uint64(21000000)},
+	}, process(block(21000000, fast, shared)))
+	assert.Equal(t, [][3]any{{fast.Hex(), 1, uint64(21000001)}}, process(block(21000001, fast)))
+	assert.Equal(t, [][3]any{{shared.Hex(), 1, uint64(21000000)}}, process(block(21000002)))
+	assert.Empty(t, process(block(21000003)))
+
+	// Untracking clears the requirement of the user only
+	assert.NoError(t, m.UntrackUserWallet(1, shared.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(1, shared.Hex(), EthereumMainnet))
+	assert.NoError(t, m.SetWalletConfirmations(2, shared.Hex(), EthereumMainnet, 2))
+	assert.Equal(t, [][3]any{{shared.Hex(), 1, uint64(21000004)}}, process(block(21000004, shared)))
+	assert.Equal(t, [][3]any{{shared.Hex(), 2, uint64(21000004)}}, process(block(21000005)))
+}
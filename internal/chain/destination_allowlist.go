@@ -0,0 +1,39 @@
+package chain
+
+// WithDestinationAllowlist only emits events of a chain whose destination is
+// one of its allowlisted addresses, e.g. deposit addresses of the consumer,
+// regardless of the tracked wallet. Chains without an allowlist are not
+// filtered.
+type WithDestinationAllowlist struct {
+	Destinations map[ChainName][]string
+}
+
+func (w WithDestinationAllowlist) Apply(m *mapSubManager) {
+	m.destinations = make(map[ChainName]map[string]bool, len(w.Destinations))
+	for chainName, destinations := range w.Destinations {
+		allowed := make(map[string]bool, len(destinations))
+		for _, destination := range destinations {
+			allowed[normalizedDestination(chainName, destination)] = true
+		}
+		m.destinations[chainName] = allowed
+	}
+}
+
+// allowsDestination reports whether the destination of the event is
+// allowlisted for its chain.
+func (m *mapSubManager) allowsDestination(event *TrackedWalletEvent) bool {
+	allowed, ok := m.destinations[event.ChainName]
+	if !ok {
+		return true
+	}
+	return allowed[normalizedDestination(event.ChainName, event.Destination)]
+}
+
+// normalizedDestination returns the canonical form of the destination, or
+// the destination itself if it is not a wallet of the chain.
+func normalizedDestination(chainName ChainName, destination string) string {
+	if normalized, err := NormalizeWallet(chainName, destination); err == nil {
+		return normalized
+	}
+	return destination
+}
@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriberManagerDestinationAllowlist(t *testing.T) {
+	allowed := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	m := NewSubsciberManager(WithDestinationAllowlist{Destinations: map[ChainName][]string{
+		// Matched regardless of the address case
+		EthereumMainnet: {"0xeea5b26b94e4e5ba416c9725e51ab755e2dde107"},
+	}})
+	eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	eth.destinations = []string{allowed, "0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97"}
+	assert.NoError(t, m.RegisterSubscribers(eth, sol))
+	defer m.Stop(context.Background())
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+
+	emitted := map[ChainName]int{}
+	for emitted[EthereumMainnet] < 3 || emitted[SolanaMainnet] < 3 {
+		select {
+		case event := <-sink:
+			// Chains without an allowlist are not filtered
+			if event.ChainName == EthereumMainnet {
+				assert.Equal(t, allowed, event.Destination)
+			}
+			emitted[event.ChainName]++
+		case <-time.After(time.Second):
+			t.Fatal("expected events of both chains")
+		}
+	}
+}
+
+func TestSubscriberManagerAllowsDestination(t *testing.T) {
+	m := NewSubsciberManager(WithDestinationAllowlist{Destinations: map[ChainName][]string{
+		Bitcoin: {"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},
+	}}).(*mapSubManager)
+
+	assert.True(t, m.allowsDestination(&TrackedWalletEvent{ChainName: Bitcoin, Destination: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}))
+	assert.False(t, m.allowsDestination(&TrackedWalletEvent{ChainName: Bitcoin, Destination: "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"}))
+	assert.False(t, m.allowsDestination(&TrackedWalletEvent{ChainName: Bitcoin}))
+	assert.True(t, m.allowsDestination(&TrackedWalletEvent{ChainName: SolanaMainnet, Destination: "any"}))
+
+	// Without the option every destination is allowed
+	m = NewSubsciberManager().(*mapSubManager)
+	assert.True(t, m.allowsDestination(&TrackedWalletEvent{ChainName: Bitcoin, Destination: "any"}))
+}
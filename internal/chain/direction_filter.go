@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DirectionBoth matches transfers of either direction. It is only used to
+// filter events, see ParseDirectionFilter.
+const DirectionBoth Direction = "both"
+
+// ParseDirectionFilter parses the direction of transfers emitted for a
+// wallet. Empty direction is DirectionBoth.
+func ParseDirectionFilter(direction string) (Direction, error) {
+	switch d := Direction(direction); d {
+	case "":
+		return DirectionBoth, nil
+	case DirectionIncoming, DirectionOutgoing, DirectionBoth:
+		return d, nil
+	}
+	return "", fmt.Errorf("unsupported direction %q", direction)
+}
+
+// directionFilter drops events of user wallets which only want transfers of
+// the other direction, e.g. deposits only. User wallets without a direction
+// receive both, as do events without a direction.
+type directionFilter struct {
+	// User wallet -> the only direction emitted
+	only map[userWallet]Direction
+	mu   sync.RWMutex
+}
+
+func newDirectionFilter() *directionFilter {
+	return &directionFilter{
+		only: make(map[userWallet]Direction),
+	}
+}
+
+// set sets the direction of transfer events of the user wallet. DirectionBoth
+// or empty direction clears it.
+func (f *directionFilter) set(key userWallet, direction Direction) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if direction == "" || direction == DirectionBoth {
+		delete(f.only, key)
+		return
+	}
+	f.only[key] = direction
+}
+
+// get returns the direction of transfer events of the user wallet.
+func (f *directionFilter) get(key userWallet) Direction {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if only, ok := f.only[key]; ok {
+		return only
+	}
+	return DirectionBoth
+}
+
+// allows reports whether the event is emitted for its user wallet.
+func (f *directionFilter) allows(event *TrackedWalletEvent) bool {
+	if event.direction == "" {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	only, ok := f.only[eventUserWallet(event)]
+	return !ok || only == event.direction
+}
@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectionFilter(t *testing.T) {
+	for input, want := range map[string]Direction{
+		"":         DirectionBoth,
+		"both":     DirectionBoth,
+		"incoming": DirectionIncoming,
+		"outgoing": DirectionOutgoing,
+	} {
+		direction, err := ParseDirectionFilter(input)
+		assert.NoError(t, err)
+		assert.Equal(t, want, direction)
+	}
+	_, err := ParseDirectionFilter("in")
+	assert.EqualError(t, err, `unsupported direction "in"`)
+}
+
+func TestDirectionFilter(t *testing.T) {
+	f := newDirectionFilter()
+	f.set(userWallet{1, "a", Bitcoin}, DirectionIncoming)
+	f.set(userWallet{1, "b", Bitcoin}, DirectionOutgoing)
+
+	event := func(wallet string, userID int, direction Direction) *TrackedWalletEvent {
+		return &TrackedWalletEvent{ChainName: Bitcoin, Wallet: wallet, UserID: userID, direction: direction}
+	}
+	assert.True(t, f.allows(event("a", 1, DirectionIncoming)))
+	assert.False(t, f.allows(event("a", 1, DirectionOutgoing)))
+	assert.False(t, f.allows(event("b", 1, DirectionIncoming)))
+	assert.True(t, f.allows(event("b", 1, DirectionOutgoing)))
+	assert.True(t, f.allows(event("c", 1, DirectionIncoming)))
+	assert.True(t, f.allows(event("c", 1, DirectionOutgoing)))
+	// Direction is set per user
+	assert.True(t, f.allows(event("a", 2, DirectionOutgoing)))
+	// Events without a direction pass
+	assert.True(t, f.allows(event("a", 1, "")))
+
+	f.set(userWallet{1, "a", Bitcoin}, DirectionBoth)
+	assert.True(t, f.allows(event("a", 1, DirectionOutgoing)))
+}
+
+// directionsOf returns directions of the events per wallet, closing the
+// channel.
+func directionsOf(events chan *TrackedWalletEvent) map[string]Direction {
+	close(events)
+	directions := map[string]Direction{}
+	for event := range events {
+		directions[event.Wallet] = event.direction
+	}
+	return directions
+}
+
+func TestSubscriberManagerUserDirection(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	signer := types.NewLondonSigner(params.MainnetChainConfig.ChainID)
+
+	block := func(number int64) *types.Block {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   params.MainnetChainConfig.ChainID,
+			Nonce:     uint64(number),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(20),
+			Gas:       21000,
+			To:        &recipient,
+			Value:     big.NewInt(1),
+		})
+		assert.NoError(t, err)
+		return types.NewBlockWithHeader(&types.Header{
+			Number:  big.NewInt(number),
+			Time:    1730000000,
+			BaseFee: big.NewInt(10),
+		}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+	}
+	// process returns wallets of events emitted for the block per user
+	process := func(m *mapSubManager, e *ethereumMainnetSubscriber, b *types.Block) map[int][]string {
+		out := make(chan *TrackedWalletEvent, 10)
+		assert.True(t, e.processBlock(b, out))
+		wallets := map[int][]string{}
+		for _, event := range fanOut(m, e, takeEvents(out)) {
+			wallets[event.UserID] = append(wallets[event.UserID], event.Wallet)
+		}
+		return wallets
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = e
+	for _, userID := range []int{1, 2} {
+		assert.NoError(t, m.TrackUserWallet(userID, sender.Hex(), EthereumMainnet))
+		assert.NoError(t, m.TrackUserWallet(userID, recipient.Hex(), EthereumMainnet))
+	}
+	both := []string{sender.Hex(), recipient.Hex()}
+	assert.Equal(t, map[int][]string{1: both, 2: both}, process(m, e, block(21000000)))
+
+	// Deposits only for user 1, user 2 keeps both directions
+	assert.NoError(t, m.SetWalletDirection(1, sender.Hex(), EthereumMainnet, DirectionIncoming))
+	assert.NoError(t, m.SetWalletDirection(1, recipient.Hex(), EthereumMainnet, DirectionIncoming))
+	assert.Equal(t, map[int][]string{1: {recipient.Hex()}, 2: both}, process(m, e, block(21000001)))
+
+	// Withdrawals only
+	assert.NoError(t, m.SetWalletDirection(1, sender.Hex(), EthereumMainnet, DirectionOutgoing))
+	assert.NoError(t, m.SetWalletDirection(1, recipient.Hex(), EthereumMainnet, DirectionOutgoing))
+	assert.Equal(t, map[int][]string{1: {sender.Hex()}, 2: both}, process(m, e, block(21000002)))
+
+	// Untracking clears the direction
+	assert.NoError(t, m.UntrackUserWallet(1, recipient.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(1, recipient.Hex(), EthereumMainnet))
+	assert.Equal(t, map[int][]string{1: both, 2: both}, process(m, e, block(21000003)))
+}
+
+func TestBitcoinEventDirections(t *testing.T) {
+	sender := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	recipient := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	block, prevTxs := btcTestBlock(t, 1, 1, []string{recipient})
+
+	b := NewBitcoinSubscriber("dummy")
+	b.getRawTransaction = func(hash *chainhash.Hash) (*btcutil.Tx, error) {
+		return prevTxs[*hash], nil
+	}
+	assert.NoError(t, b.TrackWallet(sender))
+	assert.NoError(t, b.TrackWallet(recipient))
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.True(t, b.processBlock(100, block, events))
+
+	// Incoming means the wallet owns an output, outgoing an input
+	assert.Equal(t, map[string]Direction{
+		sender:    DirectionOutgoing,
+		recipient: DirectionIncoming,
+	}, directionsOf(events))
+}
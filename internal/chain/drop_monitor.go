@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// dropMonitor counts events dropped per chain. When the number of drops within
+// a window reaches the configured threshold, onThreshold is called once for
+// that window.
+type dropMonitor struct {
+	threshold uint64
+	window    time.Duration
+
+	mu      sync.Mutex
+	total   map[ChainName]uint64
+	windows map[ChainName]*dropWindow
+
+	now         func() time.Time
+	onThreshold func(chain ChainName, drops uint64, window time.Duration)
+}
+
+type dropWindow struct {
+	start time.Time
+	drops uint64
+}
+
+func newDropMonitor(threshold uint64, window time.Duration) *dropMonitor {
+	return &dropMonitor{
+		threshold:   threshold,
+		window:      window,
+		total:       make(map[ChainName]uint64),
+		windows:     make(map[ChainName]*dropWindow),
+		now:         time.Now,
+		onThreshold: logDropThreshold,
+	}
+}
+
+// RecordDrop records a single dropped event of the given chain.
+func (d *dropMonitor) RecordDrop(chain ChainName) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.total[chain]++
+	if d.threshold == 0 {
+		return
+	}
+
+	now := d.now()
+	w, ok := d.windows[chain]
+	if !ok || now.Sub(w.start) > d.window {
+		w = &dropWindow{start: now}
+		d.windows[chain] = w
+	}
+	w.drops++
+	if w.drops == d.threshold {
+		d.onThreshold(chain, w.drops, d.window)
+	}
+}
+
+// Dropped returns total number of dropped events per chain.
+func (d *dropMonitor) Dropped() map[ChainName]uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(map[ChainName]uint64, len(d.total))
+	for chain, n := range d.total {
+		out[chain] = n
+	}
+	return out
+}
+
+func logDropThreshold(chain ChainName, drops uint64, window time.Duration) {
+	slog.Error("dropped events threshold exceeded",
+		slog.String("chain", string(chain)),
+		slog.Uint64("drops", drops),
+		slog.Duration("window", window),
+	)
+}
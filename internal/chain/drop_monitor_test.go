@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropMonitor(t *testing.T) {
+	now := time.Unix(1000, 0)
+	alerts := map[ChainName]int{}
+
+	d := newDropMonitor(3, time.Minute)
+	d.now = func() time.Time { return now }
+	d.onThreshold = func(chain ChainName, drops uint64, window time.Duration) {
+		alerts[chain]++
+	}
+
+	// Simulate overflow of solana events
+	for range 5 {
+		d.RecordDrop(SolanaMainnet)
+	}
+	d.RecordDrop(Bitcoin)
+
+	assert.Equal(t, map[ChainName]uint64{SolanaMainnet: 5, Bitcoin: 1}, d.Dropped())
+	// Alert fires once per window
+	assert.Equal(t, map[ChainName]int{SolanaMainnet: 1}, alerts)
+
+	// New window, threshold has to be reached again
+	now = now.Add(2 * time.Minute)
+	d.RecordDrop(SolanaMainnet)
+	d.RecordDrop(SolanaMainnet)
+	assert.Equal(t, 1, alerts[SolanaMainnet])
+	d.RecordDrop(SolanaMainnet)
+	assert.Equal(t, 2, alerts[SolanaMainnet])
+	assert.Equal(t, uint64(8), d.Dropped()[SolanaMainnet])
+}
+
+func TestDropMonitorNoThreshold(t *testing.T) {
+	d := newDropMonitor(0, time.Minute)
+	d.onThreshold = func(chain ChainName, drops uint64, window time.Duration) {
+		t.Fatal("threshold alert must be disabled")
+	}
+	for range 10 {
+		d.RecordDrop(EthereumMainnet)
+	}
+	assert.Equal(t, uint64(10), d.Dropped()[EthereumMainnet])
+}
@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrENSNameNotResolved is returned when an ENS name has no resolver or does
+// not resolve to an address.
+var ErrENSNameNotResolved = errors.New("ens name does not resolve to an address")
+
+// ensRegistry is the address of the ENS registry on ethereum mainnet
+var ensRegistry = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+var (
+	ensResolverSelector = crypto.Keccak256([]byte("resolver(bytes32)"))[:4]
+	ensAddrSelector     = crypto.Keccak256([]byte("addr(bytes32)"))[:4]
+)
+
+type callContractFn func(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+
+// IsENSName returns true if wallet looks like an ENS name, e.g. vitalik.eth,
+// rather than an ethereum address.
+func IsENSName(wallet string) bool {
+	return strings.Contains(wallet, ".") && !common.IsHexAddress(wallet)
+}
+
+// ensNamehash returns the namehash of name as defined in EIP-137. Names are
+// only lowercased, full ENSIP-15 normalization is not performed.
+func ensNamehash(name string) common.Hash {
+	node := common.Hash{}
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node[:], crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// resolveENSName looks up the resolver of name in the ENS registry and
+// returns the address the resolver reports for it.
+func resolveENSName(ctx context.Context, call callContractFn, name string) (common.Address, error) {
+	node := ensNamehash(name)
+
+	resolver, err := ensCallAddress(ctx, call, ensRegistry, ensResolverSelector, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to get resolver of %s: %w", name, err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s has no resolver", ErrENSNameNotResolved, name)
+	}
+
+	address, err := ensCallAddress(ctx, call, resolver, ensAddrSelector, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrENSNameNotResolved, name)
+	}
+	return address, nil
+}
+
+// ensCallAddress calls a method of contract accepting a single bytes32 node
+// and returning an address.
+func ensCallAddress(ctx context.Context, call callContractFn, contract common.Address, selector []byte, node common.Hash) (common.Address, error) {
+	data := append(append([]byte{}, selector...), node[:]...)
+	res, err := call(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(res) < 32 {
+		return common.Address{}, fmt.Errorf("unexpected result of %d bytes", len(res))
+	}
+	return common.BytesToAddress(res[12:32]), nil
+}
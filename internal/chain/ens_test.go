@@ -0,0 +1,130 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestENSNamehash(t *testing.T) {
+	// EIP-137 test vectors
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{name: "eth", want: "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"},
+		{name: "foo.eth", want: "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+		{name: "Foo.ETH", want: "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ensNamehash(tt.name).Hex())
+		})
+	}
+}
+
+func TestIsENSName(t *testing.T) {
+	assert.True(t, IsENSName("vitalik.eth"))
+	assert.True(t, IsENSName("pay.example.com"))
+	assert.False(t, IsENSName("0x9642b23Ed1E01Df1092B92641051881a322F5D4E"))
+	assert.False(t, IsENSName("vitalik"))
+	assert.False(t, IsENSName(""))
+}
+
+func TestResolveENSName(t *testing.T) {
+	resolver := common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	owner := common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+	node := ensNamehash("vitalik.eth")
+
+	// word returns address as an ABI encoded return value
+	word := func(a common.Address) []byte {
+		return common.LeftPadBytes(a.Bytes(), 32)
+	}
+
+	tests := []struct {
+		name          string
+		registryRes   []byte
+		registryErr   error
+		resolverRes   []byte
+		resolverErr   error
+		wantAddress   common.Address
+		wantErr       string
+		wantNotExists bool
+	}{
+		{
+			name:        "resolves",
+			registryRes: word(resolver),
+			resolverRes: word(owner),
+			wantAddress: owner,
+		},
+		{
+			name:          "no resolver",
+			registryRes:   word(common.Address{}),
+			wantErr:       "ens name does not resolve to an address: vitalik.eth has no resolver",
+			wantNotExists: true,
+		},
+		{
+			name:          "no address",
+			registryRes:   word(resolver),
+			resolverRes:   word(common.Address{}),
+			wantErr:       "ens name does not resolve to an address: vitalik.eth",
+			wantNotExists: true,
+		},
+		{
+			name:        "registry call fails",
+			registryErr: assert.AnError,
+			wantErr:     "failed to get resolver of vitalik.eth: " + assert.AnError.Error(),
+		},
+		{
+			name:        "resolver call fails",
+			registryRes: word(resolver),
+			resolverErr: assert.AnError,
+			wantErr:     "failed to resolve vitalik.eth: " + assert.AnError.Error(),
+		},
+		{
+			name:        "malformed result",
+			registryRes: []byte{0x01},
+			wantErr:     "failed to get resolver of vitalik.eth: unexpected result of 1 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEthereumMainnetSubscriber("http://dummy.net")
+			e.callContract = func(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+				assert.Equal(t, node[:], msg.Data[4:])
+				switch *msg.To {
+				case ensRegistry:
+					assert.True(t, bytes.Equal(ensResolverSelector, msg.Data[:4]))
+					return tt.registryRes, tt.registryErr
+				case resolver:
+					assert.True(t, bytes.Equal(ensAddrSelector, msg.Data[:4]))
+					return tt.resolverRes, tt.resolverErr
+				}
+				t.Fatalf("unexpected call to %s", msg.To)
+				return nil, nil
+			}
+
+			address, err := e.ResolveENSName(context.Background(), "vitalik.eth")
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Equal(t, tt.wantNotExists, errors.Is(err, ErrENSNameNotResolved))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAddress.String(), address)
+		})
+	}
+
+	t.Run("not initialized", func(t *testing.T) {
+		_, err := NewEthereumMainnetSubscriber("http://dummy.net").ResolveENSName(context.Background(), "vitalik.eth")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,93 @@
+package chain
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultErrorLogInterval is the interval within which identical errors are
+// logged only once.
+const defaultErrorLogInterval = time.Minute
+
+// errorLogLimiter collapses repeated identical error logs, e.g. when a provider
+// is down and every poll or header fails the same way. The first occurrence of
+// a message and error pair is logged with all its attributes. Further
+// occurrences within the interval are only counted and reported in a summary
+// once the interval elapses.
+type errorLogLimiter struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[errorLogKey]*errorLogEntry
+
+	now func() time.Time
+}
+
+type errorLogKey struct {
+	msg string
+	err string
+}
+
+type errorLogEntry struct {
+	logger     *slog.Logger
+	level      slog.Level
+	start      time.Time
+	suppressed uint64
+}
+
+func newErrorLogLimiter(interval time.Duration) *errorLogLimiter {
+	return &errorLogLimiter{
+		interval: interval,
+		entries:  make(map[errorLogKey]*errorLogEntry),
+		now:      time.Now,
+	}
+}
+
+// Log logs msg with err and attrs at level, unless the same msg and err were
+// already logged within the interval.
+func (l *errorLogLimiter) Log(logger *slog.Logger, level slog.Level, msg string, err error, attrs ...slog.Attr) {
+	if l == nil || l.interval <= 0 {
+		logger.LogAttrs(context.Background(), level, msg, append(attrs, slog.Any("error", err))...)
+		return
+	}
+
+	key := errorLogKey{msg: msg}
+	if err != nil {
+		key.err = err.Error()
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.flush(now)
+	if entry, ok := l.entries[key]; ok {
+		entry.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	l.entries[key] = &errorLogEntry{logger: logger, level: level, start: now}
+	l.mu.Unlock()
+
+	logger.LogAttrs(context.Background(), level, msg, append(attrs, slog.Any("error", err))...)
+}
+
+// flush reports suppressed occurrences of entries whose interval elapsed and
+// forgets them, so that the next occurrence is logged in full. It must be
+// called with mu held.
+func (l *errorLogLimiter) flush(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.start) < l.interval {
+			continue
+		}
+		delete(l.entries, key)
+		if entry.suppressed == 0 {
+			continue
+		}
+		entry.logger.LogAttrs(context.Background(), entry.level, key.msg+" (repeated)",
+			slog.String("error", key.err),
+			slog.Uint64("suppressed", entry.suppressed),
+			slog.Duration("interval", l.interval),
+		)
+	}
+}
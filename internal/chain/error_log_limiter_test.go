@@ -0,0 +1,117 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// logRecords decodes JSON records written by a logger of newTestLogger.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	records := []map[string]any{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		record := map[string]any{}
+		assert.NoError(t, json.Unmarshal(line, &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestErrorLogLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	logger, buf := newTestLogger()
+	l := newErrorLogLimiter(time.Minute)
+	l.now = func() time.Time { return now }
+
+	down := errors.New("connection refused")
+	for i := range 5 {
+		l.Log(logger, slog.LevelError, "failed to get block", down, slog.Int("block", i))
+	}
+	// Different errors and messages are logged separately
+	l.Log(logger, slog.LevelError, "failed to get block", errors.New("not found"))
+	l.Log(logger, slog.LevelWarn, "failed to resubscribe", down)
+
+	records := logRecords(t, buf)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "failed to get block", records[0]["msg"])
+		assert.Equal(t, "connection refused", records[0]["error"])
+		// Attributes of the first occurrence
+		assert.Equal(t, float64(0), records[0]["block"])
+		assert.Equal(t, "ERROR", records[0]["level"])
+		assert.Equal(t, "not found", records[1]["error"])
+		assert.Equal(t, "WARN", records[2]["level"])
+	}
+
+	// Summary of suppressed occurrences once the interval elapses, followed
+	// by the next occurrence in full
+	buf.Reset()
+	now = now.Add(time.Minute)
+	l.Log(logger, slog.LevelError, "failed to get block", down, slog.Int("block", 5))
+	records = logRecords(t, buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "failed to get block (repeated)", records[0]["msg"])
+		assert.Equal(t, "connection refused", records[0]["error"])
+		assert.Equal(t, float64(4), records[0]["suppressed"])
+		assert.Equal(t, "ERROR", records[0]["level"])
+		assert.Equal(t, "test-1", records[0]["instance"])
+		assert.Equal(t, "failed to get block", records[1]["msg"])
+		assert.Equal(t, float64(5), records[1]["block"])
+	}
+
+	// Entries without suppressed occurrences expire without a summary
+	buf.Reset()
+	now = now.Add(2 * time.Minute)
+	l.Log(logger, slog.LevelWarn, "failed to resubscribe", down)
+	records = logRecords(t, buf)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "failed to resubscribe", records[0]["msg"])
+	}
+	assert.Len(t, l.entries, 1)
+}
+
+func TestErrorLogLimiterDisabled(t *testing.T) {
+	logger, buf := newTestLogger()
+	for _, l := range []*errorLogLimiter{nil, newErrorLogLimiter(0)} {
+		buf.Reset()
+		for range 3 {
+			l.Log(logger, slog.LevelError, "failed to get block", errors.New("connection refused"))
+		}
+		assert.Len(t, logRecords(t, buf), 3)
+	}
+}
+
+func TestSolanaSubscriberCollapsesRepeatedErrors(t *testing.T) {
+	logger, buf := newTestLogger()
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url",
+		WithSolanaLogger{Logger: logger},
+		WithSlotFetchRetries{Retries: 0},
+	)
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	// Provider is down for every slot
+	out := make(chan *TrackedWalletEvent)
+	for slot := range uint64(10) {
+		s.fetchBlockWithRetries(slot, out)
+	}
+	assert.Equal(t, uint64(10), s.FailedSlots())
+
+	records := logRecords(t, buf)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "failed to fetch block, giving up", records[0]["msg"])
+		assert.Equal(t, float64(0), records[0]["slot"])
+		assert.Equal(t, string(SolanaMainnet), records[0]["chain"])
+	}
+}
@@ -5,31 +5,60 @@ import (
 	"fmt"
 	"log/slog"
 	"math/big"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func NewEthereumMainnetSubscriber(rpcUrl string, opts ...EthereumMainnetSubscriberOption) *ethereumMainnetSubscriber {
+	return NewEVMSubscriber(EthereumMainnet, rpcUrl, params.MainnetChainConfig, opts...)
+}
+
+// NewEVMSubscriber creates a subscriber of any EVM chain. chainConfig selects
+// the transaction signer and must match the chain id of the rpc node, see
+// EvmChainConfig for configs of supported chains.
+func NewEVMSubscriber(chainName ChainName, rpcUrl string, chainConfig *params.ChainConfig, opts ...EthereumMainnetSubscriberOption) *ethereumMainnetSubscriber {
+	ctx, cancel := context.WithCancel(context.Background())
 	e := &ethereumMainnetSubscriber{
 		rpcUrl:            rpcUrl,
+		logger:            slog.Default(),
+		name:              chainName,
+		chainConfig:       chainConfig,
+		resubscribeBase:   time.Second,
+		resubscribeMax:    time.Minute,
+		maxBackfillBlocks: 128,
 		registeredWallets: make(map[common.Address]bool),
+		walletRefs:        make(map[common.Address]int),
+		mutedWallets:      make(map[common.Address]bool),
+		errLogs:           newErrorLogLimiter(defaultErrorLogInterval),
+		ctx:               ctx,
+		cancel:            cancel,
 	}
 
 	for _, opt := range opts {
 		opt.Apply(e)
 	}
+	e.logger = e.logger.With(slog.String("chain", string(e.Name())))
 
 	return e
 }
 
 type subscribeNewHeadFn func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
 type blockByNumberFn func(ctx context.Context, number *big.Int) (*types.Block, error)
+type transactionReceiptFn func(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+type filterLogsFn func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
 
 var _ TransactionSubscriber = (*ethereumMainnetSubscriber)(nil)
 
@@ -37,17 +66,60 @@ type ethereumMainnetSubscriber struct {
 	rpcUrl string
 	// Options that will be applied to rpc client in Init
 	rpcClientOpts []rpc.ClientOption
+	logger        *slog.Logger
+	// Collapses repeated identical error logs
+	errLogs *errorLogLimiter
 
 	registeredWallets map[common.Address]bool
-	// registeredWallets mutex
+	// Number of TrackWallet calls not yet matched by UntrackWallet, a wallet
+	// stays registered until its last reference is released
+	walletRefs map[common.Address]int
+	// Tracked wallets whose events are suppressed
+	mutedWallets map[common.Address]bool
+	// registeredWallets, walletRefs and mutedWallets mutex
 	mu sync.RWMutex
-
-	c             *ethclient.Client
-	chainId       *big.Int
-	defaultSigner types.Signer
-
-	subscribeNewHead subscribeNewHeadFn
-	blockByNumber    blockByNumberFn
+	// Events of recently processed blocks. nil - events of orphaned blocks
+	// are not reverted.
+	emitted *emittedBlocks
+	// Hashes of recently processed blocks. nil - reorgs are only detected
+	// when a block of a processed height is replaced.
+	hashes *blockHashes
+
+	c       *ethclient.Client
+	chainId *big.Int
+	// Name of the subscribed EVM chain
+	name ChainName
+	// Used to select the signer matching fork rules of each processed block
+	chainConfig *params.ChainConfig
+
+	subscribeNewHead   subscribeNewHeadFn
+	blockByNumber      blockByNumberFn
+	transactionReceipt transactionReceiptFn
+	callContract       callContractFn
+	filterLogs         filterLogsFn
+
+	// Whether to emit EventContractCreation events
+	emitContractCreation bool
+	// Event topics of logs emitted as EventLog events. Empty - logs are not
+	// fetched.
+	logTopics []common.Hash
+
+	// Number of the last block whose transactions were processed
+	lastProcessedBlock atomic.Uint64
+	// Number of the latest received head, blocks behind it are historical
+	headBlock atomic.Uint64
+	// Maximum number of missed blocks processed before a new head. 0 - no
+	// limit.
+	maxBackfillBlocks uint64
+	// Exponential backoff bounds of resubscription after subscription errors
+	resubscribeBase time.Duration
+	resubscribeMax  time.Duration
+
+	// Cancelled when the subscriber is stopped. In-flight RPC calls of Start
+	// goroutines are cancelled as well.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
 }
 
 func (e *ethereumMainnetSubscriber) Init() error {
@@ -62,19 +134,18 @@ func (e *ethereumMainnetSubscriber) Init() error {
 	if err != nil {
 		return fmt.Errorf("failed to get chain id: %w", err)
 	}
-	e.chainId = chainId
-	block, err := e.c.BlockByNumber(context.Background(), nil)
-	if err != nil {
-		return fmt.Errorf("failed to get latest block: %w", err)
+	if chainId.Cmp(e.chainConfig.ChainID) != 0 {
+		return fmt.Errorf("rpc chain id %s does not match %s chain id %s", chainId, e.name, e.chainConfig.ChainID)
 	}
-
-	signer := types.MakeSigner(params.MainnetChainConfig, block.Number(), block.Time())
-	e.defaultSigner = signer
+	e.chainId = chainId
 
 	e.subscribeNewHead = e.c.SubscribeNewHead
 	e.blockByNumber = e.c.BlockByNumber
+	e.transactionReceipt = e.c.TransactionReceipt
+	e.callContract = e.c.CallContract
+	e.filterLogs = e.c.FilterLogs
 
-	slog.Info("initialized ethereum mainnet subscriber",
+	e.logger.Info("initialized ethereum mainnet subscriber",
 		slog.String("rpc_url", e.rpcUrl),
 	)
 
@@ -86,78 +157,72 @@ func (e *ethereumMainnetSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan
 	outErrors := make(chan error)
 
 	go func() {
+		defer close(outErrors)
+		defer close(outEvents)
 
 		h := make(chan *types.Header)
-		sub, err := e.subscribeNewHead(context.Background(), h)
+		sub, err := e.subscribeNewHead(e.ctx, h)
 		if err != nil {
-			outErrors <- fmt.Errorf("failed to subscribe to new head: %w", err)
+			send(outErrors, fmt.Errorf("failed to subscribe to new head: %w", err), e.ctx.Done())
 			return
 		}
+		defer func() {
+			// sub is replaced on resubscription
+			if sub != nil {
+				sub.Unsubscribe()
+			}
+		}()
 
 		for {
 			select {
+			case <-e.ctx.Done():
+				return
+
 			case err := <-sub.Err():
-				slog.Error("subscription error",
-					slog.Any("error", err),
-					slog.String("chain", string(e.Name())),
+				metrics.RPCErrors.Inc(string(e.Name()))
+				e.errLogs.Log(e.logger, slog.LevelWarn, "subscription error, resubscribing", err,
+					slog.Uint64("last_processed_block", e.lastProcessedBlock.Load()),
 				)
-				outErrors <- err
-
-				// TODO retry and recreate the sub
+				sub.Unsubscribe()
+
+				// Fresh channel so that no stale headers of the old
+				// subscription are received
+				h = make(chan *types.Header)
+				sub = e.resubscribe(h)
+				if sub == nil {
+					// Stopped while resubscribing
+					return
+				}
 
 			case newHead := <-h:
-				slog.Info("received new block headers",
+				e.headBlock.Store(newHead.Number.Uint64())
+				recordLag(e.logger, metrics.ChainHeadLagBlocks, e.Name(), newHead.Number.Uint64(), e.lastProcessedBlock.Load())
+				e.logger.Info("received new block headers",
 					slog.Any("block_number", newHead.Number.Uint64()),
 				)
 
-				block, err := e.blockByNumber(context.Background(), newHead.Number)
+				// Process blocks missed while disconnected before the
+				// new head. If the gap could not be processed, the head
+				// is left for the next one so that the gap is retried
+				// instead of being skipped.
+				if !e.backfill(newHead.Number.Uint64(), outEvents) {
+					if e.ctx.Err() != nil {
+						return
+					}
+					continue
+				}
+
+				block, err := e.fetchBlock(newHead.Number)
 				if err != nil {
-					slog.Error("failed to get block by number", slog.Any("error", err))
+					e.errLogs.Log(e.logger, slog.LevelError, "failed to get block by number", err,
+						slog.Uint64("block_number", newHead.Number.Uint64()),
+					)
 
 					// TODO send signal to retry, or inspect the error and
 					// decide what to do next.
 
-				} else {
-					for _, tx := range block.Transactions() {
-						to := tx.To()
-						hash := tx.Hash()
-						fees := big.NewInt(int64(tx.GasPrice().Uint64() * tx.Gas()))
-						amount := tx.Value()
-						wallet, err := types.Sender(
-							e.defaultSigner, tx,
-						)
-						if err != nil {
-							slog.Error("failed to recover public key",
-								slog.Any("error", err),
-								slog.String("tx_hash", hash.String()),
-							)
-							continue
-						}
-
-						// Check whether tx involves tracked wallets
-						e.mu.RLock()
-						_, okSender := e.registeredWallets[wallet]
-						okRecipient := false
-						if to != nil {
-							_, ok := e.registeredWallets[*to]
-							okRecipient = ok
-						}
-						e.mu.RUnlock()
-
-						if okSender || okRecipient {
-							outEvents <- &TrackedWalletEvent{
-								ChainName:   e.Name(),
-								Source:      wallet.String(),
-								Destination: to.String(),
-								Amount:      amount,
-								Fees:        fees,
-							}
-						}
-					}
-					slog.Info(
-						"processed a block",
-						slog.String("chain", string(e.Name())),
-					)
+				} else if !e.processCanonical(block, outEvents) {
+					return
 				}
 			}
 		}
@@ -166,7 +231,375 @@ func (e *ethereumMainnetSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan
 	return outEvents, outErrors
 }
 
+// resubscribe subscribes to new heads with exponential backoff until it
+// succeeds. It returns nil if the subscriber was stopped in the meantime.
+func (e *ethereumMainnetSubscriber) resubscribe(h chan *types.Header) ethereum.Subscription {
+	for attempt := 0; ; attempt++ {
+		delay := BackoffDelay(attempt, e.resubscribeBase, e.resubscribeMax)
+		select {
+		case <-e.ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		sub, err := e.subscribeNewHead(e.ctx, h)
+		if err == nil {
+			e.logger.Info("resubscribed to new heads",
+				slog.Int("attempt", attempt+1),
+			)
+			return sub
+		}
+		metrics.RPCErrors.Inc(string(e.Name()))
+		e.errLogs.Log(e.logger, slog.LevelWarn, "failed to resubscribe to new heads", err,
+			slog.Int("attempt", attempt+1),
+		)
+	}
+}
+
+// backfill processes blocks between the last processed block and head,
+// excluding head. At most maxBackfillBlocks most recent blocks are processed.
+// It stops at the first block which fails to be fetched, so the remaining gap
+// is backfilled again with the next head. It returns false if the gap was not
+// processed completely or the subscriber was stopped.
+func (e *ethereumMainnetSubscriber) backfill(head uint64, outEvents chan<- *TrackedWalletEvent) bool {
+	last := e.lastProcessedBlock.Load()
+	if last == 0 || head <= last+1 {
+		return true
+	}
+
+	from := last + 1
+	if e.maxBackfillBlocks > 0 && head-from > e.maxBackfillBlocks {
+		from = head - e.maxBackfillBlocks
+		e.logger.Warn("backfill gap exceeds the limit, skipping older blocks",
+			slog.Uint64("last_processed_block", last),
+			slog.Uint64("from_block", from),
+			slog.Uint64("max_backfill_blocks", e.maxBackfillBlocks),
+		)
+	}
+
+	for number := from; number < head; number++ {
+		block, err := e.fetchBlock(new(big.Int).SetUint64(number))
+		if err != nil {
+			e.errLogs.Log(e.logger, slog.LevelError, "failed to backfill block", err,
+				slog.Uint64("block_number", number),
+			)
+			return false
+		}
+		if !e.processCanonical(block, outEvents) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchBlock fetches the block by number and records the duration of the call.
+// A block which is not found is reported as ethereum.NotFound.
+func (e *ethereumMainnetSubscriber) fetchBlock(number *big.Int) (*types.Block, error) {
+	start := time.Now()
+	block, err := e.blockByNumber(e.ctx, number)
+	if err == nil && block == nil {
+		err = ethereum.NotFound
+	}
+	if err != nil {
+		metrics.RPCErrors.Inc(string(e.Name()))
+		return nil, err
+	}
+	metrics.BlockFetchDuration.Observe(string(e.Name()), time.Since(start).Seconds())
+	return block, nil
+}
+
+// processBlock emits events for all transactions in the block which involve
+// tracked wallets. It returns false if the subscriber was stopped.
+func (e *ethereumMainnetSubscriber) processBlock(block *types.Block, outEvents chan<- *TrackedWalletEvent) bool {
+	start := time.Now()
+	// Transactions must be recovered with the signer of the fork the block
+	// belongs to
+	signer := types.MakeSigner(e.chainConfig, block.Number(), block.Time())
+	// Blocks behind the latest head are backfilled
+	historical := block.NumberU64() < e.headBlock.Load()
+	emit := func(event *TrackedWalletEvent) bool {
+		event.Historical = historical
+		if e.emitted != nil {
+			e.emitted.record(event)
+		}
+		return send(outEvents, event, e.ctx.Done())
+	}
+	// Blocks replaced by this one are rolled back before its own events
+	for _, event := range e.revertOrphaned(block) {
+		if !send(outEvents, event, e.ctx.Done()) {
+			return false
+		}
+	}
+	for i, tx := range block.Transactions() {
+		to := tx.To()
+		hash := tx.Hash()
+		fees := new(big.Int).Mul(
+			effectiveGasPrice(tx, block.BaseFee()),
+			new(big.Int).SetUint64(tx.Gas()),
+		)
+		amount := tx.Value()
+		wallet, err := types.Sender(
+			signer, tx,
+		)
+		if err != nil {
+			e.logger.Error("failed to recover public key",
+				slog.Any("error", err),
+				slog.String("tx_hash", hash.String()),
+			)
+			continue
+		}
+
+		// Check whether tx involves tracked wallets
+		e.mu.RLock()
+		okSender := e.registeredWallets[wallet] && !e.mutedWallets[wallet]
+		okRecipient := false
+		if to != nil {
+			okRecipient = e.registeredWallets[*to] && !e.mutedWallets[*to]
+		}
+		e.mu.RUnlock()
+
+		if !okSender && !okRecipient {
+			continue
+		}
+
+		// Contract creation transactions have no recipient, use the
+		// address of the created contract instead.
+		destination := ""
+		if to != nil {
+			destination = to.String()
+		} else {
+			destination = crypto.CreateAddress(wallet, tx.Nonce()).String()
+		}
+		// An event per matched tracked wallet, self transfers are
+		// reported as outgoing only
+		type match struct {
+			wallet    string
+			direction Direction
+		}
+		matches := []match{}
+		if okSender {
+			matches = append(matches, match{wallet.String(), DirectionOutgoing})
+		}
+		if okRecipient && *to != wallet {
+			matches = append(matches, match{to.String(), DirectionIncoming})
+		}
+		for _, m := range matches {
+			event := &TrackedWalletEvent{
+				ChainName:      e.Name(),
+				TxHash:         hash.String(),
+				Wallet:         m.wallet,
+				Source:         wallet.String(),
+				Destination:    destination,
+				Amount:         new(big.Int).Set(amount),
+				Fees:           new(big.Int).Set(fees),
+				IdempotencyKey: idempotencyKey(e.Name(), hash.String(), m.wallet, m.direction, NativeAssetID),
+				BlockNumber:    block.NumberU64(),
+				TxIndex:        uint64(i),
+				BlockTime:      time.Unix(int64(block.Time()), 0).UTC(),
+				ObservedAt:     time.Now().UTC(),
+				direction:      m.direction,
+			}
+			if !emit(event) {
+				return false
+			}
+
+			if e.emitContractCreation && to == nil && m.direction == DirectionOutgoing {
+				creation := e.contractCreationEvent(event, tx, destination)
+				if creation != nil && !emit(creation) {
+					return false
+				}
+			}
+		}
+	}
+	for _, event := range e.logEvents(block) {
+		event.Historical = historical
+		if !emit(event) {
+			return false
+		}
+	}
+	if e.hashes != nil {
+		e.hashes.add(block.NumberU64(), block.Hash())
+	}
+	e.lastProcessedBlock.Store(block.NumberU64())
+	metrics.TxsProcessed.Add(string(e.Name()), float64(len(block.Transactions())))
+	metrics.TxProcessingDuration.Observe(string(e.Name()), time.Since(start).Seconds())
+	metrics.BlocksProcessed.Inc(string(e.Name()))
+
+	e.logger.Info(
+		"processed a block",
+	)
+	return true
+}
+
+// revertOrphaned returns EventReverted events of events emitted from blocks
+// orphaned by the block, unless the block includes their transactions as
+// well.
+func (e *ethereumMainnetSubscriber) revertOrphaned(block *types.Block) []*TrackedWalletEvent {
+	if e.emitted == nil {
+		return nil
+	}
+	orphaned := e.emitted.add(block.NumberU64(), block.Hash())
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	included := make(map[string]bool)
+	for _, tx := range block.Transactions() {
+		included[tx.Hash().String()] = true
+	}
+	reverted := []*TrackedWalletEvent{}
+	for _, b := range orphaned {
+		e.logger.Warn("block orphaned by reorg",
+			slog.Uint64("block_number", b.number),
+			slog.String("orphaned_hash", b.hash.String()),
+			slog.String("block_hash", block.Hash().String()),
+		)
+		for _, event := range b.events {
+			if included[event.TxHash] {
+				continue
+			}
+			reverted = append(reverted, revertedEvent(event))
+		}
+	}
+	return reverted
+}
+
+// ResolveENSName returns the checksummed address the ENS name currently
+// resolves to. Errors of names without an address wrap
+// ErrENSNameNotResolved.
+func (e *ethereumMainnetSubscriber) ResolveENSName(ctx context.Context, name string) (string, error) {
+	if e.callContract == nil {
+		return "", fmt.Errorf("ethereum subscriber is not initialized")
+	}
+	address, err := resolveENSName(ctx, e.callContract, name)
+	if err != nil {
+		return "", err
+	}
+	return address.String(), nil
+}
+
+// contractCreationEvent returns EventContractCreation event of the contract
+// creation transaction tx, whose transfer event is transfer. The contract
+// address is taken from the receipt, falling back to computed address if the
+// receipt is unavailable. It returns nil if the deployment failed.
+func (e *ethereumMainnetSubscriber) contractCreationEvent(transfer *TrackedWalletEvent, tx *types.Transaction, computed string) *TrackedWalletEvent {
+	contract := computed
+	receipt, err := e.transactionReceipt(e.ctx, tx.Hash())
+	switch {
+	case err != nil:
+		e.logger.Warn("failed to get contract creation receipt, using computed address",
+			slog.String("tx_hash", transfer.TxHash),
+			slog.Any("error", err),
+		)
+	case receipt.Status != types.ReceiptStatusSuccessful:
+		return nil
+	default:
+		contract = receipt.ContractAddress.String()
+	}
+
+	return &TrackedWalletEvent{
+		Type:           EventContractCreation,
+		ChainName:      transfer.ChainName,
+		TxHash:         transfer.TxHash,
+		Wallet:         transfer.Wallet,
+		Source:         transfer.Source,
+		Destination:    contract,
+		IdempotencyKey: idempotencyKey(transfer.ChainName, transfer.TxHash, transfer.Wallet, "", string(EventContractCreation)),
+		BlockNumber:    transfer.BlockNumber,
+		TxIndex:        transfer.TxIndex,
+		BlockTime:      transfer.BlockTime,
+		ObservedAt:     transfer.ObservedAt,
+		direction:      transfer.direction,
+	}
+}
+
+// logEvents returns EventLog events of logs of the block with one of the
+// configured topics, which were emitted by a tracked contract or have a
+// tracked address among their indexed topics. A log involving several tracked
+// wallets results in an event per wallet.
+func (e *ethereumMainnetSubscriber) logEvents(block *types.Block) []*TrackedWalletEvent {
+	if len(e.logTopics) == 0 {
+		return nil
+	}
+
+	hash := block.Hash()
+	logs, err := e.filterLogs(e.ctx, ethereum.FilterQuery{
+		BlockHash: &hash,
+		Topics:    [][]common.Hash{e.logTopics},
+	})
+	if err != nil {
+		metrics.RPCErrors.Inc(string(e.Name()))
+		e.errLogs.Log(e.logger, slog.LevelError, "failed to get block logs", err,
+			slog.Uint64("block_number", block.NumberU64()),
+		)
+		return nil
+	}
+
+	events := []*TrackedWalletEvent{}
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		for _, wallet := range e.logWallets(&log) {
+			events = append(events, &TrackedWalletEvent{
+				Type:           EventLog,
+				ChainName:      e.Name(),
+				TxHash:         log.TxHash.String(),
+				Wallet:         wallet.String(),
+				Source:         log.Address.String(),
+				IdempotencyKey: idempotencyKey(e.Name(), log.TxHash.String(), wallet.String(), "", fmt.Sprintf("%s:%d", EventLog, log.Index)),
+				BlockNumber:    block.NumberU64(),
+				TxIndex:        uint64(log.TxIndex),
+				BlockTime:      time.Unix(int64(block.Time()), 0).UTC(),
+				ObservedAt:     time.Now().UTC(),
+				Log:            newEventLogData(&log),
+			})
+		}
+	}
+	return events
+}
+
+// logWallets returns tracked and not muted wallets involved in the log, i.e.
+// the emitting contract and addresses of indexed topics, in order of
+// appearance.
+func (e *ethereumMainnetSubscriber) logWallets(log *types.Log) []common.Address {
+	candidates := []common.Address{log.Address}
+	// The first topic is the event signature
+	for _, topic := range log.Topics[min(1, len(log.Topics)):] {
+		// Indexed addresses are left padded to 32 bytes
+		if common.BytesToAddress(topic[:12]) != (common.Address{}) {
+			continue
+		}
+		candidates = append(candidates, common.BytesToAddress(topic[12:]))
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	wallets := []common.Address{}
+	for _, address := range candidates {
+		if e.registeredWallets[address] && !e.mutedWallets[address] && !slices.Contains(wallets, address) {
+			wallets = append(wallets, address)
+		}
+	}
+	return wallets
+}
+
+func newEventLogData(log *types.Log) *EventLogData {
+	topics := make([]string, len(log.Topics))
+	for i, topic := range log.Topics {
+		topics[i] = topic.String()
+	}
+	return &EventLogData{
+		Index:  log.Index,
+		Topics: topics,
+		Data:   hexutil.Encode(log.Data),
+	}
+}
+
 func (e *ethereumMainnetSubscriber) TrackWallet(wallet string) error {
+	if e.registeredWallets == nil {
+		return ErrSubscriberNotInitialized
+	}
 	address, err := validateEvmWallet(wallet)
 	if err != nil {
 		return err
@@ -175,6 +608,7 @@ func (e *ethereumMainnetSubscriber) TrackWallet(wallet string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.registeredWallets[address] = true
+	e.walletRefs[address]++
 
 	return nil
 }
@@ -187,13 +621,100 @@ func (e *ethereumMainnetSubscriber) UntrackWallet(wallet string) error {
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if e.walletRefs[address] == 0 {
+		return ErrWalletNotTracked
+	}
+	if e.walletRefs[address] > 1 {
+		// Still tracked for other references
+		e.walletRefs[address]--
+		return nil
+	}
 	delete(e.registeredWallets, address)
+	delete(e.walletRefs, address)
+	delete(e.mutedWallets, address)
+
+	return nil
+}
+
+func (e *ethereumMainnetSubscriber) MuteWallet(wallet string) error {
+	address, err := validateEvmWallet(wallet)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.registeredWallets[address] {
+		return ErrWalletNotTracked
+	}
+	e.mutedWallets[address] = true
 
 	return nil
 }
 
+func (e *ethereumMainnetSubscriber) UnmuteWallet(wallet string) error {
+	address, err := validateEvmWallet(wallet)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.mutedWallets, address)
+
+	return nil
+}
+
+func (e *ethereumMainnetSubscriber) WalletMuted(wallet string) (bool, error) {
+	address, err := validateEvmWallet(wallet)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.walletRefs[address] == 0 {
+		return false, ErrWalletNotTracked
+	}
+	return e.mutedWallets[address], nil
+}
+
+func (e *ethereumMainnetSubscriber) TrackedWallets() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	wallets := make([]string, 0, len(e.registeredWallets))
+	for address := range e.registeredWallets {
+		wallets = append(wallets, address.String())
+	}
+	slices.Sort(wallets)
+	return wallets
+}
+
 func (e *ethereumMainnetSubscriber) Name() ChainName {
-	return EthereumMainnet
+	return e.name
+}
+
+func (e *ethereumMainnetSubscriber) ChainTip() (uint64, error) {
+	tip := e.headBlock.Load()
+	if tip == 0 {
+		return 0, ErrChainTipUnknown
+	}
+	return tip, nil
+}
+
+func (e *ethereumMainnetSubscriber) LastProcessedBlock() uint64 {
+	return e.lastProcessedBlock.Load()
+}
+
+func (e *ethereumMainnetSubscriber) Stop() error {
+	e.stopOnce.Do(func() {
+		e.cancel()
+		if e.c != nil {
+			e.c.Close()
+		}
+	})
+	return nil
 }
 
 type EthereumMainnetSubscriberOption interface {
@@ -208,6 +729,168 @@ func (w WithRpcClientOptions) Apply(e *ethereumMainnetSubscriber) {
 	e.rpcClientOpts = w.Opts
 }
 
+// effectiveGasPrice returns the price per gas paid by the transaction. For
+// dynamic fee transactions it is min(maxFeePerGas, baseFee +
+// maxPriorityFeePerGas), for legacy and access list transactions it is the gas
+// price. baseFee is nil for pre London blocks.
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		// Fee cap below base fee can't be included in a valid block
+		return tx.GasFeeCap()
+	}
+	return tip.Add(tip, baseFee)
+}
+
+// WithResubscribeBackoff sets exponential backoff bounds used when
+// resubscribing to new heads after a subscription error.
+type WithResubscribeBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (w WithResubscribeBackoff) Apply(e *ethereumMainnetSubscriber) {
+	if w.Base > 0 {
+		e.resubscribeBase = w.Base
+	}
+	if w.Max > 0 {
+		e.resubscribeMax = w.Max
+	}
+}
+
+// WithMaxBackfillBlocks limits the number of missed blocks processed after
+// the subscriber falls behind, e.g. after reconnecting. 0 - no limit.
+type WithMaxBackfillBlocks struct {
+	Blocks uint64
+}
+
+func (w WithMaxBackfillBlocks) Apply(e *ethereumMainnetSubscriber) {
+	e.maxBackfillBlocks = w.Blocks
+}
+
+// WithContractCreationEvents enables EventContractCreation events of
+// contracts deployed by tracked wallets. Self-destructs are not reported, as
+// they are only visible in execution traces.
+type WithContractCreationEvents struct {
+	Enabled bool
+}
+
+func (w WithContractCreationEvents) Apply(e *ethereumMainnetSubscriber) {
+	e.emitContractCreation = w.Enabled
+}
+
+// WithRevertedEvents enables EventReverted events of transactions orphaned by
+// reorgs. Events emitted from the last Blocks processed blocks are
+// remembered. A reorg is detected when a block replaces one of them at the
+// same or lower height.
+type WithRevertedEvents struct {
+	Enabled bool
+	Blocks  int
+}
+
+func (w WithRevertedEvents) Apply(e *ethereumMainnetSubscriber) {
+	e.emitted = nil
+	if w.Enabled {
+		e.emitted = newEmittedBlocks(w.Blocks)
+	}
+}
+
+// WithReorgDepth enables detection of reorgs by parent hashes of new blocks.
+// Once a block doesn't descend from the processed block before it, canonical
+// blocks are fetched back to the common ancestor, at most Blocks deep, and
+// processed again. Combined with WithRevertedEvents, events of the replaced
+// blocks are reverted. 0 - disabled.
+type WithReorgDepth struct {
+	Blocks uint64
+}
+
+func (w WithReorgDepth) Apply(e *ethereumMainnetSubscriber) {
+	e.hashes = nil
+	if w.Blocks > 0 {
+		e.hashes = newBlockHashes(w.Blocks)
+	}
+}
+
+// WithLogTopics enables EventLog events of logs with any of the topics, e.g.
+// event signature hashes of contract events, which involve tracked wallets. A
+// log involves a wallet if the wallet emitted it or is one of its indexed
+// topics. Logs are fetched with an additional eth_getLogs call per block.
+type WithLogTopics struct {
+	Topics []common.Hash
+}
+
+func (w WithLogTopics) Apply(e *ethereumMainnetSubscriber) {
+	e.logTopics = w.Topics
+}
+
+// ParseLogTopics parses a comma separated list of 32 byte hex topics.
+func ParseLogTopics(list string) ([]common.Hash, error) {
+	topics := []common.Hash{}
+	for _, topic := range strings.Split(list, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		b, err := hexutil.Decode(topic)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid log topic %q", topic)
+		}
+		topics = append(topics, common.BytesToHash(b))
+	}
+	return topics, nil
+}
+
+// WithEthereumLogger sets the logger of the subscriber, e.g. one with instance
+// attributes attached. The chain attribute is added by the subscriber.
+// Default is slog.Default().
+type WithEthereumLogger struct {
+	Logger *slog.Logger
+}
+
+func (w WithEthereumLogger) Apply(e *ethereumMainnetSubscriber) {
+	if w.Logger != nil {
+		e.logger = w.Logger
+	}
+}
+
+// evmChains are the EVM chains supported by the ethereum subscriber.
+// Arbitrum is not supported, its system transaction types can't be decoded.
+var evmChains = map[ChainName]*params.ChainConfig{
+	EthereumMainnet: params.MainnetChainConfig,
+	EthereumSepolia: params.SepoliaChainConfig,
+	EthereumHolesky: params.HoleskyChainConfig,
+	PolygonMainnet:  sidechainConfig(137),
+	BscMainnet:      sidechainConfig(56),
+}
+
+// sidechainConfig returns a config of an EVM chain outside of go-ethereum
+// params. Only transaction signer selection depends on it, so every signer
+// relevant fork is active from genesis and typed transactions are accepted in
+// blocks of any height.
+func sidechainConfig(chainID int64) *params.ChainConfig {
+	return &params.ChainConfig{
+		ChainID:        big.NewInt(chainID),
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(0),
+		EIP155Block:    big.NewInt(0),
+		EIP158Block:    big.NewInt(0),
+		BerlinBlock:    big.NewInt(0),
+		LondonBlock:    big.NewInt(0),
+	}
+}
+
+// EvmChainConfig returns the chain config of a supported EVM chain.
+func EvmChainConfig(name ChainName) (*params.ChainConfig, error) {
+	config, ok := evmChains[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported evm chain %q", name)
+	}
+	return config, nil
+}
+
 func validateEvmWallet(wallet string) (common.Address, error) {
 	if !common.IsHexAddress(wallet) {
 		return common.Address{}, fmt.Errorf("invalid ethereum wallet address")
@@ -1,9 +1,14 @@
 package chain
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
 	"math/big"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/stretchr/testify/assert"
 )
@@ -23,6 +29,7 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 		wantEvents       []*TrackedWalletEvent
 		wantErrs         []error
 		trackWallets     []string
+		muteWallets      []string
 	}{
 		{
 			name: "failed sub",
@@ -42,7 +49,7 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 			subscribeNewHead: func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
 				go func() {
 					ch <- &types.Header{
-						Number: big.NewInt(500),
+						Number: big.NewInt(21000000),
 					}
 				}()
 
@@ -60,7 +67,8 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 
 				block := types.NewBlockWithHeader(
 					&types.Header{
-						Number: big.NewInt(500),
+						Number: big.NewInt(21000000),
+						Time:   1730000000,
 					},
 				)
 				block = block.WithBody(types.Body{
@@ -89,10 +97,22 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 			wantEvents: []*TrackedWalletEvent{
 				{
 					ChainName:   EthereumMainnet,
+					TxHash:      "0x5bf0d5650d4df9e308a8ce1b3be8757746c532f7f111d3529e98ba74b873ea06",
+					Wallet:      "0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
 					Source:      "0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
 					Destination: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
 					Amount:      big.NewInt(19220000000000000),
 					Fees:        big.NewInt(371211417100000),
+					IdempotencyKey: idempotencyKey(
+						EthereumMainnet,
+						"0x5bf0d5650d4df9e308a8ce1b3be8757746c532f7f111d3529e98ba74b873ea06",
+						"0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+						DirectionOutgoing,
+						NativeAssetID,
+					),
+					BlockNumber: 21000000,
+					BlockTime:   time.Unix(1730000000, 0).UTC(),
+					direction:   DirectionOutgoing,
 				},
 			},
 			wantErrs: []error{},
@@ -105,7 +125,7 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 			subscribeNewHead: func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
 				go func() {
 					ch <- &types.Header{
-						Number: big.NewInt(500),
+						Number: big.NewInt(21000000),
 					}
 				}()
 
@@ -123,7 +143,8 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 
 				block := types.NewBlockWithHeader(
 					&types.Header{
-						Number: big.NewInt(500),
+						Number: big.NewInt(21000000),
+						Time:   1730000000,
 					},
 				)
 				block = block.WithBody(types.Body{
@@ -155,6 +176,65 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 				"0xA642b23Ed1E01Df1092B92641051881a322F5D4E",
 			},
 		},
+		{
+			name: "gets headers, correctly does not process event for muted wallet",
+			subscribeNewHead: func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+				go func() {
+					ch <- &types.Header{
+						Number: big.NewInt(21000000),
+					}
+				}()
+
+				sub := &go_ethereuem_mocks.MockGoEthereumSubscription{}
+				sub.EXPECT().Err().Return(
+					make(<-chan error),
+				)
+
+				return sub, nil
+			},
+			blockByNumberFn: func(ctx context.Context, number *big.Int) (*types.Block, error) {
+
+				R, _ := big.NewInt(0).SetString("41381143044471666193394495856779718433748443387095402661844025890319923186141", 10)
+				S, _ := big.NewInt(0).SetString("51098266734372285490093418638008504503442167242690029592223759640366292416179", 10)
+
+				block := types.NewBlockWithHeader(
+					&types.Header{
+						Number: big.NewInt(21000000),
+						Time:   1730000000,
+					},
+				)
+				block = block.WithBody(types.Body{
+					Transactions: []*types.Transaction{
+						// TX hash: "0x5bf0d5650d4df9e308a8ce1b3be8757746c532f7f111d3529e98ba74b873ea06"
+						// FROM: 0x9642b23Ed1E01Df1092B92641051881a322F5D4E
+						// TO: 0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107
+						types.NewTx(&types.LegacyTx{
+							Nonce:    257664,
+							GasPrice: big.NewInt(7424228342),
+							Gas:      50000,
+							To: (func() *common.Address {
+								a := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+								return &a
+							})(),
+							Value: big.NewInt(19220000000000000),
+							Data:  []byte{},
+							V:     big.NewInt(38),
+							R:     R,
+							S:     S,
+						}),
+					},
+				})
+				return block, nil
+			},
+			wantEvents: []*TrackedWalletEvent{},
+			wantErrs:   []error{},
+			trackWallets: []string{
+				"0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+			},
+			muteWallets: []string{
+				"0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -165,7 +245,6 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 			// Manual init
 			e.subscribeNewHead = tt.subscribeNewHead
 			e.blockByNumber = tt.blockByNumberFn
-			e.defaultSigner = types.NewCancunSigner(params.MainnetChainConfig.ChainID)
 			e.chainId = params.MainnetChainConfig.ChainID
 
 			events, errs := e.Start()
@@ -179,6 +258,10 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 					assert.NoError(t, err)
 				}
 			}
+			for _, wallet := range tt.muteWallets {
+				err := e.MuteWallet(wallet)
+				assert.NoError(t, err)
+			}
 
 			done := make(chan struct{})
 			go func() {
@@ -206,10 +289,20 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 			}()
 			<-done
 
+			for _, e := range gotEvents {
+				assert.False(t, e.ObservedAt.IsZero())
+				assert.False(t, e.ObservedAt.Before(e.BlockTime))
+				// Wall clock dependent
+				e.ObservedAt = time.Time{}
+			}
+
 			if len(tt.wantEvents) > 0 {
 				assert.Len(t, gotErrors, 0)
 				assert.Equal(t, tt.wantEvents, gotEvents)
 			}
+			if tt.wantEvents != nil && len(tt.wantEvents) == 0 {
+				assert.Len(t, gotEvents, 0)
+			}
 			if len(tt.wantErrs) > 0 {
 				assert.Equal(t, tt.wantErrs, gotErrors)
 			}
@@ -217,3 +310,988 @@ func TestEthereumMainnetSubscriberStart(t *testing.T) {
 		})
 	}
 }
+
+func TestEthereumMainnetSubscriberSignerAcrossForks(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	chainID := params.MainnetChainConfig.ChainID
+
+	// Block before Berlin/London forks with EIP-155 legacy transaction
+	preLondonNumber := big.NewInt(12000000)
+	legacyTx, err := types.SignNewTx(key, types.NewEIP155Signer(chainID), &types.LegacyTx{
+		Nonce:    1,
+		GasPrice: big.NewInt(1000),
+		Gas:      21000,
+		To:       &to,
+		Value:    big.NewInt(10),
+	})
+	assert.NoError(t, err)
+
+	// Block after London fork with dynamic fee transaction
+	postLondonNumber := big.NewInt(13000000)
+	dynamicTx, err := types.SignNewTx(key, types.NewLondonSigner(chainID), &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     2,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2000),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(20),
+	})
+	assert.NoError(t, err)
+
+	// Signer of the pre London block can't recover dynamic fee transactions
+	_, err = types.Sender(types.MakeSigner(params.MainnetChainConfig, preLondonNumber, 0), dynamicTx)
+	assert.Error(t, err)
+
+	blocks := map[uint64]*types.Block{
+		preLondonNumber.Uint64(): types.NewBlockWithHeader(&types.Header{
+			Number: preLondonNumber,
+		}).WithBody(types.Body{Transactions: []*types.Transaction{legacyTx}}),
+		postLondonNumber.Uint64(): types.NewBlockWithHeader(&types.Header{
+			Number: postLondonNumber,
+			Time:   1650000000,
+		}).WithBody(types.Body{Transactions: []*types.Transaction{dynamicTx}}),
+	}
+
+	events := collectEthereumEvents(t, []*types.Block{
+		blocks[preLondonNumber.Uint64()],
+		blocks[postLondonNumber.Uint64()],
+	}, []string{sender.Hex()}, 2)
+	for _, event := range events {
+		assert.Equal(t, sender.String(), event.Source)
+	}
+	assert.Equal(t, big.NewInt(10), events[0].Amount)
+	assert.Equal(t, big.NewInt(20), events[1].Amount)
+}
+
+// collectEthereumEvents feeds blocks to a started subscriber via new heads and
+// returns the first n emitted events.
+func collectEthereumEvents(t *testing.T, blocks []*types.Block, trackWallets []string, n int) []*TrackedWalletEvent {
+	t.Helper()
+
+	byNumber := map[uint64]*types.Block{}
+	for _, b := range blocks {
+		byNumber[b.NumberU64()] = b
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		go func() {
+			for _, b := range blocks {
+				ch <- b.Header()
+			}
+		}()
+		sub := &go_ethereuem_mocks.MockGoEthereumSubscription{}
+		sub.EXPECT().Err().Return(make(<-chan error))
+		return sub, nil
+	}
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		if b, ok := byNumber[number.Uint64()]; ok {
+			return b, nil
+		}
+		// Blocks between the given ones are backfilled as empty
+		return types.NewBlockWithHeader(&types.Header{Number: number}), nil
+	}
+	for _, w := range trackWallets {
+		assert.NoError(t, e.TrackWallet(w))
+	}
+
+	out, _ := e.Start()
+	events := []*TrackedWalletEvent{}
+	for range n {
+		select {
+		case event := <-out:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d events, got %d", n, len(events))
+		}
+	}
+	return events
+}
+
+func TestEthereumMainnetSubscriberFeesDoNotOverflow(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+
+	gasPrice, _ := new(big.Int).SetString("1000000000000000000", 10)
+	gas := uint64(30000000)
+	tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+		Nonce:    1,
+		GasPrice: gasPrice,
+		Gas:      gas,
+		To:       &to,
+		Value:    big.NewInt(1),
+	})
+	assert.NoError(t, err)
+
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+	events := collectEthereumEvents(t, []*types.Block{block}, []string{sender.Hex()}, 1)
+
+	want := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	assert.Equal(t, 1, want.Cmp(big.NewInt(math.MaxInt64)))
+	assert.Equal(t, want, events[0].Fees)
+}
+
+func TestEthereumMainnetSubscriberEffectiveGasPrice(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	chainID := params.MainnetChainConfig.ChainID
+	signer := types.NewCancunSigner(chainID)
+	baseFee := big.NewInt(1000)
+	gas := uint64(21000)
+
+	tests := []struct {
+		name     string
+		tx       types.TxData
+		wantFees *big.Int
+	}{
+		{
+			name: "legacy",
+			tx: &types.LegacyTx{
+				GasPrice: big.NewInt(1500),
+				Gas:      gas,
+				To:       &to,
+				Value:    big.NewInt(1),
+			},
+			wantFees: big.NewInt(1500 * 21000),
+		},
+		{
+			name: "access list",
+			tx: &types.AccessListTx{
+				ChainID:  chainID,
+				GasPrice: big.NewInt(1200),
+				Gas:      gas,
+				To:       &to,
+				Value:    big.NewInt(1),
+			},
+			wantFees: big.NewInt(1200 * 21000),
+		},
+		{
+			name: "dynamic fee - base fee plus tip",
+			tx: &types.DynamicFeeTx{
+				ChainID:   chainID,
+				GasTipCap: big.NewInt(100),
+				GasFeeCap: big.NewInt(2000),
+				Gas:       gas,
+				To:        &to,
+				Value:     big.NewInt(1),
+			},
+			wantFees: big.NewInt(1100 * 21000),
+		},
+		{
+			name: "dynamic fee - capped by max fee",
+			tx: &types.DynamicFeeTx{
+				ChainID:   chainID,
+				GasTipCap: big.NewInt(500),
+				GasFeeCap: big.NewInt(1200),
+				Gas:       gas,
+				To:        &to,
+				Value:     big.NewInt(1),
+			},
+			wantFees: big.NewInt(1200 * 21000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := types.SignNewTx(key, signer, tt.tx)
+			assert.NoError(t, err)
+			block := types.NewBlockWithHeader(&types.Header{
+				Number:  big.NewInt(21000000),
+				Time:    1730000000,
+				BaseFee: baseFee,
+			}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+			events := collectEthereumEvents(t, []*types.Block{block}, []string{sender.Hex()}, 1)
+			assert.Equal(t, tt.wantFees, events[0].Fees)
+		})
+	}
+}
+
+func TestEthereumMainnetSubscriberContractCreation(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	tx, err := types.SignNewTx(key, types.NewLondonSigner(params.MainnetChainConfig.ChainID), &types.DynamicFeeTx{
+		ChainID:   params.MainnetChainConfig.ChainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2000),
+		Gas:       100000,
+		To:        nil,
+		Value:     big.NewInt(0),
+		Data:      []byte{0x60, 0x80, 0x60, 0x40},
+	})
+	assert.NoError(t, err)
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+	events := collectEthereumEvents(t, []*types.Block{block}, []string{sender.Hex()}, 1)
+	assert.Equal(t, sender.String(), events[0].Source)
+	assert.Equal(t, crypto.CreateAddress(sender, 7).String(), events[0].Destination)
+}
+
+func TestEthereumMainnetSubscriberContractCreationEvents(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	computed := crypto.CreateAddress(sender, 7)
+	fromReceipt := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	tx, err := types.SignNewTx(key, types.NewLondonSigner(params.MainnetChainConfig.ChainID), &types.DynamicFeeTx{
+		ChainID:   params.MainnetChainConfig.ChainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2000),
+		Gas:       100000,
+		To:        nil,
+		Value:     big.NewInt(5),
+		Data:      []byte{0x60, 0x80, 0x60, 0x40},
+	})
+	assert.NoError(t, err)
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+	tests := []struct {
+		name            string
+		enabled         bool
+		receipt         *types.Receipt
+		receiptErr      error
+		wantDestination string
+	}{
+		{
+			name:    "disabled",
+			enabled: false,
+			receipt: &types.Receipt{Status: types.ReceiptStatusSuccessful, ContractAddress: fromReceipt},
+		},
+		{
+			name:            "contract address from receipt",
+			enabled:         true,
+			receipt:         &types.Receipt{Status: types.ReceiptStatusSuccessful, ContractAddress: fromReceipt},
+			wantDestination: fromReceipt.String(),
+		},
+		{
+			name:    "failed deployment",
+			enabled: true,
+			receipt: &types.Receipt{Status: types.ReceiptStatusFailed},
+		},
+		{
+			name:            "computed address without receipt",
+			enabled:         true,
+			receiptErr:      assert.AnError,
+			wantDestination: computed.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEthereumMainnetSubscriber("http://dummy.net", WithContractCreationEvents{Enabled: tt.enabled})
+			e.transactionReceipt = func(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+				assert.Equal(t, tx.Hash(), hash)
+				return tt.receipt, tt.receiptErr
+			}
+			assert.NoError(t, e.TrackWallet(sender.Hex()))
+
+			out := make(chan *TrackedWalletEvent, 10)
+			assert.True(t, e.processBlock(block, out))
+			close(out)
+			events := []*TrackedWalletEvent{}
+			for event := range out {
+				events = append(events, event)
+			}
+
+			// Transfer event is emitted regardless
+			assert.Equal(t, EventType(""), events[0].Type)
+			assert.Equal(t, computed.String(), events[0].Destination)
+			assert.Equal(t, big.NewInt(5), events[0].Amount)
+			if tt.wantDestination == "" {
+				assert.Len(t, events, 1)
+				return
+			}
+
+			assert.Len(t, events, 2)
+			creation := events[1]
+			assert.Equal(t, EventContractCreation, creation.Type)
+			assert.Equal(t, sender.String(), creation.Wallet)
+			assert.Equal(t, sender.String(), creation.Source)
+			assert.Equal(t, tt.wantDestination, creation.Destination)
+			assert.Equal(t, tx.Hash().String(), creation.TxHash)
+			assert.Equal(t, uint64(21000000), creation.BlockNumber)
+			assert.Nil(t, creation.Amount)
+			assert.NotEqual(t, events[0].IdempotencyKey, creation.IdempotencyKey)
+		})
+	}
+}
+
+func TestEthereumMainnetSubscriberTxIndex(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	tracked := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	txs := []*types.Transaction{}
+	for i, to := range []common.Address{tracked, other, tracked} {
+		tx, err := types.SignNewTx(key, types.NewLondonSigner(params.MainnetChainConfig.ChainID), &types.DynamicFeeTx{
+			ChainID:   params.MainnetChainConfig.ChainID,
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(2000),
+			Gas:       21000,
+			To:        &to,
+			Value:     big.NewInt(1),
+		})
+		assert.NoError(t, err)
+		txs = append(txs, tx)
+	}
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: txs})
+
+	events := collectEthereumEvents(t, []*types.Block{block}, []string{tracked.Hex()}, 2)
+	assert.Equal(t, txs[0].Hash().String(), events[0].TxHash)
+	assert.Equal(t, uint64(0), events[0].TxIndex)
+	assert.Equal(t, txs[2].Hash().String(), events[1].TxHash)
+	assert.Equal(t, uint64(2), events[1].TxIndex)
+}
+
+func TestEthereumMainnetSubscriberResubscribes(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+		GasPrice: big.NewInt(1),
+		Gas:      21000,
+		To:       &to,
+		Value:    big.NewInt(1),
+	})
+	assert.NoError(t, err)
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+	// First subscription fails once, second one delivers a header
+	subErrs := make(chan error, 1)
+	subErrs <- assert.AnError
+	firstSub := go_ethereuem_mocks.NewMockGoEthereumSubscription(t)
+	firstSub.EXPECT().Err().Return(subErrs)
+	firstSub.EXPECT().Unsubscribe().Return().Once()
+	secondSub := go_ethereuem_mocks.NewMockGoEthereumSubscription(t)
+	secondSub.EXPECT().Err().Return(make(<-chan error)).Maybe()
+	secondSub.EXPECT().Unsubscribe().Return().Maybe()
+
+	subscribeCalls := 0
+	var firstCh chan<- *types.Header
+	e := NewEthereumMainnetSubscriber(
+		"http://dummy.net",
+		WithResubscribeBackoff{Base: time.Millisecond, Max: 10 * time.Millisecond},
+	)
+	e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		subscribeCalls++
+		switch subscribeCalls {
+		case 1:
+			firstCh = ch
+			return firstSub, nil
+		case 2:
+			// Transient failure while resubscribing
+			return nil, assert.AnError
+		default:
+			assert.NotEqual(t, firstCh, ch, "header channel must be recreated")
+			assert.Equal(t, 3, subscribeCalls)
+			go func() { ch <- block.Header() }()
+			return secondSub, nil
+		}
+	}
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		return block, nil
+	}
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+
+	events, errs := e.Start()
+	select {
+	case event := <-events:
+		assert.Equal(t, sender.String(), event.Source)
+	case err := <-errs:
+		t.Fatalf("transient subscription error must not be propagated: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("processing did not resume after resubscription")
+	}
+	assert.Eventually(t, func() bool {
+		return e.lastProcessedBlock.Load() == 21000000
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, e.Stop())
+}
+
+func TestEthereumMainnetSubscriberBackfill(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+
+	// Every block contains a single transaction whose value is the block
+	// number
+	blocks := map[uint64]*types.Block{}
+	for n := uint64(21000000); n <= 21000010; n++ {
+		tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+			Nonce:    n,
+			GasPrice: big.NewInt(1),
+			Gas:      21000,
+			To:       &to,
+			Value:    new(big.Int).SetUint64(n),
+		})
+		assert.NoError(t, err)
+		blocks[n] = types.NewBlockWithHeader(&types.Header{
+			Number: new(big.Int).SetUint64(n),
+			Time:   1730000000 + n,
+		}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+	}
+
+	tests := []struct {
+		name      string
+		maxBlocks uint64
+		heads     []uint64
+		// Blocks whose first fetch fails
+		failOnce map[uint64]bool
+		want     []uint64
+	}{
+		{
+			name:  "gap between heads is backfilled",
+			heads: []uint64{21000000, 21000004, 21000005},
+			want:  []uint64{21000000, 21000001, 21000002, 21000003, 21000004, 21000005},
+		},
+		{
+			name:      "backfill is limited to the most recent blocks",
+			maxBlocks: 2,
+			heads:     []uint64{21000000, 21000010},
+			want:      []uint64{21000000, 21000008, 21000009, 21000010},
+		},
+		{
+			name:      "no limit",
+			maxBlocks: 0,
+			heads:     []uint64{21000000, 21000003},
+			want:      []uint64{21000000, 21000001, 21000002, 21000003},
+		},
+		{
+			name:     "failed backfill is retried with the next head",
+			heads:    []uint64{21000000, 21000003, 21000004},
+			failOnce: map[uint64]bool{21000001: true},
+			want:     []uint64{21000000, 21000001, 21000002, 21000003, 21000004},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEthereumMainnetSubscriber(
+				"http://dummy.net",
+				WithMaxBackfillBlocks{Blocks: tt.maxBlocks},
+			)
+			e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+				go func() {
+					for _, n := range tt.heads {
+						ch <- blocks[n].Header()
+					}
+				}()
+				sub := &go_ethereuem_mocks.MockGoEthereumSubscription{}
+				sub.EXPECT().Err().Return(make(<-chan error))
+				sub.EXPECT().Unsubscribe().Return()
+				return sub, nil
+			}
+			fetched := map[uint64]int{}
+			var mu sync.Mutex
+			e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				fetched[number.Uint64()]++
+				if tt.failOnce[number.Uint64()] && fetched[number.Uint64()] == 1 {
+					return nil, assert.AnError
+				}
+				return blocks[number.Uint64()], nil
+			}
+			assert.NoError(t, e.TrackWallet(sender.Hex()))
+
+			out, _ := e.Start()
+			got := []uint64{}
+			for range tt.want {
+				select {
+				case event := <-out:
+					got = append(got, event.Amount.Uint64())
+				case <-time.After(time.Second):
+					t.Fatalf("expected %d events, got %d", len(tt.want), len(got))
+				}
+			}
+			assert.Equal(t, tt.want, got)
+
+			// No further events
+			select {
+			case event := <-out:
+				t.Fatalf("unexpected event of block %d", event.Amount.Uint64())
+			case <-time.After(20 * time.Millisecond):
+			}
+			assert.NoError(t, e.Stop())
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, n := range tt.want {
+				want := 1
+				if tt.failOnce[n] {
+					want = 2
+				}
+				assert.Equal(t, want, fetched[n], "block %d must be fetched %d times", n, want)
+			}
+			assert.Len(t, fetched, len(tt.want))
+		})
+	}
+}
+
+func TestEthereumChainTip(t *testing.T) {
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	_, err := e.ChainTip()
+	assert.ErrorIs(t, err, ErrChainTipUnknown)
+
+	heads := make(chan uint64)
+	e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		go func() {
+			for number := range heads {
+				ch <- &types.Header{Number: new(big.Int).SetUint64(number)}
+			}
+		}()
+		sub := go_ethereuem_mocks.NewMockGoEthereumSubscription(t)
+		sub.EXPECT().Err().Return(make(<-chan error))
+		sub.EXPECT().Unsubscribe().Return().Maybe()
+		return sub, nil
+	}
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		return types.NewBlockWithHeader(&types.Header{Number: number}), nil
+	}
+
+	e.Start()
+	defer e.Stop()
+	tipIs := func(want uint64) func() bool {
+		return func() bool {
+			tip, err := e.ChainTip()
+			return err == nil && tip == want
+		}
+	}
+	heads <- 5
+	assert.Eventually(t, tipIs(5), time.Second, time.Millisecond)
+	heads <- 7
+	assert.Eventually(t, tipIs(7), time.Second, time.Millisecond)
+}
+
+func TestEthereumMainnetSubscriberStop(t *testing.T) {
+	sub := go_ethereuem_mocks.NewMockGoEthereumSubscription(t)
+	sub.EXPECT().Err().Return(make(<-chan error)).Maybe()
+	sub.EXPECT().Unsubscribe().Return().Once()
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	subscribed := make(chan context.Context, 1)
+	e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		subscribed <- ctx
+		return sub, nil
+	}
+
+	events, errs := e.Start()
+	ctx := <-subscribed
+	assert.NoError(t, e.Stop())
+	// Stop is idempotent
+	assert.NoError(t, e.Stop())
+
+	// In-flight RPC calls are cancelled
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "events channel must be closed")
+	case <-time.After(time.Second):
+		t.Fatal("events channel was not closed")
+	}
+	select {
+	case _, ok := <-errs:
+		assert.False(t, ok, "errors channel must be closed")
+	case <-time.After(time.Second):
+		t.Fatal("errors channel was not closed")
+	}
+}
+
+// newTestLogger returns a logger writing JSON records with an instance
+// attribute to the returned buffer.
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil)).With(slog.String("instance", "test-1"))
+	return logger, buf
+}
+
+// assertLogged asserts buf contains a record with msg logged by the
+// subscriber of chain through a logger created by newTestLogger.
+func assertLogged(t *testing.T, buf *bytes.Buffer, chain ChainName, msg string) {
+	t.Helper()
+	var record map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		assert.NoError(t, json.Unmarshal(line, &record))
+		if record["msg"] == msg {
+			assert.Equal(t, "test-1", record["instance"])
+			assert.Equal(t, string(chain), record["chain"])
+			return
+		}
+	}
+	t.Errorf("%q was not logged, got: %s", msg, buf.String())
+}
+
+func TestEthereumMainnetSubscriberLogger(t *testing.T) {
+	logger, buf := newTestLogger()
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithEthereumLogger{Logger: logger})
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	assert.True(t, e.processBlock(block, make(chan *TrackedWalletEvent)))
+	assertLogged(t, buf, EthereumMainnet, "processed a block")
+}
+
+func TestEthereumSubscriberEvmChain(t *testing.T) {
+	sepolia, err := EvmChainConfig(EthereumSepolia)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(11155111), sepolia.ChainID)
+	_, err = EvmChainConfig("ethereum_goerli")
+	assert.EqualError(t, err, `unsupported evm chain "ethereum_goerli"`)
+
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	tx, err := types.SignNewTx(key, types.NewLondonSigner(sepolia.ChainID), &types.DynamicFeeTx{
+		ChainID:   sepolia.ChainID,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2000),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(1),
+	})
+	assert.NoError(t, err)
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(7000000),
+		Time:   1730000000,
+	}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+
+	tests := []struct {
+		name       string
+		chain      ChainName
+		config     *params.ChainConfig
+		wantEvents int
+	}{
+		{
+			name:       "sepolia signer recovers sepolia transactions",
+			chain:      EthereumSepolia,
+			config:     sepolia,
+			wantEvents: 1,
+		},
+		{
+			name:   "mainnet signer rejects sepolia transactions",
+			chain:  EthereumMainnet,
+			config: params.MainnetChainConfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEVMSubscriber(tt.chain, "http://dummy.net", tt.config)
+			assert.Equal(t, tt.chain, e.Name())
+			assert.NoError(t, e.TrackWallet(sender.Hex()))
+
+			events := make(chan *TrackedWalletEvent, 1)
+			assert.True(t, e.processBlock(block, events))
+			close(events)
+			assert.Len(t, events, tt.wantEvents)
+			for event := range events {
+				assert.Equal(t, tt.chain, event.ChainName)
+				assert.Equal(t, sender.Hex(), event.Source)
+			}
+		})
+	}
+}
+
+func TestEthereumMainnetSubscriberHistoricalEvents(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	block := func(number int64) *types.Block {
+		tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+			Nonce:    uint64(number),
+			GasPrice: big.NewInt(1),
+			Gas:      21000,
+			To:       &to,
+			Value:    big.NewInt(1),
+		})
+		assert.NoError(t, err)
+		return types.NewBlockWithHeader(&types.Header{
+			Number: big.NewInt(number),
+			Time:   1730000000,
+		}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	e.headBlock.Store(21000000)
+
+	events := make(chan *TrackedWalletEvent, 2)
+	assert.Zero(t, e.LastProcessedBlock())
+	// Backfilled block behind the head
+	assert.True(t, e.processBlock(block(20999999), events))
+	// The head itself
+	assert.True(t, e.processBlock(block(21000000), events))
+	close(events)
+	assert.Equal(t, uint64(21000000), e.LastProcessedBlock())
+
+	assert.True(t, (<-events).Historical)
+	assert.False(t, (<-events).Historical)
+}
+
+func TestEthereumMainnetSubscriberLogEvents(t *testing.T) {
+	// ERC-20 Transfer(address,address,uint256)
+	transferTopic := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	approvalTopic := crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+	token := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	tracked := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	other := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	txHash := common.HexToHash("0x01")
+	block := types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(21000000),
+		Time:   1730000000,
+	})
+	logs := []types.Log{
+		{
+			// Tracked wallet receives tokens
+			Address: token,
+			Topics:  []common.Hash{transferTopic, common.BytesToHash(other.Bytes()), common.BytesToHash(tracked.Bytes())},
+			Data:    common.LeftPadBytes(big.NewInt(1000).Bytes(), 32),
+			TxHash:  txHash,
+			TxIndex: 3,
+			Index:   7,
+		},
+		{
+			// Not involving tracked wallets
+			Address: token,
+			Topics:  []common.Hash{transferTopic, common.BytesToHash(other.Bytes()), common.BytesToHash(other.Bytes())},
+			TxHash:  txHash,
+			Index:   8,
+		},
+		{
+			// Removed by a reorg
+			Address: token,
+			Topics:  []common.Hash{transferTopic, common.BytesToHash(tracked.Bytes()), common.BytesToHash(other.Bytes())},
+			TxHash:  txHash,
+			Index:   9,
+			Removed: true,
+		},
+	}
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithLogTopics{Topics: []common.Hash{transferTopic, approvalTopic}})
+	e.filterLogs = func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+		hash := block.Hash()
+		assert.Equal(t, &hash, q.BlockHash)
+		assert.Equal(t, [][]common.Hash{{transferTopic, approvalTopic}}, q.Topics)
+		return logs, nil
+	}
+	assert.NoError(t, e.TrackWallet(tracked.Hex()))
+
+	out := make(chan *TrackedWalletEvent, 10)
+	assert.True(t, e.processBlock(block, out))
+	close(out)
+	events := []*TrackedWalletEvent{}
+	for event := range out {
+		events = append(events, event)
+	}
+
+	if assert.Len(t, events, 1) {
+		event := events[0]
+		assert.NoError(t, event.Validate())
+		assert.Equal(t, EventLog, event.Type)
+		assert.Equal(t, tracked.String(), event.Wallet)
+		assert.Equal(t, token.String(), event.Source)
+		assert.Equal(t, txHash.String(), event.TxHash)
+		assert.Equal(t, uint64(21000000), event.BlockNumber)
+		assert.Equal(t, uint64(3), event.TxIndex)
+		assert.Equal(t, &EventLogData{
+			Index: 7,
+			Topics: []string{
+				transferTopic.String(),
+				common.BytesToHash(other.Bytes()).String(),
+				common.BytesToHash(tracked.Bytes()).String(),
+			},
+			Data: "0x00000000000000000000000000000000000000000000000000000000000003e8",
+		}, event.Log)
+	}
+
+	// Logs are not fetched without topics
+	e = NewEthereumMainnetSubscriber("http://dummy.net")
+	e.filterLogs = func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+		t.Fatal("logs fetched without topics")
+		return nil, nil
+	}
+	assert.NoError(t, e.TrackWallet(tracked.Hex()))
+	assert.True(t, e.processBlock(block, make(chan *TrackedWalletEvent)))
+}
+
+func TestEthereumMainnetSubscriberLogWallets(t *testing.T) {
+	tracked := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	muted := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	assert.NoError(t, e.TrackWallet(tracked.Hex()))
+	assert.NoError(t, e.TrackWallet(muted.Hex()))
+	assert.NoError(t, e.MuteWallet(muted.Hex()))
+
+	signature := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	tests := []struct {
+		name string
+		log  *types.Log
+		want []common.Address
+	}{
+		{
+			name: "emitted by tracked contract",
+			log:  &types.Log{Address: tracked, Topics: []common.Hash{signature}},
+			want: []common.Address{tracked},
+		},
+		{
+			name: "signature topic is not an address",
+			log:  &types.Log{Address: muted, Topics: []common.Hash{common.BytesToHash(tracked.Bytes())}},
+			want: []common.Address{},
+		},
+		{
+			name: "non address topic",
+			log:  &types.Log{Topics: []common.Hash{signature, common.HexToHash("0x0100000000000000000000009642b23ed1e01df1092b92641051881a322f5d4e")}},
+			want: []common.Address{},
+		},
+		{
+			name: "muted wallet and duplicates",
+			log:  &types.Log{Address: tracked, Topics: []common.Hash{signature, common.BytesToHash(muted.Bytes()), common.BytesToHash(tracked.Bytes())}},
+			want: []common.Address{tracked},
+		},
+		{
+			name: "no topics",
+			log:  &types.Log{Address: muted},
+			want: []common.Address{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, e.logWallets(tt.log))
+		})
+	}
+}
+
+func TestParseLogTopics(t *testing.T) {
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	topics, err := ParseLogTopics(" " + topic + ", ")
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Hash{common.HexToHash(topic)}, topics)
+
+	topics, err = ParseLogTopics("")
+	assert.NoError(t, err)
+	assert.Empty(t, topics)
+
+	_, err = ParseLogTopics("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	assert.EqualError(t, err, `invalid log topic "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"`)
+	_, err = ParseLogTopics("transfer")
+	assert.Error(t, err)
+}
+
+func TestEthereumMainnetSubscriberMatchedWallets(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	transfer := func(nonce uint64, to common.Address) *types.Transaction {
+		tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: big.NewInt(1),
+			Gas:      21000,
+			To:       &to,
+			Value:    big.NewInt(10),
+		})
+		assert.NoError(t, err)
+		return tx
+	}
+
+	tests := []struct {
+		name           string
+		tracked        []common.Address
+		to             common.Address
+		wantWallets    []string
+		wantDirections []Direction
+	}{
+		{
+			name:           "sender",
+			tracked:        []common.Address{sender},
+			to:             recipient,
+			wantWallets:    []string{sender.String()},
+			wantDirections: []Direction{DirectionOutgoing},
+		},
+		{
+			name:           "recipient",
+			tracked:        []common.Address{recipient},
+			to:             recipient,
+			wantWallets:    []string{recipient.String()},
+			wantDirections: []Direction{DirectionIncoming},
+		},
+		{
+			name:           "both sides",
+			tracked:        []common.Address{sender, recipient},
+			to:             recipient,
+			wantWallets:    []string{sender.String(), recipient.String()},
+			wantDirections: []Direction{DirectionOutgoing, DirectionIncoming},
+		},
+		{
+			name:           "self transfer",
+			tracked:        []common.Address{sender},
+			to:             sender,
+			wantWallets:    []string{sender.String()},
+			wantDirections: []Direction{DirectionOutgoing},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := transfer(1, tt.to)
+			block := types.NewBlockWithHeader(&types.Header{
+				Number: big.NewInt(21000000),
+				Time:   1730000000,
+			}).WithBody(types.Body{Transactions: []*types.Transaction{tx}})
+			e := NewEthereumMainnetSubscriber("http://dummy.net")
+			for _, w := range tt.tracked {
+				assert.NoError(t, e.TrackWallet(w.Hex()))
+			}
+
+			out := make(chan *TrackedWalletEvent, 10)
+			assert.True(t, e.processBlock(block, out))
+			close(out)
+			wallets := []string{}
+			for event := range out {
+				i := len(wallets)
+				wallets = append(wallets, event.Wallet)
+				assert.Equal(t, sender.String(), event.Source)
+				assert.Equal(t, tt.to.String(), event.Destination)
+				assert.Equal(t, big.NewInt(10), event.Amount)
+				if i < len(tt.wantDirections) {
+					assert.Equal(t, idempotencyKey(EthereumMainnet, tx.Hash().String(), event.Wallet, tt.wantDirections[i], NativeAssetID), event.IdempotencyKey)
+				}
+			}
+			assert.Equal(t, tt.wantWallets, wallets)
+		})
+	}
+}
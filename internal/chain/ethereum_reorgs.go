@@ -0,0 +1,100 @@
+package chain
+
+import (
+	"log/slog"
+	"math/big"
+	"sync"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockHashes remembers hashes of recently processed blocks by number, so
+// that blocks which don't descend from them reveal reorgs.
+type blockHashes struct {
+	depth  uint64
+	hashes map[uint64]common.Hash
+	mu     sync.Mutex
+}
+
+func newBlockHashes(depth uint64) *blockHashes {
+	return &blockHashes{
+		depth:  max(depth, 1),
+		hashes: make(map[uint64]common.Hash),
+	}
+}
+
+// add records the hash of the processed block. Hashes of higher blocks
+// belong to another fork and hashes older than depth blocks are forgotten.
+func (b *blockHashes) add(number uint64, hash common.Hash) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for n := range b.hashes {
+		if n > number || n+b.depth <= number {
+			delete(b.hashes, n)
+		}
+	}
+	b.hashes[number] = hash
+}
+
+// get returns the hash of the processed block of the number.
+func (b *blockHashes) get(number uint64) (common.Hash, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hash, ok := b.hashes[number]
+	return hash, ok
+}
+
+// processCanonical processes the block after the canonical blocks it descends
+// from, if they replaced processed blocks in a reorg. It returns false if the
+// subscriber was stopped.
+func (e *ethereumMainnetSubscriber) processCanonical(block *types.Block, outEvents chan<- *TrackedWalletEvent) bool {
+	if e.hashes == nil {
+		return e.processBlock(block, outEvents)
+	}
+
+	blocks := []*types.Block{block}
+	for e.forked(blocks[0]) {
+		number := blocks[0].NumberU64() - 1
+		if block.NumberU64()-number > e.hashes.depth {
+			e.logger.Warn("reorg is deeper than the reorg depth, skipping older blocks",
+				slog.Uint64("block_number", block.NumberU64()),
+				slog.Uint64("reorg_depth", e.hashes.depth),
+			)
+			break
+		}
+		parent, err := e.fetchBlock(new(big.Int).SetUint64(number))
+		if err != nil {
+			e.errLogs.Log(e.logger, slog.LevelError, "failed to get canonical block of reorg", err,
+				slog.Uint64("block_number", number),
+			)
+			break
+		}
+		blocks = append([]*types.Block{parent}, blocks...)
+	}
+	if len(blocks) > 1 {
+		metrics.Reorgs.Inc(string(e.Name()))
+		e.logger.Warn("reorg detected, reprocessing canonical blocks",
+			slog.Uint64("from_block", blocks[0].NumberU64()),
+			slog.Uint64("block_number", block.NumberU64()),
+		)
+	}
+
+	for _, b := range blocks {
+		if !e.processBlock(b, outEvents) {
+			return false
+		}
+	}
+	return true
+}
+
+// forked reports whether the parent of the block is not the processed block
+// of the same number.
+func (e *ethereumMainnetSubscriber) forked(block *types.Block) bool {
+	if block.NumberU64() == 0 {
+		return false
+	}
+	hash, ok := e.hashes.get(block.NumberU64() - 1)
+	return ok && hash != block.ParentHash()
+}
@@ -0,0 +1,167 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// childTestBlock returns a block following the parent, fork distinguishes
+// competing blocks of the same height.
+func childTestBlock(parent *types.Block, fork string, txs ...*types.Transaction) *types.Block {
+	return types.NewBlockWithHeader(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+		Time:       1730000000,
+		Extra:      []byte(fork),
+	}).WithBody(types.Body{Transactions: txs})
+}
+
+// blocksByNumber serves the blocks by their numbers.
+func blocksByNumber(blocks ...*types.Block) blockByNumberFn {
+	return func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		for _, block := range blocks {
+			if block.Number().Cmp(number) == 0 {
+				return block, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestEthereumReorgReprocessesCanonicalBlocks(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	tx1, tx2, tx3 := reorgTestTx(t, key, 1), reorgTestTx(t, key, 2), reorgTestTx(t, key, 3)
+
+	tests := []struct {
+		name    string
+		reverts bool
+		// Tx hashes of events after the reorg, reverted ones prefixed by -
+		want []string
+	}{
+		{
+			name: "reprocessed",
+			want: []string{tx3.Hash().String(), tx2.Hash().String()},
+		},
+		{
+			name:    "reverted and reprocessed",
+			reverts: true,
+			want: []string{
+				"-" + tx1.Hash().String(), "-" + tx2.Hash().String(),
+				tx3.Hash().String(), tx2.Hash().String(),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEthereumMainnetSubscriber("http://dummy.net",
+				WithReorgDepth{Blocks: 8},
+				WithRevertedEvents{Enabled: tt.reverts, Blocks: 8},
+			)
+			assert.NoError(t, e.TrackWallet(sender.Hex()))
+			out := make(chan *TrackedWalletEvent, 10)
+
+			ancestor := reorgTestBlock(21000100, "a")
+			a1 := childTestBlock(ancestor, "a", tx1)
+			a2 := childTestBlock(a1, "a", tx2)
+			for _, block := range []*types.Block{ancestor, a1, a2} {
+				assert.True(t, e.processCanonical(block, out))
+			}
+			assert.Len(t, takeEvents(out), 2)
+
+			// The new head is the first block seen of a fork replacing a1
+			// and a2
+			b1 := childTestBlock(ancestor, "b", tx3)
+			b2 := childTestBlock(b1, "b", tx2)
+			b3 := childTestBlock(b2, "b")
+			e.blockByNumber = blocksByNumber(ancestor, b1, b2, b3)
+			assert.True(t, e.processCanonical(b3, out))
+
+			got := []string{}
+			for _, event := range takeEvents(out) {
+				if event.Type == EventReverted {
+					got = append(got, "-"+event.TxHash)
+				} else {
+					got = append(got, event.TxHash)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, b3.NumberU64(), e.lastProcessedBlock.Load())
+
+			// The canonical chain continues without reprocessing
+			assert.True(t, e.processCanonical(childTestBlock(b3, "b"), out))
+			assert.Empty(t, takeEvents(out))
+		})
+	}
+}
+
+func TestEthereumReorgDepth(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithReorgDepth{Blocks: 2})
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	out := make(chan *TrackedWalletEvent, 10)
+
+	a := []*types.Block{reorgTestBlock(21000100, "a")}
+	b := []*types.Block{a[0]}
+	for i := 1; i <= 3; i++ {
+		a = append(a, childTestBlock(a[i-1], "a"))
+		b = append(b, childTestBlock(b[i-1], "b", reorgTestTx(t, key, uint64(i))))
+	}
+	for _, block := range a {
+		assert.True(t, e.processCanonical(block, out))
+	}
+	fetched := []uint64{}
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		fetched = append(fetched, number.Uint64())
+		return blocksByNumber(b...)(ctx, number)
+	}
+
+	// Only the last 2 blocks are reprocessed, b1 is beyond the depth
+	assert.True(t, e.processCanonical(b[3], out))
+	assert.Equal(t, []uint64{21000102}, fetched)
+	events := takeEvents(out)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, b[2].Transactions()[0].Hash().String(), events[0].TxHash)
+		assert.Equal(t, b[3].Transactions()[0].Hash().String(), events[1].TxHash)
+	}
+}
+
+func TestEthereumReorgDetectionDisabled(t *testing.T) {
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		t.Fatal("unexpected block fetch")
+		return nil, nil
+	}
+	out := make(chan *TrackedWalletEvent, 10)
+
+	ancestor := reorgTestBlock(21000100, "a")
+	assert.True(t, e.processCanonical(childTestBlock(ancestor, "a"), out))
+	assert.True(t, e.processCanonical(childTestBlock(childTestBlock(ancestor, "b"), "b"), out))
+}
+
+func TestBlockHashes(t *testing.T) {
+	b := newBlockHashes(2)
+	for number := uint64(1); number <= 3; number++ {
+		b.add(number, reorgTestBlock(int64(number), "a").Hash())
+	}
+	_, ok := b.get(1)
+	assert.False(t, ok)
+	_, ok = b.get(2)
+	assert.True(t, ok)
+
+	// Blocks above a replaced one belong to the old fork
+	b.add(2, reorgTestBlock(2, "b").Hash())
+	_, ok = b.get(3)
+	assert.False(t, ok)
+	hash, _ := b.get(2)
+	assert.Equal(t, reorgTestBlock(2, "b").Hash(), hash)
+}
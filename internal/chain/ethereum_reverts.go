@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EventReverted is emitted when the block of a previously emitted event is
+// orphaned by a reorg and the transaction is not part of the block replacing
+// it, so consumers can roll the event back. Reverts is the idempotency key of
+// the reverted event, other fields are copied from it. Only emitted by
+// ethereum when enabled, see WithRevertedEvents.
+const EventReverted EventType = "reverted"
+
+// emittedBlocks is a ring buffer of recently processed blocks and events
+// emitted from them.
+type emittedBlocks struct {
+	depth int
+	// Ordered by block number, the oldest first
+	blocks []*emittedBlock
+	mu     sync.Mutex
+}
+
+type emittedBlock struct {
+	number uint64
+	hash   common.Hash
+	events []*TrackedWalletEvent
+}
+
+func newEmittedBlocks(depth int) *emittedBlocks {
+	return &emittedBlocks{depth: max(depth, 1)}
+}
+
+// add starts recording events of the processed block. Recorded blocks at the
+// same or higher number with a different hash were orphaned by a reorg, they
+// are removed and returned. The oldest block is forgotten once more than
+// depth blocks are recorded.
+func (r *emittedBlocks) add(number uint64, hash common.Hash) []*emittedBlock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var orphaned []*emittedBlock
+	kept := r.blocks[:0]
+	for _, b := range r.blocks {
+		switch {
+		case b.number < number:
+			kept = append(kept, b)
+		case b.hash != hash:
+			orphaned = append(orphaned, b)
+		}
+		// The same block processed again is recorded anew
+	}
+	r.blocks = append(kept, &emittedBlock{number: number, hash: hash})
+	if len(r.blocks) > r.depth {
+		r.blocks = r.blocks[len(r.blocks)-r.depth:]
+	}
+	return orphaned
+}
+
+// record adds the event to its block, unless the block is no longer
+// recorded.
+func (r *emittedBlocks) record(event *TrackedWalletEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.blocks) - 1; i >= 0; i-- {
+		if r.blocks[i].number == event.BlockNumber {
+			r.blocks[i].events = append(r.blocks[i].events, event)
+			return
+		}
+	}
+}
+
+// revertedEvent returns the EventReverted event of the event.
+func revertedEvent(event *TrackedWalletEvent) *TrackedWalletEvent {
+	reverted := *event
+	reverted.Type = EventReverted
+	reverted.Reverts = event.IdempotencyKey
+	reverted.IdempotencyKey = idempotencyKey("", event.IdempotencyKey, "", "", string(EventReverted))
+	reverted.ObservedAt = time.Now().UTC()
+	return &reverted
+}
@@ -0,0 +1,213 @@
+package chain
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func reorgTestTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+	to := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	tx, err := types.SignNewTx(key, types.NewEIP155Signer(params.MainnetChainConfig.ChainID), &types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(1),
+		Gas:      21000,
+		To:       &to,
+		Value:    big.NewInt(10),
+	})
+	assert.NoError(t, err)
+	return tx
+}
+
+// reorgTestBlock returns a block at the height, fork distinguishes competing
+// blocks of the same height.
+func reorgTestBlock(number int64, fork string, txs ...*types.Transaction) *types.Block {
+	return types.NewBlockWithHeader(&types.Header{
+		Number: big.NewInt(number),
+		Time:   1730000000,
+		Extra:  []byte(fork),
+	}).WithBody(types.Body{Transactions: txs})
+}
+
+func takeEvents(out chan *TrackedWalletEvent) []*TrackedWalletEvent {
+	events := []*TrackedWalletEvent{}
+	for {
+		select {
+		case event := <-out:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEthereumRevertedEvents(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	tx1, tx2, tx3 := reorgTestTx(t, key, 1), reorgTestTx(t, key, 2), reorgTestTx(t, key, 3)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithRevertedEvents{Enabled: true, Blocks: 8})
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	out := make(chan *TrackedWalletEvent, 10)
+
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "a", tx1), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "a", tx2), out))
+	emitted := takeEvents(out)
+	assert.Len(t, emitted, 2)
+
+	// Competing block 101 replaces the one including tx2
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "b", tx3), out))
+	events := takeEvents(out)
+	assert.Len(t, events, 2)
+
+	reverted := events[0]
+	assert.Equal(t, EventReverted, reverted.Type)
+	assert.Equal(t, emitted[1].IdempotencyKey, reverted.Reverts)
+	assert.NotEqual(t, emitted[1].IdempotencyKey, reverted.IdempotencyKey)
+	assert.Equal(t, tx2.Hash().String(), reverted.TxHash)
+	assert.Equal(t, sender.String(), reverted.Wallet)
+	assert.Equal(t, big.NewInt(10), reverted.Amount)
+	assert.Equal(t, uint64(21000101), reverted.BlockNumber)
+	assert.NoError(t, reverted.Validate())
+	// The original event is left untouched
+	assert.Empty(t, emitted[1].Type)
+
+	// Events of the canonical block follow
+	assert.Empty(t, events[1].Type)
+	assert.Equal(t, tx3.Hash().String(), events[1].TxHash)
+
+	// Reprocessing the canonical block reverts nothing
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "b", tx3), out))
+	events = takeEvents(out)
+	assert.Len(t, events, 1)
+	assert.Empty(t, events[0].Type)
+}
+
+func TestEthereumRevertedEventsDeepReorg(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	tx1, tx2, tx3 := reorgTestTx(t, key, 1), reorgTestTx(t, key, 2), reorgTestTx(t, key, 3)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithRevertedEvents{Enabled: true, Blocks: 8})
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	out := make(chan *TrackedWalletEvent, 10)
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "a", tx1), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "a", tx2), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000102, "a", tx3), out))
+	takeEvents(out)
+
+	// Block 101 of the new chain includes tx2 again, so only tx3 of the
+	// orphaned 102 is reverted
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "b", tx2), out))
+	events := takeEvents(out)
+	assert.Len(t, events, 2)
+	assert.Equal(t, EventReverted, events[0].Type)
+	assert.Equal(t, tx3.Hash().String(), events[0].TxHash)
+	assert.Empty(t, events[1].Type)
+	assert.Equal(t, tx2.Hash().String(), events[1].TxHash)
+}
+
+func TestEthereumRevertedEventsHeldForConfirmations(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	tx1, tx2 := reorgTestTx(t, key, 1), reorgTestTx(t, key, 2)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net", WithRevertedEvents{Enabled: true, Blocks: 8})
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = e
+	// User 1 waits for confirmations, user 2 receives events right away
+	assert.NoError(t, m.TrackUserWallet(1, sender.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, sender.Hex(), EthereumMainnet))
+	assert.NoError(t, m.SetWalletConfirmations(1, sender.Hex(), EthereumMainnet, 3))
+	out := make(chan *TrackedWalletEvent, 10)
+	events := []*TrackedWalletEvent{}
+	process := func(b *types.Block) {
+		assert.True(t, e.processBlock(b, out))
+		events = append(events, fanOut(m, e, takeEvents(out))...)
+	}
+
+	process(reorgTestBlock(21000100, "a", tx1))
+	// Orphans the block before its event was released, the held event of
+	// user 1 is discarded rather than reverted
+	process(reorgTestBlock(21000100, "b", tx2))
+	process(reorgTestBlock(21000101, "b"))
+	process(reorgTestBlock(21000102, "b"))
+
+	type emitted struct {
+		userID    int
+		eventType EventType
+		txHash    string
+	}
+	got := []emitted{}
+	for _, event := range events {
+		got = append(got, emitted{event.UserID, event.Type, event.TxHash})
+	}
+	assert.Equal(t, []emitted{
+		{2, "", tx1.Hash().String()},
+		{2, EventReverted, tx1.Hash().String()},
+		{2, "", tx2.Hash().String()},
+		{1, "", tx2.Hash().String()},
+	}, got)
+}
+
+func TestEthereumRevertedEventsDisabled(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	out := make(chan *TrackedWalletEvent, 10)
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "a", reorgTestTx(t, key, 1)), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "b", reorgTestTx(t, key, 2)), out))
+
+	for _, event := range takeEvents(out) {
+		assert.Empty(t, event.Type)
+	}
+}
+
+func TestEmittedBlocksDepth(t *testing.T) {
+	r := newEmittedBlocks(2)
+	for number := uint64(1); number <= 3; number++ {
+		assert.Empty(t, r.add(number, common.Hash{byte(number)}))
+		r.record(&TrackedWalletEvent{BlockNumber: number})
+	}
+	// Block 1 is forgotten, a reorg from it orphans only blocks 2 and 3
+	orphaned := r.add(1, common.Hash{0xff})
+	assert.Len(t, orphaned, 2)
+	for i, b := range orphaned {
+		assert.Equal(t, uint64(i+2), b.number)
+		assert.Len(t, b.events, 1)
+	}
+}
+
+func TestEthereumReprocessedTransactionKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	tx := reorgTestTx(t, key, 1)
+
+	e := NewEthereumMainnetSubscriber("http://dummy.net")
+	assert.NoError(t, e.TrackWallet(sender.Hex()))
+	out := make(chan *TrackedWalletEvent, 10)
+	// The transaction is included in both competing blocks
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "a", tx), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000100, "b", tx), out))
+	assert.True(t, e.processBlock(reorgTestBlock(21000101, "b", tx), out))
+
+	// Keys don't depend on the block, so that duplicates can be dropped
+	events := takeEvents(out)
+	assert.Len(t, events, 3)
+	for _, event := range events[1:] {
+		assert.Equal(t, events[0].IdempotencyKey, event.IdempotencyKey)
+	}
+}
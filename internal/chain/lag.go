@@ -0,0 +1,27 @@
+package chain
+
+import (
+	"log/slog"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+)
+
+// recordLag sets the lag gauge of the chain to the number of blocks or slots
+// between the polled tip and the last processed one, and logs it at debug
+// level, as it is recorded on every poll or head. The gauge is meant for
+// alerting. Nothing is recorded before the first block is processed.
+func recordLag(logger *slog.Logger, gauge *metrics.GaugeVec, chain ChainName, tip, processed uint64) {
+	if processed == 0 {
+		return
+	}
+	lag := uint64(0)
+	if tip > processed {
+		lag = tip - processed
+	}
+	gauge.Set(string(chain), float64(lag))
+	logger.Debug("chain tip lag",
+		slog.Uint64("tip", tip),
+		slog.Uint64("last_processed", processed),
+		slog.Uint64("lag", lag),
+	)
+}
@@ -0,0 +1,89 @@
+package chain
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	go_ethereuem_mocks "github.com/Mantelijo/deblock-backend/internal/mocks/go_ethereum"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordLag(t *testing.T) {
+	gauge := metrics.NewGaugeVec("lag", "Lag.")
+	chain := ChainName(t.Name())
+
+	// Unknown before the first processed block
+	recordLag(slog.Default(), gauge, chain, 110, 0)
+	assert.Zero(t, gauge.Value(string(chain)))
+
+	recordLag(slog.Default(), gauge, chain, 110, 100)
+	assert.Equal(t, float64(10), gauge.Value(string(chain)))
+	// Processed blocks ahead of a stale tip are not behind
+	recordLag(slog.Default(), gauge, chain, 100, 101)
+	assert.Zero(t, gauge.Value(string(chain)))
+}
+
+func TestBitcoinHeadLag(t *testing.T) {
+	b := NewBitcoinSubscriber("dummy")
+	b.pollInterval = time.Millisecond
+	b.lastBlockNum = 100
+	b.getBlockCount = func() (int64, error) { return 105, nil }
+	// Blocks can't be fetched, so the subscriber stays behind
+	b.getBlockHash = func(number int64) (*chainhash.Hash, error) {
+		return nil, assert.AnError
+	}
+
+	_, errs := b.Start()
+	defer b.Stop()
+	<-errs
+	assert.Equal(t, float64(5), metrics.ChainHeadLagBlocks.Value(string(Bitcoin)))
+}
+
+func TestSolanaSlotLag(t *testing.T) {
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.pollInterval = time.Millisecond
+	s.currentSlot = 100
+	s.processedSlot.Store(90)
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		return 100, nil
+	}
+
+	s.Start()
+	defer s.Stop()
+	assert.Eventually(t, func() bool {
+		return metrics.ChainSlotLag.Value(string(SolanaMainnet)) == 10
+	}, time.Second, time.Millisecond)
+}
+
+func TestEthereumHeadLag(t *testing.T) {
+	chain := ChainName(t.Name())
+	e := NewEVMSubscriber(chain, "http://dummy.net", params.MainnetChainConfig)
+	e.lastProcessedBlock.Store(21000100)
+	e.subscribeNewHead = func(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+		go func() {
+			ch <- &types.Header{Number: big.NewInt(21000105)}
+		}()
+		sub := &go_ethereuem_mocks.MockGoEthereumSubscription{}
+		sub.EXPECT().Err().Return(make(<-chan error))
+		sub.EXPECT().Unsubscribe().Return()
+		return sub, nil
+	}
+	e.blockByNumber = func(ctx context.Context, number *big.Int) (*types.Block, error) {
+		return nil, assert.AnError
+	}
+
+	e.Start()
+	defer e.Stop()
+	assert.Eventually(t, func() bool {
+		return metrics.ChainHeadLagBlocks.Value(string(chain)) == 5
+	}, time.Second, time.Millisecond)
+	assert.Zero(t, metrics.ChainSlotLag.Value(string(chain)))
+}
@@ -0,0 +1,85 @@
+package chain
+
+import (
+	"fmt"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+)
+
+// SinkPolicy controls how events are sent to the sink of StartAll when the
+// sink is not ready to receive them, e.g. a slow downstream.
+type SinkPolicy string
+
+const (
+	// Forwarding waits for the sink, stalling the subscriber's processing
+	SinkPolicyBlock SinkPolicy = "block"
+	// Events the sink is not ready to receive are dropped and counted
+	SinkPolicyDrop SinkPolicy = "drop"
+	// Events are queued for the sink, forwarding waits only once the queue
+	// is full
+	SinkPolicyQueue SinkPolicy = "queue"
+)
+
+func ParseSinkPolicy(policy string) (SinkPolicy, error) {
+	switch p := SinkPolicy(policy); p {
+	case SinkPolicyBlock, SinkPolicyDrop, SinkPolicyQueue:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported sink policy %q", policy)
+}
+
+// WithSinkPolicy sets the policy of sending events to the sink of StartAll.
+// QueueSize is the number of events queued by SinkPolicyQueue. Default is
+// SinkPolicyBlock.
+type WithSinkPolicy struct {
+	Policy    SinkPolicy
+	QueueSize int
+}
+
+func (w WithSinkPolicy) Apply(m *mapSubManager) {
+	m.sinkPolicy = w.Policy
+	m.sinkQueueSize = max(w.QueueSize, 1)
+}
+
+// sinkSender returns a function sending events to the sink according to the
+// sink policy. Queued events are sent until the manager is stopped.
+func (m *mapSubManager) sinkSender(sink chan<- *TrackedWalletEvent) func(event *TrackedWalletEvent) {
+	switch m.sinkPolicy {
+	case SinkPolicyDrop:
+		return func(event *TrackedWalletEvent) {
+			select {
+			case sink <- event:
+				metrics.EventsEmitted.Inc(string(event.ChainName))
+			default:
+				metrics.SinkDrops.Inc(string(event.ChainName))
+				m.drops.RecordDrop(event.ChainName)
+			}
+		}
+	case SinkPolicyQueue:
+		queue := make(chan *TrackedWalletEvent, m.sinkQueueSize)
+		m.forwarders.Add(1)
+		go func() {
+			defer m.forwarders.Done()
+			for {
+				select {
+				case event := <-queue:
+					if !send(sink, event, m.stopped) {
+						return
+					}
+					metrics.EventsEmitted.Inc(string(event.ChainName))
+				case <-m.stopped:
+					return
+				}
+			}
+		}()
+		return func(event *TrackedWalletEvent) {
+			send(queue, event, m.stopped)
+		}
+	default:
+		return func(event *TrackedWalletEvent) {
+			if send(sink, event, m.stopped) {
+				metrics.EventsEmitted.Inc(string(event.ChainName))
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// deliverAsync delivers the event in the background, the returned channel is
+// closed once deliver returns.
+func deliverAsync(deliver func(*TrackedWalletEvent), event *TrackedWalletEvent) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		deliver(event)
+	}()
+	return done
+}
+
+func TestSinkPolicyBlock(t *testing.T) {
+	m := NewSubsciberManager(WithSinkPolicy{Policy: SinkPolicyBlock}).(*mapSubManager)
+	defer m.Stop(context.Background())
+	sink := make(chan *TrackedWalletEvent)
+	deliver := m.sinkSender(sink)
+
+	event := &TrackedWalletEvent{ChainName: "sink_block", TxHash: "0x01"}
+	done := deliverAsync(deliver, event)
+	select {
+	case <-done:
+		t.Fatal("expected delivery to wait for the sink")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal(t, event, <-sink)
+	<-done
+	assert.Equal(t, float64(1), metrics.EventsEmitted.Value("sink_block"))
+}
+
+func TestSinkPolicyDrop(t *testing.T) {
+	m := NewSubsciberManager(WithSinkPolicy{Policy: SinkPolicyDrop}).(*mapSubManager)
+	defer m.Stop(context.Background())
+	sink := make(chan *TrackedWalletEvent)
+	deliver := m.sinkSender(sink)
+
+	// Nothing receives from the sink, events are dropped without waiting
+	for range 3 {
+		<-deliverAsync(deliver, &TrackedWalletEvent{ChainName: "sink_drop"})
+	}
+	assert.Equal(t, float64(3), metrics.SinkDrops.Value("sink_drop"))
+	assert.Equal(t, uint64(3), m.DroppedEvents()["sink_drop"])
+	assert.Zero(t, metrics.EventsEmitted.Value("sink_drop"))
+
+	// Events are delivered once the sink is ready
+	received := make(chan *TrackedWalletEvent)
+	go func() {
+		received <- <-sink
+	}()
+	event := &TrackedWalletEvent{ChainName: "sink_drop", TxHash: "0x01"}
+	assert.Eventually(t, func() bool {
+		deliver(event)
+		return metrics.EventsEmitted.Value("sink_drop") == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, event, <-received)
+}
+
+func TestSinkPolicyQueue(t *testing.T) {
+	m := NewSubsciberManager(WithSinkPolicy{Policy: SinkPolicyQueue, QueueSize: 2}).(*mapSubManager)
+	sink := make(chan *TrackedWalletEvent)
+	deliver := m.sinkSender(sink)
+
+	events := []*TrackedWalletEvent{}
+	for _, hash := range []string{"0x01", "0x02", "0x03", "0x04"} {
+		events = append(events, &TrackedWalletEvent{ChainName: "sink_queue", TxHash: hash})
+	}
+	// The first event is held by the queue sender waiting for the sink, the
+	// next ones fill the queue
+	for _, event := range events[:3] {
+		select {
+		case <-deliverAsync(deliver, event):
+		case <-time.After(time.Second):
+			t.Fatal("expected delivery not to wait for the sink")
+		}
+	}
+	done := deliverAsync(deliver, events[3])
+	select {
+	case <-done:
+		t.Fatal("expected delivery to wait for the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, event := range events {
+		assert.Equal(t, event, <-sink)
+	}
+	<-done
+	assert.Zero(t, metrics.SinkDrops.Value("sink_queue"))
+
+	// The queue sender exits on Stop
+	assert.NoError(t, m.Stop(context.Background()))
+}
+
+func TestSinkPolicySlowSink(t *testing.T) {
+	m := NewSubsciberManager(WithSinkPolicy{Policy: SinkPolicyDrop})
+	sub := newFakeSubscriber("sink_slow")
+	assert.NoError(t, m.RegisterSubscribers(sub))
+	defer m.Stop(context.Background())
+
+	// The subscriber keeps being drained while the sink is not read
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+	assert.Eventually(t, func() bool {
+		return m.DroppedEvents()["sink_slow"] >= 3
+	}, time.Second, 5*time.Millisecond)
+
+	select {
+	case e := <-sink:
+		assert.Equal(t, ChainName("sink_slow"), e.ChainName)
+	case <-time.After(time.Second):
+		t.Fatal("expected events once the sink is read")
+	}
+}
+
+func TestParseSinkPolicy(t *testing.T) {
+	policy, err := ParseSinkPolicy("queue")
+	assert.NoError(t, err)
+	assert.Equal(t, SinkPolicyQueue, policy)
+	_, err = ParseSinkPolicy("buffer")
+	assert.EqualError(t, err, `unsupported sink policy "buffer"`)
+}
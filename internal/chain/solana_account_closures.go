@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/token"
+)
+
+// solanaAccountClosures returns balance changes of tx caused by closing token
+// accounts, per account index. Closing an account moves all of its lamports,
+// i.e. the rent deposit, to the destination account. The closed account's
+// change is negative and the destination's positive. Subtracting them from
+// balance changes leaves the transfers of the transaction only.
+func solanaAccountClosures(tx client.BlockTransaction) map[int]int64 {
+	if tx.Meta == nil {
+		return nil
+	}
+	accounts := solanaTxAccounts(tx)
+	balances := min(len(tx.Meta.PreBalances), len(tx.Meta.PostBalances))
+
+	var closures map[int]int64
+	for _, ci := range solanaInstructions(tx) {
+		program, ok := solanaAccountAt(accounts, ci.ProgramIDIndex)
+		if !ok || (program != common.TokenProgramID && program != common.Token2022ProgramID) {
+			continue
+		}
+		// Closed account followed by the destination
+		if len(ci.Data) == 0 || token.Instruction(ci.Data[0]) != token.InstructionCloseAccount || len(ci.Accounts) < 2 {
+			continue
+		}
+		closed, destination := ci.Accounts[0], ci.Accounts[1]
+		if closed < 0 || closed >= balances || destination < 0 || destination >= balances || closed == destination {
+			continue
+		}
+		// Account is gone once the transaction completes
+		if tx.Meta.PostBalances[closed] != 0 {
+			continue
+		}
+
+		if closures == nil {
+			closures = map[int]int64{}
+		}
+		// Includes lamports the account received from earlier closures
+		rent := tx.Meta.PreBalances[closed] + closures[closed]
+		closures[closed] -= rent
+		closures[destination] += rent
+	}
+	return closures
+}
@@ -0,0 +1,139 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/system"
+	"github.com/blocto/solana-go-sdk/program/token"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// closureTx returns a transaction of payer sending 100 lamports to recipient
+// and closing its token account, whose rent of 50 lamports is returned to
+// rentDestination.
+func closureTx(payer, tokenAccount, recipient, rentDestination common.PublicKey) client.BlockTransaction {
+	accounts := []common.PublicKey{payer, tokenAccount, recipient, common.SystemProgramID, common.TokenProgramID}
+	pre, post := []int64{1000, 50, 0, 1, 1}, []int64{895, 0, 100, 1, 1}
+	destination := 0
+	if rentDestination == payer {
+		post[0] += 50
+	} else {
+		destination = len(accounts)
+		accounts = append(accounts, rentDestination)
+		pre, post = append(pre, 0), append(post, 50)
+	}
+	closeAccount := token.CloseAccount(token.CloseAccountParam{
+		Account: tokenAccount, To: rentDestination, Auth: payer,
+	}).Data
+
+	return client.BlockTransaction{
+		Meta: &client.TransactionMeta{
+			PreBalances:  pre,
+			PostBalances: post,
+			Fee:          5,
+		},
+		Transaction: types.Transaction{
+			Message: types.Message{
+				Accounts: accounts,
+				Instructions: []types.CompiledInstruction{
+					{
+						ProgramIDIndex: 3,
+						Accounts:       []int{0, 2},
+						Data:           system.Transfer(system.TransferParam{From: payer, To: recipient, Amount: 100}).Data,
+					},
+					{ProgramIDIndex: 4, Accounts: []int{1, destination, 0}, Data: closeAccount},
+				},
+			},
+		},
+	}
+}
+
+func TestSolanaAccountClosures(t *testing.T) {
+	payer, tokenAccount, recipient, other := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey, types.NewAccount().PublicKey
+
+	// Rent returned to the payer
+	assert.Equal(t, map[int]int64{0: 50, 1: -50}, solanaAccountClosures(closureTx(payer, tokenAccount, recipient, payer)))
+
+	// Rent returned to another account
+	assert.Equal(t, map[int]int64{1: -50, 5: 50}, solanaAccountClosures(closureTx(payer, tokenAccount, recipient, other)))
+
+	// Account which still holds lamports was not closed
+	tx := closureTx(payer, tokenAccount, recipient, other)
+	tx.Meta.PostBalances[1], tx.Meta.PostBalances[5] = 10, 40
+	assert.Nil(t, solanaAccountClosures(tx))
+}
+
+func TestSolanaAccountClosureFilter(t *testing.T) {
+	payer, tokenAccount, recipient, other := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey, types.NewAccount().PublicKey
+
+	type result struct {
+		Source      string
+		Destination string
+		Amount      *big.Int
+	}
+	tests := []struct {
+		name            string
+		enabled         bool
+		rentDestination common.PublicKey
+		tracked         []common.PublicKey
+		want            map[string]result
+	}{
+		{
+			name:            "closure nets out of the payer's change",
+			enabled:         true,
+			rentDestination: payer,
+			tracked:         []common.PublicKey{payer},
+			want: map[string]result{
+				payer.String(): {payer.String(), recipient.String(), big.NewInt(105)},
+			},
+		},
+		{
+			name:            "rent received from a closure is not a transfer",
+			enabled:         true,
+			rentDestination: other,
+			tracked:         []common.PublicKey{other, recipient},
+			want: map[string]result{
+				recipient.String(): {payer.String(), recipient.String(), big.NewInt(100)},
+			},
+		},
+		{
+			name:            "closures are reported as transfers when disabled",
+			rentDestination: other,
+			tracked:         []common.PublicKey{other},
+			want: map[string]result{
+				other.String(): {payer.String() + "," + tokenAccount.String(), other.String(), big.NewInt(50)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithAccountClosureFilter{Enabled: tt.enabled})
+			s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+				return &client.Block{
+					Transactions: []client.BlockTransaction{closureTx(payer, tokenAccount, recipient, tt.rentDestination)},
+				}, nil
+			}
+			for _, wallet := range tt.tracked {
+				assert.NoError(t, s.TrackWallet(wallet.String()))
+			}
+
+			events := make(chan *TrackedWalletEvent, 10)
+			assert.NoError(t, s.fetchBlock(500, events))
+			close(events)
+
+			got := map[string]result{}
+			for event := range events {
+				got[event.Wallet] = result{event.Source, event.Destination, event.Amount}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package chain
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/pkg/hdwallet"
+	"github.com/blocto/solana-go-sdk/types"
+)
+
+// solanaDerivationPath is the derivation path of Solana HD wallet accounts
+// used by the common wallets. Ed25519 supports hardened derivation only, so
+// unlike bitcoin xpubs, addresses can't be derived from a public key and the
+// seed is required.
+const solanaDerivationPath = "m/44'/501'/%d'/0'"
+
+// defaultSolanaHDGapLimit is the number of unused derived addresses tracked
+// ahead of the last used one.
+const defaultSolanaHDGapLimit = 20
+
+// solanaHDWallet is a tracked HD wallet whose addresses are derived on demand.
+type solanaHDWallet struct {
+	seed []byte
+	// Number of derived and tracked addresses, starting from index 0
+	derived uint32
+}
+
+// derivedSolanaWallet points to the HD wallet an address was derived from.
+type derivedSolanaWallet struct {
+	hd    *solanaHDWallet
+	index uint32
+}
+
+// deriveSolanaWallet derives the address at index of the HD wallet seed.
+func deriveSolanaWallet(seed []byte, index uint32) (common.PublicKey, error) {
+	key, err := hdwallet.Derived(fmt.Sprintf(solanaDerivationPath, index), seed)
+	if err != nil {
+		return common.PublicKey{}, err
+	}
+	account, err := types.AccountFromSeed(key.PrivateKey)
+	if err != nil {
+		return common.PublicKey{}, err
+	}
+	return account.PublicKey, nil
+}
+
+// TrackDerivedWallets starts tracking addresses derived from the HD wallet
+// seed. The first hdGapLimit addresses are tracked initially. Whenever a
+// transaction of a derived address is seen, further addresses are derived so
+// that hdGapLimit unused addresses are always tracked after the last used one.
+// The seed is kept in memory and must never be accepted from untrusted
+// sources.
+func (s *solanaMainnetSubscriber) TrackDerivedWallets(seed []byte) error {
+	if len(seed) < 16 || len(seed) > 64 {
+		return fmt.Errorf("invalid seed length %d", len(seed))
+	}
+
+	hd := &solanaHDWallet{seed: seed}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deriveUpTo(hd, s.hdGapLimit)
+}
+
+// markDerivedWalletUsed extends the tracked addresses of the HD wallet which
+// derived wallet so that hdGapLimit unused addresses follow it.
+func (s *solanaMainnetSubscriber) markDerivedWalletUsed(wallet common.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	derived, ok := s.derivedWallets[wallet]
+	if !ok {
+		return
+	}
+	if err := s.deriveUpTo(derived.hd, derived.index+1+s.hdGapLimit); err != nil {
+		s.logger.Error("failed to derive hd wallet addresses",
+			slog.Any("error", err),
+		)
+	}
+}
+
+// deriveUpTo derives and tracks addresses of hd until count addresses are
+// tracked. It must be called with mu held.
+func (s *solanaMainnetSubscriber) deriveUpTo(hd *solanaHDWallet, count uint32) error {
+	for ; hd.derived < count; hd.derived++ {
+		address, err := deriveSolanaWallet(hd.seed, hd.derived)
+		if err != nil {
+			return fmt.Errorf("deriving address %d: %w", hd.derived, err)
+		}
+		s.registeredWallets[address] = true
+		s.derivedWallets[address] = derivedSolanaWallet{hd: hd, index: hd.derived}
+	}
+	return nil
+}
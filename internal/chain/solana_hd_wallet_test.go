@@ -0,0 +1,94 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// BIP39 seed of "abandon abandon abandon abandon abandon abandon abandon
+// abandon abandon abandon abandon about" mnemonic with empty passphrase
+const testHDSeed = "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+func TestDeriveSolanaWallet(t *testing.T) {
+	seed, err := hex.DecodeString(testHDSeed)
+	assert.NoError(t, err)
+
+	address, err := deriveSolanaWallet(seed, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk", address.String())
+
+	other, err := deriveSolanaWallet(seed, 1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, address, other)
+}
+
+func TestSolanaTrackDerivedWallets(t *testing.T) {
+	seed, err := hex.DecodeString(testHDSeed)
+	assert.NoError(t, err)
+	derived := func(index uint32) common.PublicKey {
+		address, err := deriveSolanaWallet(seed, index)
+		assert.NoError(t, err)
+		return address
+	}
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithHDGapLimit{Limit: 3})
+	assert.Error(t, s.TrackDerivedWallets([]byte("short")))
+	assert.NoError(t, s.TrackDerivedWallets(seed))
+	assert.Len(t, s.TrackedWallets(), 3)
+	for i := range uint32(3) {
+		assert.True(t, s.registeredWallets[derived(i)])
+	}
+	assert.False(t, s.registeredWallets[derived(3)])
+
+	sender := types.NewAccount()
+	transferTo := func(recipient common.PublicKey) *client.Block {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1000, 0},
+						PostBalances: []int64{500, 500},
+					},
+					Transaction: types.Transaction{
+						Message: types.Message{
+							Accounts: []common.PublicKey{sender.PublicKey, recipient},
+						},
+					},
+				},
+			},
+		}
+	}
+	fetch := func(block *client.Block) []*TrackedWalletEvent {
+		s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+			return block, nil
+		}
+		ch := make(chan *TrackedWalletEvent, 10)
+		assert.NoError(t, s.fetchBlock(500, ch))
+		close(ch)
+		events := []*TrackedWalletEvent{}
+		for e := range ch {
+			events = append(events, e)
+		}
+		return events
+	}
+
+	// Address beyond the gap limit is not tracked yet
+	assert.Empty(t, fetch(transferTo(derived(4))))
+
+	// Using the last tracked address extends the window by the gap limit
+	events := fetch(transferTo(derived(2)))
+	assert.Len(t, events, 1)
+	assert.Equal(t, derived(2).String(), events[0].Destination)
+	assert.Len(t, s.TrackedWallets(), 6)
+
+	events = fetch(transferTo(derived(4)))
+	assert.Len(t, events, 1)
+	assert.Equal(t, derived(4).String(), events[0].Destination)
+	assert.Len(t, s.TrackedWallets(), 8)
+}
@@ -0,0 +1,109 @@
+package chain
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/system"
+	"github.com/blocto/solana-go-sdk/types"
+)
+
+// solanaInstructionFlows returns lamport transfers of System Program
+// instructions of tx in execution order, including inner instructions invoked
+// by programs (CPI). Only Transfer and TransferWithSeed instructions are
+// parsed.
+func solanaInstructionFlows(tx client.BlockTransaction) []AssetFlow {
+	accounts := solanaTxAccounts(tx)
+	flows := []AssetFlow{}
+	for _, ci := range solanaInstructions(tx) {
+		if flow, ok := systemTransferFlow(ci, accounts); ok {
+			flows = append(flows, flow)
+		}
+	}
+	return flows
+}
+
+// solanaInstructions returns top level and inner instructions of tx in
+// execution order. Inner instructions follow the top level instruction which
+// invoked them.
+func solanaInstructions(tx client.BlockTransaction) []types.CompiledInstruction {
+	// Top level instruction index -> its inner instructions
+	inner := map[uint64][]types.CompiledInstruction{}
+	if tx.Meta != nil {
+		for _, ii := range tx.Meta.InnerInstructions {
+			inner[ii.Index] = append(inner[ii.Index], ii.Instructions...)
+		}
+	}
+
+	instructions := []types.CompiledInstruction{}
+	for i, instruction := range tx.Transaction.Message.Instructions {
+		instructions = append(instructions, instruction)
+		instructions = append(instructions, inner[uint64(i)]...)
+	}
+	return instructions
+}
+
+// solanaTxAccounts returns accounts instructions of tx refer to by index.
+func solanaTxAccounts(tx client.BlockTransaction) []common.PublicKey {
+	if len(tx.AccountKeys) > 0 {
+		return tx.AccountKeys
+	}
+	return tx.Transaction.Message.Accounts
+}
+
+// systemTransferFlow parses a System Program transfer instruction.
+func systemTransferFlow(ci types.CompiledInstruction, accounts []common.PublicKey) (AssetFlow, bool) {
+	program, ok := solanaAccountAt(accounts, ci.ProgramIDIndex)
+	// Instruction discriminator followed by lamports
+	if !ok || program != common.SystemProgramID || len(ci.Data) < 12 {
+		return AssetFlow{}, false
+	}
+
+	// Position of the recipient in instruction accounts
+	toIndex := 0
+	switch system.Instruction(binary.LittleEndian.Uint32(ci.Data[:4])) {
+	case system.InstructionTransfer:
+		toIndex = 1
+	case system.InstructionTransferWithSeed:
+		// Base account precedes the recipient
+		toIndex = 2
+	default:
+		return AssetFlow{}, false
+	}
+	if len(ci.Accounts) <= toIndex {
+		return AssetFlow{}, false
+	}
+
+	from, okFrom := solanaAccountAt(accounts, ci.Accounts[0])
+	to, okTo := solanaAccountAt(accounts, ci.Accounts[toIndex])
+	if !okFrom || !okTo {
+		return AssetFlow{}, false
+	}
+	return AssetFlow{
+		Source:      from.String(),
+		Destination: to.String(),
+		AssetID:     NativeAssetID,
+		Amount:      new(big.Int).SetUint64(binary.LittleEndian.Uint64(ci.Data[4:12])),
+	}, true
+}
+
+// solanaAccountAt returns the account at index i of transaction accounts.
+func solanaAccountAt(accounts []common.PublicKey, i int) (common.PublicKey, bool) {
+	if i < 0 || i >= len(accounts) {
+		return common.PublicKey{}, false
+	}
+	return accounts[i], true
+}
+
+// walletFlows returns flows from or to wallet.
+func walletFlows(flows []AssetFlow, wallet string) []AssetFlow {
+	var out []AssetFlow
+	for _, flow := range flows {
+		if flow.Source == wallet || flow.Destination == wallet {
+			out = append(out, flow)
+		}
+	}
+	return out
+}
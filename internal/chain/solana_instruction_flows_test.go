@@ -0,0 +1,138 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/system"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// splitterTx returns a transaction of wallet paying a, b and c. a and b are
+// paid by a router program invoking the System Program, c directly.
+func splitterTx(wallet, a, b, c, router common.PublicKey) client.BlockTransaction {
+	transfer := func(from, to common.PublicKey, amount uint64) []byte {
+		return system.Transfer(system.TransferParam{From: from, To: to, Amount: amount}).Data
+	}
+	return client.BlockTransaction{
+		Meta: &client.TransactionMeta{
+			PreBalances:  []int64{1000, 0, 0, 0, 1, 1},
+			PostBalances: []int64{445, 300, 200, 50, 1, 1},
+			Fee:          5,
+			InnerInstructions: []client.InnerInstruction{
+				{
+					Index: 0,
+					Instructions: []types.CompiledInstruction{
+						{ProgramIDIndex: 5, Accounts: []int{0, 1}, Data: transfer(wallet, a, 300)},
+						{ProgramIDIndex: 5, Accounts: []int{0, 2}, Data: transfer(wallet, b, 200)},
+					},
+				},
+			},
+		},
+		Transaction: types.Transaction{
+			Message: types.Message{
+				Accounts: []common.PublicKey{wallet, a, b, c, router, common.SystemProgramID},
+				Instructions: []types.CompiledInstruction{
+					{ProgramIDIndex: 4, Accounts: []int{0, 1, 2, 5}, Data: []byte{1}},
+					{ProgramIDIndex: 5, Accounts: []int{0, 3}, Data: transfer(wallet, c, 50)},
+				},
+			},
+		},
+	}
+}
+
+func TestSolanaInstructionFlows(t *testing.T) {
+	wallet, a, b, c, router := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey, types.NewAccount().PublicKey, types.NewAccount().PublicKey
+	flow := func(from, to common.PublicKey, amount int64) AssetFlow {
+		return AssetFlow{Source: from.String(), Destination: to.String(), AssetID: NativeAssetID, Amount: big.NewInt(amount)}
+	}
+	withSeed := system.TransferWithSeed(system.TransferWithSeedParam{
+		From: wallet, To: c, Base: router, Seed: "deblock", Amount: 70,
+	}).Data
+	createAccount := system.CreateAccount(system.CreateAccountParam{
+		From: wallet, New: c, Owner: router, Lamports: 10, Space: 1,
+	}).Data
+
+	tests := []struct {
+		name string
+		tx   func() client.BlockTransaction
+		want []AssetFlow
+	}{
+		{
+			name: "inner instructions follow their top level instruction",
+			tx: func() client.BlockTransaction {
+				return splitterTx(wallet, a, b, c, router)
+			},
+			want: []AssetFlow{flow(wallet, a, 300), flow(wallet, b, 200), flow(wallet, c, 50)},
+		},
+		{
+			name: "transfer with seed",
+			tx: func() client.BlockTransaction {
+				tx := splitterTx(wallet, a, b, c, router)
+				tx.Meta.InnerInstructions = nil
+				tx.Transaction.Message.Instructions[1] = types.CompiledInstruction{
+					ProgramIDIndex: 5, Accounts: []int{0, 4, 3}, Data: withSeed,
+				}
+				return tx
+			},
+			want: []AssetFlow{flow(wallet, c, 70)},
+		},
+		{
+			name: "other instructions are ignored",
+			tx: func() client.BlockTransaction {
+				tx := splitterTx(wallet, a, b, c, router)
+				tx.Meta.InnerInstructions[0].Instructions = []types.CompiledInstruction{
+					// Not a transfer
+					{ProgramIDIndex: 5, Accounts: []int{0, 3}, Data: createAccount},
+					// Truncated data
+					{ProgramIDIndex: 5, Accounts: []int{0, 1}, Data: []byte{2, 0, 0, 0}},
+					// Account out of range
+					{ProgramIDIndex: 5, Accounts: []int{0, 9}, Data: tx.Transaction.Message.Instructions[1].Data},
+					// Not the System Program
+					{ProgramIDIndex: 4, Accounts: []int{0, 1}, Data: tx.Transaction.Message.Instructions[1].Data},
+				}
+				return tx
+			},
+			want: []AssetFlow{flow(wallet, c, 50)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, solanaInstructionFlows(tt.tx()))
+		})
+	}
+}
+
+func TestSolanaInstructionFlowsEvents(t *testing.T) {
+	wallet, a, b, c, router := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey, types.NewAccount().PublicKey, types.NewAccount().PublicKey
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithInstructionFlows{Enabled: true})
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{splitterTx(wallet, a, b, c, router)},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(wallet.String()))
+	assert.NoError(t, s.TrackWallet(a.String()))
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+	close(events)
+
+	flows := map[string][]AssetFlow{}
+	for event := range events {
+		flows[event.Wallet] = event.Flows
+	}
+	assert.Len(t, flows[wallet.String()], 3)
+	if assert.Len(t, flows[a.String()], 1) {
+		assert.Equal(t, wallet.String(), flows[a.String()][0].Source)
+		assert.Equal(t, big.NewInt(300), flows[a.String()][0].Amount)
+	}
+}
@@ -2,24 +2,51 @@ package chain
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 	"github.com/blocto/solana-go-sdk/client"
 	"github.com/blocto/solana-go-sdk/common"
 	"github.com/blocto/solana-go-sdk/rpc"
 	"github.com/mr-tron/base58"
 )
 
-func NewSolanaMainnetSubscriber(rpcUrl string) *solanaMainnetSubscriber {
-	return &solanaMainnetSubscriber{
+func NewSolanaMainnetSubscriber(rpcUrl string, opts ...SolanaMainnetSubscriberOption) *solanaMainnetSubscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &solanaMainnetSubscriber{
 		rpcUrl:            rpcUrl,
+		logger:            slog.Default(),
 		registeredWallets: make(map[common.PublicKey]bool),
+		walletRefs:        make(map[common.PublicKey]int),
+		mutedWallets:      make(map[common.PublicKey]bool),
+		derivedWallets:    make(map[common.PublicKey]derivedSolanaWallet),
+		hdGapLimit:        defaultSolanaHDGapLimit,
+		pollInterval:      time.Second,
+		fetchWorkers:      16,
+		fetchRetries:      3,
+		failedTxs:         FailedTxsExclude,
+		fetchRetryBase:    500 * time.Millisecond,
+		fetchRetryMax:     10 * time.Second,
+		owners:            make(map[common.PublicKey]common.PublicKey),
+		errLogs:           newErrorLogLimiter(defaultErrorLogInterval),
+		ctx:               ctx,
+		cancel:            cancel,
 	}
+
+	for _, opt := range opts {
+		opt.Apply(s)
+	}
+	s.logger = s.logger.With(slog.String("chain", string(s.Name())))
+
+	return s
 }
 
 var _ TransactionSubscriber = (*solanaMainnetSubscriber)(nil)
@@ -27,15 +54,77 @@ var _ TransactionSubscriber = (*solanaMainnetSubscriber)(nil)
 type solanaMainnetSubscriber struct {
 	rpcUrl string
 	c      *client.Client
+	logger *slog.Logger
+	// Collapses repeated identical error logs
+	errLogs *errorLogLimiter
 
 	registeredWallets map[common.PublicKey]bool
-	// registeredWallets mutex
+	// Number of TrackWallet calls not yet matched by UntrackWallet, a wallet
+	// stays registered until its last reference is released. Derived wallets
+	// have no references.
+	walletRefs map[common.PublicKey]int
+	// Tracked wallets whose events are suppressed
+	mutedWallets map[common.PublicKey]bool
+	// Tracked wallets derived from HD wallet seeds
+	derivedWallets map[common.PublicKey]derivedSolanaWallet
+	// Number of unused HD wallet addresses tracked after the last used one
+	hdGapLimit uint32
+	// registeredWallets, walletRefs, mutedWallets and derivedWallets mutex
 	mu sync.RWMutex
 
 	currentSlot uint64
+	// Interval of polling the latest finalized slot
+	pollInterval time.Duration
+	// Maximum number of blocks fetched concurrently
+	fetchWorkers int
+	// Number of retries of failed block fetches and their exponential
+	// backoff bounds
+	fetchRetries   int
+	fetchRetryBase time.Duration
+	fetchRetryMax  time.Duration
+	// Number of slots whose blocks could not be fetched even after retries
+	failedSlots atomic.Uint64
+	// Latest slot of the last poll, used to tell catch-up slots apart
+	tipSlot atomic.Uint64
+	// Highest slot whose block was processed. Blocks are fetched
+	// concurrently, so lower slots may still be in flight.
+	processedSlot atomic.Uint64
+	// Maximum number of slots processed when catching up to the chain tip. 0
+	// means no limit.
+	maxCatchUpSlots uint64
+	// Whether to attach tracked wallet's pre and post balances to events
+	emitBalances bool
+	// Whether to exclude program owned accounts from sender and recipient
+	// classification
+	filterProgramAccounts bool
+	// Whether to emit a single event per transaction instead of one per
+	// tracked sender and recipient
+	aggregateTransactions bool
+	// Whether to attach transfers parsed from instructions to events
+	emitInstructionFlows bool
+	// Whether to exclude rent moved by closing token accounts from balance
+	// changes
+	skipAccountClosures bool
+	// Whether to skip transactions invoking the Vote program only
+	skipVoteTxs bool
+	// What to do with transactions which failed on chain
+	failedTxs FailedTxPolicy
+	// Cached account -> owner program lookups
+	owners   map[common.PublicKey]common.PublicKey
+	ownersMu sync.Mutex
 
 	getSlot  func(context.Context) (uint64, error)
 	getBlock func(context.Context, uint64) (*client.Block, error)
+	// Returns confirmed slots between start and end slots, inclusive
+	getBlocks func(ctx context.Context, start, end uint64) ([]uint64, error)
+	// Returns owner programs of accounts, in the same order
+	getAccountOwners func(ctx context.Context, accounts []common.PublicKey) ([]common.PublicKey, error)
+
+	// Cancelled when the subscriber is stopped. In-flight RPC calls of Start
+	// goroutines are cancelled as well.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
 }
 
 func (s *solanaMainnetSubscriber) Init() error {
@@ -53,13 +142,45 @@ func (s *solanaMainnetSubscriber) Init() error {
 		})
 	}
 
+	s.getBlocks = func(ctx context.Context, start, end uint64) ([]uint64, error) {
+		res, err := c.RpcClient.GetBlocksWithConfig(ctx, start, end, rpc.GetBlocksConfig{
+			Commitment: rpc.CommitmentFinalized,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := res.GetError(); err != nil {
+			return nil, err
+		}
+		return res.GetResult(), nil
+	}
+
+	s.getAccountOwners = func(ctx context.Context, accounts []common.PublicKey) ([]common.PublicKey, error) {
+		owners := make([]common.PublicKey, 0, len(accounts))
+		// getMultipleAccounts accepts up to 100 accounts
+		for batch := range slices.Chunk(accounts, 100) {
+			addrs := make([]string, len(batch))
+			for i, account := range batch {
+				addrs[i] = account.ToBase58()
+			}
+			infos, err := c.GetMultipleAccounts(ctx, addrs)
+			if err != nil {
+				return nil, err
+			}
+			for _, info := range infos {
+				owners = append(owners, info.Owner)
+			}
+		}
+		return owners, nil
+	}
+
 	slot, err := s.getSlot(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to get initial slot value: %w", err)
 	}
 	s.currentSlot = slot
 
-	slog.Info("initialized solana mainnet subscriber",
+	s.logger.Info("initialized solana mainnet subscriber",
 		slog.String("rpc_url", s.rpcUrl),
 	)
 
@@ -67,35 +188,58 @@ func (s *solanaMainnetSubscriber) Init() error {
 }
 
 // Start starts the slot fetching loop and distributes all unprocessed blocks to
-// a list of fetchBlock goroutines. Slots are fetched every second. Start
-// complies to TransactionSubscriber interface contract and does not block.
+// a list of fetchBlock goroutines, at most fetchWorkers at a time. Slots are
+// fetched every pollInterval. Start complies to TransactionSubscriber
+// interface contract and does not block.
 func (s *solanaMainnetSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan error) {
 	outEvents, outErrors := make(chan *TrackedWalletEvent, 1000), make(chan error)
 
 	go func() {
-		for range time.Tick(time.Second) {
-			slot, err := s.getSlot(context.Background())
+		// Block fetching goroutines must finish before the channels are closed
+		var fetches sync.WaitGroup
+		defer close(outErrors)
+		defer close(outEvents)
+		defer fetches.Wait()
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		// Bounds concurrent fetches, so that catching up on large slot gaps
+		// does not exhaust RPC limits
+		fetchSlots := make(chan struct{}, max(s.fetchWorkers, 1))
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			slot, err := s.getSlot(s.ctx)
 			if err != nil {
-				outErrors <- fmt.Errorf("failed to get slot: %w", err)
+				metrics.RPCErrors.Inc(string(s.Name()))
+				if !send(outErrors, fmt.Errorf("failed to get slot: %w", err), s.ctx.Done()) {
+					return
+				}
 				continue
 			}
 
+			recordLag(s.logger, metrics.ChainSlotLag, s.Name(), slot, s.processedSlot.Load())
 			if slot <= s.currentSlot {
 				continue
 			}
-
-			for i := s.currentSlot; i < slot; i++ {
+			s.tipSlot.Store(slot)
+
+			for _, i := range s.confirmedSlots(s.catchUpStart(slot), slot) {
+				select {
+				case fetchSlots <- struct{}{}:
+				case <-s.ctx.Done():
+					return
+				}
+				fetches.Add(1)
 				go func(slot uint64) {
-					if err := s.fetchBlock(slot, outEvents); err != nil {
-						slog.Error(
-							"failed to fetch block",
-							slog.String("chian", string(s.Name())),
-							slog.Int64("slot", int64(slot)),
-							slog.Any("error", err),
-						)
-						return
-						// TODO better error handling, retry logic, etc.
-					}
+					defer fetches.Done()
+					defer func() { <-fetchSlots }()
+					s.fetchBlockWithRetries(slot, outEvents)
 				}(i)
 			}
 			s.currentSlot = slot
@@ -105,38 +249,172 @@ func (s *solanaMainnetSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan er
 	return outEvents, outErrors
 }
 
+// catchUpStart returns the first slot to process when catching up from
+// currentSlot to tip. If the gap exceeds maxCatchUpSlots, older slots are
+// skipped so that the subscriber goes live quickly.
+func (s *solanaMainnetSubscriber) catchUpStart(tip uint64) uint64 {
+	if s.maxCatchUpSlots == 0 || tip-s.currentSlot <= s.maxCatchUpSlots {
+		return s.currentSlot
+	}
+
+	start := tip - s.maxCatchUpSlots
+	s.logger.Warn("catch-up gap exceeds the limit, skipping older slots",
+		slog.Uint64("from_slot", s.currentSlot),
+		slog.Uint64("skipped_until_slot", start),
+		slog.Uint64("max_catch_up_slots", s.maxCatchUpSlots),
+	)
+	return start
+}
+
+// confirmedSlots returns slots in range [from, to) which contain a confirmed
+// block, so that skipped slots are not fetched. If the confirmed slots can't
+// be retrieved, all slots in the range are returned.
+func (s *solanaMainnetSubscriber) confirmedSlots(from, to uint64) []uint64 {
+	if from >= to {
+		return nil
+	}
+
+	if s.getBlocks != nil {
+		slots, err := s.getBlocks(s.ctx, from, to-1)
+		if err == nil {
+			return slots
+		}
+		metrics.RPCErrors.Inc(string(s.Name()))
+		s.errLogs.Log(s.logger, slog.LevelWarn, "failed to get confirmed slots, fetching every slot", err,
+			slog.Uint64("from_slot", from),
+			slog.Uint64("to_slot", to),
+		)
+	}
+
+	slots := make([]uint64, 0, to-from)
+	for i := from; i < to; i++ {
+		slots = append(slots, i)
+	}
+	return slots
+}
+
+// fetchBlockWithRetries fetches the block of slot, retrying transient errors
+// with exponential backoff. Skipped slots are not retried. Slots which fail
+// all attempts are logged and counted in failedSlots.
+func (s *solanaMainnetSubscriber) fetchBlockWithRetries(slot uint64, out chan<- *TrackedWalletEvent) {
+	for attempt := 0; ; attempt++ {
+		err := s.fetchBlock(slot, out)
+		switch {
+		case err == nil, s.ctx.Err() != nil:
+			return
+		case isSkippedSlotError(err):
+			s.logger.Info("slot was skipped, no block to fetch",
+				slog.Uint64("slot", slot),
+			)
+			return
+		case attempt >= s.fetchRetries:
+			s.failedSlots.Add(1)
+			s.errLogs.Log(s.logger, slog.LevelError, "failed to fetch block, giving up", err,
+				slog.Uint64("slot", slot),
+				slog.Int("attempts", attempt+1),
+			)
+			return
+		}
+
+		delay := BackoffDelay(attempt, s.fetchRetryBase, s.fetchRetryMax)
+		s.errLogs.Log(s.logger, slog.LevelWarn, "failed to fetch block, retrying", err,
+			slog.Uint64("slot", slot),
+			slog.Duration("delay", delay),
+		)
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// FailedSlots returns the number of slots whose blocks could not be fetched
+// even after retries. Their transactions are not processed.
+func (s *solanaMainnetSubscriber) FailedSlots() uint64 {
+	return s.failedSlots.Load()
+}
+
+// Json rpc error codes of slots without a block
+const (
+	solanaSlotSkippedCode            = -32007
+	solanaLongTermStorageSkippedCode = -32009
+)
+
+// isSkippedSlotError returns true if err reports that the slot was skipped
+// and has no block, so that fetching it again is pointless.
+func isSkippedSlotError(err error) bool {
+	var rpcErr *rpc.JsonRpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	return rpcErr.Code == solanaSlotSkippedCode || rpcErr.Code == solanaLongTermStorageSkippedCode
+}
+
 // Fetch block fetches a block for given slot and processes all transactions in
 // it and sends them via provided out channel. Only transasctions with non 0
 // transfer amount are processed.
 func (s *solanaMainnetSubscriber) fetchBlock(slot uint64, out chan<- *TrackedWalletEvent) error {
 	start := time.Now()
-	block, err := s.getBlock(context.Background(), slot)
+	block, err := s.getBlock(s.ctx, slot)
 	fetchEnd := time.Since(start)
 
 	if err != nil {
+		if !isSkippedSlotError(err) {
+			metrics.RPCErrors.Inc(string(s.Name()))
+		}
 		return err
 	}
-	for _, tx := range block.Transactions {
+	metrics.BlockFetchDuration.Observe(string(s.Name()), fetchEnd.Seconds())
+	blockTime := time.Time{}
+	if block.BlockTime != nil {
+		blockTime = block.BlockTime.UTC()
+	}
+	historical := s.isCatchUpSlot(slot)
+
+	for txIndex, tx := range block.Transactions {
 		if tx.Meta == nil || len(tx.Transaction.Message.Accounts) == 0 {
 			continue
 		}
+		if s.skipVoteTxs && isSolanaVoteTx(tx) {
+			continue
+		}
 
 		// Data should be consistent, if not, skip the transaction.
 		if len(tx.Meta.PostBalances) != len(tx.Meta.PreBalances) {
 			continue
 		}
+		// Failed transactions only charge the fee payer
+		failed := tx.Meta.Err != nil
+		if failed && s.failedTxs != FailedTxsInclude {
+			continue
+		}
 
 		senderWalletsStr := []string{}
 		senderWallets := []common.PublicKey{}
 		senderAmounts := []int64{}
+		senderIndexes := []int{}
 		recipientWalletsStr := []string{}
 		recipientWallets := []common.PublicKey{}
 		recipientAmouts := []int64{}
+		recipientIndexes := []int{}
 
+		changed := []common.PublicKey{}
 		for i, account := range tx.Transaction.Message.Accounts {
-			solChange := tx.Meta.PostBalances[i] - tx.Meta.PreBalances[i]
-			// Skip 0 amount addresses
-			if solChange == 0 {
+			if tx.Meta.PostBalances[i] != tx.Meta.PreBalances[i] {
+				changed = append(changed, account)
+			}
+		}
+		programAccounts := s.programAccounts(changed)
+		var closures map[int]int64
+		if s.skipAccountClosures {
+			closures = solanaAccountClosures(tx)
+		}
+
+		for i, account := range tx.Transaction.Message.Accounts {
+			solChange := tx.Meta.PostBalances[i] - tx.Meta.PreBalances[i] - closures[i]
+			// Skip 0 amount and non wallet addresses
+			if solChange == 0 || programAccounts[account] {
 				continue
 			}
 			// Sender
@@ -145,37 +423,90 @@ func (s *solanaMainnetSubscriber) fetchBlock(slot uint64, out chan<- *TrackedWal
 				senderWallets = append(senderWallets, account)
 				// Amount is negative for sender
 				senderAmounts = append(senderAmounts, -solChange)
+				senderIndexes = append(senderIndexes, i)
 			} else {
 				// Recipient
 				recipientWalletsStr = append(recipientWalletsStr, account.String())
 				recipientWallets = append(recipientWallets, account)
 				recipientAmouts = append(recipientAmouts, solChange)
+				recipientIndexes = append(recipientIndexes, i)
 			}
 		}
+		txHash := ""
+		if len(tx.Transaction.Signatures) > 0 {
+			txHash = base58.Encode(tx.Transaction.Signatures[0])
+		}
 		recipientsCommaSep := strings.Join(recipientWalletsStr, ",")
 		sendersCommaSep := strings.Join(senderWalletsStr, ",")
 
+		events := []*TrackedWalletEvent{}
 		for i := range senderWalletsStr {
-			s.mu.RLock()
-			_, send := s.registeredWallets[senderWallets[i]]
-			s.mu.RUnlock()
-			if send {
-				out <- constructSolanaTransactionEvent(senderWalletsStr[i], recipientsCommaSep, senderAmounts[i], int64(tx.Meta.Fee))
+			if !s.isTrackedWallet(senderWallets[i]) {
+				continue
 			}
+			s.markDerivedWalletUsed(senderWallets[i])
+			// Fee is paid by the first account of the transaction only
+			fees := int64(0)
+			if senderIndexes[i] == 0 {
+				fees = int64(tx.Meta.Fee)
+			}
+			event := constructSolanaTransactionEvent(txHash, senderWalletsStr[i], recipientsCommaSep, senderWalletsStr[i], DirectionOutgoing, senderAmounts[i], fees)
+			s.attachBalances(event, tx.Meta, senderIndexes[i])
+			events = append(events, event)
 		}
 		for i := range recipientWalletsStr {
-			s.mu.RLock()
-			_, send := s.registeredWallets[recipientWallets[i]]
-			s.mu.RUnlock()
-			if send {
-				out <- constructSolanaTransactionEvent(sendersCommaSep, recipientWalletsStr[i], recipientAmouts[i], int64(tx.Meta.Fee))
+			if !s.isTrackedWallet(recipientWallets[i]) {
+				continue
 			}
+			s.markDerivedWalletUsed(recipientWallets[i])
+			event := constructSolanaTransactionEvent(txHash, sendersCommaSep, recipientWalletsStr[i], recipientWalletsStr[i], DirectionIncoming, recipientAmouts[i], 0)
+			s.attachBalances(event, tx.Meta, recipientIndexes[i])
+			events = append(events, event)
 		}
 
+		if s.aggregateTransactions && len(events) > 0 {
+			received := int64(0)
+			for _, amount := range recipientAmouts {
+				received += amount
+			}
+			aggregated := constructAggregatedSolanaEvent(txHash, sendersCommaSep, recipientsCommaSep, events[0].Wallet, received, int64(tx.Meta.Fee))
+			// Direction of the wallet the event is emitted for
+			aggregated.direction = events[0].direction
+			events = []*TrackedWalletEvent{aggregated}
+		}
+
+		if s.emitInstructionFlows && len(events) > 0 {
+			flows := solanaInstructionFlows(tx)
+			for _, event := range events {
+				if s.aggregateTransactions {
+					event.Flows = flows
+					continue
+				}
+				event.Flows = walletFlows(flows, event.Wallet)
+			}
+		}
+
+		for _, event := range events {
+			event.BlockNumber = slot
+			event.TxIndex = uint64(txIndex)
+			event.BlockTime = blockTime
+			event.Historical = historical
+			event.Failed = failed
+			if !send(out, event, s.ctx.Done()) {
+				return nil
+			}
+		}
+	}
+	for processed := s.processedSlot.Load(); processed < slot; processed = s.processedSlot.Load() {
+		if s.processedSlot.CompareAndSwap(processed, slot) {
+			break
+		}
 	}
-	slog.Info(
+	metrics.TxsProcessed.Add(string(s.Name()), float64(len(block.Transactions)))
+	metrics.TxProcessingDuration.Observe(string(s.Name()), (time.Since(start) - fetchEnd).Seconds())
+	metrics.BlocksProcessed.Inc(string(s.Name()))
+	s.logger.Info(
 		"processed a block",
-		slog.String("chain", string(s.Name())),
 		slog.Duration("tx_processing_duration", time.Since(start)-fetchEnd),
 		slog.Duration("block_fetch_duration", fetchEnd),
 	)
@@ -183,17 +514,75 @@ func (s *solanaMainnetSubscriber) fetchBlock(slot uint64, out chan<- *TrackedWal
 	return nil
 }
 
-func constructSolanaTransactionEvent(sender, recipient string, amount, fees int64) *TrackedWalletEvent {
+// solanaSlotTime is the approximate time between solana slots
+const solanaSlotTime = 400 * time.Millisecond
+
+// isCatchUpSlot returns true if slot lags behind the tip of the last poll by
+// more than two poll intervals worth of slots. Slots of regular polls are
+// within the lag.
+func (s *solanaMainnetSubscriber) isCatchUpSlot(slot uint64) bool {
+	lag := max(uint64(2*s.pollInterval/solanaSlotTime), 1)
+	return slot+lag < s.tipSlot.Load()
+}
+
+// isTrackedWallet returns true if wallet is tracked and not muted.
+func (s *solanaMainnetSubscriber) isTrackedWallet(wallet common.PublicKey) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.registeredWallets[wallet] && !s.mutedWallets[wallet]
+}
+
+// attachBalances sets pre and post balances of the account at accountIndex on
+// the event if balance context is enabled.
+func (s *solanaMainnetSubscriber) attachBalances(event *TrackedWalletEvent, meta *client.TransactionMeta, accountIndex int) {
+	if !s.emitBalances {
+		return
+	}
+	event.PreBalance = big.NewInt(meta.PreBalances[accountIndex])
+	event.PostBalance = big.NewInt(meta.PostBalances[accountIndex])
+}
+
+// constructAggregatedSolanaEvent constructs the single event of a transaction
+// when transactions are aggregated. Source and Destination contain all
+// senders and recipients, Amount is the total received by recipients and Fees
+// is the transaction fee.
+func constructAggregatedSolanaEvent(txHash, senders, recipients, wallet string, amount, fees int64) *TrackedWalletEvent {
 	return &TrackedWalletEvent{
 		ChainName:   SolanaMainnet,
-		Source:      sender,
-		Destination: recipient,
+		TxHash:      txHash,
+		Wallet:      wallet,
+		Source:      senders,
+		Destination: recipients,
 		Amount:      big.NewInt(amount),
 		Fees:        big.NewInt(fees),
+		// Key doesn't depend on the wallet, which changes with the set of
+		// tracked wallets
+		IdempotencyKey: idempotencyKey(SolanaMainnet, txHash, "", "", NativeAssetID),
+		ObservedAt:     time.Now().UTC(),
+	}
+}
+
+// constructSolanaTransactionEvent builds an event for the tracked wallet which
+// sent or received funds in the transaction.
+func constructSolanaTransactionEvent(txHash, sender, recipient, wallet string, direction Direction, amount, fees int64) *TrackedWalletEvent {
+	return &TrackedWalletEvent{
+		ChainName:      SolanaMainnet,
+		TxHash:         txHash,
+		Wallet:         wallet,
+		Source:         sender,
+		Destination:    recipient,
+		Amount:         big.NewInt(amount),
+		Fees:           big.NewInt(fees),
+		IdempotencyKey: idempotencyKey(SolanaMainnet, txHash, wallet, direction, NativeAssetID),
+		ObservedAt:     time.Now().UTC(),
+		direction:      direction,
 	}
 }
 
 func (e *solanaMainnetSubscriber) TrackWallet(wallet string) error {
+	if e.registeredWallets == nil {
+		return ErrSubscriberNotInitialized
+	}
 	address, err := validateSolanaWallet(wallet)
 	if err != nil {
 		return err
@@ -202,6 +591,7 @@ func (e *solanaMainnetSubscriber) TrackWallet(wallet string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.registeredWallets[address] = true
+	e.walletRefs[address]++
 
 	return nil
 }
@@ -214,15 +604,284 @@ func (e *solanaMainnetSubscriber) UntrackWallet(wallet string) error {
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if e.walletRefs[address] == 0 {
+		return ErrWalletNotTracked
+	}
+	if e.walletRefs[address] > 1 {
+		// Still tracked for other references
+		e.walletRefs[address]--
+		return nil
+	}
 	delete(e.registeredWallets, address)
+	delete(e.walletRefs, address)
+	delete(e.mutedWallets, address)
+	delete(e.derivedWallets, address)
+
+	return nil
+}
+
+func (e *solanaMainnetSubscriber) MuteWallet(wallet string) error {
+	address, err := validateSolanaWallet(wallet)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.registeredWallets[address] {
+		return ErrWalletNotTracked
+	}
+	e.mutedWallets[address] = true
 
 	return nil
 }
 
+func (e *solanaMainnetSubscriber) UnmuteWallet(wallet string) error {
+	address, err := validateSolanaWallet(wallet)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.mutedWallets, address)
+
+	return nil
+}
+
+func (s *solanaMainnetSubscriber) WalletMuted(wallet string) (bool, error) {
+	address, err := validateSolanaWallet(wallet)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.walletRefs[address] == 0 {
+		return false, ErrWalletNotTracked
+	}
+	return s.mutedWallets[address], nil
+}
+
+func (s *solanaMainnetSubscriber) TrackedWallets() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wallets := make([]string, 0, len(s.registeredWallets))
+	for address := range s.registeredWallets {
+		wallets = append(wallets, address.String())
+	}
+	slices.Sort(wallets)
+	return wallets
+}
+
 func (s *solanaMainnetSubscriber) Name() ChainName {
 	return SolanaMainnet
 }
 
+func (s *solanaMainnetSubscriber) ChainTip() (uint64, error) {
+	tip := s.tipSlot.Load()
+	if tip == 0 {
+		return 0, ErrChainTipUnknown
+	}
+	return tip, nil
+}
+
+func (s *solanaMainnetSubscriber) LastProcessedBlock() uint64 {
+	return s.processedSlot.Load()
+}
+
+func (s *solanaMainnetSubscriber) Stop() error {
+	s.stopOnce.Do(func() {
+		s.cancel()
+	})
+	return nil
+}
+
+type SolanaMainnetSubscriberOption interface {
+	Apply(*solanaMainnetSubscriber)
+}
+
+// WithMaxCatchUpSlots limits the number of slots processed when the
+// subscriber lags behind the chain tip.
+type WithMaxCatchUpSlots struct {
+	Slots uint64
+}
+
+func (w WithMaxCatchUpSlots) Apply(s *solanaMainnetSubscriber) {
+	s.maxCatchUpSlots = w.Slots
+}
+
+// WithSlotPollInterval sets how often the latest slot is polled, e.g. to stay
+// within rate limits of the RPC provider. Default is 1s.
+type WithSlotPollInterval struct {
+	Interval time.Duration
+}
+
+func (w WithSlotPollInterval) Apply(s *solanaMainnetSubscriber) {
+	if w.Interval > 0 {
+		s.pollInterval = w.Interval
+	}
+}
+
+// WithSlotFetchWorkers sets the maximum number of blocks fetched
+// concurrently, e.g. when catching up after the subscriber falls behind.
+// Default is 16.
+type WithSlotFetchWorkers struct {
+	Workers int
+}
+
+func (w WithSlotFetchWorkers) Apply(s *solanaMainnetSubscriber) {
+	if w.Workers > 0 {
+		s.fetchWorkers = w.Workers
+	}
+}
+
+// WithSlotFetchRetries sets the number of retries of failed block fetches
+// and bounds of the exponential backoff between them. Defaults are 3 retries
+// with 500ms base and 10s max backoff.
+type WithSlotFetchRetries struct {
+	Retries int
+	Base    time.Duration
+	Max     time.Duration
+}
+
+func (w WithSlotFetchRetries) Apply(s *solanaMainnetSubscriber) {
+	if w.Retries >= 0 {
+		s.fetchRetries = w.Retries
+	}
+	if w.Base > 0 {
+		s.fetchRetryBase = w.Base
+	}
+	if w.Max > 0 {
+		s.fetchRetryMax = w.Max
+	}
+}
+
+// WithBalanceContext enables PreBalance and PostBalance of the tracked wallet
+// in emitted events.
+type WithBalanceContext struct {
+	Enabled bool
+}
+
+func (w WithBalanceContext) Apply(s *solanaMainnetSubscriber) {
+	s.emitBalances = w.Enabled
+}
+
+// WithHDGapLimit sets the number of unused HD wallet addresses tracked after
+// the last used one.
+type WithHDGapLimit struct {
+	Limit uint32
+}
+
+func (w WithHDGapLimit) Apply(s *solanaMainnetSubscriber) {
+	if w.Limit > 0 {
+		s.hdGapLimit = w.Limit
+	}
+}
+
+// WithProgramAccountFilter excludes balance changes of programs and program
+// owned accounts, e.g. token or stake accounts, from sender and recipient
+// classification. Account owners are looked up via RPC and cached.
+type WithProgramAccountFilter struct {
+	Enabled bool
+}
+
+func (w WithProgramAccountFilter) Apply(s *solanaMainnetSubscriber) {
+	s.filterProgramAccounts = w.Enabled
+}
+
+// WithAggregatedTransactions emits a single event per transaction involving
+// tracked wallets, with all senders in Source and all recipients in
+// Destination. Amount is the total received by recipients and Fees is the
+// transaction fee. Wallet is the first tracked sender, or the first tracked
+// recipient if no sender is tracked. By default, an event is emitted for
+// every tracked sender and recipient.
+type WithAggregatedTransactions struct {
+	Enabled bool
+}
+
+func (w WithAggregatedTransactions) Apply(s *solanaMainnetSubscriber) {
+	s.aggregateTransactions = w.Enabled
+}
+
+// WithInstructionFlows attaches SOL transfers parsed from System Program
+// instructions, including inner instructions invoked by other programs, to
+// events. Balance changes only reflect net effects of a transaction, flows
+// attribute them to individual transfers. Events list flows from or to their
+// wallet, aggregated events list all flows of the transaction.
+type WithInstructionFlows struct {
+	Enabled bool
+}
+
+func (w WithInstructionFlows) Apply(s *solanaMainnetSubscriber) {
+	s.emitInstructionFlows = w.Enabled
+}
+
+// WithAccountClosureFilter excludes rent returned by closing token accounts
+// from balance changes. Closed accounts and rent received by the destination
+// of the closure are not reported as transfers.
+type WithAccountClosureFilter struct {
+	Enabled bool
+}
+
+func (w WithAccountClosureFilter) Apply(s *solanaMainnetSubscriber) {
+	s.skipAccountClosures = w.Enabled
+}
+
+// WithVoteFilter skips transactions whose only program is the Vote program
+// before their balance changes are processed, reducing the noise of
+// validator votes flooding every block.
+type WithVoteFilter struct {
+	Enabled bool
+}
+
+func (w WithVoteFilter) Apply(s *solanaMainnetSubscriber) {
+	s.skipVoteTxs = w.Enabled
+}
+
+// FailedTxPolicy controls solana transactions which failed on chain. Their
+// balance changes consist of the fee charged to the fee payer only.
+type FailedTxPolicy string
+
+const (
+	// Failed transactions are not processed
+	FailedTxsExclude FailedTxPolicy = "exclude"
+	// Events of failed transactions are emitted with Failed set
+	FailedTxsInclude FailedTxPolicy = "include"
+)
+
+func ParseFailedTxPolicy(policy string) (FailedTxPolicy, error) {
+	switch p := FailedTxPolicy(policy); p {
+	case FailedTxsExclude, FailedTxsInclude:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported failed transaction policy %q", policy)
+}
+
+// WithFailedTransactions sets the policy of transactions which failed on
+// chain. Default is FailedTxsExclude.
+type WithFailedTransactions struct {
+	Policy FailedTxPolicy
+}
+
+func (w WithFailedTransactions) Apply(s *solanaMainnetSubscriber) {
+	s.failedTxs = w.Policy
+}
+
+// WithSolanaLogger sets the logger of the subscriber, e.g. one with instance
+// attributes attached. The chain attribute is added by the subscriber.
+// Default is slog.Default().
+type WithSolanaLogger struct {
+	Logger *slog.Logger
+}
+
+func (w WithSolanaLogger) Apply(s *solanaMainnetSubscriber) {
+	if w.Logger != nil {
+		s.logger = w.Logger
+	}
+}
+
 func validateSolanaWallet(wallet string) (common.PublicKey, error) {
 	b, err := base58.Decode(wallet)
 	if err != nil {
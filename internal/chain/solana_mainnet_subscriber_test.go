@@ -2,14 +2,25 @@ package chain
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 	"github.com/blocto/solana-go-sdk/client"
 	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/rpc"
 	"github.com/blocto/solana-go-sdk/types"
+	"github.com/mr-tron/base58"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,6 +30,9 @@ func TestFetchBlock(t *testing.T) {
 	acc3 := types.NewAccount() // anything
 	acc4 := types.NewAccount() // anything
 	acc5 := types.NewAccount() // anything
+	sig := types.Signature("deblock-test-signature")
+	sigStr := base58.Encode(sig)
+	blockTime := time.Unix(1730000000, 0)
 
 	tests := []struct {
 		name            string
@@ -27,6 +41,7 @@ func TestFetchBlock(t *testing.T) {
 		wantErr         string
 		wantEvents      []*TrackedWalletEvent
 		registerWallets []string
+		muteWallets     []string
 	}{
 		{
 			name: "failed to get block",
@@ -79,6 +94,7 @@ func TestFetchBlock(t *testing.T) {
 			name: "correctly returns events for tracked wallet",
 			getBlcok: func(ctx context.Context, slot uint64) (*client.Block, error) {
 				b := &client.Block{
+					BlockTime: &blockTime,
 					Transactions: []client.BlockTransaction{
 						{
 							Meta: &client.TransactionMeta{
@@ -87,6 +103,7 @@ func TestFetchBlock(t *testing.T) {
 								Fee:          57,
 							},
 							Transaction: types.Transaction{
+								Signatures: []types.Signature{sig},
 								Message: types.Message{
 									Accounts: []common.PublicKey{
 										acc1.PublicKey, // sender
@@ -106,6 +123,8 @@ func TestFetchBlock(t *testing.T) {
 			wantEvents: []*TrackedWalletEvent{
 				{
 					ChainName: SolanaMainnet,
+					TxHash:    sigStr,
+					Wallet:    acc1.PublicKey.String(),
 					Source:    acc1.PublicKey.String(),
 					Destination: strings.Join(
 						[]string{
@@ -114,11 +133,17 @@ func TestFetchBlock(t *testing.T) {
 						},
 						",",
 					),
-					Amount: big.NewInt(250),
-					Fees:   big.NewInt(57),
+					Amount:         big.NewInt(250),
+					Fees:           big.NewInt(57),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, sigStr, acc1.PublicKey.String(), DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    500,
+					BlockTime:      blockTime.UTC(),
 				},
 				{
 					ChainName:   SolanaMainnet,
+					TxHash:      sigStr,
+					Wallet:      acc4.PublicKey.String(),
 					Destination: acc4.PublicKey.String(),
 					Source: strings.Join(
 						[]string{
@@ -127,8 +152,12 @@ func TestFetchBlock(t *testing.T) {
 						},
 						",",
 					),
-					Amount: big.NewInt(50),
-					Fees:   big.NewInt(57),
+					Amount:         big.NewInt(50),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, sigStr, acc4.PublicKey.String(), DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    500,
+					BlockTime:      blockTime.UTC(),
 				},
 			},
 			registerWallets: []string{
@@ -136,6 +165,77 @@ func TestFetchBlock(t *testing.T) {
 				acc4.PublicKey.String(),
 			},
 		},
+		{
+			name: "fee is attributed to the fee payer only",
+			getBlcok: func(ctx context.Context, slot uint64) (*client.Block, error) {
+				b := &client.Block{
+					Transactions: []client.BlockTransaction{
+						{
+							Meta: &client.TransactionMeta{
+								PreBalances:  []int64{1250, 500, 150},
+								PostBalances: []int64{1000, 800, 100},
+								Fee:          57,
+							},
+							Transaction: types.Transaction{
+								Signatures: []types.Signature{sig},
+								Message: types.Message{
+									Accounts: []common.PublicKey{
+										acc1.PublicKey, // fee payer, sender
+										acc2.PublicKey, // receiver
+										acc3.PublicKey, // sender
+									},
+								},
+							},
+						},
+					},
+				}
+				return b, nil
+			},
+			slot: 500,
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      SolanaMainnet,
+					TxHash:         sigStr,
+					Wallet:         acc1.PublicKey.String(),
+					Source:         acc1.PublicKey.String(),
+					Destination:    acc2.PublicKey.String(),
+					Amount:         big.NewInt(250),
+					Fees:           big.NewInt(57),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, sigStr, acc1.PublicKey.String(), DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    500,
+				},
+				{
+					ChainName:      SolanaMainnet,
+					TxHash:         sigStr,
+					Wallet:         acc3.PublicKey.String(),
+					Source:         acc3.PublicKey.String(),
+					Destination:    acc2.PublicKey.String(),
+					Amount:         big.NewInt(50),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, sigStr, acc3.PublicKey.String(), DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    500,
+				},
+				{
+					ChainName:      SolanaMainnet,
+					TxHash:         sigStr,
+					Wallet:         acc2.PublicKey.String(),
+					Source:         acc1.PublicKey.String() + "," + acc3.PublicKey.String(),
+					Destination:    acc2.PublicKey.String(),
+					Amount:         big.NewInt(300),
+					Fees:           big.NewInt(0),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, sigStr, acc2.PublicKey.String(), DirectionIncoming, NativeAssetID),
+					direction:      DirectionIncoming,
+					BlockNumber:    500,
+				},
+			},
+			registerWallets: []string{
+				acc1.PublicKey.String(),
+				acc2.PublicKey.String(),
+				acc3.PublicKey.String(),
+			},
+		},
 		{
 			name: "correctly returns no events for non-tracked wallet",
 			getBlcok: func(ctx context.Context, slot uint64) (*client.Block, error) {
@@ -164,6 +264,52 @@ func TestFetchBlock(t *testing.T) {
 			wantEvents:      []*TrackedWalletEvent{},
 			registerWallets: []string{},
 		},
+		{
+			name: "correctly returns events only for unmuted tracked wallet",
+			getBlcok: func(ctx context.Context, slot uint64) (*client.Block, error) {
+				b := &client.Block{
+					Transactions: []client.BlockTransaction{
+						{
+							Meta: &client.TransactionMeta{
+								PreBalances:  []int64{1250, 500},
+								PostBalances: []int64{1000, 750},
+								Fee:          57,
+							},
+							Transaction: types.Transaction{
+								Message: types.Message{
+									Accounts: []common.PublicKey{
+										acc1.PublicKey,
+										acc2.PublicKey,
+									},
+								},
+							},
+						},
+					},
+				}
+				return b, nil
+			},
+			slot: 500,
+			wantEvents: []*TrackedWalletEvent{
+				{
+					ChainName:      SolanaMainnet,
+					Wallet:         acc1.PublicKey.String(),
+					Source:         acc1.PublicKey.String(),
+					Destination:    acc2.PublicKey.String(),
+					Amount:         big.NewInt(250),
+					Fees:           big.NewInt(57),
+					IdempotencyKey: idempotencyKey(SolanaMainnet, "", acc1.PublicKey.String(), DirectionOutgoing, NativeAssetID),
+					direction:      DirectionOutgoing,
+					BlockNumber:    500,
+				},
+			},
+			registerWallets: []string{
+				acc1.PublicKey.String(),
+				acc2.PublicKey.String(),
+			},
+			muteWallets: []string{
+				acc2.PublicKey.String(),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -176,6 +322,10 @@ func TestFetchBlock(t *testing.T) {
 				err := s.TrackWallet(w)
 				assert.NoError(t, err)
 			}
+			for _, w := range tt.muteWallets {
+				err := s.MuteWallet(w)
+				assert.NoError(t, err)
+			}
 
 			ch := make(chan *TrackedWalletEvent)
 			chErr := make(chan error)
@@ -213,8 +363,853 @@ func TestFetchBlock(t *testing.T) {
 				assert.EqualError(t, err, tt.wantErr)
 			} else {
 
+				for _, e := range events {
+					assert.False(t, e.ObservedAt.IsZero())
+					assert.False(t, e.ObservedAt.Before(e.BlockTime))
+					// Wall clock dependent
+					e.ObservedAt = time.Time{}
+				}
 				assert.Equal(t, tt.wantEvents, events)
 			}
 		})
 	}
 }
+
+func TestSolanaMuteWallet(t *testing.T) {
+	acc := types.NewAccount()
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+
+	err := s.MuteWallet(acc.PublicKey.String())
+	assert.ErrorIs(t, err, ErrWalletNotTracked)
+
+	assert.NoError(t, s.TrackWallet(acc.PublicKey.String()))
+	assert.NoError(t, s.MuteWallet(acc.PublicKey.String()))
+	assert.True(t, s.registeredWallets[acc.PublicKey])
+	assert.True(t, s.mutedWallets[acc.PublicKey])
+
+	assert.NoError(t, s.UnmuteWallet(acc.PublicKey.String()))
+	assert.False(t, s.mutedWallets[acc.PublicKey])
+	assert.True(t, s.registeredWallets[acc.PublicKey])
+}
+
+func TestSolanaCatchUpStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxCatchUp  uint64
+		currentSlot uint64
+		tip         uint64
+		want        uint64
+	}{
+		{
+			name:        "no limit",
+			maxCatchUp:  0,
+			currentSlot: 100,
+			tip:         10000,
+			want:        100,
+		},
+		{
+			name:        "gap within limit",
+			maxCatchUp:  50,
+			currentSlot: 100,
+			tip:         120,
+			want:        100,
+		},
+		{
+			name:        "gap exceeds limit",
+			maxCatchUp:  50,
+			currentSlot: 100,
+			tip:         10000,
+			want:        9950,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSolanaMainnetSubscriber(
+				"alchemy-or-other-rpc-url",
+				WithMaxCatchUpSlots{Slots: tt.maxCatchUp},
+			)
+			s.currentSlot = tt.currentSlot
+			assert.Equal(t, tt.want, s.catchUpStart(tt.tip))
+		})
+	}
+}
+
+func TestSolanaIdempotencyKeyStableAcrossReEmissions(t *testing.T) {
+	sender := types.NewAccount()
+	recipient := types.NewAccount()
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1250, 500},
+						PostBalances: []int64{1000, 750},
+					},
+					Transaction: types.Transaction{
+						Signatures: []types.Signature{types.Signature("sig")},
+						Message: types.Message{
+							Accounts: []common.PublicKey{sender.PublicKey, recipient.PublicKey},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(sender.PublicKey.String()))
+	assert.NoError(t, s.TrackWallet(recipient.PublicKey.String()))
+
+	fetch := func() []*TrackedWalletEvent {
+		ch := make(chan *TrackedWalletEvent, 10)
+		assert.NoError(t, s.fetchBlock(500, ch))
+		close(ch)
+		events := []*TrackedWalletEvent{}
+		for e := range ch {
+			events = append(events, e)
+		}
+		return events
+	}
+
+	first, second := fetch(), fetch()
+	assert.Len(t, first, 2)
+	assert.Len(t, second, 2)
+	for i := range first {
+		assert.NotEmpty(t, first[i].IdempotencyKey)
+		assert.Equal(t, first[i].IdempotencyKey, second[i].IdempotencyKey)
+	}
+	// Sender and recipient events of the same tx are distinct events
+	assert.NotEqual(t, first[0].IdempotencyKey, first[1].IdempotencyKey)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	base := idempotencyKey(SolanaMainnet, "tx", "wallet", DirectionIncoming, NativeAssetID)
+	assert.Equal(t, base, idempotencyKey(SolanaMainnet, "tx", "wallet", DirectionIncoming, NativeAssetID))
+
+	distinct := []string{
+		idempotencyKey(EthereumMainnet, "tx", "wallet", DirectionIncoming, NativeAssetID),
+		idempotencyKey(SolanaMainnet, "tx2", "wallet", DirectionIncoming, NativeAssetID),
+		idempotencyKey(SolanaMainnet, "tx", "wallet2", DirectionIncoming, NativeAssetID),
+		idempotencyKey(SolanaMainnet, "tx", "wallet", DirectionOutgoing, NativeAssetID),
+		idempotencyKey(SolanaMainnet, "tx", "wallet", DirectionIncoming, "usdc"),
+	}
+	for _, k := range distinct {
+		assert.NotEqual(t, base, k)
+	}
+}
+
+func TestSolanaStop(t *testing.T) {
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		return 0, nil
+	}
+
+	events, errs := s.Start()
+	assert.NoError(t, s.Stop())
+	// Stop is idempotent
+	assert.NoError(t, s.Stop())
+
+	for _, closed := range []func() bool{
+		func() bool { _, ok := <-events; return !ok },
+		func() bool { _, ok := <-errs; return !ok },
+	} {
+		done := make(chan bool)
+		go func() { done <- closed() }()
+		select {
+		case ok := <-done:
+			assert.True(t, ok)
+		case <-time.After(2 * time.Second):
+			t.Fatal("channel was not closed after Stop")
+		}
+	}
+}
+
+func TestSolanaBalanceContext(t *testing.T) {
+	sender := types.NewAccount()
+	recipient := types.NewAccount()
+	getBlock := func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1250, 500},
+						PostBalances: []int64{1000, 750},
+					},
+					Transaction: types.Transaction{
+						Message: types.Message{
+							Accounts: []common.PublicKey{sender.PublicKey, recipient.PublicKey},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	fetch := func(s *solanaMainnetSubscriber) []*TrackedWalletEvent {
+		s.getBlock = getBlock
+		assert.NoError(t, s.TrackWallet(sender.PublicKey.String()))
+		assert.NoError(t, s.TrackWallet(recipient.PublicKey.String()))
+		ch := make(chan *TrackedWalletEvent, 10)
+		assert.NoError(t, s.fetchBlock(500, ch))
+		close(ch)
+		events := []*TrackedWalletEvent{}
+		for e := range ch {
+			events = append(events, e)
+		}
+		return events
+	}
+
+	events := fetch(NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithBalanceContext{Enabled: true}))
+	assert.Len(t, events, 2)
+	assert.Equal(t, big.NewInt(1250), events[0].PreBalance)
+	assert.Equal(t, big.NewInt(1000), events[0].PostBalance)
+	assert.Equal(t, big.NewInt(500), events[1].PreBalance)
+	assert.Equal(t, big.NewInt(750), events[1].PostBalance)
+
+	events = fetch(NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url"))
+	assert.Len(t, events, 2)
+	for _, e := range events {
+		assert.Nil(t, e.PreBalance)
+		assert.Nil(t, e.PostBalance)
+		b, err := json.Marshal(e)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(b), "PreBalance")
+	}
+}
+
+func TestSolanaConfirmedSlots(t *testing.T) {
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlocks = func(ctx context.Context, start, end uint64) ([]uint64, error) {
+		assert.Equal(t, uint64(100), start)
+		assert.Equal(t, uint64(109), end)
+		return []uint64{100, 103, 109}, nil
+	}
+	assert.Equal(t, []uint64{100, 103, 109}, s.confirmedSlots(100, 110))
+	assert.Empty(t, s.confirmedSlots(110, 110))
+
+	// Every slot is fetched when confirmed slots are unavailable
+	s.getBlocks = func(ctx context.Context, start, end uint64) ([]uint64, error) {
+		return nil, assert.AnError
+	}
+	assert.Equal(t, []uint64{100, 101, 102}, s.confirmedSlots(100, 103))
+}
+
+func TestSolanaCatchUpSkipsSkippedSlots(t *testing.T) {
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.currentSlot = 100
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		return 110, nil
+	}
+	confirmed := []uint64{101, 104, 105, 109}
+	s.getBlocks = func(ctx context.Context, start, end uint64) ([]uint64, error) {
+		return confirmed, nil
+	}
+	fetched := make(chan uint64, 20)
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		fetched <- slot
+		return &client.Block{}, nil
+	}
+
+	s.Start()
+	got := []uint64{}
+	for range confirmed {
+		select {
+		case slot := <-fetched:
+			got = append(got, slot)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected %d fetched slots, got %d", len(confirmed), len(got))
+		}
+	}
+	assert.NoError(t, s.Stop())
+	assert.ElementsMatch(t, confirmed, got)
+
+	select {
+	case slot := <-fetched:
+		t.Fatalf("skipped slot %d was fetched", slot)
+	default:
+	}
+}
+
+func TestSolanaTxIndex(t *testing.T) {
+	sender := types.NewAccount()
+	tracked := types.NewAccount()
+	transfer := func(sig string) client.BlockTransaction {
+		return client.BlockTransaction{
+			Meta: &client.TransactionMeta{
+				PreBalances:  []int64{1000, 0},
+				PostBalances: []int64{900, 95},
+				Fee:          5,
+			},
+			Transaction: types.Transaction{
+				Signatures: []types.Signature{types.Signature(sig)},
+				Message: types.Message{
+					Accounts: []common.PublicKey{sender.PublicKey, tracked.PublicKey},
+				},
+			},
+		}
+	}
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				// Skipped transactions keep their position
+				{Meta: nil},
+				transfer("deblock-test-signature-1"),
+				transfer("deblock-test-signature-2"),
+			},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(tracked.PublicKey.String()))
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+	close(events)
+
+	got := []*TrackedWalletEvent{}
+	for event := range events {
+		got = append(got, event)
+	}
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, base58.Encode([]byte("deblock-test-signature-1")), got[0].TxHash)
+		assert.Equal(t, uint64(1), got[0].TxIndex)
+		assert.Equal(t, base58.Encode([]byte("deblock-test-signature-2")), got[1].TxHash)
+		assert.Equal(t, uint64(2), got[1].TxIndex)
+	}
+}
+
+func TestSolanaUserWalletMinAmount(t *testing.T) {
+	sender := types.NewAccount()
+	tracked := types.NewAccount()
+	transfer := func(sig string, amount int64) client.BlockTransaction {
+		return client.BlockTransaction{
+			Meta: &client.TransactionMeta{
+				PreBalances:  []int64{10_000, 0},
+				PostBalances: []int64{10_000 - amount - 5, amount},
+				Fee:          5,
+			},
+			Transaction: types.Transaction{
+				Signatures: []types.Signature{types.Signature(sig)},
+				Message: types.Message{
+					Accounts: []common.PublicKey{sender.PublicKey, tracked.PublicKey},
+				},
+			},
+		}
+	}
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				transfer("deblock-test-signature-1", 890),
+				transfer("deblock-test-signature-2", 5000),
+				transfer("deblock-test-signature-3", 900),
+			},
+		}, nil
+	}
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[SolanaMainnet] = s
+	assert.NoError(t, m.TrackUserWallet(1, tracked.PublicKey.String(), SolanaMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, tracked.PublicKey.String(), SolanaMainnet))
+	assert.NoError(t, m.SetWalletMinAmount(1, tracked.PublicKey.String(), SolanaMainnet, big.NewInt(900)))
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+
+	amounts := map[int][]int64{}
+	for _, event := range fanOut(m, s, takeEvents(events)) {
+		amounts[event.UserID] = append(amounts[event.UserID], event.Amount.Int64())
+	}
+	assert.Equal(t, map[int][]int64{
+		1: {5000, 900},
+		2: {890, 5000, 900},
+	}, amounts)
+}
+
+func TestSolanaEventDirections(t *testing.T) {
+	sender := types.NewAccount()
+	recipient := types.NewAccount()
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{{
+				Meta: &client.TransactionMeta{
+					PreBalances:  []int64{1000, 0},
+					PostBalances: []int64{900, 95},
+					Fee:          5,
+				},
+				Transaction: types.Transaction{
+					Signatures: []types.Signature{types.Signature("deblock-test-signature-1")},
+					Message: types.Message{
+						Accounts: []common.PublicKey{sender.PublicKey, recipient.PublicKey},
+					},
+				},
+			}},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(sender.PublicKey.String()))
+	assert.NoError(t, s.TrackWallet(recipient.PublicKey.String()))
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+
+	// Incoming means a positive balance change
+	assert.Equal(t, map[string]Direction{
+		sender.PublicKey.String():    DirectionOutgoing,
+		recipient.PublicKey.String(): DirectionIncoming,
+	}, directionsOf(events))
+}
+
+func TestSolanaAggregatedTransactions(t *testing.T) {
+	sender := types.NewAccount()
+	recipient1 := types.NewAccount()
+	recipient2 := types.NewAccount()
+	sig := base58.Encode([]byte("deblock-test-signature"))
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithAggregatedTransactions{Enabled: true})
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1000, 0, 0},
+						PostBalances: []int64{845, 95, 55},
+						Fee:          5,
+					},
+					Transaction: types.Transaction{
+						Signatures: []types.Signature{types.Signature("deblock-test-signature")},
+						Message: types.Message{
+							Accounts: []common.PublicKey{sender.PublicKey, recipient1.PublicKey, recipient2.PublicKey},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+	// Both sides of the transaction are tracked
+	assert.NoError(t, s.TrackWallet(sender.PublicKey.String()))
+	assert.NoError(t, s.TrackWallet(recipient2.PublicKey.String()))
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+	close(events)
+
+	if assert.Len(t, events, 1) {
+		event := <-events
+		event.ObservedAt = time.Time{}
+		assert.Equal(t, &TrackedWalletEvent{
+			ChainName:      SolanaMainnet,
+			TxHash:         sig,
+			Wallet:         sender.PublicKey.String(),
+			Source:         sender.PublicKey.String(),
+			Destination:    recipient1.PublicKey.String() + "," + recipient2.PublicKey.String(),
+			Amount:         big.NewInt(150),
+			Fees:           big.NewInt(5),
+			IdempotencyKey: idempotencyKey(SolanaMainnet, sig, "", "", NativeAssetID),
+			BlockNumber:    500,
+			direction:      DirectionOutgoing,
+		}, event)
+	}
+}
+
+func TestSolanaChainTip(t *testing.T) {
+	s := NewSolanaMainnetSubscriber(
+		"alchemy-or-other-rpc-url",
+		WithSlotPollInterval{Interval: time.Millisecond},
+	)
+	_, err := s.ChainTip()
+	assert.ErrorIs(t, err, ErrChainTipUnknown)
+
+	var slot atomic.Uint64
+	slot.Store(1000)
+	s.currentSlot = 999
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		return slot.Load(), nil
+	}
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{}, nil
+	}
+
+	s.Start()
+	defer s.Stop()
+	tipIs := func(want uint64) func() bool {
+		return func() bool {
+			tip, err := s.ChainTip()
+			return err == nil && tip == want
+		}
+	}
+	assert.Eventually(t, tipIs(1000), time.Second, time.Millisecond)
+	slot.Store(1005)
+	assert.Eventually(t, tipIs(1005), time.Second, time.Millisecond)
+}
+
+func TestSolanaPollInterval(t *testing.T) {
+	assert.Equal(t, time.Second, NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url").pollInterval)
+
+	s := NewSolanaMainnetSubscriber(
+		"alchemy-or-other-rpc-url",
+		WithSlotPollInterval{Interval: 10 * time.Millisecond},
+	)
+	var polls atomic.Int64
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		polls.Add(1)
+		return 0, nil
+	}
+
+	s.Start()
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, s.Stop())
+
+	// ~20 polls, with a margin for slow CI machines
+	assert.GreaterOrEqual(t, polls.Load(), int64(5))
+	assert.LessOrEqual(t, polls.Load(), int64(21))
+}
+
+func TestSolanaFetchConcurrencyBounded(t *testing.T) {
+	const workers = 4
+	s := NewSolanaMainnetSubscriber(
+		"alchemy-or-other-rpc-url",
+		WithSlotPollInterval{Interval: time.Millisecond},
+		WithSlotFetchWorkers{Workers: workers},
+	)
+	// 1000 slot gap
+	s.currentSlot = 0
+	s.getSlot = func(ctx context.Context) (uint64, error) {
+		return 1000, nil
+	}
+
+	var inFlight, maxInFlight, fetched atomic.Int64
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+		fetched.Add(1)
+		return &client.Block{}, nil
+	}
+
+	s.Start()
+	defer s.Stop()
+	assert.Eventually(t, func() bool {
+		return fetched.Load() == 1000
+	}, 10*time.Second, time.Millisecond)
+	assert.LessOrEqual(t, maxInFlight.Load(), int64(workers))
+	assert.Greater(t, maxInFlight.Load(), int64(1))
+}
+
+func TestSolanaFetchBlockRetries(t *testing.T) {
+	tracked := types.NewAccount()
+	block := &client.Block{
+		Transactions: []client.BlockTransaction{
+			{
+				Meta: &client.TransactionMeta{
+					PreBalances:  []int64{1000, 0},
+					PostBalances: []int64{900, 95},
+					Fee:          5,
+				},
+				Transaction: types.Transaction{
+					Message: types.Message{
+						Accounts: []common.PublicKey{types.NewAccount().PublicKey, tracked.PublicKey},
+					},
+				},
+			},
+		},
+	}
+	skipped := &rpc.JsonRpcError{
+		Code:    -32007,
+		Message: "Slot 500 was skipped, or missing due to ledger jump to recent snapshot",
+	}
+
+	tests := []struct {
+		name            string
+		errs            []error
+		wantCalls       int
+		wantEvents      int
+		wantFailedSlots uint64
+	}{
+		{
+			name:       "fails twice then succeeds",
+			errs:       []error{assert.AnError, assert.AnError},
+			wantCalls:  3,
+			wantEvents: 1,
+		},
+		{
+			name:      "skipped slot is not retried",
+			errs:      []error{skipped},
+			wantCalls: 1,
+		},
+		{
+			name:      "wrapped skipped slot error",
+			errs:      []error{fmt.Errorf("get block: %w", skipped)},
+			wantCalls: 1,
+		},
+		{
+			name:            "gives up after retries",
+			errs:            []error{assert.AnError, assert.AnError, assert.AnError, assert.AnError},
+			wantCalls:       4,
+			wantFailedSlots: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSolanaMainnetSubscriber(
+				"alchemy-or-other-rpc-url",
+				WithSlotFetchRetries{Retries: 3, Base: time.Millisecond, Max: time.Millisecond},
+			)
+			calls := 0
+			s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+				assert.Equal(t, uint64(500), slot)
+				calls++
+				if calls <= len(tt.errs) {
+					return nil, tt.errs[calls-1]
+				}
+				return block, nil
+			}
+			assert.NoError(t, s.TrackWallet(tracked.PublicKey.String()))
+
+			out := make(chan *TrackedWalletEvent, 10)
+			s.fetchBlockWithRetries(500, out)
+			close(out)
+
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Len(t, out, tt.wantEvents)
+			assert.Equal(t, tt.wantFailedSlots, s.FailedSlots())
+		})
+	}
+}
+
+func TestSolanaLogger(t *testing.T) {
+	logger, buf := newTestLogger()
+	s := NewSolanaMainnetSubscriber(
+		"alchemy-or-other-rpc-url",
+		WithSolanaLogger{Logger: logger},
+		WithMaxCatchUpSlots{Slots: 10},
+	)
+	s.currentSlot = 100
+
+	assert.Equal(t, uint64(190), s.catchUpStart(200))
+	assertLogged(t, buf, SolanaMainnet, "catch-up gap exceeds the limit, skipping older slots")
+}
+
+func TestSolanaHistoricalEvents(t *testing.T) {
+	tracked := types.NewAccount()
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithSlotPollInterval{Interval: time.Second})
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1000, 0},
+						PostBalances: []int64{900, 95},
+						Fee:          5,
+					},
+					Transaction: types.Transaction{
+						Message: types.Message{
+							Accounts: []common.PublicKey{types.NewAccount().PublicKey, tracked.PublicKey},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(tracked.PublicKey.String()))
+	s.tipSlot.Store(1000)
+
+	events := make(chan *TrackedWalletEvent, 2)
+	// Two poll intervals are 5 slots
+	assert.NoError(t, s.fetchBlock(994, events))
+	assert.NoError(t, s.fetchBlock(995, events))
+	close(events)
+
+	assert.True(t, (<-events).Historical)
+	assert.False(t, (<-events).Historical)
+}
+
+// scrapeMetric returns the value of the metric of chain served by the default
+// metrics registry.
+func scrapeMetric(t *testing.T, name string, chain ChainName) float64 {
+	t.Helper()
+	ts := httptest.NewServer(metrics.Default.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/metrics")
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	prefix := fmt.Sprintf("%s{chain=%q} ", name, chain)
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			assert.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+func TestSolanaSubscriberMetrics(t *testing.T) {
+	payer, tokenAccount, recipient := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		if slot == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &client.Block{
+			Transactions: []client.BlockTransaction{closureTx(payer, tokenAccount, recipient, payer)},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(recipient.String()))
+
+	blocks := scrapeMetric(t, "blocks_processed_total", SolanaMainnet)
+	fetches := scrapeMetric(t, "block_fetch_duration_seconds_count", SolanaMainnet)
+	processing := scrapeMetric(t, "tx_processing_duration_seconds_count", SolanaMainnet)
+	rpcErrors := scrapeMetric(t, "rpc_errors_total", SolanaMainnet)
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+	assert.Error(t, s.fetchBlock(0, events))
+	assert.Len(t, events, 1)
+
+	assert.Equal(t, blocks+1, scrapeMetric(t, "blocks_processed_total", SolanaMainnet))
+	assert.Equal(t, fetches+1, scrapeMetric(t, "block_fetch_duration_seconds_count", SolanaMainnet))
+	assert.Equal(t, processing+1, scrapeMetric(t, "tx_processing_duration_seconds_count", SolanaMainnet))
+	assert.Equal(t, rpcErrors+1, scrapeMetric(t, "rpc_errors_total", SolanaMainnet))
+}
+
+func TestSolanaFailedTransactions(t *testing.T) {
+	payer, recipient := types.NewAccount().PublicKey, types.NewAccount().PublicKey
+	// Transfer which failed on chain, only the fee is charged
+	failedTx := client.BlockTransaction{
+		Meta: &client.TransactionMeta{
+			Err:          map[string]any{"InstructionError": []any{0, "InsufficientFunds"}},
+			PreBalances:  []int64{1000, 0, 1},
+			PostBalances: []int64{995, 0, 1},
+			Fee:          5,
+		},
+		Transaction: types.Transaction{
+			Signatures: []types.Signature{types.Signature("failed")},
+			Message: types.Message{
+				Accounts: []common.PublicKey{payer, recipient, common.SystemProgramID},
+			},
+		},
+	}
+	succeededTx := closureTx(payer, types.NewAccount().PublicKey, recipient, payer)
+	succeededTx.Transaction.Signatures = []types.Signature{types.Signature("succeeded")}
+
+	tests := []struct {
+		name       string
+		opts       []SolanaMainnetSubscriberOption
+		wantFailed bool
+	}{
+		{name: "excluded by default"},
+		{
+			name: "excluded",
+			opts: []SolanaMainnetSubscriberOption{WithFailedTransactions{Policy: FailedTxsExclude}},
+		},
+		{
+			name:       "included",
+			opts:       []SolanaMainnetSubscriberOption{WithFailedTransactions{Policy: FailedTxsInclude}},
+			wantFailed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", tt.opts...)
+			s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+				return &client.Block{Transactions: []client.BlockTransaction{failedTx, succeededTx}}, nil
+			}
+			assert.NoError(t, s.TrackWallet(payer.String()))
+
+			events := make(chan *TrackedWalletEvent, 10)
+			assert.NoError(t, s.fetchBlock(500, events))
+			close(events)
+
+			got := map[string]*TrackedWalletEvent{}
+			for event := range events {
+				got[event.TxHash] = event
+			}
+			if assert.Contains(t, got, base58.Encode(succeededTx.Transaction.Signatures[0])) {
+				assert.False(t, got[base58.Encode(succeededTx.Transaction.Signatures[0])].Failed)
+			}
+
+			failed, ok := got[base58.Encode(failedTx.Transaction.Signatures[0])]
+			if !tt.wantFailed {
+				assert.False(t, ok, "failed transaction must be excluded")
+				return
+			}
+			if assert.True(t, ok, "failed transaction must be included") {
+				assert.True(t, failed.Failed)
+				assert.Equal(t, payer.String(), failed.Source)
+				assert.Empty(t, failed.Destination)
+				assert.Equal(t, big.NewInt(5), failed.Fees)
+				assert.NoError(t, failed.Validate())
+			}
+		})
+	}
+}
+
+func TestParseFailedTxPolicy(t *testing.T) {
+	p, err := ParseFailedTxPolicy("include")
+	assert.NoError(t, err)
+	assert.Equal(t, FailedTxsInclude, p)
+
+	_, err = ParseFailedTxPolicy("fees")
+	assert.EqualError(t, err, `unsupported failed transaction policy "fees"`)
+}
+
+func TestSolanaWalletMultiParty(t *testing.T) {
+	sender := types.NewAccount().PublicKey
+	recipient1 := types.NewAccount().PublicKey
+	recipient2 := types.NewAccount().PublicKey
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1000, 0, 0},
+						PostBalances: []int64{845, 95, 55},
+						Fee:          5,
+					},
+					Transaction: types.Transaction{
+						Signatures: []types.Signature{types.Signature("deblock-test-signature")},
+						Message: types.Message{
+							Accounts: []common.PublicKey{sender, recipient1, recipient2},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+	assert.NoError(t, s.TrackWallet(sender.String()))
+	assert.NoError(t, s.TrackWallet(recipient2.String()))
+
+	events := make(chan *TrackedWalletEvent, 10)
+	assert.NoError(t, s.fetchBlock(500, events))
+	close(events)
+
+	// Destination lists both recipients, Wallet tells which one is
+	// tracked
+	recipients := recipient1.String() + "," + recipient2.String()
+	if assert.Len(t, events, 2) {
+		outgoing := <-events
+		assert.Equal(t, sender.String(), outgoing.Wallet)
+		assert.Equal(t, recipients, outgoing.Destination)
+		incoming := <-events
+		assert.Equal(t, recipient2.String(), incoming.Wallet)
+		assert.Equal(t, sender.String(), incoming.Source)
+		assert.Equal(t, big.NewInt(55), incoming.Amount)
+	}
+}
@@ -0,0 +1,93 @@
+package chain
+
+import (
+	"log/slog"
+
+	"github.com/blocto/solana-go-sdk/common"
+)
+
+// knownSolanaProgramIDs are excluded from sender and recipient classification
+// without owner lookup.
+var knownSolanaProgramIDs = map[common.PublicKey]bool{
+	common.SystemProgramID:                    true,
+	common.ConfigProgramID:                    true,
+	common.StakeProgramID:                     true,
+	common.VoteProgramID:                      true,
+	common.BPFLoaderProgramID:                 true,
+	common.BPFLoaderUpgradeableProgramID:      true,
+	common.Secp256k1ProgramID:                 true,
+	common.TokenProgramID:                     true,
+	common.Token2022ProgramID:                 true,
+	common.MemoProgramID:                      true,
+	common.SPLAssociatedTokenAccountProgramID: true,
+	common.SPLNameServiceProgramID:            true,
+	common.MetaplexTokenMetaProgramID:         true,
+	common.ComputeBudgetProgramID:             true,
+	common.AddressLookupTableProgramID:        true,
+}
+
+// maxSolanaOwnerCacheSize bounds the number of cached account owners. The
+// cache is reset once the limit is reached.
+const maxSolanaOwnerCacheSize = 100_000
+
+// programAccounts returns accounts which are not wallets: known programs and
+// accounts owned by a program other than the System Program. Owners are only
+// looked up if one of the accounts is tracked, otherwise the transaction is
+// irrelevant. Accounts whose owner can't be looked up are treated as wallets.
+func (s *solanaMainnetSubscriber) programAccounts(accounts []common.PublicKey) map[common.PublicKey]bool {
+	if !s.filterProgramAccounts {
+		return nil
+	}
+
+	s.mu.RLock()
+	involvesTracked := false
+	for _, account := range accounts {
+		if s.registeredWallets[account] {
+			involvesTracked = true
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if !involvesTracked {
+		return nil
+	}
+
+	excluded := map[common.PublicKey]bool{}
+	unknown := []common.PublicKey{}
+	s.ownersMu.Lock()
+	for _, account := range accounts {
+		if knownSolanaProgramIDs[account] {
+			excluded[account] = true
+		} else if _, ok := s.owners[account]; !ok {
+			unknown = append(unknown, account)
+		}
+	}
+	s.ownersMu.Unlock()
+
+	if len(unknown) > 0 && s.getAccountOwners != nil {
+		owners, err := s.getAccountOwners(s.ctx, unknown)
+		if err != nil {
+			s.errLogs.Log(s.logger, slog.LevelWarn, "failed to look up account owners", err)
+		} else {
+			s.ownersMu.Lock()
+			if len(s.owners)+len(owners) > maxSolanaOwnerCacheSize {
+				s.owners = make(map[common.PublicKey]common.PublicKey)
+			}
+			for i, owner := range owners {
+				s.owners[unknown[i]] = owner
+			}
+			s.ownersMu.Unlock()
+		}
+	}
+
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	for _, account := range accounts {
+		owner, ok := s.owners[account]
+		// Zero owner means the account does not exist (anymore)
+		if ok && owner != common.SystemProgramID && owner != (common.PublicKey{}) {
+			excluded[account] = true
+		}
+	}
+	return excluded
+}
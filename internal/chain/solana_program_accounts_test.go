@@ -0,0 +1,108 @@
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolanaProgramAccountFilter(t *testing.T) {
+	sender := types.NewAccount().PublicKey
+	recipient := types.NewAccount().PublicKey
+	tokenAccount := types.NewAccount().PublicKey
+	stakeAccount := types.NewAccount().PublicKey
+	closedAccount := types.NewAccount().PublicKey
+
+	owners := map[common.PublicKey]common.PublicKey{
+		sender:       common.SystemProgramID,
+		recipient:    common.SystemProgramID,
+		tokenAccount: common.TokenProgramID,
+		stakeAccount: common.StakeProgramID,
+		// Closed account has no owner
+	}
+	getBlock := func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{
+				{
+					Meta: &client.TransactionMeta{
+						PreBalances:  []int64{1000, 0, 0, 0, 50, 1},
+						PostBalances: []int64{600, 150, 100, 50, 100, 1},
+					},
+					Transaction: types.Transaction{
+						Message: types.Message{
+							Accounts: []common.PublicKey{
+								sender,
+								recipient,
+								tokenAccount,
+								stakeAccount,
+								closedAccount,
+								common.SystemProgramID,
+							},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	fetch := func(s *solanaMainnetSubscriber) []*TrackedWalletEvent {
+		s.getBlock = getBlock
+		ch := make(chan *TrackedWalletEvent, 10)
+		assert.NoError(t, s.fetchBlock(500, ch))
+		close(ch)
+		events := []*TrackedWalletEvent{}
+		for e := range ch {
+			events = append(events, e)
+		}
+		return events
+	}
+
+	s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithProgramAccountFilter{Enabled: true})
+	lookups := 0
+	s.getAccountOwners = func(ctx context.Context, accounts []common.PublicKey) ([]common.PublicKey, error) {
+		lookups++
+		res := make([]common.PublicKey, len(accounts))
+		for i, a := range accounts {
+			res[i] = owners[a]
+		}
+		return res, nil
+	}
+	assert.NoError(t, s.TrackWallet(sender.String()))
+
+	for range 2 {
+		events := fetch(s)
+		assert.Len(t, events, 1)
+		// Token and stake accounts are not recipients
+		assert.Equal(t, recipient.String()+","+closedAccount.String(), events[0].Destination)
+	}
+	// Owners are cached
+	assert.Equal(t, 1, lookups)
+
+	// Tracked program owned account is not classified as a wallet
+	assert.NoError(t, s.TrackWallet(tokenAccount.String()))
+	for _, e := range fetch(s) {
+		assert.NotEqual(t, tokenAccount.String(), e.Wallet)
+	}
+
+	// Transactions without tracked wallets don't require lookups
+	s = NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithProgramAccountFilter{Enabled: true})
+	s.getAccountOwners = func(ctx context.Context, accounts []common.PublicKey) ([]common.PublicKey, error) {
+		t.Fatal("unexpected owner lookup")
+		return nil, nil
+	}
+	assert.Empty(t, fetch(s))
+
+	// Disabled filter keeps all accounts
+	s = NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	assert.NoError(t, s.TrackWallet(sender.String()))
+	events := fetch(s)
+	assert.Len(t, events, 1)
+	assert.Equal(t,
+		recipient.String()+","+tokenAccount.String()+","+stakeAccount.String()+","+closedAccount.String(),
+		events[0].Destination,
+	)
+}
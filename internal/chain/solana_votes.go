@@ -0,0 +1,24 @@
+package chain
+
+import (
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+)
+
+// isSolanaVoteTx reports whether every top level instruction of tx invokes
+// the Vote program. Validators submit such transactions every slot, they only
+// move tiny amounts for fees and dominate blocks.
+func isSolanaVoteTx(tx client.BlockTransaction) bool {
+	instructions := tx.Transaction.Message.Instructions
+	if len(instructions) == 0 {
+		return false
+	}
+	accounts := solanaTxAccounts(tx)
+	for _, ci := range instructions {
+		program, ok := solanaAccountAt(accounts, ci.ProgramIDIndex)
+		if !ok || program != common.VoteProgramID {
+			return false
+		}
+	}
+	return true
+}
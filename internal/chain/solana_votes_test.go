@@ -0,0 +1,103 @@
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/system"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/assert"
+)
+
+// voteTestTx returns a transaction of the validator paying the fee of a vote,
+// followed by a transfer to recipient if it is set.
+func voteTestTx(signature byte, validator, voteAccount common.PublicKey, recipient *common.PublicKey) client.BlockTransaction {
+	accounts := []common.PublicKey{validator, voteAccount, common.VoteProgramID}
+	pre, post := []int64{1_000_000, 500, 1}, []int64{995_000, 500, 1}
+	instructions := []types.CompiledInstruction{
+		{ProgramIDIndex: 2, Accounts: []int{1, 0}, Data: []byte{12, 0, 0, 0}},
+	}
+	if recipient != nil {
+		accounts = append(accounts, *recipient, common.SystemProgramID)
+		pre, post = append(pre, 0, 1), append(post, 100, 1)
+		post[0] -= 100
+		instructions = append(instructions, types.CompiledInstruction{
+			ProgramIDIndex: 4,
+			Accounts:       []int{0, 3},
+			Data:           system.Transfer(system.TransferParam{From: validator, To: *recipient, Amount: 100}).Data,
+		})
+	}
+	return client.BlockTransaction{
+		Meta: &client.TransactionMeta{
+			PreBalances:  pre,
+			PostBalances: post,
+			Fee:          5000,
+		},
+		Transaction: types.Transaction{
+			Signatures: []types.Signature{{signature}},
+			Message: types.Message{
+				Accounts:     accounts,
+				Instructions: instructions,
+			},
+		},
+	}
+}
+
+func TestSolanaVoteFilter(t *testing.T) {
+	validator, voteAccount, recipient := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey
+	vote := voteTestTx(1, validator, voteAccount, nil)
+	// Transactions invoking other programs besides the Vote program are
+	// processed
+	mixed := voteTestTx(2, validator, voteAccount, &recipient)
+	transfer := closureTx(validator, types.NewAccount().PublicKey, recipient, validator)
+	transfer.Transaction.Signatures = []types.Signature{{3}}
+
+	assert.True(t, isSolanaVoteTx(vote))
+	assert.False(t, isSolanaVoteTx(mixed))
+	assert.False(t, isSolanaVoteTx(transfer))
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    []client.BlockTransaction
+	}{
+		{
+			name:    "votes are skipped",
+			enabled: true,
+			want:    []client.BlockTransaction{mixed, transfer},
+		},
+		{
+			name: "votes are processed when disabled",
+			want: []client.BlockTransaction{vote, mixed, transfer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url", WithVoteFilter{Enabled: tt.enabled})
+			s.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+				return &client.Block{
+					Transactions: []client.BlockTransaction{vote, mixed, transfer},
+				}, nil
+			}
+			assert.NoError(t, s.TrackWallet(validator.String()))
+
+			events := make(chan *TrackedWalletEvent, 10)
+			assert.NoError(t, s.fetchBlock(500, events))
+			close(events)
+
+			got := []string{}
+			for event := range events {
+				got = append(got, event.TxHash)
+			}
+			want := []string{}
+			for _, tx := range tt.want {
+				want = append(want, base58.Encode(tx.Transaction.Signatures[0]))
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
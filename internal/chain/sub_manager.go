@@ -1,89 +1,1022 @@
 package chain
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
 )
 
+// ErrNoSubscriber is returned when no subscriber is registered for a chain.
+var ErrNoSubscriber = errors.New("no registered subscriber for chain")
+
+// heldEventsPollInterval is the interval of releasing events held for more
+// confirmations.
+const heldEventsPollInterval = time.Second
+
 type WalletTransactionTracker interface {
 	// TrackWallet starts tracking wallet's transactions within the given chain
 	// subscriber.
 	TrackWallet(wallet string, chain ChainName) error
 
+	// TrackUserWallet tracks wallet like TrackWallet and associates it with
+	// the user. Events of the wallet are emitted once per associated user,
+	// with UserID set. User id 0 tracks the wallet without a user. Tracking
+	// the same wallet again for the user returns ErrWalletAlreadyTracked.
+	TrackUserWallet(userID int, wallet string, chain ChainName) error
+
 	// UntrackWallet stops tracking wallet's transactions within the given chain
-	// subscriber.
+	// subscriber. The wallet is no longer associated with any user.
+	// ErrWalletNotTracked is returned if the wallet is not tracked.
 	UntrackWallet(wallet string, chain ChainName) error
+
+	// UntrackUserWallet removes the association of wallet with the user.
+	// Wallet's transactions are tracked until the last associated user
+	// untracks it. ErrWalletNotTracked is returned if the wallet is not
+	// associated with the user.
+	UntrackUserWallet(userID int, wallet string, chain ChainName) error
+
+	// MuteWallet suppresses events of a tracked wallet within the given chain
+	// subscriber. The wallet stays tracked.
+	MuteWallet(wallet string, chain ChainName) error
+
+	// UnmuteWallet resumes event emission of a muted wallet within the given
+	// chain subscriber.
+	UnmuteWallet(wallet string, chain ChainName) error
+
+	// TrackedWallets returns currently tracked wallets of every registered
+	// chain subscriber.
+	TrackedWallets() map[ChainName][]string
+
+	// SetWalletConfirmations delays events of the wallet emitted for the
+	// user until the block containing the transaction has the given number
+	// of confirmations. 0 and 1 emit events as soon as the block is
+	// processed. Settings may be set before the wallet is tracked for the
+	// user and are cleared when the user untracks it.
+	SetWalletConfirmations(userID int, wallet string, chain ChainName, confirmations uint64) error
+
+	// SetWalletMinAmount drops transfer events of the wallet emitted for the
+	// user whose amount, in the chain's base units, is below minAmount. nil
+	// or 0 disables the filter.
+	SetWalletMinAmount(userID int, wallet string, chain ChainName, minAmount *big.Int) error
+
+	// SetWalletDirection emits only transfers of the direction of the wallet
+	// for the user, e.g. DirectionIncoming for deposits only. DirectionBoth
+	// disables the filter.
+	SetWalletDirection(userID int, wallet string, chain ChainName, direction Direction) error
+
+	// WalletSettings returns settings of the wallet tracked for the user.
+	// Muted is shared by all users of the wallet. ErrWalletNotTracked is
+	// returned if the wallet is not tracked for the user.
+	WalletSettings(userID int, wallet string, chain ChainName) (WalletSettings, error)
+
+	// ExportWallets returns the configuration of every wallet tracked via
+	// the tracker, ordered by chain and wallet.
+	ExportWallets() ([]TrackedWalletConfig, error)
+
+	// ImportWallets tracks wallets of the configs for their users and
+	// applies their settings, e.g. to restore an export. Wallets already
+	// tracked for a user stay tracked. All configs are validated first, and
+	// wallets tracked by a failed import are untracked again.
+	ImportWallets(configs []TrackedWalletConfig) error
+
+	// ReplaceUserWallets replaces the set of wallets tracked for the user with
+	// wallets. Only the difference between the current and the new set is
+	// applied: new wallets are tracked before the removed ones are untracked.
+	// If any wallet is invalid or can't be tracked or untracked, no changes
+	// are made.
+	ReplaceUserWallets(userID int, wallets map[ChainName][]string) error
+}
+
+// ChainController controls the lifecycle of individual chain subscribers.
+type ChainController interface {
+	// StopChain stops the subscriber of the given chain without affecting
+	// subscribers of other chains. Stopped subscriber is deregistered.
+	StopChain(chain ChainName) error
 }
 
 // SubscriberManager manages all blockchain transaction subscribers within the
 // application
 type SubscriberManager interface {
 	WalletTransactionTracker
+	ChainController
 
 	// RegisterSubscribers registers new subscribers and calls its Init.
-	// RegisterSubscriber should not be called concurrently.
+	// Failed Init is retried as configured by WithInitRetry. With
+	// WithLenientInit, subscribers failing all attempts are skipped rather
+	// than failing the registration. RegisterSubscriber should not be called
+	// concurrently.
 	RegisterSubscribers(subscribers ...TransactionSubscriber) error
 
+	// ValidateSubscribers calls Init of subscribers to check their
+	// configuration and RPC connectivity, and stops them afterwards.
+	// Subscribers are not registered and can't be started later. It returns
+	// the result of every chain, nil for successfully initialized ones.
+	ValidateSubscribers(subscribers ...TransactionSubscriber) map[ChainName]error
+
 	// StartAll accepts a sink which will receive all tracked wallet events from
 	// all of the registered subscribers. StartAll blocks and exits with an
-	// error if something goes wrong in one of the registered subscribers.
+	// error if something goes wrong in one of the registered subscribers, or
+	// with nil once Stop is called.
 	StartAll(sink chan<- *TrackedWalletEvent) error
+
+	// Stop stops all registered subscribers and waits until their events are
+	// no longer forwarded to the sink, or until ctx is done.
+	Stop(ctx context.Context) error
+
+	// DroppedEvents returns the number of events dropped per chain before
+	// reaching the sink, including events which failed validation.
+	DroppedEvents() map[ChainName]uint64
+
+	// ChainTips returns the latest known chain tip of every registered
+	// subscriber. The tip is 0 if the subscriber has not received it yet.
+	ChainTips() map[ChainName]uint64
+
+	// SubscriberStats returns processing statistics of every registered
+	// subscriber.
+	SubscriberStats() map[ChainName]SubscriberStats
 }
 
-func NewSubsciberManager() SubscriberManager {
-	return &mapSubManager{
-		subs: make(map[ChainName]TransactionSubscriber),
+func NewSubsciberManager(opts ...SubscriberManagerOption) SubscriberManager {
+	m := &mapSubManager{
+		subs:          make(map[ChainName]TransactionSubscriber),
+		userWallets:   make(map[int]map[ChainName]map[string]bool),
+		walletUsers:   make(map[ChainName]map[string]map[int]bool),
+		confirmations: newConfirmationGate(),
+		minAmounts:    newAmountFilter(),
+		directions:    newDirectionFilter(),
+		drops:         newDropMonitor(0, 0),
+		seenWallets:   make(map[ChainName]map[string]bool),
+		startedAt:     make(map[ChainName]time.Time),
+		stopped:       make(chan struct{}),
 	}
+
+	for _, opt := range opts {
+		opt.Apply(m)
+	}
+
+	return m
 }
 
 var _ SubscriberManager = (*mapSubManager)(nil)
 
 type mapSubManager struct {
 	subs map[ChainName]TransactionSubscriber
+	// subs mutex
+	mu sync.RWMutex
+
+	// user id -> chain -> normalized wallets tracked for the user
+	userWallets map[int]map[ChainName]map[string]bool
+	// chain -> normalized wallet -> ids of users the wallet is tracked for
+	walletUsers map[ChainName]map[string]map[int]bool
+	// userWallets and walletUsers mutex, serializes wallet set replacements
+	usersMu sync.RWMutex
+
+	// Delays events of user wallets requiring more confirmations
+	confirmations *confirmationGate
+	// Drops transfers below minimum amounts of user wallets
+	minAmounts *amountFilter
+	// Drops transfers of directions user wallets don't want
+	directions *directionFilter
+
+	drops *dropMonitor
+
+	// What to do with events of blocks processed while catching up
+	catchUpEvents CatchUpEventPolicy
+
+	// How events are sent to the sink of StartAll
+	sinkPolicy    SinkPolicy
+	sinkQueueSize int
+
+	// Retries of failed subscriber Init
+	initRetry WithInitRetry
+	// Whether subscribers failing Init are skipped on registration
+	lenientInit bool
+
+	// Maximum plausible event amounts per chain
+	maxAmounts map[ChainName]*big.Int
+	// chain -> the only destinations whose events are emitted
+	destinations map[ChainName]map[string]bool
+
+	// Whether to emit EventFirstActivity events
+	emitFirstActivity bool
+	// chain -> wallets which had activity since the process start
+	seenWallets map[ChainName]map[string]bool
+	// seenWallets mutex
+	seenMu sync.Mutex
+
+	// chain -> time its subscriber was started
+	startedAt map[ChainName]time.Time
+	// startedAt mutex
+	startedMu sync.Mutex
+
+	// Closed when the manager is stopped
+	stopped  chan struct{}
+	stopOnce sync.Once
+	// Goroutines forwarding subscriber channels to the sink
+	forwarders sync.WaitGroup
 }
 
 func (m *mapSubManager) RegisterSubscribers(subscribers ...TransactionSubscriber) error {
 	for _, subscriber := range subscribers {
 		chain := subscriber.Name()
-		if _, ok := m.subs[chain]; ok {
+		if _, ok := m.sub(chain); ok {
 			return fmt.Errorf("subscriber for chain %s already exists", chain)
 		}
 
-		if err := subscriber.Init(); err != nil {
-			return fmt.Errorf("initializing %s subscriber: %w", chain, err)
+		// Not holding the lock while waiting between attempts
+		if err := m.initSubscriber(subscriber); err != nil {
+			if !m.lenientInit {
+				return fmt.Errorf("initializing %s subscriber: %w", chain, err)
+			}
+			slog.Error("skipping subscriber which failed to initialize",
+				slog.String("chain", string(chain)),
+				slog.Any("error", err),
+			)
+			// Init may leave RPC connections open
+			if err := subscriber.Stop(); err != nil {
+				slog.Error("failed to stop skipped subscriber",
+					slog.String("chain", string(chain)),
+					slog.Any("error", err),
+				)
+			}
+			continue
 		}
+		m.mu.Lock()
 		m.subs[chain] = subscriber
+		m.mu.Unlock()
 	}
 	return nil
 }
 
+// initSubscriber calls Init of the subscriber, retrying failures with
+// exponential backoff. Retries end early once the manager is stopped.
+func (m *mapSubManager) initSubscriber(subscriber TransactionSubscriber) error {
+	for attempt := 0; ; attempt++ {
+		err := subscriber.Init()
+		if err == nil || attempt >= m.initRetry.Retries {
+			return err
+		}
+		delay := BackoffDelay(attempt, m.initRetry.BaseDelay, m.initRetry.MaxDelay)
+		slog.Warn("failed to initialize subscriber, retrying",
+			slog.String("chain", string(subscriber.Name())),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		select {
+		case <-time.After(delay):
+		case <-m.stopped:
+			return err
+		}
+	}
+}
+
+func (m *mapSubManager) ValidateSubscribers(subscribers ...TransactionSubscriber) map[ChainName]error {
+	results := make(map[ChainName]error, len(subscribers))
+	for _, subscriber := range subscribers {
+		chain := subscriber.Name()
+		err := subscriber.Init()
+		if err != nil {
+			err = fmt.Errorf("initializing %s subscriber: %w", chain, err)
+		}
+		// Init may leave RPC connections open
+		if stopErr := subscriber.Stop(); stopErr != nil {
+			err = errors.Join(err, fmt.Errorf("stopping %s subscriber: %w", chain, stopErr))
+		}
+		results[chain] = err
+	}
+	return results
+}
+
 func (m *mapSubManager) TrackWallet(wallet string, chain ChainName) error {
-	if sub, ok := m.subs[chain]; ok {
-		return sub.TrackWallet(wallet)
+	return m.TrackUserWallet(0, wallet, chain)
+}
+
+func (m *mapSubManager) TrackUserWallet(userID int, wallet string, chain ChainName) error {
+	sub, ok := m.sub(chain)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	normalized, err := NormalizeWallet(chain, wallet)
+	if err != nil {
+		return err
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	// Every user holds a single reference of the wallet in the subscriber
+	if m.walletUsers[chain][normalized][userID] {
+		return ErrWalletAlreadyTracked
+	}
+	if err := sub.TrackWallet(wallet); err != nil {
+		return err
 	}
-	return fmt.Errorf("no registered subscriber for chain %s", chain)
+	m.addUserWallet(userID, chain, normalized)
+	return nil
 }
 
 func (m *mapSubManager) UntrackWallet(wallet string, chain ChainName) error {
-	if sub, ok := m.subs[chain]; ok {
+	sub, ok := m.sub(chain)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	normalized, err := NormalizeWallet(chain, wallet)
+	if err != nil {
+		return err
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	users := m.walletUsers[chain][normalized]
+	if len(users) == 0 {
+		return sub.UntrackWallet(wallet)
+	}
+	for userID := range users {
+		if err := sub.UntrackWallet(wallet); err != nil {
+			return err
+		}
+		m.removeUserWallet(userID, chain, normalized)
+	}
+	return nil
+}
+
+func (m *mapSubManager) UntrackUserWallet(userID int, wallet string, chain ChainName) error {
+	sub, ok := m.sub(chain)
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	normalized, err := NormalizeWallet(chain, wallet)
+	if err != nil {
+		return err
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	if !m.walletUsers[chain][normalized][userID] {
+		return ErrWalletNotTracked
+	}
+	if err := sub.UntrackWallet(wallet); err != nil {
+		return err
+	}
+	m.removeUserWallet(userID, chain, normalized)
+	return nil
+}
+
+// trackWallet and untrackWallet add and release a reference of wallet in the
+// subscriber without changing user associations.
+func (m *mapSubManager) trackWallet(wallet string, chain ChainName) error {
+	if sub, ok := m.sub(chain); ok {
+		return sub.TrackWallet(wallet)
+	}
+	return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+}
+
+func (m *mapSubManager) untrackWallet(wallet string, chain ChainName) error {
+	if sub, ok := m.sub(chain); ok {
 		return sub.UntrackWallet(wallet)
 	}
-	return fmt.Errorf("no registered subscriber for chain %s", chain)
+	return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+}
+
+func (m *mapSubManager) MuteWallet(wallet string, chain ChainName) error {
+	if sub, ok := m.sub(chain); ok {
+		return sub.MuteWallet(wallet)
+	}
+	return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+}
+
+func (m *mapSubManager) UnmuteWallet(wallet string, chain ChainName) error {
+	if sub, ok := m.sub(chain); ok {
+		return sub.UnmuteWallet(wallet)
+	}
+	return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+}
+
+func (m *mapSubManager) SetWalletConfirmations(userID int, wallet string, chain ChainName, confirmations uint64) error {
+	key, err := m.userWallet(userID, wallet, chain)
+	if err != nil {
+		return err
+	}
+	m.confirmations.set(key, confirmations)
+	return nil
+}
+
+func (m *mapSubManager) SetWalletMinAmount(userID int, wallet string, chain ChainName, minAmount *big.Int) error {
+	key, err := m.userWallet(userID, wallet, chain)
+	if err != nil {
+		return err
+	}
+	m.minAmounts.set(key, minAmount)
+	return nil
+}
+
+func (m *mapSubManager) SetWalletDirection(userID int, wallet string, chain ChainName, direction Direction) error {
+	key, err := m.userWallet(userID, wallet, chain)
+	if err != nil {
+		return err
+	}
+	m.directions.set(key, direction)
+	return nil
+}
+
+func (m *mapSubManager) WalletSettings(userID int, wallet string, chain ChainName) (WalletSettings, error) {
+	sub, ok := m.sub(chain)
+	if !ok {
+		return WalletSettings{}, fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	key, err := m.userWallet(userID, wallet, chain)
+	if err != nil {
+		return WalletSettings{}, err
+	}
+
+	m.usersMu.RLock()
+	defer m.usersMu.RUnlock()
+	if !m.walletUsers[chain][key.wallet][userID] {
+		return WalletSettings{}, ErrWalletNotTracked
+	}
+	return m.walletSettings(sub, key)
+}
+
+// walletSettings returns settings of the user wallet tracked by sub.
+func (m *mapSubManager) walletSettings(sub TransactionSubscriber, key userWallet) (WalletSettings, error) {
+	muted, err := sub.WalletMuted(key.wallet)
+	if err != nil {
+		return WalletSettings{}, err
+	}
+	return WalletSettings{
+		Muted:         muted,
+		Confirmations: m.confirmations.get(key),
+		MinAmount:     m.minAmounts.get(key),
+		Direction:     m.directions.get(key),
+	}, nil
+}
+
+// userWallet returns the key of settings of the wallet of the user. The
+// chain must have a registered subscriber.
+func (m *mapSubManager) userWallet(userID int, wallet string, chain ChainName) (userWallet, error) {
+	if _, ok := m.sub(chain); !ok {
+		return userWallet{}, fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	normalized, err := NormalizeWallet(chain, wallet)
+	if err != nil {
+		return userWallet{}, err
+	}
+	return userWallet{userID, normalized, chain}, nil
+}
+
+func (m *mapSubManager) TrackedWallets() map[ChainName][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wallets := make(map[ChainName][]string, len(m.subs))
+	for chain, sub := range m.subs {
+		wallets[chain] = sub.TrackedWallets()
+	}
+	return wallets
 }
 
 func (m *mapSubManager) StartAll(sink chan<- *TrackedWalletEvent) error {
 	errCh := make(chan error)
-	for _, sub := range m.subs {
+
+	m.mu.RLock()
+	select {
+	case <-m.stopped:
+		m.mu.RUnlock()
+		return nil
+	default:
+	}
+	deliver := m.sinkSender(sink)
+	for chain, sub := range m.subs {
 		events, errs := sub.Start()
-		go func() {
-			for {
+		m.startedMu.Lock()
+		m.startedAt[chain] = time.Now()
+		m.startedMu.Unlock()
+		m.forwarders.Add(1)
+		// Channels are passed explicitly so that every forwarder drains its
+		// own subscriber
+		go func(sub TransactionSubscriber, events <-chan *TrackedWalletEvent, errs <-chan error) {
+			defer m.forwarders.Done()
+			// Held events are also released while the chain has no events
+			// of tracked wallets
+			ticker := time.NewTicker(heldEventsPollInterval)
+			defer ticker.Stop()
+			// Channels are closed when the subscriber is stopped
+			for events != nil || errs != nil {
 				select {
-				case event := <-events:
-					sink <- event
-				case err := <-errs:
-					errCh <- err
+				case <-ticker.C:
+					for _, e := range m.releaseHeld(sub) {
+						deliver(e)
+					}
+				case event, ok := <-events:
+					if !ok {
+						events = nil
+						continue
+					}
+					if err := event.Validate(); err != nil {
+						slog.Error("dropping invalid event",
+							slog.String("chain", string(event.ChainName)),
+							slog.String("tx_hash", event.TxHash),
+							slog.Any("error", err),
+						)
+						m.drops.RecordDrop(event.ChainName)
+						continue
+					}
+					if !m.applyCatchUpPolicy(event) || !m.allowsDestination(event) {
+						continue
+					}
+					m.flagImplausible(event)
+					if first := m.firstActivity(event); first != nil {
+						for _, e := range m.perUser(first) {
+							deliver(e)
+						}
+					}
+					for _, e := range m.perUser(event) {
+						deliver(e)
+					}
+					for _, e := range m.releaseHeld(sub) {
+						deliver(e)
+					}
+				case err, ok := <-errs:
+					if !ok {
+						errs = nil
+						continue
+					}
+					send(errCh, err, m.stopped)
 				}
 			}
-		}()
+		}(sub, events, errs)
+	}
+	m.mu.RUnlock()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-m.stopped:
+		return nil
+	}
+}
+
+func (m *mapSubManager) Stop(ctx context.Context) error {
+	m.stopOnce.Do(func() {
+		close(m.stopped)
+	})
+
+	// Write lock orders Stop after forwarders started by a concurrent StartAll
+	m.mu.Lock()
+	var errs []error
+	for chain, sub := range m.subs {
+		if err := sub.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s subscriber: %w", chain, err))
+		}
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.forwarders.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("waiting for subscribers to stop: %w", ctx.Err()))
+	}
+	return errors.Join(errs...)
+}
+
+// firstActivity returns EventFirstActivity event if event is the first one of
+// its wallet seen by the process and first activity events are enabled.
+func (m *mapSubManager) firstActivity(event *TrackedWalletEvent) *TrackedWalletEvent {
+	if !m.emitFirstActivity || event.Type != "" || event.Wallet == "" {
+		return nil
+	}
+
+	m.seenMu.Lock()
+	defer m.seenMu.Unlock()
+	if m.seenWallets[event.ChainName][event.Wallet] {
+		return nil
+	}
+	if _, ok := m.seenWallets[event.ChainName]; !ok {
+		m.seenWallets[event.ChainName] = make(map[string]bool)
+	}
+	m.seenWallets[event.ChainName][event.Wallet] = true
+
+	return &TrackedWalletEvent{
+		Type:           EventFirstActivity,
+		ChainName:      event.ChainName,
+		TxHash:         event.TxHash,
+		Wallet:         event.Wallet,
+		IdempotencyKey: idempotencyKey(event.ChainName, "", event.Wallet, "", string(EventFirstActivity)),
+		BlockNumber:    event.BlockNumber,
+		TxIndex:        event.TxIndex,
+		BlockTime:      event.BlockTime,
+		ObservedAt:     event.ObservedAt,
+		Historical:     event.Historical,
+	}
+}
+
+// applyCatchUpPolicy applies the catch-up event policy to event and reports
+// whether it should be emitted.
+func (m *mapSubManager) applyCatchUpPolicy(event *TrackedWalletEvent) bool {
+	if !event.Historical {
+		return true
+	}
+	switch m.catchUpEvents {
+	case CatchUpEventsSuppress:
+		return false
+	case CatchUpEventsTag:
+	default:
+		event.Historical = false
+	}
+	return true
+}
+
+func (m *mapSubManager) StopChain(chain ChainName) error {
+	m.mu.Lock()
+	sub, ok := m.subs[chain]
+	delete(m.subs, chain)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoSubscriber, chain)
+	}
+	if err := sub.Stop(); err != nil {
+		return fmt.Errorf("stopping %s subscriber: %w", chain, err)
+	}
+	return nil
+}
+
+func (m *mapSubManager) ReplaceUserWallets(userID int, wallets map[ChainName][]string) error {
+	// Validate the whole new set before mutating any subscriber
+	newSet := make(map[ChainName]map[string]bool)
+	for chain, list := range wallets {
+		newSet[chain] = make(map[string]bool)
+		for _, wallet := range list {
+			normalized, err := NormalizeWallet(chain, wallet)
+			if err != nil {
+				return fmt.Errorf("invalid %s wallet %s: %w", chain, wallet, err)
+			}
+			newSet[chain][normalized] = true
+		}
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+
+	oldSet := m.userWallets[userID]
+
+	type walletOnChain struct {
+		wallet string
+		chain  ChainName
+	}
+	additions, removals := []walletOnChain{}, []walletOnChain{}
+	for chain, set := range newSet {
+		for wallet := range set {
+			if !oldSet[chain][wallet] {
+				additions = append(additions, walletOnChain{wallet, chain})
+			}
+		}
+	}
+	for chain, set := range oldSet {
+		for wallet := range set {
+			if !newSet[chain][wallet] {
+				removals = append(removals, walletOnChain{wallet, chain})
+			}
+		}
+	}
+
+	// Track additions first so that the user is never left without tracked
+	// wallets. Roll back on failure.
+	rollbackAdditions := func(done []walletOnChain) {
+		for _, a := range done {
+			m.untrackWallet(a.wallet, a.chain)
+			m.removeUserWallet(userID, a.chain, a.wallet)
+		}
+	}
+	for i, a := range additions {
+		if err := m.trackWallet(a.wallet, a.chain); err != nil {
+			rollbackAdditions(additions[:i])
+			return fmt.Errorf("tracking %s wallet %s: %w", a.chain, a.wallet, err)
+		}
+		m.addUserWallet(userID, a.chain, a.wallet)
+	}
+
+	// Removed wallets keep their user associations and settings until all
+	// of them are untracked, so that a failed removal can be rolled back by
+	// tracking the untracked ones again.
+	for i, r := range removals {
+		if err := m.untrackWallet(r.wallet, r.chain); err != nil && !errors.Is(err, ErrNoSubscriber) {
+			for _, done := range removals[:i] {
+				m.trackWallet(done.wallet, done.chain)
+			}
+			rollbackAdditions(additions)
+			return fmt.Errorf("untracking %s wallet %s: %w", r.chain, r.wallet, err)
+		}
+	}
+	for _, r := range removals {
+		m.removeUserWallet(userID, r.chain, r.wallet)
+	}
+	return nil
+}
+
+// addUserWallet associates normalized wallet with the user. It must be
+// called with usersMu held.
+func (m *mapSubManager) addUserWallet(userID int, chain ChainName, wallet string) {
+	if m.userWallets[userID] == nil {
+		m.userWallets[userID] = make(map[ChainName]map[string]bool)
+	}
+	if m.userWallets[userID][chain] == nil {
+		m.userWallets[userID][chain] = make(map[string]bool)
+	}
+	m.userWallets[userID][chain][wallet] = true
+
+	if m.walletUsers[chain] == nil {
+		m.walletUsers[chain] = make(map[string]map[int]bool)
+	}
+	if m.walletUsers[chain][wallet] == nil {
+		m.walletUsers[chain][wallet] = make(map[int]bool)
+	}
+	m.walletUsers[chain][wallet][userID] = true
+}
+
+// removeUserWallet removes the association of normalized wallet with the
+// user and clears the user's settings of the wallet. It must be called with
+// usersMu held.
+func (m *mapSubManager) removeUserWallet(userID int, chain ChainName, wallet string) {
+	delete(m.userWallets[userID][chain], wallet)
+	delete(m.walletUsers[chain][wallet], userID)
+	if len(m.walletUsers[chain][wallet]) == 0 {
+		delete(m.walletUsers[chain], wallet)
+	}
+	key := userWallet{userID, wallet, chain}
+	m.confirmations.set(key, 0)
+	m.minAmounts.set(key, nil)
+	m.directions.set(key, DirectionBoth)
+}
+
+// userWallet identifies a wallet tracked for a user. Settings of wallets are
+// stored per user wallet.
+type userWallet struct {
+	userID int
+	// Normalized wallet
+	wallet string
+	chain  ChainName
+}
+
+// eventUserWallet returns the user wallet the event is emitted for.
+func eventUserWallet(event *TrackedWalletEvent) userWallet {
+	return userWallet{event.UserID, event.Wallet, event.ChainName}
+}
+
+// perUser returns a copy of event for every user its wallet is tracked for,
+// ordered by user id. Copies have UserID set and an idempotency key unique per
+// user, reverted events refer to the key of the user's copy. The event itself
+// is returned if the wallet has no users. Settings of the user's wallet are
+// applied to every copy, copies which are filtered out or held for more
+// confirmations are not returned.
+func (m *mapSubManager) perUser(event *TrackedWalletEvent) []*TrackedWalletEvent {
+	m.usersMu.RLock()
+	users := make([]int, 0, len(m.walletUsers[event.ChainName][event.Wallet]))
+	for userID := range m.walletUsers[event.ChainName][event.Wallet] {
+		// Tracked without a user
+		if userID != 0 {
+			users = append(users, userID)
+		}
+	}
+	m.usersMu.RUnlock()
+	if len(users) == 0 {
+		if !m.applySettings(event) {
+			return nil
+		}
+		return []*TrackedWalletEvent{event}
+	}
+	slices.Sort(users)
+
+	events := make([]*TrackedWalletEvent, 0, len(users))
+	for _, userID := range users {
+		e := *event
+		e.UserID = userID
+		e.IdempotencyKey = userIdempotencyKey(event.IdempotencyKey, userID)
+		if event.Reverts != "" {
+			e.Reverts = userIdempotencyKey(event.Reverts, userID)
+		}
+		if m.applySettings(&e) {
+			events = append(events, &e)
+		}
+	}
+	return events
+}
+
+// applySettings applies settings of the user wallet of the event and reports
+// whether the event is emitted now. Events waiting for more confirmations are
+// held until releaseHeld, reverts of held events discard them instead of
+// being emitted.
+func (m *mapSubManager) applySettings(event *TrackedWalletEvent) bool {
+	if !m.directions.allows(event) || m.minAmounts.below(event) {
+		return false
+	}
+	if event.Type == EventReverted && m.confirmations.discard(event.ChainName, event.Reverts) {
+		return false
+	}
+	return !m.confirmations.hold(event)
+}
+
+// releaseHeld returns held events of the chain which have enough
+// confirmations once its last processed block is known.
+func (m *mapSubManager) releaseHeld(sub TransactionSubscriber) []*TrackedWalletEvent {
+	return m.confirmations.release(sub.Name(), sub.LastProcessedBlock())
+}
+
+func (m *mapSubManager) sub(chain ChainName) (TransactionSubscriber, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sub, ok := m.subs[chain]
+	return sub, ok
+}
+
+func (m *mapSubManager) DroppedEvents() map[ChainName]uint64 {
+	return m.drops.Dropped()
+}
+
+func (m *mapSubManager) ChainTips() map[ChainName]uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tips := make(map[ChainName]uint64, len(m.subs))
+	for chain, sub := range m.subs {
+		// Unknown tips are reported as 0
+		tip, _ := sub.ChainTip()
+		tips[chain] = tip
+	}
+	return tips
+}
+
+// SubscriberStats are processing statistics of a chain subscriber. Heights
+// are slots for solana.
+type SubscriberStats struct {
+	LastProcessedBlock uint64
+	// 0 if the subscriber has not received it yet
+	ChainTip uint64
+	// Number of blocks the subscriber is behind the chain tip. 0 if either
+	// height is unknown.
+	Lag           uint64
+	EventsEmitted uint64
+	TxsProcessed  uint64
+	RPCErrors     uint64
+	// Time since the subscriber was started, 0 if it was not started
+	Uptime time.Duration
+}
+
+func (m *mapSubManager) SubscriberStats() map[ChainName]SubscriberStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.startedMu.Lock()
+	defer m.startedMu.Unlock()
+
+	stats := make(map[ChainName]SubscriberStats, len(m.subs))
+	for chain, sub := range m.subs {
+		tip, _ := sub.ChainTip()
+		s := SubscriberStats{
+			LastProcessedBlock: sub.LastProcessedBlock(),
+			ChainTip:           tip,
+			EventsEmitted:      uint64(metrics.EventsEmitted.Value(string(chain))),
+			TxsProcessed:       uint64(metrics.TxsProcessed.Value(string(chain))),
+			RPCErrors:          uint64(metrics.RPCErrors.Value(string(chain))),
+		}
+		if s.LastProcessedBlock > 0 && tip > s.LastProcessedBlock {
+			s.Lag = tip - s.LastProcessedBlock
+		}
+		if started, ok := m.startedAt[chain]; ok {
+			s.Uptime = time.Since(started)
+		}
+		stats[chain] = s
+	}
+	return stats
+}
+
+type SubscriberManagerOption interface {
+	Apply(*mapSubManager)
+}
+
+// WithDropAlert configures a high severity alert which is logged when a
+// chain drops Threshold or more events within Window. Threshold 0 disables
+// the alert.
+type WithDropAlert struct {
+	Threshold uint64
+	Window    time.Duration
+}
+
+func (w WithDropAlert) Apply(m *mapSubManager) {
+	m.drops = newDropMonitor(w.Threshold, w.Window)
+}
+
+// WithFirstActivityEvents enables EventFirstActivity events which are
+// emitted once per wallet per process, before the wallet's first transfer
+// event.
+type WithFirstActivityEvents struct {
+	Enabled bool
+}
+
+func (w WithFirstActivityEvents) Apply(m *mapSubManager) {
+	m.emitFirstActivity = w.Enabled
+}
+
+// CatchUpEventPolicy controls events of blocks which subscribers process
+// while catching up with the chain tip, e.g. after an RPC outage or a
+// resubscription.
+type CatchUpEventPolicy string
+
+const (
+	// Catch-up events are emitted like live events
+	CatchUpEventsEmit CatchUpEventPolicy = "emit"
+	// Catch-up events are emitted with Historical set
+	CatchUpEventsTag CatchUpEventPolicy = "tag"
+	// Catch-up events are not emitted
+	CatchUpEventsSuppress CatchUpEventPolicy = "suppress"
+)
+
+func ParseCatchUpEventPolicy(policy string) (CatchUpEventPolicy, error) {
+	switch p := CatchUpEventPolicy(policy); p {
+	case CatchUpEventsEmit, CatchUpEventsTag, CatchUpEventsSuppress:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported catch-up event policy %q", policy)
+}
+
+// WithCatchUpEvents sets the policy of events of blocks processed while
+// catching up with the chain tip. Default is CatchUpEventsEmit.
+type WithCatchUpEvents struct {
+	Policy CatchUpEventPolicy
+}
+
+func (w WithCatchUpEvents) Apply(m *mapSubManager) {
+	m.catchUpEvents = w.Policy
+}
+
+// WithInitRetry retries failed Init of registered subscribers, e.g. when an
+// RPC provider is briefly unavailable at startup, up to Retries times with
+// exponential backoff from BaseDelay to MaxDelay. Default is no retries.
+type WithInitRetry struct {
+	Retries   int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (w WithInitRetry) Apply(m *mapSubManager) {
+	m.initRetry = w
+}
+
+// WithLenientInit skips subscribers whose Init fails after all retries
+// instead of failing RegisterSubscribers, so that the remaining chains are
+// still tracked.
+type WithLenientInit struct {
+	Enabled bool
+}
+
+func (w WithLenientInit) Apply(m *mapSubManager) {
+	m.lenientInit = w.Enabled
+}
+
+// NormalizeWallet validates wallet address of the given chain and returns it in
+// the canonical form used in emitted events.
+func NormalizeWallet(chain ChainName, wallet string) (string, error) {
+	if _, ok := evmChains[chain]; ok {
+		a, err := validateEvmWallet(wallet)
+		if err != nil {
+			return "", err
+		}
+		return a.String(), nil
+	}
+
+	switch chain {
+	case Bitcoin:
+		// Subscriber checks the network it was configured with, addresses
+		// of any supported network are accepted here
+		var err error
+		for _, network := range bitcoinNetworks {
+			a, networkErr := validateBtcAddress(wallet, network)
+			if networkErr == nil {
+				return a.EncodeAddress(), nil
+			}
+			// Report the error of mainnet, the default network
+			if err == nil {
+				err = networkErr
+			}
+		}
+		return "", fmt.Errorf("invalid btc address: %w", err)
+	case SolanaMainnet:
+		a, err := validateSolanaWallet(wallet)
+		if err != nil {
+			return "", err
+		}
+		return a.String(), nil
 	}
-	return <-errCh
+	return "", fmt.Errorf("unsupported chain %s", chain)
 }
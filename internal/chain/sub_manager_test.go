@@ -0,0 +1,924 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/blocto/solana-go-sdk/client"
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSubscriber emits an event for its chain every interval until stopped.
+type fakeSubscriber struct {
+	chain    ChainName
+	interval time.Duration
+	// Wallets of emitted events, used in turn
+	wallets []string
+	// Destinations of emitted events, used in turn
+	destinations []string
+	// Returned by Init
+	initErr error
+	// Whether emitted events fail validation
+	invalid bool
+	// Amount of emitted events, 1 if nil
+	amount *big.Int
+	// Returned by ChainTip, 0 if unknown
+	tip uint64
+	// Returned by LastProcessedBlock
+	processed uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newFakeSubscriber(chain ChainName) *fakeSubscriber {
+	return &fakeSubscriber{
+		chain:    chain,
+		interval: 5 * time.Millisecond,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (f *fakeSubscriber) Init() error { return f.initErr }
+
+func (f *fakeSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan error) {
+	events, errs := make(chan *TrackedWalletEvent), make(chan error)
+	go func() {
+		defer close(errs)
+		defer close(events)
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+				event := &TrackedWalletEvent{
+					ChainName:   f.chain,
+					TxHash:      fmt.Sprintf("tx-%d", i),
+					Wallet:      "wallet",
+					Source:      "source",
+					Destination: "destination",
+					Amount:      big.NewInt(1),
+					Fees:        big.NewInt(0),
+				}
+				if len(f.wallets) > 0 {
+					event.Wallet = f.wallets[i%len(f.wallets)]
+				}
+				if len(f.destinations) > 0 {
+					event.Destination = f.destinations[i%len(f.destinations)]
+				}
+				event.IdempotencyKey = idempotencyKey(f.chain, event.TxHash, event.Wallet, DirectionOutgoing, NativeAssetID)
+				if f.amount != nil {
+					event.Amount = new(big.Int).Set(f.amount)
+				}
+				if f.invalid {
+					event.Amount = nil
+				}
+				if !send(events, event, f.stop) {
+					return
+				}
+			}
+		}
+	}()
+	return events, errs
+}
+
+func (f *fakeSubscriber) TrackWallet(wallet string) error         { return nil }
+func (f *fakeSubscriber) UntrackWallet(wallet string) error       { return nil }
+func (f *fakeSubscriber) MuteWallet(wallet string) error          { return nil }
+func (f *fakeSubscriber) UnmuteWallet(wallet string) error        { return nil }
+func (f *fakeSubscriber) WalletMuted(wallet string) (bool, error) { return false, nil }
+func (f *fakeSubscriber) TrackedWallets() []string                { return nil }
+func (f *fakeSubscriber) Name() ChainName                         { return f.chain }
+
+func (f *fakeSubscriber) ChainTip() (uint64, error) {
+	if f.tip == 0 {
+		return 0, ErrChainTipUnknown
+	}
+	return f.tip, nil
+}
+
+func (f *fakeSubscriber) LastProcessedBlock() uint64 { return f.processed }
+
+func (f *fakeSubscriber) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+	return nil
+}
+
+func TestSubscriberManagerStopChain(t *testing.T) {
+	m := NewSubsciberManager()
+	eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	assert.NoError(t, m.RegisterSubscribers(eth, sol))
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+
+	// receive collects events per chain for the given duration
+	receive := func(d time.Duration) map[ChainName]int {
+		got := map[ChainName]int{}
+		timeout := time.After(d)
+		for {
+			select {
+			case e := <-sink:
+				got[e.ChainName]++
+			case <-timeout:
+				return got
+			}
+		}
+	}
+
+	got := receive(100 * time.Millisecond)
+	assert.Greater(t, got[EthereumMainnet], 0)
+	assert.Greater(t, got[SolanaMainnet], 0)
+
+	assert.NoError(t, m.StopChain(EthereumMainnet))
+	// Let in-flight ethereum events drain
+	receive(20 * time.Millisecond)
+
+	got = receive(100 * time.Millisecond)
+	assert.Equal(t, 0, got[EthereumMainnet])
+	assert.Greater(t, got[SolanaMainnet], 0)
+
+	assert.ErrorIs(t, m.StopChain(EthereumMainnet), ErrNoSubscriber)
+	assert.ErrorIs(t, m.TrackWallet("wallet", EthereumMainnet), ErrNoSubscriber)
+	assert.NoError(t, m.TrackWallet(types.NewAccount().PublicKey.String(), SolanaMainnet))
+}
+
+func TestSubscriberManagerReplaceUserWallets(t *testing.T) {
+	eth := NewEthereumMainnetSubscriber("http://dummy.net")
+	sol := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	m := NewSubsciberManager().(*mapSubManager)
+	// Subscribers are not initialized, only their wallet registries are used
+	m.subs[EthereumMainnet] = eth
+	m.subs[SolanaMainnet] = sol
+
+	ethA := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	ethB := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	solA := types.NewAccount().PublicKey
+
+	assert.NoError(t, m.ReplaceUserWallets(1, map[ChainName][]string{
+		EthereumMainnet: {ethA.Hex()},
+		SolanaMainnet:   {solA.String()},
+	}))
+	assert.Equal(t, map[common.Address]bool{ethA: true}, eth.registeredWallets)
+	assert.Len(t, sol.registeredWallets, 1)
+
+	// Replace: ethA removed, ethB added, solana wallets removed
+	assert.NoError(t, m.ReplaceUserWallets(1, map[ChainName][]string{
+		EthereumMainnet: {strings.ToLower(ethB.Hex())},
+	}))
+	assert.Equal(t, map[common.Address]bool{ethB: true}, eth.registeredWallets)
+	assert.Len(t, sol.registeredWallets, 0)
+
+	// Invalid wallet in the new set leaves the previous set untouched
+	err := m.ReplaceUserWallets(1, map[ChainName][]string{
+		EthereumMainnet: {ethA.Hex()},
+		SolanaMainnet:   {"0OIl-not-base58"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, map[common.Address]bool{ethB: true}, eth.registeredWallets)
+
+	// Failure to track on one chain rolls back additions on other chains
+	err = m.ReplaceUserWallets(1, map[ChainName][]string{
+		EthereumMainnet: {ethA.Hex(), ethB.Hex()},
+		Bitcoin:         {"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+	})
+	assert.ErrorIs(t, err, ErrNoSubscriber)
+	assert.Equal(t, map[common.Address]bool{ethB: true}, eth.registeredWallets)
+}
+
+func TestSubscriberManagerReplaceUserWalletsRemovalFailure(t *testing.T) {
+	eth := NewEthereumMainnetSubscriber("http://dummy.net")
+	sol := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = eth
+	m.subs[SolanaMainnet] = sol
+
+	ethA := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	ethB := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	solA := types.NewAccount().PublicKey
+	assert.NoError(t, m.ReplaceUserWallets(1, map[ChainName][]string{
+		EthereumMainnet: {ethA.Hex()},
+		SolanaMainnet:   {solA.String()},
+	}))
+	assert.NoError(t, m.SetWalletMinAmount(1, ethA.Hex(), EthereumMainnet, big.NewInt(100)))
+
+	// Untracked behind the manager's back, so its removal fails
+	assert.NoError(t, sol.UntrackWallet(solA.String()))
+
+	err := m.ReplaceUserWallets(1, map[ChainName][]string{EthereumMainnet: {ethB.Hex()}})
+	assert.ErrorIs(t, err, ErrWalletNotTracked)
+
+	// Addition of ethB and removal of ethA are rolled back
+	assert.Equal(t, map[common.Address]bool{ethA: true}, eth.registeredWallets)
+	settings, err := m.WalletSettings(1, ethA.Hex(), EthereumMainnet)
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(100), settings.MinAmount)
+	_, err = m.WalletSettings(1, ethB.Hex(), EthereumMainnet)
+	assert.ErrorIs(t, err, ErrWalletNotTracked)
+}
+
+func TestSubscriberManagerReplaceUserWalletsKeepsOtherUsers(t *testing.T) {
+	eth := NewEthereumMainnetSubscriber("http://dummy.net")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = eth
+
+	ethA := common.HexToAddress("0x9642b23Ed1E01Df1092B92641051881a322F5D4E")
+	ethB := common.HexToAddress("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	assert.NoError(t, m.TrackUserWallet(1, ethA.Hex(), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, ethA.Hex(), EthereumMainnet))
+
+	// ethA stays tracked for user 2
+	assert.NoError(t, m.ReplaceUserWallets(1, map[ChainName][]string{EthereumMainnet: {ethB.Hex()}}))
+	assert.Equal(t, map[common.Address]bool{ethA: true, ethB: true}, eth.registeredWallets)
+	assert.ErrorIs(t, m.UntrackUserWallet(1, ethA.Hex(), EthereumMainnet), ErrWalletNotTracked)
+
+	assert.NoError(t, m.ReplaceUserWallets(2, nil))
+	assert.Equal(t, map[common.Address]bool{ethB: true}, eth.registeredWallets)
+}
+
+func TestSubscriberManagerTrackedWallets(t *testing.T) {
+	eth := NewEthereumMainnetSubscriber("http://dummy.net")
+	btc := NewBitcoinSubscriber("dummy")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = eth
+	m.subs[Bitcoin] = btc
+
+	ethA := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	ethB := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	// Lowercase input is listed in canonical form
+	assert.NoError(t, m.TrackWallet(strings.ToLower(ethA), EthereumMainnet))
+	assert.NoError(t, m.TrackWallet(ethB, EthereumMainnet))
+	assert.NoError(t, m.TrackWallet("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", Bitcoin))
+	assert.NoError(t, m.TrackWallet("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Bitcoin))
+
+	assert.Equal(t, map[ChainName][]string{
+		EthereumMainnet: {ethB, ethA},
+		Bitcoin:         {"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+	}, m.TrackedWallets())
+
+	assert.NoError(t, m.UntrackWallet(ethA, EthereumMainnet))
+	assert.NoError(t, m.UntrackWallet("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Bitcoin))
+	assert.Equal(t, map[ChainName][]string{
+		EthereumMainnet: {ethB},
+		Bitcoin:         {"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+	}, m.TrackedWallets())
+}
+
+func TestSubscriberManagerTrackingChanges(t *testing.T) {
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = NewEthereumMainnetSubscriber("http://dummy.net")
+	m.subs[Bitcoin] = NewBitcoinSubscriber("dummy")
+	m.subs[SolanaMainnet] = NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+
+	wallets := map[ChainName]string{
+		EthereumMainnet: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		Bitcoin:         "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		SolanaMainnet:   types.NewAccount().PublicKey.String(),
+	}
+	for chainName, wallet := range wallets {
+		t.Run(string(chainName), func(t *testing.T) {
+			assert.ErrorIs(t, m.UntrackWallet(wallet, chainName), ErrWalletNotTracked)
+			assert.ErrorIs(t, m.UntrackUserWallet(1, wallet, chainName), ErrWalletNotTracked)
+
+			assert.NoError(t, m.TrackWallet(wallet, chainName))
+			assert.ErrorIs(t, m.TrackWallet(wallet, chainName), ErrWalletAlreadyTracked)
+			// Tracking for another user changes the state
+			assert.NoError(t, m.TrackUserWallet(1, wallet, chainName))
+			assert.ErrorIs(t, m.TrackUserWallet(1, wallet, chainName), ErrWalletAlreadyTracked)
+
+			assert.NoError(t, m.UntrackWallet(wallet, chainName))
+			assert.Empty(t, m.TrackedWallets()[chainName])
+			assert.ErrorIs(t, m.UntrackWallet(wallet, chainName), ErrWalletNotTracked)
+			assert.ErrorIs(t, m.UntrackUserWallet(1, wallet, chainName), ErrWalletNotTracked)
+		})
+	}
+}
+
+func TestSubscriberManagerConcurrentTracking(t *testing.T) {
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = NewEthereumMainnetSubscriber("http://dummy.net")
+	m.subs[Bitcoin] = NewBitcoinSubscriber("dummy")
+	m.subs[SolanaMainnet] = NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+
+	wallets := map[ChainName]string{
+		EthereumMainnet: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		Bitcoin:         "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		SolanaMainnet:   types.NewAccount().PublicKey.String(),
+	}
+	for chainName, wallet := range wallets {
+		t.Run(string(chainName), func(t *testing.T) {
+			// Users race each other and untracking of the wallet for
+			// everyone, so operations may fail with expected errors only
+			expected := func(err error) {
+				if err != nil {
+					assert.ErrorIs(t, err, ErrWalletAlreadyTracked)
+				}
+			}
+			wg := sync.WaitGroup{}
+			for i := range 16 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					userID := i % 4
+					for range 50 {
+						expected(m.TrackUserWallet(userID, wallet, chainName))
+						if i%5 == 0 {
+							err := m.UntrackWallet(wallet, chainName)
+							if err != nil {
+								assert.ErrorIs(t, err, ErrWalletNotTracked)
+							}
+							continue
+						}
+						err := m.UntrackUserWallet(userID, wallet, chainName)
+						if err != nil {
+							assert.ErrorIs(t, err, ErrWalletNotTracked)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			// The subscriber holds a reference per user of the wallet
+			sub := m.subs[chainName]
+			assert.Equal(t, len(m.TrackedWallets()[chainName]) > 0, len(sub.TrackedWallets()) > 0)
+			err := m.UntrackWallet(wallet, chainName)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrWalletNotTracked)
+			}
+			assert.Empty(t, m.TrackedWallets()[chainName])
+			assert.Empty(t, sub.TrackedWallets())
+			assert.ErrorIs(t, sub.UntrackWallet(wallet), ErrWalletNotTracked)
+		})
+	}
+}
+
+func TestSubscriberManagerSharedWallet(t *testing.T) {
+	sol := NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[SolanaMainnet] = sol
+
+	payer, tokenAccount, recipient := types.NewAccount().PublicKey, types.NewAccount().PublicKey,
+		types.NewAccount().PublicKey
+	sol.getBlock = func(ctx context.Context, slot uint64) (*client.Block, error) {
+		return &client.Block{
+			Transactions: []client.BlockTransaction{closureTx(payer, tokenAccount, recipient, payer)},
+		}, nil
+	}
+	wallet := recipient.String()
+
+	// Users receiving the event of the wallet
+	receivers := func() []int {
+		events := make(chan *TrackedWalletEvent, 10)
+		assert.NoError(t, sol.fetchBlock(500, events))
+		close(events)
+		users := []int{}
+		for event := range events {
+			for _, e := range m.perUser(event) {
+				users = append(users, e.UserID)
+			}
+		}
+		return users
+	}
+
+	const userA, userB = 1, 2
+	assert.NoError(t, m.TrackUserWallet(userA, wallet, SolanaMainnet))
+	assert.NoError(t, m.TrackUserWallet(userB, wallet, SolanaMainnet))
+	// Tracking again does not add another reference
+	assert.ErrorIs(t, m.TrackUserWallet(userA, wallet, SolanaMainnet), ErrWalletAlreadyTracked)
+	assert.Equal(t, []int{userA, userB}, receivers())
+
+	// User A untracks, events still flow for user B
+	assert.NoError(t, m.UntrackUserWallet(userA, wallet, SolanaMainnet))
+	assert.ErrorIs(t, m.UntrackUserWallet(userA, wallet, SolanaMainnet), ErrWalletNotTracked)
+	assert.Equal(t, []int{userB}, receivers())
+	assert.Equal(t, map[ChainName][]string{SolanaMainnet: {wallet}}, m.TrackedWallets())
+
+	// Last user untracks
+	assert.NoError(t, m.UntrackUserWallet(userB, wallet, SolanaMainnet))
+	assert.Empty(t, receivers())
+	assert.Empty(t, m.TrackedWallets()[SolanaMainnet])
+
+	// Untracking without a user stops tracking for everyone
+	assert.NoError(t, m.TrackUserWallet(userA, wallet, SolanaMainnet))
+	assert.NoError(t, m.TrackUserWallet(userB, wallet, SolanaMainnet))
+	assert.NoError(t, m.TrackWallet(wallet, SolanaMainnet))
+	assert.NoError(t, m.UntrackWallet(wallet, SolanaMainnet))
+	assert.Empty(t, receivers())
+	assert.Empty(t, m.TrackedWallets()[SolanaMainnet])
+
+	assert.ErrorIs(t, m.UntrackUserWallet(userA, wallet, Bitcoin), ErrNoSubscriber)
+}
+
+func TestSubscriberManagerFirstActivityEvents(t *testing.T) {
+	collect := func(m SubscriberManager, n int) []*TrackedWalletEvent {
+		eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+		eth.wallets = []string{"a", "b"}
+		// Same wallet on a different chain is a distinct wallet
+		sol.wallets = []string{"a"}
+		assert.NoError(t, m.RegisterSubscribers(eth, sol))
+		defer eth.Stop()
+		defer sol.Stop()
+
+		sink := make(chan *TrackedWalletEvent)
+		go m.StartAll(sink)
+		events := []*TrackedWalletEvent{}
+		for range n {
+			select {
+			case e := <-sink:
+				events = append(events, e)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %d events, got %d", n, len(events))
+			}
+		}
+		return events
+	}
+
+	events := collect(NewSubsciberManager(WithFirstActivityEvents{Enabled: true}), 30)
+	first := map[ChainName][]string{}
+	for i, e := range events {
+		if e.Type != EventFirstActivity {
+			continue
+		}
+		first[e.ChainName] = append(first[e.ChainName], e.Wallet)
+		// Followed by the transfer event of the same wallet
+		if i+1 < len(events) {
+			assert.Equal(t, EventType(""), events[i+1].Type)
+			assert.Equal(t, e.Wallet, events[i+1].Wallet)
+			assert.Equal(t, e.ChainName, events[i+1].ChainName)
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, first[EthereumMainnet])
+	assert.Equal(t, []string{"a"}, first[SolanaMainnet])
+
+	// Disabled by default
+	for _, e := range collect(NewSubsciberManager(), 10) {
+		assert.Equal(t, EventType(""), e.Type)
+	}
+}
+
+func TestSubscriberManagerCatchUpEvents(t *testing.T) {
+	tests := []struct {
+		policy         CatchUpEventPolicy
+		wantEmitted    bool
+		wantHistorical bool
+	}{
+		{policy: "", wantEmitted: true},
+		{policy: CatchUpEventsEmit, wantEmitted: true},
+		{policy: CatchUpEventsTag, wantEmitted: true, wantHistorical: true},
+		{policy: CatchUpEventsSuppress},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			m := NewSubsciberManager(WithCatchUpEvents{Policy: tt.policy}).(*mapSubManager)
+
+			// Live events are emitted regardless of the policy
+			assert.True(t, m.applyCatchUpPolicy(&TrackedWalletEvent{}))
+
+			event := &TrackedWalletEvent{Historical: true}
+			assert.Equal(t, tt.wantEmitted, m.applyCatchUpPolicy(event))
+			if tt.wantEmitted {
+				assert.Equal(t, tt.wantHistorical, event.Historical)
+			}
+		})
+	}
+
+	policy, err := ParseCatchUpEventPolicy("tag")
+	assert.NoError(t, err)
+	assert.Equal(t, CatchUpEventsTag, policy)
+	_, err = ParseCatchUpEventPolicy("drop")
+	assert.EqualError(t, err, `unsupported catch-up event policy "drop"`)
+}
+
+func TestSubscriberManagerDropsInvalidEvents(t *testing.T) {
+	m := NewSubsciberManager()
+	valid, invalid := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	invalid.invalid = true
+	assert.NoError(t, m.RegisterSubscribers(valid, invalid))
+	defer m.Stop(context.Background())
+
+	emitted := metrics.EventsEmitted.Value(string(EthereumMainnet))
+	emittedInvalid := metrics.EventsEmitted.Value(string(SolanaMainnet))
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+	for range 10 {
+		select {
+		case e := <-sink:
+			assert.Equal(t, EthereumMainnet, e.ChainName)
+		case <-time.After(time.Second):
+			t.Fatal("expected valid events")
+		}
+	}
+	assert.Positive(t, m.DroppedEvents()[SolanaMainnet])
+	assert.Zero(t, m.DroppedEvents()[EthereumMainnet])
+	// Counted once the sink received the event
+	assert.Eventually(t, func() bool {
+		return metrics.EventsEmitted.Value(string(EthereumMainnet)) >= emitted+10
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, emittedInvalid, metrics.EventsEmitted.Value(string(SolanaMainnet)))
+}
+
+func TestSubscriberManagerUserEvents(t *testing.T) {
+	shared := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	own := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	unowned := "0x000000000000000000000000000000000000dEaD"
+
+	m := NewSubsciberManager()
+	eth := newFakeSubscriber(EthereumMainnet)
+	eth.wallets = []string{shared, own, unowned}
+	assert.NoError(t, m.RegisterSubscribers(eth))
+	defer m.Stop(context.Background())
+
+	// Same wallet tracked by two users, lowercase input is associated in
+	// the form events report
+	assert.NoError(t, m.TrackUserWallet(2, strings.ToLower(shared), EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(1, shared, EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(3, own, EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(0, unowned, EthereumMainnet))
+	assert.ErrorIs(t, m.TrackUserWallet(1, shared, SolanaMainnet), ErrNoSubscriber)
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+	next := func() *TrackedWalletEvent {
+		t.Helper()
+		select {
+		case e := <-sink:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("expected an event")
+			return nil
+		}
+	}
+
+	// Wallets emit in turn, copies are ordered by user id
+	want := []struct {
+		wallet string
+		userID int
+	}{{shared, 1}, {shared, 2}, {own, 3}, {unowned, 0}}
+	keys := map[string]bool{}
+	for _, w := range want {
+		e := next()
+		assert.Equal(t, w.wallet, e.Wallet)
+		assert.Equal(t, w.userID, e.UserID)
+		keys[e.IdempotencyKey] = true
+	}
+	assert.Len(t, keys, len(want), "idempotency keys must be unique per user")
+
+	// Untracking the wallet removes it for all users
+	assert.NoError(t, m.UntrackWallet(shared, EthereumMainnet))
+	for {
+		if e := next(); e.Wallet == shared {
+			assert.Zero(t, e.UserID)
+			break
+		}
+	}
+}
+
+// fanOut passes events of sub through the per user fan-out of the manager,
+// as its forwarders do, followed by held events released once the last block
+// of sub is processed.
+func fanOut(m *mapSubManager, sub TransactionSubscriber, events []*TrackedWalletEvent) []*TrackedWalletEvent {
+	forwarded := []*TrackedWalletEvent{}
+	for _, event := range events {
+		forwarded = append(forwarded, m.perUser(event)...)
+	}
+	return append(forwarded, m.releaseHeld(sub)...)
+}
+
+func TestSubscriberManagerUserReverts(t *testing.T) {
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	m := NewSubsciberManager().(*mapSubManager)
+	assert.NoError(t, m.RegisterSubscribers(newFakeSubscriber(EthereumMainnet)))
+	assert.NoError(t, m.TrackUserWallet(1, wallet, EthereumMainnet))
+	assert.NoError(t, m.TrackUserWallet(2, wallet, EthereumMainnet))
+
+	event := &TrackedWalletEvent{
+		ChainName:      EthereumMainnet,
+		TxHash:         "0x01",
+		Wallet:         wallet,
+		IdempotencyKey: idempotencyKey(EthereumMainnet, "0x01", wallet, DirectionIncoming, NativeAssetID),
+	}
+	copies, reverts := m.perUser(event), m.perUser(revertedEvent(event))
+	if !assert.Len(t, reverts, len(copies)) {
+		return
+	}
+	// Consumers deduplicating by key forget the copy the user received, so
+	// that the re-included transaction is delivered again
+	for i, e := range copies {
+		assert.Equal(t, e.UserID, reverts[i].UserID)
+		assert.Equal(t, e.IdempotencyKey, reverts[i].Reverts)
+		assert.NotEqual(t, e.IdempotencyKey, reverts[i].IdempotencyKey)
+	}
+}
+
+func TestSubscriberManagerChainTips(t *testing.T) {
+	eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	eth.tip = 21000000
+	m := NewSubsciberManager()
+	assert.NoError(t, m.RegisterSubscribers(eth, sol))
+
+	// Unknown tips are reported as 0
+	assert.Equal(t, map[ChainName]uint64{EthereumMainnet: 21000000, SolanaMainnet: 0}, m.ChainTips())
+}
+
+func TestSubscriberManagerStop(t *testing.T) {
+	m := NewSubsciberManager()
+	eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	assert.NoError(t, m.RegisterSubscribers(eth, sol))
+
+	// Nobody reads the sink, forwarders must not block the shutdown
+	sink := make(chan *TrackedWalletEvent)
+	startErr := make(chan error)
+	go func() {
+		startErr <- m.StartAll(sink)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, m.Stop(ctx))
+
+	select {
+	case err := <-startErr:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("StartAll did not return after Stop")
+	}
+	for _, sub := range []*fakeSubscriber{eth, sol} {
+		select {
+		case <-sub.stop:
+		default:
+			t.Fatalf("%s subscriber was not stopped", sub.chain)
+		}
+	}
+}
+
+// stuckSubscriber never closes its channels.
+type stuckSubscriber struct {
+	*fakeSubscriber
+}
+
+func (s stuckSubscriber) Start() (<-chan *TrackedWalletEvent, <-chan error) {
+	return make(chan *TrackedWalletEvent), make(chan error)
+}
+
+func TestSubscriberManagerStopHonorsContext(t *testing.T) {
+	m := NewSubsciberManager()
+	assert.NoError(t, m.RegisterSubscribers(stuckSubscriber{newFakeSubscriber(Bitcoin)}))
+	go m.StartAll(make(chan *TrackedWalletEvent))
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestSubscriberManagerSubscriberStats(t *testing.T) {
+	// Chains unique to the test, so that counters of other tests don't
+	// interfere
+	behind, unknown := ChainName("stats_behind"), ChainName("stats_unknown")
+	behindSub, unknownSub := newFakeSubscriber(behind), newFakeSubscriber(unknown)
+	behindSub.tip, behindSub.processed = 1000, 990
+	behindSub.wallets = []string{"wallet"}
+	metrics.TxsProcessed.Add(string(behind), 250)
+	metrics.RPCErrors.Add(string(behind), 3)
+
+	m := NewSubsciberManager()
+	assert.NoError(t, m.RegisterSubscribers(behindSub, unknownSub))
+	defer m.Stop(context.Background())
+
+	// Not started yet
+	assert.Zero(t, m.SubscriberStats()[behind].Uptime)
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+	received := 0
+	for received < 2 {
+		if e := <-sink; e.ChainName == behind {
+			received++
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return m.SubscriberStats()[behind].EventsEmitted == 2
+	}, time.Second, time.Millisecond)
+	stats := m.SubscriberStats()
+	got := stats[behind]
+	assert.Greater(t, got.Uptime, time.Duration(0))
+	got.Uptime = 0
+	assert.Equal(t, SubscriberStats{
+		LastProcessedBlock: 990,
+		ChainTip:           1000,
+		Lag:                10,
+		EventsEmitted:      2,
+		TxsProcessed:       250,
+		RPCErrors:          3,
+	}, got)
+	// Unknown heights report no lag
+	assert.Zero(t, stats[unknown].Lag)
+	assert.Zero(t, stats[unknown].ChainTip)
+}
+
+func TestSubscriberManagerStartAllDrainsEverySubscriber(t *testing.T) {
+	m := NewSubsciberManager()
+	eth, sol := newFakeSubscriber(EthereumMainnet), newFakeSubscriber(SolanaMainnet)
+	eth.wallets, sol.wallets = []string{"eth-wallet"}, []string{"sol-wallet"}
+	assert.NoError(t, m.RegisterSubscribers(eth, sol))
+	defer m.Stop(context.Background())
+
+	sink := make(chan *TrackedWalletEvent)
+	go m.StartAll(sink)
+
+	got := map[ChainName]string{}
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case e := <-sink:
+			got[e.ChainName] = e.Wallet
+		case <-timeout:
+			t.Fatalf("expected events of both subscribers, got %v", got)
+		}
+	}
+	assert.Equal(t, map[ChainName]string{
+		EthereumMainnet: "eth-wallet",
+		SolanaMainnet:   "sol-wallet",
+	}, got)
+}
+
+func TestSubscriberManagerValidateSubscribers(t *testing.T) {
+	ethereum := newFakeSubscriber(EthereumMainnet)
+	solana := newFakeSubscriber(SolanaMainnet)
+	solana.initErr = assert.AnError
+	bitcoin := newFakeSubscriber(Bitcoin)
+
+	m := NewSubsciberManager()
+	results := m.ValidateSubscribers(ethereum, solana, bitcoin)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[EthereumMainnet])
+	assert.ErrorIs(t, results[SolanaMainnet], assert.AnError)
+	assert.ErrorContains(t, results[SolanaMainnet], "initializing solana")
+	assert.NoError(t, results[Bitcoin])
+
+	// Every subscriber is stopped, successfully initialized ones as well
+	for _, sub := range []*fakeSubscriber{ethereum, solana, bitcoin} {
+		select {
+		case <-sub.stop:
+		default:
+			t.Fatalf("%s subscriber was not stopped", sub.chain)
+		}
+	}
+
+	// Validated subscribers are not registered
+	assert.Empty(t, m.TrackedWallets())
+	assert.ErrorIs(t, m.TrackWallet("wallet", EthereumMainnet), ErrNoSubscriber)
+}
+
+// evmRpcServer returns url of a json rpc server answering eth_chainId with
+// chainID.
+func evmRpcServer(t *testing.T, chainID int64) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "eth_chainId", req.Method)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x%x"}`, req.ID, chainID)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestSubscriberManagerMultipleEVMChains(t *testing.T) {
+	polygonConfig, err := EvmChainConfig(PolygonMainnet)
+	assert.NoError(t, err)
+	bscConfig, err := EvmChainConfig(BscMainnet)
+	assert.NoError(t, err)
+	polygon := NewEVMSubscriber(PolygonMainnet, evmRpcServer(t, 137), polygonConfig)
+	bsc := NewEVMSubscriber(BscMainnet, evmRpcServer(t, 56), bscConfig)
+	defer polygon.Stop()
+	defer bsc.Stop()
+
+	m := NewSubsciberManager()
+	assert.NoError(t, m.RegisterSubscribers(polygon, bsc))
+
+	polygonWallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	bscWallet := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	assert.NoError(t, m.TrackWallet(polygonWallet, PolygonMainnet))
+	assert.NoError(t, m.TrackWallet(bscWallet, BscMainnet))
+	assert.Equal(t, map[ChainName][]string{
+		PolygonMainnet: {polygonWallet},
+		BscMainnet:     {bscWallet},
+	}, m.TrackedWallets())
+
+	normalized, err := NormalizeWallet(BscMainnet, strings.ToLower(bscWallet))
+	assert.NoError(t, err)
+	assert.Equal(t, bscWallet, normalized)
+
+	// Config must match the chain of the rpc node
+	mismatched := NewEVMSubscriber(BscMainnet, evmRpcServer(t, 137), bscConfig)
+	defer mismatched.Stop()
+	assert.EqualError(t, mismatched.Init(), "rpc chain id 137 does not match bsc_mainnet chain id 56")
+}
+
+// flakySubscriber fails Init until failures reach zero.
+type flakySubscriber struct {
+	*fakeSubscriber
+	failures int
+	inits    int
+}
+
+func (s *flakySubscriber) Init() error {
+	s.inits++
+	if s.failures > 0 {
+		s.failures--
+		return assert.AnError
+	}
+	return nil
+}
+
+func TestSubscriberManagerInitRetry(t *testing.T) {
+	m := NewSubsciberManager(WithInitRetry{Retries: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond})
+	defer m.Stop(context.Background())
+
+	sub := &flakySubscriber{fakeSubscriber: newFakeSubscriber(Bitcoin), failures: 2}
+	assert.NoError(t, m.RegisterSubscribers(sub))
+	assert.Equal(t, 3, sub.inits)
+	assert.Contains(t, m.ChainTips(), Bitcoin)
+}
+
+func TestSubscriberManagerInitRetryExhausted(t *testing.T) {
+	m := NewSubsciberManager(WithInitRetry{Retries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	defer m.Stop(context.Background())
+
+	sub := &flakySubscriber{fakeSubscriber: newFakeSubscriber(Bitcoin), failures: 2}
+	err := m.RegisterSubscribers(sub)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "initializing bitcoin subscriber")
+	assert.Equal(t, 2, sub.inits)
+
+	// Without retries Init is called once
+	m = NewSubsciberManager()
+	defer m.Stop(context.Background())
+	sub = &flakySubscriber{fakeSubscriber: newFakeSubscriber(Bitcoin), failures: 1}
+	assert.Error(t, m.RegisterSubscribers(sub))
+	assert.Equal(t, 1, sub.inits)
+}
+
+func TestSubscriberManagerLenientInit(t *testing.T) {
+	m := NewSubsciberManager(
+		WithInitRetry{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		WithLenientInit{Enabled: true},
+	)
+	defer m.Stop(context.Background())
+
+	failing := &flakySubscriber{fakeSubscriber: newFakeSubscriber(Bitcoin), failures: 5}
+	recovering := &flakySubscriber{fakeSubscriber: newFakeSubscriber(SolanaMainnet), failures: 2}
+	healthy := newFakeSubscriber(EthereumMainnet)
+	assert.NoError(t, m.RegisterSubscribers(failing, recovering, healthy))
+
+	assert.Equal(t, 3, failing.inits)
+	assert.Equal(t, 3, recovering.inits)
+	tips := m.ChainTips()
+	assert.NotContains(t, tips, Bitcoin)
+	assert.Contains(t, tips, SolanaMainnet)
+	assert.Contains(t, tips, EthereumMainnet)
+	// The skipped subscriber is stopped
+	select {
+	case <-failing.stop:
+	default:
+		t.Fatal("skipped subscriber was not stopped")
+	}
+}
+
+func TestSubscriberManagerInitRetryStopped(t *testing.T) {
+	m := NewSubsciberManager(WithInitRetry{Retries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	sub := &flakySubscriber{fakeSubscriber: newFakeSubscriber(Bitcoin), failures: 5}
+
+	errs := make(chan error)
+	go func() { errs <- m.RegisterSubscribers(sub) }()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, m.Stop(context.Background()))
+
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, assert.AnError)
+	case <-time.After(time.Second):
+		t.Fatal("retries did not end once stopped")
+	}
+}
@@ -1,6 +1,35 @@
 package chain
 
-import "math/big"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWalletNotTracked is returned when an operation requires the wallet to be
+// tracked by the subscriber, but it is not.
+var ErrWalletNotTracked = errors.New("wallet is not tracked")
+
+// ErrWalletAlreadyTracked is returned when a wallet is tracked again for the
+// same user.
+var ErrWalletAlreadyTracked = errors.New("wallet is already tracked")
+
+// ErrSubscriberNotInitialized is returned when wallets are tracked by a
+// subscriber which was not created by its constructor.
+var ErrSubscriberNotInitialized = errors.New("subscriber not initialized")
+
+// ErrChainTipUnknown is returned by ChainTip until the subscriber receives
+// the chain tip from its provider.
+var ErrChainTipUnknown = errors.New("chain tip is not known yet")
+
+// ErrInvalidEvent is returned by TrackedWalletEvent.Validate when the event
+// breaks one of its invariants.
+var ErrInvalidEvent = errors.New("invalid tracked wallet event")
 
 // TransactionSubscriber subscribes to real time chain data for a particular blockchain.
 type TransactionSubscriber interface {
@@ -13,35 +42,242 @@ type TransactionSubscriber interface {
 	// RPC provider. Start does not block.
 	Start() (<-chan *TrackedWalletEvent, <-chan error)
 
-	// TrackWallet starts to track transactions of provided wallet
+	// TrackWallet starts to track transactions of provided wallet. Wallets
+	// are reference counted, every call adds a reference.
 	TrackWallet(wallet string) error
 
-	// UntrackWallet stops tracking wallet's transactions
+	// UntrackWallet releases a reference of the wallet added by TrackWallet.
+	// Wallet's transactions are no longer tracked once its last reference is
+	// released. ErrWalletNotTracked is returned if the wallet has no
+	// references.
 	UntrackWallet(wallet string) error
 
+	// MuteWallet suppresses events of a tracked wallet. Muted wallet's
+	// transactions are still processed, but no events are emitted for it.
+	MuteWallet(wallet string) error
+
+	// UnmuteWallet resumes event emission for a previously muted wallet.
+	UnmuteWallet(wallet string) error
+
+	// WalletMuted reports whether events of a tracked wallet are muted.
+	// ErrWalletNotTracked is returned if the wallet is not tracked.
+	WalletMuted(wallet string) (bool, error)
+
+	// TrackedWallets returns sorted addresses of currently tracked wallets in
+	// their canonical form.
+	TrackedWallets() []string
+
 	// Name returns the chain name of given TransactionSubscriber
 	Name() ChainName
+
+	// ChainTip returns the latest block height, slot for solana, received
+	// from the provider by the most recent poll or new head subscription.
+	ChainTip() (uint64, error)
+
+	// LastProcessedBlock returns the height, slot for solana, of the latest
+	// block whose transactions were processed. 0 until the first block is
+	// processed.
+	LastProcessedBlock() uint64
+
+	// Stop stops the subscriber. Goroutines started by Start exit and the
+	// channels returned by Start are closed. Stop is safe to call multiple
+	// times.
+	Stop() error
+}
+
+// send sends v to out unless stop is closed first. It reports whether v was
+// sent.
+func send[T any](out chan<- T, v T, stop <-chan struct{}) bool {
+	select {
+	case out <- v:
+		return true
+	case <-stop:
+		return false
+	}
 }
 
-// TrackedWalletEvent represents a tracked wallet event. For bitcoin events,
-// Source will contain a string of comma separated addresses. For solana events,
-// if amount is sender's value, Source will be a single wallet address and
+// TrackedWalletEvent represents a tracked wallet event. For bitcoin incoming
+// events, Source will contain a string of comma separated addresses, outgoing
+// events of spenders have comma separated recipients in Destination and carry
+// the fee. For solana events, if amount is sender's value, Source will be a single wallet address and
 // Destination will contain comma separated recipient addresses. If amount is
 // recipient's value, Source will contain comma separated sender addresses and
 // Destination will be a single wallet address. For solana, Fees will be non 0
-// only for fee payer Source.
+// only for fee payer Source, unless transactions are aggregated, see
+// WithAggregatedTransactions. IdempotencyKey is deterministic for the same
+// logical event and can be used by consumers to deduplicate re-emitted events.
+// Type is empty for transfer events.
 type TrackedWalletEvent struct {
-	ChainName   ChainName
+	Type      EventType `json:",omitempty"`
+	ChainName ChainName
+	TxHash    string
+	// Tracked wallet whose match caused the event, i.e. the single
+	// registered wallet among Source and Destination lists the event is
+	// about. Transactions matching several tracked wallets emit an event
+	// per wallet.
+	Wallet         string
+	Source         string
+	Destination    string
+	Amount         *big.Int
+	Fees           *big.Int
+	IdempotencyKey string
+
+	// Number of the block containing the transaction. Slot for solana.
+	BlockNumber uint64
+	// Position of the transaction within its block. Together with
+	// BlockNumber it totally orders events of a chain.
+	TxIndex uint64
+	// On-chain time of the block containing the transaction. Zero if the
+	// provider does not report it.
+	BlockTime time.Time
+	// Time when the service processed the transaction
+	ObservedAt time.Time
+
+	// Balances of the tracked wallet before and after the transaction. Only
+	// set for solana events when enabled.
+	PreBalance  *big.Int `json:",omitempty"`
+	PostBalance *big.Int `json:",omitempty"`
+
+	// Whether the block was processed while catching up with the chain tip,
+	// e.g. after an RPC outage. Only set if catch-up events are tagged, see
+	// WithCatchUpEvents.
+	Historical bool `json:",omitempty"`
+
+	// Whether the transaction failed on chain. Failed transactions only
+	// charge fees and have no destination. Only set for solana events when
+	// failed transactions are included, see WithFailedTransactions.
+	Failed bool `json:",omitempty"`
+
+	// Transfers of the transaction from or to the tracked wallet, parsed
+	// from instructions. Only set for solana events when enabled.
+	Flows []AssetFlow `json:",omitempty"`
+
+	// Log of EventLog events
+	Log *EventLogData `json:",omitempty"`
+
+	// Idempotency key of the event reverted by EventReverted events
+	Reverts string `json:",omitempty"`
+
+	// Whether Amount exceeds the maximum plausible amount of the chain,
+	// which likely indicates a processing bug. See WithAmountBounds.
+	Implausible bool `json:",omitempty"`
+
+	// User the event is emitted for. Events of wallets tracked by several
+	// users are emitted once per user. 0 if the wallet is not associated
+	// with a user, see TrackUserWallet.
+	UserID int `json:",omitempty"`
+
+	// Direction of transfers, and contract creations and reverts derived
+	// from them, from the perspective of Wallet. Used to apply direction
+	// settings of users, empty for other events.
+	direction Direction
+}
+
+// Validate checks invariants consumers rely on. Every event must have a
+// chain, wallet and idempotency key. Transfer events must also have a
+// transaction hash, source, destination and non negative amount and fees.
+// Events of failed transactions may have no destination.
+func (e *TrackedWalletEvent) Validate() error {
+	switch {
+	case e.ChainName == "":
+		return fmt.Errorf("%w: empty chain name", ErrInvalidEvent)
+	case e.Wallet == "":
+		return fmt.Errorf("%w: empty wallet", ErrInvalidEvent)
+	case e.IdempotencyKey == "":
+		return fmt.Errorf("%w: empty idempotency key", ErrInvalidEvent)
+	}
+	if e.Type != "" {
+		return nil
+	}
+
+	switch {
+	case e.TxHash == "":
+		return fmt.Errorf("%w: empty tx hash", ErrInvalidEvent)
+	case e.Source == "":
+		return fmt.Errorf("%w: empty source", ErrInvalidEvent)
+	case e.Destination == "" && !e.Failed:
+		return fmt.Errorf("%w: empty destination", ErrInvalidEvent)
+	case e.Amount == nil:
+		return fmt.Errorf("%w: nil amount", ErrInvalidEvent)
+	case e.Amount.Sign() < 0:
+		return fmt.Errorf("%w: negative amount %s", ErrInvalidEvent, e.Amount)
+	case e.Fees == nil:
+		return fmt.Errorf("%w: nil fees", ErrInvalidEvent)
+	case e.Fees.Sign() < 0:
+		return fmt.Errorf("%w: negative fees %s", ErrInvalidEvent, e.Fees)
+	}
+	return nil
+}
+
+// AssetFlow is a single transfer of an asset within a transaction.
+type AssetFlow struct {
 	Source      string
 	Destination string
+	AssetID     string
 	Amount      *big.Int
-	Fees        *big.Int
+}
+
+// EventType distinguishes special events from transfer events.
+type EventType string
+
+// EventFirstActivity is emitted before the first transfer event of a wallet
+// seen by the process.
+const EventFirstActivity EventType = "first_activity"
+
+// EventContractCreation is emitted when a tracked wallet deploys a contract,
+// in addition to the transfer event of the transaction. Destination is the
+// address of the created contract. Only emitted by ethereum when enabled.
+const EventContractCreation EventType = "contract_creation"
+
+// EventLog is emitted for contract logs with configured topics which involve
+// a tracked wallet. Source is the address of the contract which emitted the
+// log. Only emitted by ethereum when enabled, see WithLogTopics.
+const EventLog EventType = "log"
+
+// EventLogData is a contract log of an EventLog event.
+type EventLogData struct {
+	// Position of the log within its block
+	Index  uint
+	Topics []string
+	// Hex encoded non indexed data
+	Data string
+}
+
+// Direction of the transfer from the perspective of the tracked wallet.
+type Direction string
+
+const (
+	DirectionIncoming Direction = "incoming"
+	DirectionOutgoing Direction = "outgoing"
+)
+
+// NativeAssetID identifies chain's native currency (ETH, BTC, SOL).
+const NativeAssetID = "native"
+
+// idempotencyKey computes a deterministic key of an event from its identifying
+// attributes.
+func idempotencyKey(chain ChainName, txHash, wallet string, direction Direction, assetID string) string {
+	h := sha256.Sum256([]byte(strings.Join(
+		[]string{string(chain), txHash, wallet, string(direction), assetID},
+		"|",
+	)))
+	return hex.EncodeToString(h[:])
+}
+
+// userIdempotencyKey derives the idempotency key of an event copy emitted
+// for the user from the key of the event.
+func userIdempotencyKey(key string, userID int) string {
+	return idempotencyKey("", key, strconv.Itoa(userID), "", "")
 }
 
 type ChainName string
 
 const (
 	EthereumMainnet ChainName = "ethereum_mainnet"
+	EthereumSepolia ChainName = "ethereum_sepolia"
+	EthereumHolesky ChainName = "ethereum_holesky"
+	PolygonMainnet  ChainName = "polygon_mainnet"
+	BscMainnet      ChainName = "bsc_mainnet"
 	Bitcoin         ChainName = "bitcoin"
 	SolanaMainnet   ChainName = "solana_mainnet"
 )
@@ -0,0 +1,249 @@
+package chain
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackedWalletEventValidate(t *testing.T) {
+	transfer := func(modify func(e *TrackedWalletEvent)) *TrackedWalletEvent {
+		e := &TrackedWalletEvent{
+			ChainName:      EthereumMainnet,
+			TxHash:         "0x01",
+			Wallet:         "0xa",
+			Source:         "0xa",
+			Destination:    "0xb",
+			Amount:         big.NewInt(10),
+			Fees:           big.NewInt(1),
+			IdempotencyKey: "key",
+		}
+		if modify != nil {
+			modify(e)
+		}
+		return e
+	}
+
+	tests := []struct {
+		name    string
+		event   *TrackedWalletEvent
+		wantErr string
+	}{
+		{name: "valid transfer", event: transfer(nil)},
+		{
+			name:  "zero amount and fees",
+			event: transfer(func(e *TrackedWalletEvent) { e.Amount, e.Fees = big.NewInt(0), big.NewInt(0) }),
+		},
+		{
+			name: "first activity without transfer fields",
+			event: &TrackedWalletEvent{
+				Type:           EventFirstActivity,
+				ChainName:      SolanaMainnet,
+				Wallet:         "wallet",
+				IdempotencyKey: "key",
+			},
+		},
+		{
+			name:    "empty chain",
+			event:   transfer(func(e *TrackedWalletEvent) { e.ChainName = "" }),
+			wantErr: "invalid tracked wallet event: empty chain name",
+		},
+		{
+			name:    "empty wallet",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Wallet = "" }),
+			wantErr: "invalid tracked wallet event: empty wallet",
+		},
+		{
+			name:    "empty idempotency key",
+			event:   transfer(func(e *TrackedWalletEvent) { e.IdempotencyKey = "" }),
+			wantErr: "invalid tracked wallet event: empty idempotency key",
+		},
+		{
+			name:    "empty tx hash",
+			event:   transfer(func(e *TrackedWalletEvent) { e.TxHash = "" }),
+			wantErr: "invalid tracked wallet event: empty tx hash",
+		},
+		{
+			name:    "empty source",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Source = "" }),
+			wantErr: "invalid tracked wallet event: empty source",
+		},
+		{
+			name:  "failed transaction without destination",
+			event: transfer(func(e *TrackedWalletEvent) { e.Destination, e.Failed = "", true }),
+		},
+		{
+			name:    "empty destination",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Destination = "" }),
+			wantErr: "invalid tracked wallet event: empty destination",
+		},
+		{
+			name:    "nil amount",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Amount = nil }),
+			wantErr: "invalid tracked wallet event: nil amount",
+		},
+		{
+			name:    "negative amount",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Amount = big.NewInt(-1) }),
+			wantErr: "invalid tracked wallet event: negative amount -1",
+		},
+		{
+			name:    "nil fees",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Fees = nil }),
+			wantErr: "invalid tracked wallet event: nil fees",
+		},
+		{
+			name:    "negative fees",
+			event:   transfer(func(e *TrackedWalletEvent) { e.Fees = big.NewInt(-5) }),
+			wantErr: "invalid tracked wallet event: negative fees -5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.event.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, ErrInvalidEvent)
+		})
+	}
+}
+
+func TestSubscriberWalletReferences(t *testing.T) {
+	tests := []struct {
+		sub    TransactionSubscriber
+		wallet string
+	}{
+		{
+			sub:    NewEthereumMainnetSubscriber("http://dummy.net"),
+			wallet: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		},
+		{
+			sub:    NewBitcoinSubscriber("dummy"),
+			wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		},
+		{
+			sub:    NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url"),
+			wallet: types.NewAccount().PublicKey.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sub.Name()), func(t *testing.T) {
+			assert.NoError(t, tt.sub.TrackWallet(tt.wallet))
+			assert.NoError(t, tt.sub.TrackWallet(tt.wallet))
+
+			// Tracked until every reference is released
+			assert.NoError(t, tt.sub.UntrackWallet(tt.wallet))
+			assert.Equal(t, []string{tt.wallet}, tt.sub.TrackedWallets())
+			assert.NoError(t, tt.sub.MuteWallet(tt.wallet))
+
+			assert.NoError(t, tt.sub.UntrackWallet(tt.wallet))
+			assert.Empty(t, tt.sub.TrackedWallets())
+			assert.ErrorIs(t, tt.sub.MuteWallet(tt.wallet), ErrWalletNotTracked)
+
+			// Releasing an untracked wallet is reported and has no effect
+			assert.ErrorIs(t, tt.sub.UntrackWallet(tt.wallet), ErrWalletNotTracked)
+			assert.NoError(t, tt.sub.TrackWallet(tt.wallet))
+			assert.Equal(t, []string{tt.wallet}, tt.sub.TrackedWallets())
+		})
+	}
+}
+
+func TestSubscriberConcurrentTracking(t *testing.T) {
+	tests := []struct {
+		sub    TransactionSubscriber
+		wallet string
+	}{
+		{
+			sub:    NewEthereumMainnetSubscriber("http://dummy.net"),
+			wallet: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		},
+		{
+			sub:    NewBitcoinSubscriber("dummy"),
+			wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		},
+		{
+			sub:    NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url"),
+			wallet: types.NewAccount().PublicKey.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sub.Name()), func(t *testing.T) {
+			// Every worker releases the references it holds, except kept
+			// ones
+			const workers, rounds, kept = 16, 50, 3
+			wg := sync.WaitGroup{}
+			for i := range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range rounds {
+						assert.NoError(t, tt.sub.TrackWallet(tt.wallet))
+						assert.NoError(t, tt.sub.MuteWallet(tt.wallet))
+						_, err := tt.sub.WalletMuted(tt.wallet)
+						assert.NoError(t, err)
+						tt.sub.TrackedWallets()
+						assert.NoError(t, tt.sub.UnmuteWallet(tt.wallet))
+						assert.NoError(t, tt.sub.UntrackWallet(tt.wallet))
+					}
+					if i < kept {
+						assert.NoError(t, tt.sub.TrackWallet(tt.wallet))
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, []string{tt.wallet}, tt.sub.TrackedWallets())
+			for range kept {
+				assert.NoError(t, tt.sub.UntrackWallet(tt.wallet))
+			}
+			assert.Empty(t, tt.sub.TrackedWallets())
+			assert.ErrorIs(t, tt.sub.UntrackWallet(tt.wallet), ErrWalletNotTracked)
+		})
+	}
+}
+
+func TestTrackWalletUninitializedSubscriber(t *testing.T) {
+	tests := []struct {
+		name   string
+		sub    TransactionSubscriber
+		wallet string
+	}{
+		{
+			name:   "ethereum",
+			sub:    &ethereumMainnetSubscriber{},
+			wallet: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		},
+		{
+			name:   "bitcoin",
+			sub:    &bitcoinSubscriber{},
+			wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		},
+		{
+			name:   "solana",
+			sub:    &solanaMainnetSubscriber{},
+			wallet: types.NewAccount().PublicKey.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				assert.ErrorIs(t, tt.sub.TrackWallet(tt.wallet), ErrSubscriberNotInitialized)
+			})
+		})
+	}
+
+	// Subscribers created by constructors track wallets before Init
+	assert.NoError(t, NewEthereumMainnetSubscriber("http://dummy.net").TrackWallet("0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"))
+	assert.NoError(t, NewBitcoinSubscriber("dummy").TrackWallet("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"))
+	assert.NoError(t, NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url").TrackWallet(types.NewAccount().PublicKey.String()))
+}
@@ -0,0 +1,171 @@
+package chain
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// WalletSettings are settings of a wallet tracked for a user. Muted is shared
+// by all users of the wallet.
+type WalletSettings struct {
+	Muted         bool
+	Confirmations uint64
+	// nil - transfers of any amount are emitted
+	MinAmount *big.Int
+	Direction Direction
+}
+
+// TrackedWalletConfig is the tracking configuration of a wallet, used to back
+// up tracked wallets and restore them, e.g. when migrating to another
+// instance. Users of a wallet with different settings have a config each.
+type TrackedWalletConfig struct {
+	Chain ChainName `json:"chain"`
+	// Canonical form of the wallet
+	Wallet string `json:"wallet"`
+	// Users the wallet is tracked for with the settings, 0 - tracked
+	// without a user
+	UserIDs       []int  `json:"user_ids"`
+	Muted         bool   `json:"muted,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// Decimal integer in the chain's base units, empty if not set
+	MinAmount string    `json:"min_amount,omitempty"`
+	Direction Direction `json:"direction,omitempty"`
+}
+
+func (m *mapSubManager) ExportWallets() ([]TrackedWalletConfig, error) {
+	m.usersMu.RLock()
+	defer m.usersMu.RUnlock()
+
+	configs := []TrackedWalletConfig{}
+	for chain, wallets := range m.walletUsers {
+		sub, ok := m.sub(chain)
+		if !ok {
+			continue
+		}
+		for wallet, users := range wallets {
+			userIDs := make([]int, 0, len(users))
+			for userID := range users {
+				userIDs = append(userIDs, userID)
+			}
+			slices.Sort(userIDs)
+
+			// Users with equal settings share a config
+			walletConfigs := []TrackedWalletConfig{}
+			for _, userID := range userIDs {
+				settings, err := m.walletSettings(sub, userWallet{userID, wallet, chain})
+				if err != nil {
+					return nil, fmt.Errorf("settings of %s wallet %s: %w", chain, wallet, err)
+				}
+				config := TrackedWalletConfig{
+					Chain:         chain,
+					Wallet:        wallet,
+					Muted:         settings.Muted,
+					Confirmations: settings.Confirmations,
+				}
+				if settings.MinAmount != nil {
+					config.MinAmount = settings.MinAmount.String()
+				}
+				if settings.Direction != DirectionBoth {
+					config.Direction = settings.Direction
+				}
+				i := slices.IndexFunc(walletConfigs, func(c TrackedWalletConfig) bool {
+					return c.Confirmations == config.Confirmations &&
+						c.MinAmount == config.MinAmount &&
+						c.Direction == config.Direction
+				})
+				if i < 0 {
+					walletConfigs = append(walletConfigs, config)
+					i = len(walletConfigs) - 1
+				}
+				walletConfigs[i].UserIDs = append(walletConfigs[i].UserIDs, userID)
+			}
+			configs = append(configs, walletConfigs...)
+		}
+	}
+	slices.SortFunc(configs, func(a, b TrackedWalletConfig) int {
+		return cmp.Or(
+			cmp.Compare(a.Chain, b.Chain),
+			cmp.Compare(a.Wallet, b.Wallet),
+			cmp.Compare(a.UserIDs[0], b.UserIDs[0]),
+		)
+	})
+	return configs, nil
+}
+
+func (m *mapSubManager) ImportWallets(configs []TrackedWalletConfig) error {
+	// Validate every config before mutating any subscriber
+	type walletImport struct {
+		config    TrackedWalletConfig
+		minAmount *big.Int
+		direction Direction
+	}
+	imports := make([]walletImport, 0, len(configs))
+	for _, config := range configs {
+		if _, ok := m.sub(config.Chain); !ok {
+			return fmt.Errorf("%w %s", ErrNoSubscriber, config.Chain)
+		}
+		normalized, err := NormalizeWallet(config.Chain, config.Wallet)
+		if err != nil {
+			return fmt.Errorf("invalid %s wallet %s: %w", config.Chain, config.Wallet, err)
+		}
+		config.Wallet = normalized
+		if len(config.UserIDs) == 0 {
+			return fmt.Errorf("%s wallet %s has no users", config.Chain, config.Wallet)
+		}
+		var minAmount *big.Int
+		if config.MinAmount != "" {
+			amount, ok := new(big.Int).SetString(config.MinAmount, 10)
+			if !ok || amount.Sign() < 0 {
+				return fmt.Errorf("invalid minimum amount %q of %s wallet %s", config.MinAmount, config.Chain, config.Wallet)
+			}
+			minAmount = amount
+		}
+		direction, err := ParseDirectionFilter(string(config.Direction))
+		if err != nil {
+			return fmt.Errorf("invalid direction of %s wallet %s: %w", config.Chain, config.Wallet, err)
+		}
+		imports = append(imports, walletImport{config, minAmount, direction})
+	}
+
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+
+	// Users tracked by the import, untracked again on failure. Settings are
+	// applied before tracking, so that no events are emitted without them.
+	tracked := []userWallet{}
+	rollback := func() {
+		for _, done := range tracked {
+			m.untrackWallet(done.wallet, done.chain)
+			m.removeUserWallet(done.userID, done.chain, done.wallet)
+		}
+	}
+	for _, i := range imports {
+		sub, _ := m.sub(i.config.Chain)
+		wallet := i.config.Wallet
+		for _, userID := range i.config.UserIDs {
+			key := userWallet{userID, wallet, i.config.Chain}
+			m.confirmations.set(key, i.config.Confirmations)
+			m.minAmounts.set(key, i.minAmount)
+			m.directions.set(key, i.direction)
+			// Users already tracking the wallet keep it
+			if m.walletUsers[i.config.Chain][wallet][userID] {
+				continue
+			}
+			if err := sub.TrackWallet(wallet); err != nil {
+				rollback()
+				return fmt.Errorf("tracking %s wallet %s: %w", i.config.Chain, wallet, err)
+			}
+			m.addUserWallet(userID, i.config.Chain, wallet)
+			tracked = append(tracked, userWallet{userID, wallet, i.config.Chain})
+		}
+		if i.config.Muted {
+			if err := sub.MuteWallet(wallet); err != nil {
+				rollback()
+				return fmt.Errorf("muting %s wallet %s: %w", i.config.Chain, wallet, err)
+			}
+		}
+	}
+	return nil
+}
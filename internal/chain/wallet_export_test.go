@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/blocto/solana-go-sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportTestManager returns a manager with subscribers of every chain.
+func exportTestManager() *mapSubManager {
+	m := NewSubsciberManager().(*mapSubManager)
+	m.subs[EthereumMainnet] = NewEthereumMainnetSubscriber("http://dummy.net")
+	m.subs[Bitcoin] = NewBitcoinSubscriber("dummy")
+	m.subs[SolanaMainnet] = NewSolanaMainnetSubscriber("alchemy-or-other-rpc-url")
+	return m
+}
+
+func TestSubscriberManagerExportImportRoundTrip(t *testing.T) {
+	ethWallet, btcWallet := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	solWallet := types.NewAccount().PublicKey.String()
+
+	m := exportTestManager()
+	// Users 1 and 2 share settings, user 4 has its own
+	for _, userID := range []int{1, 2} {
+		assert.NoError(t, m.SetWalletConfirmations(userID, ethWallet, EthereumMainnet, 12))
+		assert.NoError(t, m.SetWalletMinAmount(userID, ethWallet, EthereumMainnet, big.NewInt(1000)))
+		assert.NoError(t, m.TrackUserWallet(userID, ethWallet, EthereumMainnet))
+	}
+	assert.NoError(t, m.TrackUserWallet(4, ethWallet, EthereumMainnet))
+	assert.NoError(t, m.SetWalletDirection(4, ethWallet, EthereumMainnet, DirectionOutgoing))
+	assert.NoError(t, m.SetWalletDirection(0, btcWallet, Bitcoin, DirectionIncoming))
+	assert.NoError(t, m.TrackWallet(btcWallet, Bitcoin))
+	assert.NoError(t, m.TrackUserWallet(3, solWallet, SolanaMainnet))
+	assert.NoError(t, m.MuteWallet(solWallet, SolanaMainnet))
+
+	exported, err := m.ExportWallets()
+	assert.NoError(t, err)
+	assert.Equal(t, []TrackedWalletConfig{
+		{Chain: Bitcoin, Wallet: btcWallet, UserIDs: []int{0}, Direction: DirectionIncoming},
+		{Chain: EthereumMainnet, Wallet: ethWallet, UserIDs: []int{1, 2}, Confirmations: 12, MinAmount: "1000"},
+		{Chain: EthereumMainnet, Wallet: ethWallet, UserIDs: []int{4}, Direction: DirectionOutgoing},
+		{Chain: SolanaMainnet, Wallet: solWallet, UserIDs: []int{3}, Muted: true},
+	}, exported)
+
+	// Restored from JSON by another instance
+	backup, err := json.Marshal(exported)
+	assert.NoError(t, err)
+	restoredConfigs := []TrackedWalletConfig{}
+	assert.NoError(t, json.Unmarshal(backup, &restoredConfigs))
+	restored := exportTestManager()
+	assert.NoError(t, restored.ImportWallets(restoredConfigs))
+
+	reexported, err := restored.ExportWallets()
+	assert.NoError(t, err)
+	assert.Equal(t, exported, reexported)
+	assert.Equal(t, m.TrackedWallets(), restored.TrackedWallets())
+
+	// Importing again keeps the wallets tracked once per user
+	assert.NoError(t, restored.ImportWallets(restoredConfigs))
+	assert.NoError(t, restored.UntrackUserWallet(1, ethWallet, EthereumMainnet))
+	assert.NoError(t, restored.UntrackUserWallet(2, ethWallet, EthereumMainnet))
+	assert.NoError(t, restored.UntrackUserWallet(4, ethWallet, EthereumMainnet))
+	assert.Empty(t, restored.TrackedWallets()[EthereumMainnet])
+}
+
+func TestSubscriberManagerImportInvalidWallets(t *testing.T) {
+	ethWallet := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	valid := TrackedWalletConfig{Chain: EthereumMainnet, Wallet: ethWallet, UserIDs: []int{1}}
+
+	tests := []struct {
+		name    string
+		invalid TrackedWalletConfig
+		wantErr string
+	}{
+		{
+			name:    "unsupported chain",
+			invalid: TrackedWalletConfig{Chain: "dogecoin", Wallet: "D", UserIDs: []int{1}},
+			wantErr: "no registered subscriber for chain dogecoin",
+		},
+		{
+			name:    "invalid wallet",
+			invalid: TrackedWalletConfig{Chain: Bitcoin, Wallet: ethWallet, UserIDs: []int{1}},
+			wantErr: "invalid bitcoin wallet",
+		},
+		{
+			name:    "without users",
+			invalid: TrackedWalletConfig{Chain: Bitcoin, Wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},
+			wantErr: "has no users",
+		},
+		{
+			name:    "invalid minimum amount",
+			invalid: TrackedWalletConfig{Chain: Bitcoin, Wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", UserIDs: []int{1}, MinAmount: "-1"},
+			wantErr: `invalid minimum amount "-1"`,
+		},
+		{
+			name:    "invalid direction",
+			invalid: TrackedWalletConfig{Chain: Bitcoin, Wallet: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", UserIDs: []int{1}, Direction: "sideways"},
+			wantErr: "invalid direction",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := exportTestManager()
+			err := m.ImportWallets([]TrackedWalletConfig{valid, tt.invalid})
+			assert.ErrorContains(t, err, tt.wantErr)
+			// Nothing is imported
+			exported, err := m.ExportWallets()
+			assert.NoError(t, err)
+			assert.Empty(t, exported)
+		})
+	}
+}
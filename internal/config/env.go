@@ -9,12 +9,333 @@ const (
 	// Bitcoin rpc url - http url
 	RPC_URL_BITCOIN = "RPC_URL_BITCOIN"
 
+	// Initial and maximum delay of exponential backoff used when resubscribing
+	// to ethereum new heads, as duration strings. Defaults are 1s and 1m.
+	ETHEREUM_RESUBSCRIBE_BACKOFF_BASE = "ETHEREUM_RESUBSCRIBE_BACKOFF_BASE"
+	ETHEREUM_RESUBSCRIBE_BACKOFF_MAX  = "ETHEREUM_RESUBSCRIBE_BACKOFF_MAX"
+
+	// Maximum number of missed ethereum blocks processed after the subscriber
+	// falls behind, e.g. after reconnecting. Older blocks are skipped. Default
+	// is 128, 0 - no limit.
+	ETHEREUM_MAX_BACKFILL_BLOCKS = "ETHEREUM_MAX_BACKFILL_BLOCKS"
+
+	// Whether a contract_creation event is emitted when a tracked ethereum
+	// wallet deploys a contract. Default is false.
+	ETHEREUM_EMIT_CONTRACT_CREATION = "ETHEREUM_EMIT_CONTRACT_CREATION"
+
+	// Comma separated 32 byte hex topics, e.g. event signature hashes. Logs
+	// with any of the topics emitted by or indexing a tracked ethereum wallet
+	// are emitted as log events. Default is empty - logs are not fetched.
+	ETHEREUM_LOG_TOPICS = "ETHEREUM_LOG_TOPICS"
+
+	// Whether to emit reverted events of ethereum transactions whose block
+	// was orphaned by a reorg, so consumers can roll them back. Default is
+	// false.
+	ETHEREUM_EMIT_REVERTED = "ETHEREUM_EMIT_REVERTED"
+
+	// Number of recently processed ethereum blocks whose events can be
+	// reverted. Default is 64.
+	ETHEREUM_REVERT_DEPTH = "ETHEREUM_REVERT_DEPTH"
+
+	// Maximum depth of ethereum reorgs detected by parent hashes of new
+	// blocks. Canonical blocks replacing processed ones are processed again.
+	// 0 disables the detection. Default is 64.
+	ETHEREUM_REORG_DEPTH = "ETHEREUM_REORG_DEPTH"
+
+	// Whether ENS names are accepted in place of ethereum wallet addresses.
+	// Names are tracked as the addresses they resolve to. Default is false.
+	ENS_ENABLED = "ENS_ENABLED"
+
+	// Interval of re-resolving tracked ENS names as a duration string.
+	// Tracking moves to the new address once a name resolves to it. Default
+	// is 10m.
+	ENS_REFRESH_INTERVAL = "ENS_REFRESH_INTERVAL"
+
+	// Maximum number of most recent solana slots to process when the
+	// subscriber lags behind the chain tip. Older slots are skipped. Default is
+	// 0 - no limit.
+	SOLANA_MAX_CATCHUP_SLOTS = "SOLANA_MAX_CATCHUP_SLOTS"
+
+	// Number of dropped events per chain within EVENT_DROP_ALERT_WINDOW
+	// which triggers a high severity alert. Default is 0 - alert disabled.
+	EVENT_DROP_ALERT_THRESHOLD = "EVENT_DROP_ALERT_THRESHOLD"
+
+	// Window of EVENT_DROP_ALERT_THRESHOLD as a duration string. Default is 1m
+	EVENT_DROP_ALERT_WINDOW = "EVENT_DROP_ALERT_WINDOW"
+
+	// Whether API responses are gzip compressed for clients which accept it.
+	// Default is false.
+	API_GZIP_ENABLED = "API_GZIP_ENABLED"
+
+	// Minimum API response size in bytes which is gzip compressed. Default is
+	// 1024.
+	API_GZIP_MIN_SIZE = "API_GZIP_MIN_SIZE"
+
+	// Whether API routes are only served with the version prefix, e.g.
+	// /v1/tracked-wallets, and not at their unversioned paths. Default is
+	// false.
+	API_DISABLE_LEGACY_ROUTES = "API_DISABLE_LEGACY_ROUTES"
+
+	// Number of track, untrack and admin API requests per second allowed for
+	// each client ip, as a decimal number. Default is 0 - not limited.
+	API_RATE_LIMIT = "API_RATE_LIMIT"
+
+	// Number of track, untrack and admin API requests a client ip may burst
+	// above API_RATE_LIMIT. Default is 10.
+	API_RATE_LIMIT_BURST = "API_RATE_LIMIT_BURST"
+
+	// Bearer token of the admin API endpoints, which export and import
+	// tracked wallets and stop chain subscribers. Default is empty - admin
+	// endpoints are disabled.
+	API_ADMIN_TOKEN = "API_ADMIN_TOKEN"
+
+	// Number of events buffered for each consumer of the event stream. When
+	// a consumer's buffer is full, new events are dropped for that consumer,
+	// except for event sinks, which hold back new events until they catch
+	// up. Default is 256.
+	EVENT_HUB_BUFFER_SIZE = "EVENT_HUB_BUFFER_SIZE"
+
+	// Number of event idempotency keys remembered to drop duplicate events
+	// before they reach any consumer, e.g. transactions processed again in a
+	// competing block of a reorg. Default is 10000, 0 disables
+	// deduplication.
+	DEDUP_CACHE_SIZE = "DEDUP_CACHE_SIZE"
+
+	// Time an idempotency key is remembered as a duration string, 0 keeps
+	// keys until evicted by DEDUP_CACHE_SIZE. Default is 10m.
+	DEDUP_TTL = "DEDUP_TTL"
+
+	// Which keys DEDUP_CACHE_SIZE evicts first, either "lru" (least
+	// recently seen, duplicates refresh the key) or "ttl" (oldest). Default
+	// is lru.
+	DEDUP_EVICTION_POLICY = "DEDUP_EVICTION_POLICY"
+
+	// Comma separated chain:confirmations pairs, e.g. bitcoin:3, delaying
+	// publishing of all events of the chain until it advanced the number of
+	// blocks, the block containing the transaction included. Default is
+	// empty - events are published as soon as they are received.
+	PUBLISH_CONFIRMATIONS = "PUBLISH_CONFIRMATIONS"
+
+	// Number of unused solana HD wallet addresses tracked after the last used
+	// one. Default is 20.
+	SOLANA_HD_GAP_LIMIT = "SOLANA_HD_GAP_LIMIT"
+
+	// Whether a first_activity event is emitted before the first transfer
+	// event of each wallet seen since the service start. Default is false.
+	EMIT_FIRST_ACTIVITY_EVENTS = "EMIT_FIRST_ACTIVITY_EVENTS"
+
+	// What to do with events of blocks processed while catching up with the
+	// chain tip: emit, tag (emitted with Historical set) or suppress. Default
+	// is emit.
+	CATCH_UP_EVENTS = "CATCH_UP_EVENTS"
+
+	// Whether balance changes of solana program owned accounts are excluded
+	// from event senders and recipients. Requires account owner lookups.
+	// Default is false.
+	SOLANA_FILTER_PROGRAM_ACCOUNTS = "SOLANA_FILTER_PROGRAM_ACCOUNTS"
+
+	// Whether solana events include tracked wallet's lamport balances before
+	// and after the transaction. Default is false.
+	SOLANA_EMIT_BALANCES = "SOLANA_EMIT_BALANCES"
+
+	// Whether a single event is emitted per solana transaction involving
+	// tracked wallets, listing all senders and recipients. Default is false -
+	// an event per tracked sender and recipient.
+	SOLANA_AGGREGATE_TRANSACTIONS = "SOLANA_AGGREGATE_TRANSACTIONS"
+
+	// Whether solana events include SOL transfers parsed from System Program
+	// instructions, including inner instructions. Default is false.
+	SOLANA_INSTRUCTION_FLOWS = "SOLANA_INSTRUCTION_FLOWS"
+
+	// Whether rent returned by closing solana token accounts is excluded from
+	// balance changes, so that closures are not reported as transfers.
+	// Default is false.
+	SOLANA_SKIP_ACCOUNT_CLOSURES = "SOLANA_SKIP_ACCOUNT_CLOSURES"
+
+	// Whether solana transactions invoking the Vote program only, i.e.
+	// validator votes, are skipped before processing. Default is false.
+	SOLANA_SKIP_VOTE_TXS = "SOLANA_SKIP_VOTE_TXS"
+
+	// What to do with solana transactions which failed on chain: exclude or
+	// include (emitted with Failed set). Default is exclude.
+	SOLANA_FAILED_TXS = "SOLANA_FAILED_TXS"
+
 	// Http api port. Default is 8080
 	API_PORT = "API_PORT"
 
 	// Http api bind address. Default is 127.0.0.1
 	API_BIND_ADDR = "API_BIND_ADDR"
 
+	// Comma separated list of proxy IPs or CIDR ranges whose X-Forwarded-For
+	// and X-Real-IP headers are trusted. Default is empty - headers are
+	// ignored.
+	API_TRUSTED_PROXIES = "API_TRUSTED_PROXIES"
+
+	// Comma separated list of from:to renames of event fields published to
+	// Kafka and webhooks, e.g. TxHash:tx_hash. Default is empty.
+	EVENT_RENAME_FIELDS = "EVENT_RENAME_FIELDS"
+
+	// Comma separated list of event fields left out of events published to
+	// Kafka and webhooks. Default is empty.
+	EVENT_DROP_FIELDS = "EVENT_DROP_FIELDS"
+
+	// Comma separated list of key:value fields added to every event
+	// published to Kafka and webhooks. Default is empty.
+	EVENT_TAGS = "EVENT_TAGS"
+
+	// Number of goroutines processing transactions of a bitcoin block
+	// concurrently. Default is 8.
+	BITCOIN_TX_WORKERS = "BITCOIN_TX_WORKERS"
+
+	// Number of previous bitcoin transactions cached across blocks. Default
+	// is 10000.
+	BITCOIN_PREV_TX_CACHE_SIZE = "BITCOIN_PREV_TX_CACHE_SIZE"
+
+	// Whether bitcoin outputs of a transaction to the same tracked wallet are
+	// emitted as a single event with summed amounts. Default is false - an
+	// event per output.
+	BITCOIN_AGGREGATE_OUTPUTS = "BITCOIN_AGGREGATE_OUTPUTS"
+
+	// Maximum number of bitcoin blocks processed when the subscriber lags
+	// behind the chain tip. Older blocks are skipped. 0 means no limit.
+	// Default is 6.
+	BITCOIN_MAX_CATCHUP_BLOCKS = "BITCOIN_MAX_CATCHUP_BLOCKS"
+
+	// Interval of polling the latest bitcoin block as a duration string.
+	// Default is 15s.
+	BITCOIN_POLL_INTERVAL = "BITCOIN_POLL_INTERVAL"
+
+	// Interval of polling the latest solana slot as a duration string.
+	// Default is 1s.
+	SOLANA_POLL_INTERVAL = "SOLANA_POLL_INTERVAL"
+
+	// Maximum number of solana blocks fetched concurrently. Default is 16.
+	SOLANA_FETCH_WORKERS = "SOLANA_FETCH_WORKERS"
+
+	// Number of retries of failed solana block fetches. Skipped slots are
+	// not retried. Default is 3.
+	SOLANA_FETCH_RETRIES = "SOLANA_FETCH_RETRIES"
+
+	// Whether to only check configuration and RPC connectivity of chain
+	// subscribers and exit, with code 1 if any of them fails. Default is
+	// false.
+	VALIDATE_ONLY = "VALIDATE_ONLY"
+
+	// Number of retries of failed chain subscriber initialization at startup,
+	// e.g. while an RPC provider is briefly unavailable. Default is 3.
+	SUBSCRIBER_INIT_RETRIES = "SUBSCRIBER_INIT_RETRIES"
+
+	// Initial and maximum delay of exponential backoff between chain
+	// subscriber initialization attempts, as duration strings. Defaults are
+	// 1s and 30s.
+	SUBSCRIBER_INIT_BACKOFF_BASE = "SUBSCRIBER_INIT_BACKOFF_BASE"
+	SUBSCRIBER_INIT_BACKOFF_MAX  = "SUBSCRIBER_INIT_BACKOFF_MAX"
+
+	// Whether to start without chain subscribers which failed all
+	// initialization attempts instead of exiting. Default is false.
+	SUBSCRIBER_INIT_LENIENT = "SUBSCRIBER_INIT_LENIENT"
+
+	// Bitcoin network of RPC_URL_BITCOIN node and tracked addresses: mainnet,
+	// testnet3, signet or regtest. Default is mainnet.
+	BITCOIN_NETWORK = "BITCOIN_NETWORK"
+
+	// Maximum number of transactions of a bitcoin block processed per poll,
+	// bounding the work of a poll on large blocks. The rest of the block is
+	// processed by subsequent polls. Default is 0 - no limit.
+	BITCOIN_MAX_TXS_PER_BLOCK = "BITCOIN_MAX_TXS_PER_BLOCK"
+
+	// EVM chain of RPC_URL_ETHEREUM node and tracked ethereum wallets:
+	// ethereum_mainnet, ethereum_sepolia, ethereum_holesky, polygon_mainnet or
+	// bsc_mainnet. Default is ethereum_mainnet.
+	ETHEREUM_CHAIN = "ETHEREUM_CHAIN"
+
+	// Time components have to stop on SIGINT/SIGTERM as a duration string.
+	// Components still running afterwards are logged and the service exits
+	// with code 1. Default is 10s.
+	SHUTDOWN_TIMEOUT = "SHUTDOWN_TIMEOUT"
+
+	// Comma separated chain:amount pairs of maximum plausible event amounts
+	// in the chain's base units, e.g. the total supply. Events exceeding them
+	// are logged and flagged as implausible. Default is empty - amounts are
+	// not checked.
+	MAX_EVENT_AMOUNTS = "MAX_EVENT_AMOUNTS"
+
+	// Comma separated chain:address pairs of destinations whose events are
+	// the only ones emitted for the chain, e.g. deposit addresses. A chain may
+	// be listed multiple times. Default is empty - events of every
+	// destination are emitted.
+	DESTINATION_ALLOWLIST = "DESTINATION_ALLOWLIST"
+
+	// What to do with events when the sink is not ready to receive them:
+	// block, drop (counted as dropped events) or queue. Default is block.
+	SINK_POLICY = "SINK_POLICY"
+
+	// Number of events queued for the sink by the queue SINK_POLICY. Default
+	// is 1024.
+	SINK_QUEUE_SIZE = "SINK_QUEUE_SIZE"
+
+	// Name of the configured sink, kafka, webhook or file, which only mirrors
+	// events of the other sink, e.g. to validate it while migrating
+	// consumers. Its failures are logged without affecting the other sink.
+	// Default is empty - every sink is published to independently.
+	SHADOW_SINK = "SHADOW_SINK"
+
+	// Comma separated list of backends events are published to: kafka,
+	// webhook and file, e.g. "file" in environments without Kafka. Every
+	// listed backend requires its settings below. Default is empty - every
+	// backend whose settings are configured is used.
+	EVENT_BACKEND = "EVENT_BACKEND"
+
 	// Kafka broker url
 	KAFKA_BROKER_URL = "KAFKA_BROKER_URL"
+
+	// Kafka topic receiving all tracked wallet events, e.g. to route events
+	// per environment. Default is deblock_tx_tracker.
+	KAFKA_TOPIC = "KAFKA_TOPIC"
+
+	// Maximum number of events of a wallet produced as a single JSON array
+	// Kafka message, reducing per message overhead. Default is 0 - events are
+	// produced individually.
+	KAFKA_BATCH_SIZE = "KAFKA_BATCH_SIZE"
+
+	// Interval of producing incomplete Kafka batches as a duration string.
+	// Default is 1s.
+	KAFKA_BATCH_INTERVAL = "KAFKA_BATCH_INTERVAL"
+
+	// Url every event is POSTed to as JSON by the webhook backend. Default is
+	// empty - events are not delivered to a webhook.
+	WEBHOOK_URL = "WEBHOOK_URL"
+
+	// Shared secret of the HMAC-SHA256 body signature sent in the
+	// X-Deblock-Signature header of WEBHOOK_URL requests. Default is empty -
+	// requests are not signed.
+	WEBHOOK_SECRET = "WEBHOOK_SECRET"
+
+	// Timeout of a single WEBHOOK_URL delivery attempt as a duration string.
+	// Default is 10s.
+	WEBHOOK_TIMEOUT = "WEBHOOK_TIMEOUT"
+
+	// Number of retries of failed WEBHOOK_URL deliveries, i.e. transport
+	// errors and non 2xx responses. Default is 3.
+	WEBHOOK_RETRIES = "WEBHOOK_RETRIES"
+
+	// Initial and maximum delay of exponential backoff between WEBHOOK_URL
+	// delivery attempts, as duration strings. Defaults are 1s and 30s.
+	WEBHOOK_BACKOFF_BASE = "WEBHOOK_BACKOFF_BASE"
+	WEBHOOK_BACKOFF_MAX  = "WEBHOOK_BACKOFF_MAX"
+
+	// Path of a local file every event is appended to as a line of JSON by
+	// the file backend. Default is empty - events are not written to a file.
+	EVENT_FILE_PATH = "EVENT_FILE_PATH"
+
+	// Size in bytes EVENT_FILE_PATH is rotated at. Default is 104857600
+	// (100MiB), 0 disables size based rotation.
+	EVENT_FILE_MAX_SIZE = "EVENT_FILE_MAX_SIZE"
+
+	// Age EVENT_FILE_PATH is rotated at as a duration string. Default is 0 -
+	// the file is not rotated by age.
+	EVENT_FILE_MAX_AGE = "EVENT_FILE_MAX_AGE"
+
+	// Whether rotated event files are gzip compressed. Default is false.
+	EVENT_FILE_GZIP = "EVENT_FILE_GZIP"
 )
@@ -20,8 +20,46 @@ var Global = koanf.New(".")
 func LoadRequiredEnv() error {
 	// Load default values
 	Global.Load(confmap.Provider(map[string]interface{}{
-		API_PORT:      "8080",
-		API_BIND_ADDR: "127.0.0.1",
+		API_PORT:                          "8080",
+		API_BIND_ADDR:                     "127.0.0.1",
+		EVENT_DROP_ALERT_WINDOW:           "1m",
+		CATCH_UP_EVENTS:                   "emit",
+		ETHEREUM_RESUBSCRIBE_BACKOFF_BASE: "1s",
+		ETHEREUM_RESUBSCRIBE_BACKOFF_MAX:  "1m",
+		EVENT_HUB_BUFFER_SIZE:             "256",
+		DEDUP_CACHE_SIZE:                  "10000",
+		DEDUP_TTL:                         "10m",
+		DEDUP_EVICTION_POLICY:             "lru",
+		ETHEREUM_MAX_BACKFILL_BLOCKS:      "128",
+		ETHEREUM_REVERT_DEPTH:             "64",
+		ETHEREUM_REORG_DEPTH:              "64",
+		API_GZIP_MIN_SIZE:                 "1024",
+		API_RATE_LIMIT_BURST:              "10",
+		SOLANA_HD_GAP_LIMIT:               "20",
+		SHUTDOWN_TIMEOUT:                  "10s",
+		BITCOIN_TX_WORKERS:                "8",
+		BITCOIN_PREV_TX_CACHE_SIZE:        "10000",
+		BITCOIN_MAX_CATCHUP_BLOCKS:        "6",
+		BITCOIN_NETWORK:                   "mainnet",
+		ETHEREUM_CHAIN:                    "ethereum_mainnet",
+		BITCOIN_POLL_INTERVAL:             "15s",
+		SOLANA_POLL_INTERVAL:              "1s",
+		SOLANA_FETCH_WORKERS:              "16",
+		SOLANA_FETCH_RETRIES:              "3",
+		SOLANA_FAILED_TXS:                 "exclude",
+		ENS_REFRESH_INTERVAL:              "10m",
+		KAFKA_TOPIC:                       "deblock_tx_tracker",
+		KAFKA_BATCH_INTERVAL:              "1s",
+		WEBHOOK_TIMEOUT:                   "10s",
+		WEBHOOK_RETRIES:                   "3",
+		WEBHOOK_BACKOFF_BASE:              "1s",
+		WEBHOOK_BACKOFF_MAX:               "30s",
+		SUBSCRIBER_INIT_RETRIES:           "3",
+		SUBSCRIBER_INIT_BACKOFF_BASE:      "1s",
+		SUBSCRIBER_INIT_BACKOFF_MAX:       "30s",
+		EVENT_FILE_MAX_SIZE:               "104857600",
+		SINK_POLICY:                       "block",
+		SINK_QUEUE_SIZE:                   "1024",
 	}, "."), nil)
 
 	// .env file is optional, but we still try to load it if it exists.
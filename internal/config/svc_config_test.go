@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadTestEnv loads configuration from env into a fresh Global.
+func loadTestEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	Global = koanf.New(".")
+	for _, r := range []string{RPC_URL_ETHEREUM, RPC_URL_SOLANA, RPC_URL_BITCOIN} {
+		t.Setenv(r, "http://dummy.net")
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	assert.NoError(t, LoadRequiredEnv())
+}
+
+func TestLoadRequiredEnvKafkaTopic(t *testing.T) {
+	loadTestEnv(t, nil)
+	assert.Equal(t, "deblock_tx_tracker", Global.String(KAFKA_TOPIC))
+
+	loadTestEnv(t, map[string]string{KAFKA_TOPIC: "deblock_tx_tracker_staging"})
+	assert.Equal(t, "deblock_tx_tracker_staging", Global.String(KAFKA_TOPIC))
+}
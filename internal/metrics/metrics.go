@@ -0,0 +1,279 @@
+// Package metrics collects counters and histograms of subscribers labeled by
+// chain, and exposes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are upper bounds of duration histograms, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	BlocksProcessed = NewCounterVec("blocks_processed_total",
+		"Number of blocks whose transactions were processed.")
+	TxsProcessed = NewCounterVec("transactions_processed_total",
+		"Number of transactions processed.")
+	EventsEmitted = NewCounterVec("events_emitted_total",
+		"Number of tracked wallet events delivered to the sink.")
+	RPCErrors = NewCounterVec("rpc_errors_total",
+		"Number of failed RPC provider calls.")
+	BlockFetchDuration = NewHistogramVec("block_fetch_duration_seconds",
+		"Duration of fetching a block from the RPC provider.", DefaultBuckets)
+	TxProcessingDuration = NewHistogramVec("tx_processing_duration_seconds",
+		"Duration of processing transactions of a block.", DefaultBuckets)
+	DedupHits = NewCounterVec("dedup_hits_total",
+		"Number of duplicate events dropped by the dedup cache.")
+	DedupMisses = NewCounterVec("dedup_misses_total",
+		"Number of events not found in the dedup cache.")
+	DedupEvictions = NewCounterVec("dedup_evictions_total",
+		"Number of keys evicted from the dedup cache by size or TTL.")
+	ShadowSinkFailures = NewCounterVec("shadow_sink_failures_total",
+		"Number of events which failed to be published to the shadow sink or were dropped.")
+	ImplausibleAmounts = NewCounterVec("implausible_amounts_total",
+		"Number of events whose amount exceeds the maximum plausible amount of the chain.")
+	Reorgs = NewCounterVec("reorgs_total",
+		"Number of detected chain reorganizations.")
+	ChainHeadLagBlocks = NewGaugeVec("chain_head_lag_blocks",
+		"Number of blocks between the chain tip and the last processed block.")
+	ChainSlotLag = NewGaugeVec("chain_slot_lag",
+		"Number of slots between the chain tip and the last processed slot.")
+	SinkDrops = NewCounterVec("sink_dropped_events_total",
+		"Number of events dropped because the sink was not ready to receive them.")
+)
+
+// Default registers all metrics of the package.
+var Default = NewRegistry(
+	BlocksProcessed, TxsProcessed, EventsEmitted, RPCErrors, BlockFetchDuration, TxProcessingDuration,
+	DedupHits, DedupMisses, DedupEvictions, ShadowSinkFailures, ImplausibleAmounts, Reorgs, ChainHeadLagBlocks, ChainSlotLag,
+	SinkDrops,
+)
+
+// Collector writes its metric family in the text exposition format.
+type Collector interface {
+	Write(w io.Writer) error
+}
+
+type Registry struct {
+	collectors []Collector
+}
+
+func NewRegistry(collectors ...Collector) *Registry {
+	return &Registry{collectors: collectors}
+}
+
+// Write writes all registered metrics in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range r.collectors {
+		if err := c.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registered metrics to Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			slog.Warn("failed to write metrics", slog.Any("error", err))
+		}
+	})
+}
+
+// CounterVec is a monotonically increasing counter per chain.
+type CounterVec struct {
+	name string
+	help string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounterVec(name, help string) *CounterVec {
+	return &CounterVec{name: name, help: help, values: make(map[string]float64)}
+}
+
+func (c *CounterVec) Inc(chain string) {
+	c.Add(chain, 1)
+}
+
+// Add increases the counter of chain by v, which must not be negative.
+func (c *CounterVec) Add(chain string, v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[chain] += v
+}
+
+// Value returns the current value of the counter of chain.
+func (c *CounterVec) Value(chain string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[chain]
+}
+
+func (c *CounterVec) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+	for _, chain := range sortedKeys(c.values) {
+		if _, err := fmt.Fprintf(w, "%s{chain=%q} %s\n", c.name, escapeLabel(chain), formatFloat(c.values[chain])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeVec is a value per chain which can go up and down.
+type GaugeVec struct {
+	name string
+	help string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewGaugeVec(name, help string) *GaugeVec {
+	return &GaugeVec{name: name, help: help, values: make(map[string]float64)}
+}
+
+func (g *GaugeVec) Set(chain string, v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[chain] = v
+}
+
+// Value returns the current value of the gauge of chain.
+func (g *GaugeVec) Value(chain string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[chain]
+}
+
+func (g *GaugeVec) Write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name); err != nil {
+		return err
+	}
+	for _, chain := range sortedKeys(g.values) {
+		if _, err := fmt.Fprintf(w, "%s{chain=%q} %s\n", g.name, escapeLabel(chain), formatFloat(g.values[chain])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec samples observations into buckets per chain.
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	// Observations per bucket, not cumulative. The last one counts
+	// observations above the highest bucket.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec creates a histogram with the given bucket upper bounds,
+// which must be sorted in increasing order.
+func NewHistogramVec(name, help string, buckets []float64) *HistogramVec {
+	return &HistogramVec{name: name, help: help, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *HistogramVec) Observe(chain string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[chain]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[chain] = s
+	}
+	i, _ := slices.BinarySearch(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations of chain.
+func (h *HistogramVec) Count(chain string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[chain]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+		return err
+	}
+	for _, chain := range sortedKeys(h.series) {
+		s, label := h.series[chain], escapeLabel(chain)
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket{chain=%q,le=%q} %d\n", h.name, label, formatFloat(bound), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{chain=%q,le=\"+Inf\"} %d\n%s_sum{chain=%q} %s\n%s_count{chain=%q} %d\n",
+			h.name, label, s.count,
+			h.name, label, formatFloat(s.sum),
+			h.name, label, s.count,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// escapeLabel escapes characters of label values which %q does not escape
+// the way the exposition format expects. Chain names are plain identifiers,
+// so this only guards against malformed output.
+func escapeLabel(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	blocks := NewCounterVec("blocks_processed_total", "Processed blocks.")
+	fetch := NewHistogramVec("block_fetch_duration_seconds", "Block fetch duration.", []float64{0.1, 1})
+	r := NewRegistry(blocks, fetch)
+
+	blocks.Inc("solana_mainnet")
+	blocks.Add("bitcoin", 2)
+	blocks.Add("bitcoin", -1)
+	fetch.Observe("bitcoin", 0.05)
+	fetch.Observe("bitcoin", 0.1)
+	fetch.Observe("bitcoin", 0.5)
+	fetch.Observe("bitcoin", 3)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, r.Write(buf))
+	assert.Equal(t, `# HELP blocks_processed_total Processed blocks.
+# TYPE blocks_processed_total counter
+blocks_processed_total{chain="bitcoin"} 2
+blocks_processed_total{chain="solana_mainnet"} 1
+# HELP block_fetch_duration_seconds Block fetch duration.
+# TYPE block_fetch_duration_seconds histogram
+block_fetch_duration_seconds_bucket{chain="bitcoin",le="0.1"} 2
+block_fetch_duration_seconds_bucket{chain="bitcoin",le="1"} 3
+block_fetch_duration_seconds_bucket{chain="bitcoin",le="+Inf"} 4
+block_fetch_duration_seconds_sum{chain="bitcoin"} 3.65
+block_fetch_duration_seconds_count{chain="bitcoin"} 4
+`, buf.String())
+	assert.Equal(t, float64(2), blocks.Value("bitcoin"))
+	assert.Equal(t, uint64(4), fetch.Count("bitcoin"))
+	assert.Zero(t, fetch.Count("solana_mainnet"))
+}
+
+func TestGaugeVecWrite(t *testing.T) {
+	lag := NewGaugeVec("chain_head_lag_blocks", "Head lag.")
+	lag.Set("bitcoin", 5)
+	lag.Set("bitcoin", 2)
+	lag.Set("ethereum_mainnet", 0)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, NewRegistry(lag).Write(buf))
+	assert.Equal(t, `# HELP chain_head_lag_blocks Head lag.
+# TYPE chain_head_lag_blocks gauge
+chain_head_lag_blocks{chain="bitcoin"} 2
+chain_head_lag_blocks{chain="ethereum_mainnet"} 0
+`, buf.String())
+	assert.Equal(t, float64(2), lag.Value("bitcoin"))
+}
+
+func TestRegistryHandler(t *testing.T) {
+	events := NewCounterVec("events_emitted_total", "Emitted events.")
+	events.Inc("bitcoin")
+
+	rec := httptest.NewRecorder()
+	NewRegistry(events).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `events_emitted_total{chain="bitcoin"} 1`)
+}
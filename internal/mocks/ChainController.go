@@ -0,0 +1,81 @@
+// Code generated by mockery v2.46.3. DO NOT EDIT.
+
+package mocks
+
+import (
+	chain "github.com/Mantelijo/deblock-backend/internal/chain"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ChainController is an autogenerated mock type for the ChainController type
+type ChainController struct {
+	mock.Mock
+}
+
+type ChainController_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *ChainController) EXPECT() *ChainController_Expecter {
+	return &ChainController_Expecter{mock: &_m.Mock}
+}
+
+// StopChain provides a mock function with given fields: _a0
+func (_m *ChainController) StopChain(_a0 chain.ChainName) error {
+	ret := _m.Called(_a0)
+
+	if len(ret) == 0 {
+		panic("no return value specified for StopChain")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(chain.ChainName) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ChainController_StopChain_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'StopChain'
+type ChainController_StopChain_Call struct {
+	*mock.Call
+}
+
+// StopChain is a helper method to define mock.On call
+//   - _a0 chain.ChainName
+func (_e *ChainController_Expecter) StopChain(_a0 interface{}) *ChainController_StopChain_Call {
+	return &ChainController_StopChain_Call{Call: _e.mock.On("StopChain", _a0)}
+}
+
+func (_c *ChainController_StopChain_Call) Run(run func(_a0 chain.ChainName)) *ChainController_StopChain_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *ChainController_StopChain_Call) Return(_a0 error) *ChainController_StopChain_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *ChainController_StopChain_Call) RunAndReturn(run func(chain.ChainName) error) *ChainController_StopChain_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewChainController creates a new instance of ChainController. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewChainController(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ChainController {
+	mock := &ChainController{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
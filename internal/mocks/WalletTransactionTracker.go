@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	big "math/big"
+
 	chain "github.com/Mantelijo/deblock-backend/internal/chain"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -20,6 +22,398 @@ func (_m *WalletTransactionTracker) EXPECT() *WalletTransactionTracker_Expecter
 	return &WalletTransactionTracker_Expecter{mock: &_m.Mock}
 }
 
+// ExportWallets provides a mock function with given fields:
+func (_m *WalletTransactionTracker) ExportWallets() ([]chain.TrackedWalletConfig, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExportWallets")
+	}
+
+	var r0 []chain.TrackedWalletConfig
+	var r1 error
+	if rf, ok := ret.Get(0).(func() ([]chain.TrackedWalletConfig, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() []chain.TrackedWalletConfig); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]chain.TrackedWalletConfig)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WalletTransactionTracker_ExportWallets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ExportWallets'
+type WalletTransactionTracker_ExportWallets_Call struct {
+	*mock.Call
+}
+
+// ExportWallets is a helper method to define mock.On call
+func (_e *WalletTransactionTracker_Expecter) ExportWallets() *WalletTransactionTracker_ExportWallets_Call {
+	return &WalletTransactionTracker_ExportWallets_Call{Call: _e.mock.On("ExportWallets")}
+}
+
+func (_c *WalletTransactionTracker_ExportWallets_Call) Run(run func()) *WalletTransactionTracker_ExportWallets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ExportWallets_Call) Return(_a0 []chain.TrackedWalletConfig, _a1 error) *WalletTransactionTracker_ExportWallets_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ExportWallets_Call) RunAndReturn(run func() ([]chain.TrackedWalletConfig, error)) *WalletTransactionTracker_ExportWallets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ImportWallets provides a mock function with given fields: configs
+func (_m *WalletTransactionTracker) ImportWallets(configs []chain.TrackedWalletConfig) error {
+	ret := _m.Called(configs)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImportWallets")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]chain.TrackedWalletConfig) error); ok {
+		r0 = rf(configs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_ImportWallets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImportWallets'
+type WalletTransactionTracker_ImportWallets_Call struct {
+	*mock.Call
+}
+
+// ImportWallets is a helper method to define mock.On call
+//   - configs []chain.TrackedWalletConfig
+func (_e *WalletTransactionTracker_Expecter) ImportWallets(configs interface{}) *WalletTransactionTracker_ImportWallets_Call {
+	return &WalletTransactionTracker_ImportWallets_Call{Call: _e.mock.On("ImportWallets", configs)}
+}
+
+func (_c *WalletTransactionTracker_ImportWallets_Call) Run(run func(configs []chain.TrackedWalletConfig)) *WalletTransactionTracker_ImportWallets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]chain.TrackedWalletConfig))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ImportWallets_Call) Return(_a0 error) *WalletTransactionTracker_ImportWallets_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ImportWallets_Call) RunAndReturn(run func([]chain.TrackedWalletConfig) error) *WalletTransactionTracker_ImportWallets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// MuteWallet provides a mock function with given fields: wallet, _a1
+func (_m *WalletTransactionTracker) MuteWallet(wallet string, _a1 chain.ChainName) error {
+	ret := _m.Called(wallet, _a1)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MuteWallet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, chain.ChainName) error); ok {
+		r0 = rf(wallet, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_MuteWallet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'MuteWallet'
+type WalletTransactionTracker_MuteWallet_Call struct {
+	*mock.Call
+}
+
+// MuteWallet is a helper method to define mock.On call
+//   - wallet string
+//   - _a1 chain.ChainName
+func (_e *WalletTransactionTracker_Expecter) MuteWallet(wallet interface{}, _a1 interface{}) *WalletTransactionTracker_MuteWallet_Call {
+	return &WalletTransactionTracker_MuteWallet_Call{Call: _e.mock.On("MuteWallet", wallet, _a1)}
+}
+
+func (_c *WalletTransactionTracker_MuteWallet_Call) Run(run func(wallet string, _a1 chain.ChainName)) *WalletTransactionTracker_MuteWallet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_MuteWallet_Call) Return(_a0 error) *WalletTransactionTracker_MuteWallet_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_MuteWallet_Call) RunAndReturn(run func(string, chain.ChainName) error) *WalletTransactionTracker_MuteWallet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ReplaceUserWallets provides a mock function with given fields: userID, wallets
+func (_m *WalletTransactionTracker) ReplaceUserWallets(userID int, wallets map[chain.ChainName][]string) error {
+	ret := _m.Called(userID, wallets)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReplaceUserWallets")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, map[chain.ChainName][]string) error); ok {
+		r0 = rf(userID, wallets)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_ReplaceUserWallets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ReplaceUserWallets'
+type WalletTransactionTracker_ReplaceUserWallets_Call struct {
+	*mock.Call
+}
+
+// ReplaceUserWallets is a helper method to define mock.On call
+//   - userID int
+//   - wallets map[chain.ChainName][]string
+func (_e *WalletTransactionTracker_Expecter) ReplaceUserWallets(userID interface{}, wallets interface{}) *WalletTransactionTracker_ReplaceUserWallets_Call {
+	return &WalletTransactionTracker_ReplaceUserWallets_Call{Call: _e.mock.On("ReplaceUserWallets", userID, wallets)}
+}
+
+func (_c *WalletTransactionTracker_ReplaceUserWallets_Call) Run(run func(userID int, wallets map[chain.ChainName][]string)) *WalletTransactionTracker_ReplaceUserWallets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(map[chain.ChainName][]string))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ReplaceUserWallets_Call) Return(_a0 error) *WalletTransactionTracker_ReplaceUserWallets_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_ReplaceUserWallets_Call) RunAndReturn(run func(int, map[chain.ChainName][]string) error) *WalletTransactionTracker_ReplaceUserWallets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetWalletConfirmations provides a mock function with given fields: userID, wallet, _a2, confirmations
+func (_m *WalletTransactionTracker) SetWalletConfirmations(userID int, wallet string, _a2 chain.ChainName, confirmations uint64) error {
+	ret := _m.Called(userID, wallet, _a2, confirmations)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWalletConfirmations")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName, uint64) error); ok {
+		r0 = rf(userID, wallet, _a2, confirmations)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_SetWalletConfirmations_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetWalletConfirmations'
+type WalletTransactionTracker_SetWalletConfirmations_Call struct {
+	*mock.Call
+}
+
+// SetWalletConfirmations is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+//   - confirmations uint64
+func (_e *WalletTransactionTracker_Expecter) SetWalletConfirmations(userID interface{}, wallet interface{}, _a2 interface{}, confirmations interface{}) *WalletTransactionTracker_SetWalletConfirmations_Call {
+	return &WalletTransactionTracker_SetWalletConfirmations_Call{Call: _e.mock.On("SetWalletConfirmations", userID, wallet, _a2, confirmations)}
+}
+
+func (_c *WalletTransactionTracker_SetWalletConfirmations_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName, confirmations uint64)) *WalletTransactionTracker_SetWalletConfirmations_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName), args[3].(uint64))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletConfirmations_Call) Return(_a0 error) *WalletTransactionTracker_SetWalletConfirmations_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletConfirmations_Call) RunAndReturn(run func(int, string, chain.ChainName, uint64) error) *WalletTransactionTracker_SetWalletConfirmations_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetWalletDirection provides a mock function with given fields: userID, wallet, _a2, direction
+func (_m *WalletTransactionTracker) SetWalletDirection(userID int, wallet string, _a2 chain.ChainName, direction chain.Direction) error {
+	ret := _m.Called(userID, wallet, _a2, direction)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWalletDirection")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName, chain.Direction) error); ok {
+		r0 = rf(userID, wallet, _a2, direction)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_SetWalletDirection_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetWalletDirection'
+type WalletTransactionTracker_SetWalletDirection_Call struct {
+	*mock.Call
+}
+
+// SetWalletDirection is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+//   - direction chain.Direction
+func (_e *WalletTransactionTracker_Expecter) SetWalletDirection(userID interface{}, wallet interface{}, _a2 interface{}, direction interface{}) *WalletTransactionTracker_SetWalletDirection_Call {
+	return &WalletTransactionTracker_SetWalletDirection_Call{Call: _e.mock.On("SetWalletDirection", userID, wallet, _a2, direction)}
+}
+
+func (_c *WalletTransactionTracker_SetWalletDirection_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName, direction chain.Direction)) *WalletTransactionTracker_SetWalletDirection_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName), args[3].(chain.Direction))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletDirection_Call) Return(_a0 error) *WalletTransactionTracker_SetWalletDirection_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletDirection_Call) RunAndReturn(run func(int, string, chain.ChainName, chain.Direction) error) *WalletTransactionTracker_SetWalletDirection_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetWalletMinAmount provides a mock function with given fields: userID, wallet, _a2, minAmount
+func (_m *WalletTransactionTracker) SetWalletMinAmount(userID int, wallet string, _a2 chain.ChainName, minAmount *big.Int) error {
+	ret := _m.Called(userID, wallet, _a2, minAmount)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWalletMinAmount")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName, *big.Int) error); ok {
+		r0 = rf(userID, wallet, _a2, minAmount)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_SetWalletMinAmount_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetWalletMinAmount'
+type WalletTransactionTracker_SetWalletMinAmount_Call struct {
+	*mock.Call
+}
+
+// SetWalletMinAmount is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+//   - minAmount *big.Int
+func (_e *WalletTransactionTracker_Expecter) SetWalletMinAmount(userID interface{}, wallet interface{}, _a2 interface{}, minAmount interface{}) *WalletTransactionTracker_SetWalletMinAmount_Call {
+	return &WalletTransactionTracker_SetWalletMinAmount_Call{Call: _e.mock.On("SetWalletMinAmount", userID, wallet, _a2, minAmount)}
+}
+
+func (_c *WalletTransactionTracker_SetWalletMinAmount_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName, minAmount *big.Int)) *WalletTransactionTracker_SetWalletMinAmount_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName), args[3].(*big.Int))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletMinAmount_Call) Return(_a0 error) *WalletTransactionTracker_SetWalletMinAmount_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_SetWalletMinAmount_Call) RunAndReturn(run func(int, string, chain.ChainName, *big.Int) error) *WalletTransactionTracker_SetWalletMinAmount_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// TrackUserWallet provides a mock function with given fields: userID, wallet, _a2
+func (_m *WalletTransactionTracker) TrackUserWallet(userID int, wallet string, _a2 chain.ChainName) error {
+	ret := _m.Called(userID, wallet, _a2)
+
+	if len(ret) == 0 {
+		panic("no return value specified for TrackUserWallet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName) error); ok {
+		r0 = rf(userID, wallet, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_TrackUserWallet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TrackUserWallet'
+type WalletTransactionTracker_TrackUserWallet_Call struct {
+	*mock.Call
+}
+
+// TrackUserWallet is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+func (_e *WalletTransactionTracker_Expecter) TrackUserWallet(userID interface{}, wallet interface{}, _a2 interface{}) *WalletTransactionTracker_TrackUserWallet_Call {
+	return &WalletTransactionTracker_TrackUserWallet_Call{Call: _e.mock.On("TrackUserWallet", userID, wallet, _a2)}
+}
+
+func (_c *WalletTransactionTracker_TrackUserWallet_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName)) *WalletTransactionTracker_TrackUserWallet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_TrackUserWallet_Call) Return(_a0 error) *WalletTransactionTracker_TrackUserWallet_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_TrackUserWallet_Call) RunAndReturn(run func(int, string, chain.ChainName) error) *WalletTransactionTracker_TrackUserWallet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // TrackWallet provides a mock function with given fields: wallet, _a1
 func (_m *WalletTransactionTracker) TrackWallet(wallet string, _a1 chain.ChainName) error {
 	ret := _m.Called(wallet, _a1)
@@ -67,6 +461,148 @@ func (_c *WalletTransactionTracker_TrackWallet_Call) RunAndReturn(run func(strin
 	return _c
 }
 
+// TrackedWallets provides a mock function with given fields:
+func (_m *WalletTransactionTracker) TrackedWallets() map[chain.ChainName][]string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for TrackedWallets")
+	}
+
+	var r0 map[chain.ChainName][]string
+	if rf, ok := ret.Get(0).(func() map[chain.ChainName][]string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[chain.ChainName][]string)
+		}
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_TrackedWallets_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TrackedWallets'
+type WalletTransactionTracker_TrackedWallets_Call struct {
+	*mock.Call
+}
+
+// TrackedWallets is a helper method to define mock.On call
+func (_e *WalletTransactionTracker_Expecter) TrackedWallets() *WalletTransactionTracker_TrackedWallets_Call {
+	return &WalletTransactionTracker_TrackedWallets_Call{Call: _e.mock.On("TrackedWallets")}
+}
+
+func (_c *WalletTransactionTracker_TrackedWallets_Call) Run(run func()) *WalletTransactionTracker_TrackedWallets_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_TrackedWallets_Call) Return(_a0 map[chain.ChainName][]string) *WalletTransactionTracker_TrackedWallets_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_TrackedWallets_Call) RunAndReturn(run func() map[chain.ChainName][]string) *WalletTransactionTracker_TrackedWallets_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UnmuteWallet provides a mock function with given fields: wallet, _a1
+func (_m *WalletTransactionTracker) UnmuteWallet(wallet string, _a1 chain.ChainName) error {
+	ret := _m.Called(wallet, _a1)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UnmuteWallet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, chain.ChainName) error); ok {
+		r0 = rf(wallet, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_UnmuteWallet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UnmuteWallet'
+type WalletTransactionTracker_UnmuteWallet_Call struct {
+	*mock.Call
+}
+
+// UnmuteWallet is a helper method to define mock.On call
+//   - wallet string
+//   - _a1 chain.ChainName
+func (_e *WalletTransactionTracker_Expecter) UnmuteWallet(wallet interface{}, _a1 interface{}) *WalletTransactionTracker_UnmuteWallet_Call {
+	return &WalletTransactionTracker_UnmuteWallet_Call{Call: _e.mock.On("UnmuteWallet", wallet, _a1)}
+}
+
+func (_c *WalletTransactionTracker_UnmuteWallet_Call) Run(run func(wallet string, _a1 chain.ChainName)) *WalletTransactionTracker_UnmuteWallet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_UnmuteWallet_Call) Return(_a0 error) *WalletTransactionTracker_UnmuteWallet_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_UnmuteWallet_Call) RunAndReturn(run func(string, chain.ChainName) error) *WalletTransactionTracker_UnmuteWallet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UntrackUserWallet provides a mock function with given fields: userID, wallet, _a2
+func (_m *WalletTransactionTracker) UntrackUserWallet(userID int, wallet string, _a2 chain.ChainName) error {
+	ret := _m.Called(userID, wallet, _a2)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UntrackUserWallet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName) error); ok {
+		r0 = rf(userID, wallet, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WalletTransactionTracker_UntrackUserWallet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UntrackUserWallet'
+type WalletTransactionTracker_UntrackUserWallet_Call struct {
+	*mock.Call
+}
+
+// UntrackUserWallet is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+func (_e *WalletTransactionTracker_Expecter) UntrackUserWallet(userID interface{}, wallet interface{}, _a2 interface{}) *WalletTransactionTracker_UntrackUserWallet_Call {
+	return &WalletTransactionTracker_UntrackUserWallet_Call{Call: _e.mock.On("UntrackUserWallet", userID, wallet, _a2)}
+}
+
+func (_c *WalletTransactionTracker_UntrackUserWallet_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName)) *WalletTransactionTracker_UntrackUserWallet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_UntrackUserWallet_Call) Return(_a0 error) *WalletTransactionTracker_UntrackUserWallet_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_UntrackUserWallet_Call) RunAndReturn(run func(int, string, chain.ChainName) error) *WalletTransactionTracker_UntrackUserWallet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // UntrackWallet provides a mock function with given fields: wallet, _a1
 func (_m *WalletTransactionTracker) UntrackWallet(wallet string, _a1 chain.ChainName) error {
 	ret := _m.Called(wallet, _a1)
@@ -114,6 +650,64 @@ func (_c *WalletTransactionTracker_UntrackWallet_Call) RunAndReturn(run func(str
 	return _c
 }
 
+// WalletSettings provides a mock function with given fields: userID, wallet, _a2
+func (_m *WalletTransactionTracker) WalletSettings(userID int, wallet string, _a2 chain.ChainName) (chain.WalletSettings, error) {
+	ret := _m.Called(userID, wallet, _a2)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WalletSettings")
+	}
+
+	var r0 chain.WalletSettings
+	var r1 error
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName) (chain.WalletSettings, error)); ok {
+		return rf(userID, wallet, _a2)
+	}
+	if rf, ok := ret.Get(0).(func(int, string, chain.ChainName) chain.WalletSettings); ok {
+		r0 = rf(userID, wallet, _a2)
+	} else {
+		r0 = ret.Get(0).(chain.WalletSettings)
+	}
+
+	if rf, ok := ret.Get(1).(func(int, string, chain.ChainName) error); ok {
+		r1 = rf(userID, wallet, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WalletTransactionTracker_WalletSettings_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'WalletSettings'
+type WalletTransactionTracker_WalletSettings_Call struct {
+	*mock.Call
+}
+
+// WalletSettings is a helper method to define mock.On call
+//   - userID int
+//   - wallet string
+//   - _a2 chain.ChainName
+func (_e *WalletTransactionTracker_Expecter) WalletSettings(userID interface{}, wallet interface{}, _a2 interface{}) *WalletTransactionTracker_WalletSettings_Call {
+	return &WalletTransactionTracker_WalletSettings_Call{Call: _e.mock.On("WalletSettings", userID, wallet, _a2)}
+}
+
+func (_c *WalletTransactionTracker_WalletSettings_Call) Run(run func(userID int, wallet string, _a2 chain.ChainName)) *WalletTransactionTracker_WalletSettings_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(int), args[1].(string), args[2].(chain.ChainName))
+	})
+	return _c
+}
+
+func (_c *WalletTransactionTracker_WalletSettings_Call) Return(_a0 chain.WalletSettings, _a1 error) *WalletTransactionTracker_WalletSettings_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *WalletTransactionTracker_WalletSettings_Call) RunAndReturn(run func(int, string, chain.ChainName) (chain.WalletSettings, error)) *WalletTransactionTracker_WalletSettings_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewWalletTransactionTracker creates a new instance of WalletTransactionTracker. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewWalletTransactionTracker(t interface {
@@ -0,0 +1,26 @@
+package svc
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// parseAmountBounds parses a comma separated list of chain:amount pairs of
+// maximum plausible amounts in the chain's base units.
+func parseAmountBounds(list string) (map[chain.ChainName]*big.Int, error) {
+	pairs, err := parsePairs(list)
+	if err != nil {
+		return nil, err
+	}
+	bounds := make(map[chain.ChainName]*big.Int, len(pairs))
+	for chainName, value := range pairs {
+		bound, ok := new(big.Int).SetString(value, 10)
+		if !ok || bound.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid maximum amount %q of chain %s", value, chainName)
+		}
+		bounds[chain.ChainName(chainName)] = bound
+	}
+	return bounds, nil
+}
@@ -0,0 +1,30 @@
+package svc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmountBounds(t *testing.T) {
+	bounds, err := parseAmountBounds("bitcoin:2100000000000000, ethereum_mainnet:200000000000000000000000000")
+	assert.NoError(t, err)
+	ethBound, _ := new(big.Int).SetString("200000000000000000000000000", 10)
+	assert.Equal(t, map[chain.ChainName]*big.Int{
+		chain.Bitcoin:         big.NewInt(2_100_000_000_000_000),
+		chain.EthereumMainnet: ethBound,
+	}, bounds)
+
+	bounds, err = parseAmountBounds("")
+	assert.NoError(t, err)
+	assert.Empty(t, bounds)
+
+	_, err = parseAmountBounds("bitcoin:21e6")
+	assert.EqualError(t, err, `invalid maximum amount "21e6" of chain bitcoin`)
+	_, err = parseAmountBounds("bitcoin:0")
+	assert.Error(t, err)
+	_, err = parseAmountBounds("bitcoin")
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package svc
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// confirmationPollInterval is the interval of checking chain tips for held
+// events which became confirmed.
+const confirmationPollInterval = time.Second
+
+// confirmationBuffer delays publishing of events until the chain advanced
+// enough blocks past the block containing the transaction. Unlike wallet
+// confirmations of users, it applies to all events of a chain. The block
+// containing the transaction counts as the first confirmation. It is not
+// safe for concurrent use.
+type confirmationBuffer struct {
+	// Required confirmations per chain, chains requiring at most one are
+	// not present
+	required map[chain.ChainName]uint64
+	// Held events per chain, in the order they were received
+	pending map[chain.ChainName][]*chain.TrackedWalletEvent
+}
+
+// newConfirmationBuffer returns nil if no chain requires more than one
+// confirmation.
+func newConfirmationBuffer(required map[chain.ChainName]uint64) *confirmationBuffer {
+	b := &confirmationBuffer{
+		required: make(map[chain.ChainName]uint64),
+		pending:  make(map[chain.ChainName][]*chain.TrackedWalletEvent),
+	}
+	for chainName, confirmations := range required {
+		if confirmations > 1 {
+			b.required[chainName] = confirmations
+		}
+	}
+	if len(b.required) == 0 {
+		return nil
+	}
+	return b
+}
+
+// Hold returns true if the event must wait for more confirmations. Held
+// events are returned by Release. Events without a block number are never
+// held.
+func (b *confirmationBuffer) Hold(event *chain.TrackedWalletEvent) bool {
+	if b == nil || event.BlockNumber == 0 || b.required[event.ChainName] == 0 {
+		return false
+	}
+	b.pending[event.ChainName] = append(b.pending[event.ChainName], event)
+	return true
+}
+
+// Release returns held events whose chain tip is deep enough, in the order
+// they were held within each chain. Events of chains with unknown, i.e. 0,
+// tips stay held.
+func (b *confirmationBuffer) Release(tips map[chain.ChainName]uint64) []*chain.TrackedWalletEvent {
+	if b == nil {
+		return nil
+	}
+	released := []*chain.TrackedWalletEvent{}
+	chains := make([]chain.ChainName, 0, len(b.pending))
+	for chainName := range b.pending {
+		chains = append(chains, chainName)
+	}
+	slices.Sort(chains)
+
+	for _, chainName := range chains {
+		tip := tips[chainName]
+		held := b.pending[chainName][:0]
+		for _, event := range b.pending[chainName] {
+			if tip >= event.BlockNumber+b.required[chainName]-1 {
+				released = append(released, event)
+			} else {
+				held = append(held, event)
+			}
+		}
+		if len(held) == 0 {
+			delete(b.pending, chainName)
+		} else {
+			b.pending[chainName] = held
+		}
+	}
+	return released
+}
+
+// Len returns the number of held events.
+func (b *confirmationBuffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	n := 0
+	for _, held := range b.pending {
+		n += len(held)
+	}
+	return n
+}
+
+// parseChainConfirmations parses a comma separated list of chain:confirmations
+// pairs.
+func parseChainConfirmations(list string) (map[chain.ChainName]uint64, error) {
+	pairs, err := parsePairs(list)
+	if err != nil {
+		return nil, err
+	}
+	required := make(map[chain.ChainName]uint64, len(pairs))
+	for chainName, value := range pairs {
+		confirmations, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid confirmations %q of chain %s", value, chainName)
+		}
+		required[chain.ChainName(chainName)] = confirmations
+	}
+	return required, nil
+}
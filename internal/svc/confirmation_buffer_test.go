@@ -0,0 +1,103 @@
+package svc
+
+import (
+	"testing"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func blockEvent(c chain.ChainName, block uint64, txHash string) *chain.TrackedWalletEvent {
+	return &chain.TrackedWalletEvent{ChainName: c, BlockNumber: block, TxHash: txHash}
+}
+
+func txHashes(events []*chain.TrackedWalletEvent) []string {
+	hashes := []string{}
+	for _, event := range events {
+		hashes = append(hashes, event.TxHash)
+	}
+	return hashes
+}
+
+func TestConfirmationBuffer(t *testing.T) {
+	b := newConfirmationBuffer(map[chain.ChainName]uint64{
+		chain.Bitcoin:         3,
+		chain.EthereumMainnet: 12,
+		chain.SolanaMainnet:   1,
+	})
+
+	// Chains requiring at most one confirmation and events without a
+	// block pass through
+	assert.False(t, b.Hold(blockEvent(chain.SolanaMainnet, 300, "sol")))
+	assert.False(t, b.Hold(blockEvent(chain.Bitcoin, 0, "unknown_block")))
+
+	assert.True(t, b.Hold(blockEvent(chain.Bitcoin, 100, "btc100")))
+	assert.True(t, b.Hold(blockEvent(chain.Bitcoin, 101, "btc101")))
+	assert.True(t, b.Hold(blockEvent(chain.EthereumMainnet, 500, "eth500")))
+	assert.Equal(t, 3, b.Len())
+
+	// Not deep enough yet, tips of other chains don't matter
+	assert.Empty(t, b.Release(map[chain.ChainName]uint64{
+		chain.Bitcoin:       101,
+		chain.SolanaMainnet: 1_000_000,
+	}))
+
+	// Block 100 has 3 confirmations at 102
+	assert.Equal(t, []string{"btc100"}, txHashes(b.Release(map[chain.ChainName]uint64{
+		chain.Bitcoin: 102,
+	})))
+	assert.Equal(t, 2, b.Len())
+
+	// Unknown tips keep events held
+	assert.Empty(t, b.Release(map[chain.ChainName]uint64{chain.Bitcoin: 0}))
+
+	assert.Equal(t, []string{"btc101", "eth500"}, txHashes(b.Release(map[chain.ChainName]uint64{
+		chain.Bitcoin:         110,
+		chain.EthereumMainnet: 511,
+	})))
+	assert.Zero(t, b.Len())
+	assert.Empty(t, b.Release(map[chain.ChainName]uint64{chain.Bitcoin: 200}))
+}
+
+func TestConfirmationBufferKeepsOrder(t *testing.T) {
+	b := newConfirmationBuffer(map[chain.ChainName]uint64{chain.Bitcoin: 2})
+	// Events of a chain are not necessarily received in block order, e.g.
+	// after catching up
+	for _, event := range []*chain.TrackedWalletEvent{
+		blockEvent(chain.Bitcoin, 10, "a"),
+		blockEvent(chain.Bitcoin, 12, "b"),
+		blockEvent(chain.Bitcoin, 11, "c"),
+		blockEvent(chain.Bitcoin, 10, "d"),
+	} {
+		assert.True(t, b.Hold(event))
+	}
+
+	assert.Equal(t, []string{"a", "c", "d"}, txHashes(b.Release(map[chain.ChainName]uint64{chain.Bitcoin: 12})))
+	assert.Equal(t, []string{"b"}, txHashes(b.Release(map[chain.ChainName]uint64{chain.Bitcoin: 13})))
+}
+
+func TestConfirmationBufferDisabled(t *testing.T) {
+	b := newConfirmationBuffer(map[chain.ChainName]uint64{chain.Bitcoin: 1})
+	assert.Nil(t, b)
+	assert.False(t, b.Hold(blockEvent(chain.Bitcoin, 10, "a")))
+	assert.Empty(t, b.Release(map[chain.ChainName]uint64{chain.Bitcoin: 10}))
+	assert.Zero(t, b.Len())
+}
+
+func TestParseChainConfirmations(t *testing.T) {
+	required, err := parseChainConfirmations(" bitcoin:3, ethereum_mainnet:12 ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[chain.ChainName]uint64{
+		chain.Bitcoin:         3,
+		chain.EthereumMainnet: 12,
+	}, required)
+
+	required, err = parseChainConfirmations("")
+	assert.NoError(t, err)
+	assert.Empty(t, required)
+
+	_, err = parseChainConfirmations("bitcoin:three")
+	assert.ErrorContains(t, err, `invalid confirmations "three" of chain bitcoin`)
+	_, err = parseChainConfirmations("bitcoin")
+	assert.Error(t, err)
+}
@@ -1,10 +1,14 @@
 package svc
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/Mantelijo/deblock-backend/internal/api"
@@ -31,10 +35,296 @@ func RunDeblockTxTracker() {
 	}
 
 	// Initialize the chain subscribers
-	ethereum := chain.NewEthereumMainnetSubscriber(config.Global.String(config.RPC_URL_ETHEREUM))
-	solana := chain.NewSolanaMainnetSubscriber(config.Global.String(config.RPC_URL_SOLANA))
-	bitcoin := chain.NewBitcoinSubscriber(config.Global.String(config.RPC_URL_BITCOIN))
-	subManager := chain.NewSubsciberManager()
+	ethereumChain := chain.ChainName(config.Global.String(config.ETHEREUM_CHAIN))
+	ethereumChainConfig, err := chain.EvmChainConfig(ethereumChain)
+	if err != nil {
+		slog.Error(
+			"invalid ethereum chain",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	logTopics, err := chain.ParseLogTopics(config.Global.String(config.ETHEREUM_LOG_TOPICS))
+	if err != nil {
+		slog.Error(
+			"invalid ethereum log topics",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	ethereum := chain.NewEVMSubscriber(
+		ethereumChain,
+		config.Global.String(config.RPC_URL_ETHEREUM),
+		ethereumChainConfig,
+		chain.WithResubscribeBackoff{
+			Base: config.Global.Duration(config.ETHEREUM_RESUBSCRIBE_BACKOFF_BASE),
+			Max:  config.Global.Duration(config.ETHEREUM_RESUBSCRIBE_BACKOFF_MAX),
+		},
+		chain.WithMaxBackfillBlocks{
+			Blocks: uint64(config.Global.Int64(config.ETHEREUM_MAX_BACKFILL_BLOCKS)),
+		},
+		chain.WithContractCreationEvents{
+			Enabled: config.Global.Bool(config.ETHEREUM_EMIT_CONTRACT_CREATION),
+		},
+		chain.WithLogTopics{
+			Topics: logTopics,
+		},
+		chain.WithRevertedEvents{
+			Enabled: config.Global.Bool(config.ETHEREUM_EMIT_REVERTED),
+			Blocks:  config.Global.Int(config.ETHEREUM_REVERT_DEPTH),
+		},
+		chain.WithReorgDepth{
+			Blocks: uint64(config.Global.Int64(config.ETHEREUM_REORG_DEPTH)),
+		},
+	)
+	failedTxs, err := chain.ParseFailedTxPolicy(config.Global.String(config.SOLANA_FAILED_TXS))
+	if err != nil {
+		slog.Error(
+			"invalid solana failed transaction policy",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	solana := chain.NewSolanaMainnetSubscriber(
+		config.Global.String(config.RPC_URL_SOLANA),
+		chain.WithMaxCatchUpSlots{
+			Slots: uint64(config.Global.Int64(config.SOLANA_MAX_CATCHUP_SLOTS)),
+		},
+		chain.WithSlotPollInterval{
+			Interval: config.Global.Duration(config.SOLANA_POLL_INTERVAL),
+		},
+		chain.WithSlotFetchWorkers{
+			Workers: config.Global.Int(config.SOLANA_FETCH_WORKERS),
+		},
+		chain.WithSlotFetchRetries{
+			Retries: config.Global.Int(config.SOLANA_FETCH_RETRIES),
+		},
+		chain.WithBalanceContext{
+			Enabled: config.Global.Bool(config.SOLANA_EMIT_BALANCES),
+		},
+		chain.WithProgramAccountFilter{
+			Enabled: config.Global.Bool(config.SOLANA_FILTER_PROGRAM_ACCOUNTS),
+		},
+		chain.WithAggregatedTransactions{
+			Enabled: config.Global.Bool(config.SOLANA_AGGREGATE_TRANSACTIONS),
+		},
+		chain.WithInstructionFlows{
+			Enabled: config.Global.Bool(config.SOLANA_INSTRUCTION_FLOWS),
+		},
+		chain.WithAccountClosureFilter{
+			Enabled: config.Global.Bool(config.SOLANA_SKIP_ACCOUNT_CLOSURES),
+		},
+		chain.WithVoteFilter{
+			Enabled: config.Global.Bool(config.SOLANA_SKIP_VOTE_TXS),
+		},
+		chain.WithHDGapLimit{
+			Limit: uint32(config.Global.Int64(config.SOLANA_HD_GAP_LIMIT)),
+		},
+		chain.WithFailedTransactions{
+			Policy: failedTxs,
+		},
+	)
+	bitcoinNetwork, err := chain.BitcoinNetwork(config.Global.String(config.BITCOIN_NETWORK))
+	if err != nil {
+		slog.Error(
+			"invalid bitcoin network",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	bitcoin := chain.NewBitcoinSubscriber(
+		config.Global.String(config.RPC_URL_BITCOIN),
+		chain.WithNetwork{
+			Params: bitcoinNetwork,
+		},
+		chain.WithTxWorkers{
+			Workers: config.Global.Int(config.BITCOIN_TX_WORKERS),
+		},
+		chain.WithPrevTxCacheSize{
+			Size: config.Global.Int(config.BITCOIN_PREV_TX_CACHE_SIZE),
+		},
+		chain.WithAggregatedOutputs{
+			Enabled: config.Global.Bool(config.BITCOIN_AGGREGATE_OUTPUTS),
+		},
+		chain.WithMaxCatchUpBlocks{
+			Blocks: config.Global.Int64(config.BITCOIN_MAX_CATCHUP_BLOCKS),
+		},
+		chain.WithBlockPollInterval{
+			Interval: config.Global.Duration(config.BITCOIN_POLL_INTERVAL),
+		},
+		chain.WithMaxTxsPerBlock{
+			Txs: config.Global.Int(config.BITCOIN_MAX_TXS_PER_BLOCK),
+		},
+	)
+	catchUpEvents, err := chain.ParseCatchUpEventPolicy(config.Global.String(config.CATCH_UP_EVENTS))
+	if err != nil {
+		slog.Error(
+			"invalid catch-up event policy",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	maxAmounts, err := parseAmountBounds(config.Global.String(config.MAX_EVENT_AMOUNTS))
+	if err != nil {
+		slog.Error(
+			"invalid maximum event amounts",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	destinations, err := parseDestinationAllowlist(config.Global.String(config.DESTINATION_ALLOWLIST))
+	if err != nil {
+		slog.Error(
+			"invalid destination allowlist",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	sinkPolicy, err := chain.ParseSinkPolicy(config.Global.String(config.SINK_POLICY))
+	if err != nil {
+		slog.Error(
+			"invalid sink policy",
+			slog.Any("error", err),
+		)
+		os.Exit(1)
+	}
+	subManager := chain.NewSubsciberManager(
+		chain.WithDropAlert{
+			Threshold: uint64(config.Global.Int64(config.EVENT_DROP_ALERT_THRESHOLD)),
+			Window:    config.Global.Duration(config.EVENT_DROP_ALERT_WINDOW),
+		},
+		chain.WithFirstActivityEvents{
+			Enabled: config.Global.Bool(config.EMIT_FIRST_ACTIVITY_EVENTS),
+		},
+		chain.WithCatchUpEvents{
+			Policy: catchUpEvents,
+		},
+		chain.WithInitRetry{
+			Retries:   config.Global.Int(config.SUBSCRIBER_INIT_RETRIES),
+			BaseDelay: config.Global.Duration(config.SUBSCRIBER_INIT_BACKOFF_BASE),
+			MaxDelay:  config.Global.Duration(config.SUBSCRIBER_INIT_BACKOFF_MAX),
+		},
+		chain.WithLenientInit{
+			Enabled: config.Global.Bool(config.SUBSCRIBER_INIT_LENIENT),
+		},
+		chain.WithAmountBounds{
+			Max: maxAmounts,
+		},
+		chain.WithDestinationAllowlist{
+			Destinations: destinations,
+		},
+		chain.WithSinkPolicy{
+			Policy:    sinkPolicy,
+			QueueSize: config.Global.Int(config.SINK_QUEUE_SIZE),
+		},
+	)
+
+	if config.Global.Bool(config.VALIDATE_ONLY) {
+		if !validateSubscribers(subManager, ethereum, solana, bitcoin) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Bind the api server before any other component is started, so that
+	// address conflicts fail the startup immediately
+	trustedProxies, err := api.ParseTrustedProxies(
+		config.Global.String(config.API_TRUSTED_PROXIES),
+	)
+	if err != nil {
+		slog.Error(
+			"failed to parse trusted proxies",
+			slog.Any("error", err),
+		)
+		return
+	}
+	mapping, err := parseEventMapping(
+		config.Global.String(config.EVENT_RENAME_FIELDS),
+		config.Global.String(config.EVENT_DROP_FIELDS),
+		config.Global.String(config.EVENT_TAGS),
+	)
+	if err != nil {
+		slog.Error(
+			"invalid event field mapping",
+			slog.Any("error", err),
+		)
+		return
+	}
+	dedupPolicy, err := parseDedupPolicy(config.Global.String(config.DEDUP_EVICTION_POLICY))
+	if err != nil {
+		slog.Error(
+			"invalid dedup eviction policy",
+			slog.Any("error", err),
+		)
+		return
+	}
+	dedup := newEventDedup(
+		config.Global.Int(config.DEDUP_CACHE_SIZE),
+		config.Global.Duration(config.DEDUP_TTL),
+		dedupPolicy,
+	)
+	publishConfirmations, err := parseChainConfirmations(config.Global.String(config.PUBLISH_CONFIRMATIONS))
+	if err != nil {
+		slog.Error(
+			"invalid publish confirmations",
+			slog.Any("error", err),
+		)
+		return
+	}
+	confirmations := newConfirmationBuffer(publishConfirmations)
+	// Every consumer receives all events through its own buffer
+	hub := newEventHub()
+	defer hub.Close()
+	bufferSize := config.Global.Int(config.EVENT_HUB_BUFFER_SIZE)
+
+	webhooks := newWebhookRouter()
+	webhooks.mapping = mapping
+	apiOpts := []api.HttpServerOption{
+		api.WithTrustedProxies{Proxies: trustedProxies},
+		api.WithStatsProvider{Provider: subManager},
+		api.WithWebhookRegistry{Registry: webhooks},
+		api.WithEthereumChain{Name: ethereumChain},
+		api.WithEventStream{Stream: hubEventStream{hub: hub, buffer: bufferSize}},
+		api.WithGzip{
+			Enabled: config.Global.Bool(config.API_GZIP_ENABLED),
+			MinSize: config.Global.Int(config.API_GZIP_MIN_SIZE),
+		},
+		api.WithLegacyRoutes{
+			Enabled: !config.Global.Bool(config.API_DISABLE_LEGACY_ROUTES),
+		},
+		api.WithRateLimit{
+			Rate:  config.Global.Float64(config.API_RATE_LIMIT),
+			Burst: config.Global.Int(config.API_RATE_LIMIT_BURST),
+		},
+	}
+	// Admin endpoints are opt-in, chains can only be controlled with the
+	// admin token
+	if adminToken := config.Global.String(config.API_ADMIN_TOKEN); adminToken != "" {
+		apiOpts = append(apiOpts,
+			api.WithAdminToken{Token: adminToken},
+			api.WithChainController{Controller: subManager},
+		)
+	}
+	var ens *ensWatcher
+	if config.Global.Bool(config.ENS_ENABLED) {
+		ens = newENSWatcher(ethereum, subManager, ethereumChain, config.Global.Duration(config.ENS_REFRESH_INTERVAL))
+		apiOpts = append(apiOpts, api.WithENSRegistry{Registry: ens})
+	}
+	var apiServer api.Server = api.NewHttpServer(
+		config.Global.String(config.API_BIND_ADDR),
+		config.Global.String(config.API_PORT),
+		subManager,
+		apiOpts...,
+	)
+	if err := apiServer.Listen(); err != nil {
+		slog.Error(
+			"failed to bind api server",
+			slog.Any("error", err),
+		)
+		return
+	}
+	defer apiServer.Close()
+
 	if err := subManager.RegisterSubscribers(ethereum, solana, bitcoin); err != nil {
 		slog.Error(
 			"failed to register subscriber",
@@ -42,6 +332,12 @@ func RunDeblockTxTracker() {
 		)
 		return
 	}
+	if ens != nil {
+		go ens.Run()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	errorsCh := make(chan error)
 
@@ -55,37 +351,144 @@ func RunDeblockTxTracker() {
 	}()
 
 	// Start the api server
-	var apiServer api.Server = api.NewHttpServer(
-		config.Global.String(config.API_BIND_ADDR),
-		config.Global.String(config.API_PORT),
-		subManager,
-	)
 	go func() {
 		if err := apiServer.Serve(); err != nil {
 			errorsCh <- fmt.Errorf("failed to start api server: %w", err)
 		}
 	}()
 
-	kafkaProd, err := InitKafka()
+	// Deliver to webhooks of the wallets involved in the event
+	webhookEvents, _ := hub.Subscribe("webhooks", bufferSize, dropOnFull)
+	go func() {
+		// Queued deliveries finish once the hub is closed
+		defer webhooks.Close()
+		for event := range webhookEvents {
+			webhooks.Dispatch(event)
+		}
+	}()
+
+	// Publish events to the configured transports, each through its own
+	// buffer
+	backends, err := parseEventBackends(config.Global.String(config.EVENT_BACKEND))
 	if err != nil {
-		slog.Info(
-			"kafka producer not initialized",
+		slog.Error(
+			"invalid event backend",
 			slog.Any("error", err),
 		)
+		return
+	}
+	// Without selected backends, every backend whose settings are
+	// configured is used
+	useBackend := func(name string, configured bool) bool {
+		if backends == nil {
+			return configured
+		}
+		return backends[name]
+	}
+	sinks := map[string]EventSink{}
+	var kafkaProd sarama.AsyncProducer
+	if useBackend("kafka", true) {
+		kafkaProd, err = InitKafka()
+		if err != nil {
+			slog.Info(
+				"kafka producer not initialized",
+				slog.Any("error", err),
+			)
+		}
+		if kafkaProd == nil && backends["kafka"] {
+			slog.Error("kafka event backend requires a reachable KAFKA_BROKER_URL")
+			return
+		}
 	}
 	if kafkaProd != nil {
-		go func() {
-			for err := range kafkaProd.Errors() {
-				slog.Error(
-					"failed to produce message to kafka",
-					slog.Any("error", err),
-				)
-			}
-		}()
+		sinks["kafka"] = NewKafkaSink(kafkaProd, KafkaSinkConfig{
+			Topic:         config.Global.String(config.KAFKA_TOPIC),
+			BatchSize:     config.Global.Int(config.KAFKA_BATCH_SIZE),
+			BatchInterval: config.Global.Duration(config.KAFKA_BATCH_INTERVAL),
+		}, mapping)
+	}
+	if webhookUrl := config.Global.String(config.WEBHOOK_URL); useBackend("webhook", webhookUrl != "") {
+		webhookSink, err := NewWebhookSink(WebhookSinkConfig{
+			URL:         webhookUrl,
+			Secret:      config.Global.String(config.WEBHOOK_SECRET),
+			Timeout:     config.Global.Duration(config.WEBHOOK_TIMEOUT),
+			Retries:     config.Global.Int(config.WEBHOOK_RETRIES),
+			BackoffBase: config.Global.Duration(config.WEBHOOK_BACKOFF_BASE),
+			BackoffMax:  config.Global.Duration(config.WEBHOOK_BACKOFF_MAX),
+		}, mapping)
+		if err != nil {
+			slog.Error(
+				"invalid webhook sink",
+				slog.Any("error", err),
+			)
+			return
+		}
+		sinks["webhook"] = webhookSink
+	}
+	if eventFile := config.Global.String(config.EVENT_FILE_PATH); useBackend("file", eventFile != "") {
+		fileSink, err := NewFileSink(FileSinkConfig{
+			Path:    eventFile,
+			MaxSize: config.Global.Int64(config.EVENT_FILE_MAX_SIZE),
+			MaxAge:  config.Global.Duration(config.EVENT_FILE_MAX_AGE),
+			Gzip:    config.Global.Bool(config.EVENT_FILE_GZIP),
+		}, mapping)
+		if err != nil {
+			slog.Error(
+				"invalid file sink",
+				slog.Any("error", err),
+			)
+			return
+		}
+		sinks["file"] = fileSink
+	}
+	if shadow := config.Global.String(config.SHADOW_SINK); shadow != "" {
+		sinks, err = withShadowSink(sinks, shadow, bufferSize)
+		if err != nil {
+			slog.Error(
+				"invalid shadow sink",
+				slog.Any("error", err),
+			)
+			return
+		}
+	}
+	if len(sinks) == 0 {
+		sinks["noop"] = NoopSink{}
+	}
+	publishers := startSinkPublishers(hub, sinks, bufferSize)
+
+	// Held events are checked against chain tips only if any chain requires
+	// confirmations
+	var confirmationTicks <-chan time.Time
+	if confirmations != nil {
+		ticker := time.NewTicker(confirmationPollInterval)
+		defer ticker.Stop()
+		confirmationTicks = ticker.C
 	}
 
 	for {
 		select {
+		case <-ctx.Done():
+			slog.Info("shutting down")
+			if held := confirmations.Len(); held > 0 {
+				slog.Warn("dropping events waiting for confirmations",
+					slog.Int("events", held),
+				)
+			}
+			components := []component{
+				// Sinks are closed only after events of the stopped
+				// subscribers are drained from the hub
+				{name: "subscribers and sinks", stop: func(ctx context.Context) error {
+					return errors.Join(subManager.Stop(ctx), publishers.Stop(ctx))
+				}},
+				{name: "api", stop: func(context.Context) error {
+					return apiServer.Close()
+				}},
+			}
+			if ens != nil {
+				components = append(components, component{name: "ens", stop: ens.Stop})
+			}
+			shutdown(config.Global.Duration(config.SHUTDOWN_TIMEOUT), components...)
+			return
 		case err := <-errorsCh:
 			slog.Error(
 				"service encountered critical error",
@@ -93,31 +496,59 @@ func RunDeblockTxTracker() {
 			)
 			return
 		case event := <-eventsSink:
+			if dedup.Duplicate(event) {
+				slog.Debug(
+					"dropped duplicate event",
+					slog.String("idempotency_key", event.IdempotencyKey),
+				)
+				continue
+			}
 			slog.Info(
 				"received new event",
 				slog.Any("event", event),
 			)
-
-			// If kafka is enabled - push the event to kafka topic
-			if kafkaProd != nil {
-				eventJson, err := json.Marshal(event)
-				if err == nil {
-					kafkaProd.Input() <- &sarama.ProducerMessage{
-						Topic: "deblock_tx_tracker",
-						Value: sarama.StringEncoder(eventJson),
-					}
-				}
-
+			if confirmations.Hold(event) {
+				continue
+			}
+			hub.Broadcast(ctx, event)
+		case <-confirmationTicks:
+			for _, event := range confirmations.Release(subManager.ChainTips()) {
+				hub.Broadcast(ctx, event)
 			}
 		}
 	}
 }
 
+// validateSubscribers logs the validation result of every subscriber and
+// returns false if any of them failed.
+func validateSubscribers(m chain.SubscriberManager, subscribers ...chain.TransactionSubscriber) bool {
+	ok := true
+	for chainName, err := range m.ValidateSubscribers(subscribers...) {
+		if err != nil {
+			ok = false
+			slog.Error(
+				"subscriber validation failed",
+				slog.String("chain", string(chainName)),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		slog.Info(
+			"subscriber validated",
+			slog.String("chain", string(chainName)),
+		)
+	}
+	return ok
+}
+
 func InitKafka() (sarama.AsyncProducer, error) {
 	brokerUrl := config.Global.String(config.KAFKA_BROKER_URL)
 	slog.Info("kafka broker url", slog.String("url", brokerUrl))
 	if brokerUrl != "" {
 		cfg := sarama.NewConfig()
+		// Messages with the same key land on the same partition, see
+		// kafkaMessageKey
+		cfg.Producer.Partitioner = sarama.NewHashPartitioner
 		prod, err := sarama.NewAsyncProducer([]string{brokerUrl}, cfg)
 		if err != nil {
 			return nil, err
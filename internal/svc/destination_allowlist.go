@@ -0,0 +1,31 @@
+package svc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// parseDestinationAllowlist parses a comma separated list of chain:address
+// pairs of allowlisted destinations. A chain may be listed multiple times.
+func parseDestinationAllowlist(list string) (map[chain.ChainName][]string, error) {
+	destinations := make(map[chain.ChainName][]string)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		chainName, address, ok := strings.Cut(entry, ":")
+		chainName, address = strings.TrimSpace(chainName), strings.TrimSpace(address)
+		if !ok || chainName == "" || address == "" {
+			return nil, fmt.Errorf("entry %q is not a chain:address pair", entry)
+		}
+		normalized, err := chain.NormalizeWallet(chain.ChainName(chainName), address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q of chain %s: %w", address, chainName, err)
+		}
+		destinations[chain.ChainName(chainName)] = append(destinations[chain.ChainName(chainName)], normalized)
+	}
+	return destinations, nil
+}
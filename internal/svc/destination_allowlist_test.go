@@ -0,0 +1,32 @@
+package svc
+
+import (
+	"testing"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDestinationAllowlist(t *testing.T) {
+	destinations, err := parseDestinationAllowlist(
+		"ethereum_mainnet:0xeea5b26b94e4e5ba416c9725e51ab755e2dde107, bitcoin:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2," +
+			"ethereum_mainnet:0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, map[chain.ChainName][]string{
+		chain.EthereumMainnet: {
+			"0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+			"0x4838B106FCe9647Bdf1E7877BF73cE8B0BAD5f97",
+		},
+		chain.Bitcoin: {"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},
+	}, destinations)
+
+	destinations, err = parseDestinationAllowlist("")
+	assert.NoError(t, err)
+	assert.Empty(t, destinations)
+
+	_, err = parseDestinationAllowlist("bitcoin:0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107")
+	assert.ErrorContains(t, err, `invalid destination "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107" of chain bitcoin`)
+	_, err = parseDestinationAllowlist("bitcoin")
+	assert.EqualError(t, err, `entry "bitcoin" is not a chain:address pair`)
+}
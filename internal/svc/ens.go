@@ -0,0 +1,154 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// ensResolveTimeout bounds a single ENS name resolution
+const ensResolveTimeout = 10 * time.Second
+
+// ensResolver resolves ENS names to ethereum addresses.
+type ensResolver interface {
+	ResolveENSName(ctx context.Context, name string) (string, error)
+}
+
+// ensWatcher resolves ENS names of track requests and periodically
+// re-resolves tracked names. When a name resolves to a new address, the new
+// address is tracked and the previous one untracked.
+type ensWatcher struct {
+	resolver ensResolver
+	tracker  chain.WalletTransactionTracker
+	// EVM chain resolved addresses are tracked on
+	chainName chain.ChainName
+	interval  time.Duration
+
+	// name -> address the name is tracked as
+	names map[string]string
+	// names mutex
+	mu sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newENSWatcher(resolver ensResolver, tracker chain.WalletTransactionTracker, chainName chain.ChainName, interval time.Duration) *ensWatcher {
+	return &ensWatcher{
+		resolver:  resolver,
+		tracker:   tracker,
+		chainName: chainName,
+		interval:  interval,
+		names:     make(map[string]string),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (w *ensWatcher) Resolve(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ensResolveTimeout)
+	defer cancel()
+	return w.resolver.ResolveENSName(ctx, name)
+}
+
+func (w *ensWatcher) Watch(name, address string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.names[name] = address
+}
+
+func (w *ensWatcher) Unwatch(name string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	address, ok := w.names[name]
+	delete(w.names, name)
+	return address, ok
+}
+
+// Run re-resolves watched names every interval until Stop is called.
+func (w *ensWatcher) Run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.refresh()
+		}
+	}
+}
+
+// Stop stops Run and waits for it to return, or until ctx is done.
+func (w *ensWatcher) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh re-resolves every watched name and moves tracking of names which
+// resolve to a different address.
+func (w *ensWatcher) refresh() {
+	w.mu.Lock()
+	names := make(map[string]string, len(w.names))
+	for name, address := range w.names {
+		names[name] = address
+	}
+	w.mu.Unlock()
+
+	for name, old := range names {
+		address, err := w.Resolve(name)
+		if err != nil {
+			slog.Warn("failed to re-resolve ens name, keeping the tracked address",
+				slog.String("name", name),
+				slog.String("address", old),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		if address == old {
+			continue
+		}
+
+		// Address may already be tracked on its own, the name then shares
+		// its tracking
+		err = w.tracker.TrackWallet(address, w.chainName)
+		if err != nil && !errors.Is(err, chain.ErrWalletAlreadyTracked) {
+			slog.Error("failed to track new address of ens name",
+				slog.String("name", name),
+				slog.String("address", address),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		if err := w.tracker.UntrackWallet(old, w.chainName); err != nil {
+			slog.Error("failed to untrack previous address of ens name",
+				slog.String("name", name),
+				slog.String("address", old),
+				slog.Any("error", err),
+			)
+		}
+
+		w.mu.Lock()
+		// Name may have been unwatched meanwhile
+		if _, ok := w.names[name]; ok {
+			w.names[name] = address
+		}
+		w.mu.Unlock()
+		slog.Info("ens name resolves to a new address, moved tracking",
+			slog.String("name", name),
+			slog.String("previous_address", old),
+			slog.String("address", address),
+		)
+	}
+}
@@ -0,0 +1,97 @@
+package svc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeENSResolver resolves names from a mutable map.
+type fakeENSResolver struct {
+	addresses map[string]string
+	mu        sync.Mutex
+}
+
+func (f *fakeENSResolver) ResolveENSName(ctx context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	address, ok := f.addresses[name]
+	if !ok {
+		return "", chain.ErrENSNameNotResolved
+	}
+	return address, nil
+}
+
+func (f *fakeENSResolver) set(name, address string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if address == "" {
+		delete(f.addresses, name)
+		return
+	}
+	f.addresses[name] = address
+}
+
+func TestENSWatcherMovesTracking(t *testing.T) {
+	oldAddress := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	newAddress := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	resolver := &fakeENSResolver{addresses: map[string]string{"deblock.eth": oldAddress}}
+	tracker := mocks.NewWalletTransactionTracker(t)
+	w := newENSWatcher(resolver, tracker, chain.EthereumMainnet, time.Hour)
+
+	address, err := w.Resolve("deblock.eth")
+	assert.NoError(t, err)
+	assert.Equal(t, oldAddress, address)
+	_, err = w.Resolve("unknown.eth")
+	assert.ErrorIs(t, err, chain.ErrENSNameNotResolved)
+	w.Watch("deblock.eth", address)
+
+	// Unchanged name keeps its tracking
+	w.refresh()
+
+	// Changed name moves tracking to the new address
+	resolver.set("deblock.eth", newAddress)
+	tracker.EXPECT().TrackWallet(newAddress, chain.EthereumMainnet).Return(nil).Once()
+	tracker.EXPECT().UntrackWallet(oldAddress, chain.EthereumMainnet).Return(nil).Once()
+	w.refresh()
+
+	// Names which stop resolving keep the last address
+	resolver.set("deblock.eth", "")
+	w.refresh()
+
+	address, ok := w.Unwatch("deblock.eth")
+	assert.True(t, ok)
+	assert.Equal(t, newAddress, address)
+	_, ok = w.Unwatch("deblock.eth")
+	assert.False(t, ok)
+}
+
+func TestENSWatcherKeepsAddressWhenTrackingFails(t *testing.T) {
+	oldAddress := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	newAddress := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	resolver := &fakeENSResolver{addresses: map[string]string{"deblock.eth": newAddress}}
+	tracker := mocks.NewWalletTransactionTracker(t)
+	w := newENSWatcher(resolver, tracker, chain.EthereumMainnet, time.Hour)
+	w.Watch("deblock.eth", oldAddress)
+
+	tracker.EXPECT().TrackWallet(newAddress, chain.EthereumMainnet).Return(assert.AnError).Once()
+	w.refresh()
+
+	address, _ := w.Unwatch("deblock.eth")
+	assert.Equal(t, oldAddress, address)
+}
+
+func TestENSWatcherRunAndStop(t *testing.T) {
+	resolver := &fakeENSResolver{addresses: map[string]string{}}
+	w := newENSWatcher(resolver, mocks.NewWalletTransactionTracker(t), chain.EthereumMainnet, time.Millisecond)
+	go w.Run()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, w.Stop(context.Background()))
+	// Repeated stops are no-op
+	assert.NoError(t, w.Stop(context.Background()))
+}
@@ -0,0 +1,162 @@
+package svc
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+)
+
+// dedupPolicy determines which entry the dedup cache evicts when it is full.
+type dedupPolicy string
+
+const (
+	// Least recently seen keys are evicted first. Duplicates refresh the
+	// key, so frequently re-emitted events stay deduplicated.
+	dedupLRU dedupPolicy = "lru"
+	// Oldest keys are evicted first. Duplicates do not extend the lifetime
+	// of the key.
+	dedupTTL dedupPolicy = "ttl"
+)
+
+func parseDedupPolicy(policy string) (dedupPolicy, error) {
+	switch p := dedupPolicy(policy); p {
+	case dedupLRU, dedupTTL:
+		return p, nil
+	}
+	return "", fmt.Errorf("unsupported dedup eviction policy %q", policy)
+}
+
+// eventDedup drops events whose IdempotencyKey was already seen, e.g. events
+// re-emitted after resubscribing or catching up, or transactions processed
+// again in a competing block of a reorg. Keys don't depend on the block, they
+// identify the chain, transaction, wallet, direction and asset of the event.
+// It remembers up to size keys, each for at most ttl.
+//
+// Events reverted by an EventReverted event are forgotten, so that the
+// transaction is emitted again once it is included in the new chain, and so
+// are reverts of events emitted again.
+type eventDedup struct {
+	size   int
+	ttl    time.Duration
+	policy dedupPolicy
+	now    func() time.Time
+
+	// Keys in eviction order, the next evicted one is at the back
+	order   *list.List
+	entries map[string]*list.Element
+	// Key of a reverted event -> key of its EventReverted event
+	revertedBy map[string]string
+	mu         sync.Mutex
+}
+
+type dedupEntry struct {
+	key       string
+	chainName chain.ChainName
+	seenAt    time.Time
+	// Key of the event reverted by the entry's event
+	reverts string
+}
+
+// newEventDedup returns nil if size is not positive, which disables
+// deduplication. ttl of 0 keeps keys until they are evicted by size.
+func newEventDedup(size int, ttl time.Duration, policy dedupPolicy) *eventDedup {
+	if size <= 0 {
+		return nil
+	}
+	return &eventDedup{
+		size:       size,
+		ttl:        ttl,
+		policy:     policy,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		revertedBy: make(map[string]string),
+	}
+}
+
+// Duplicate reports whether the event was already seen and remembers it
+// otherwise. Events without IdempotencyKey are never duplicates.
+func (d *eventDedup) Duplicate(event *chain.TrackedWalletEvent) bool {
+	if d == nil || event.IdempotencyKey == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expire(now)
+	if el, ok := d.entries[event.IdempotencyKey]; ok {
+		metrics.DedupHits.Inc(string(event.ChainName))
+		if d.policy == dedupLRU {
+			el.Value.(*dedupEntry).seenAt = now
+			d.order.MoveToFront(el)
+		}
+		return true
+	}
+
+	metrics.DedupMisses.Inc(string(event.ChainName))
+	entry := &dedupEntry{
+		key:       event.IdempotencyKey,
+		chainName: event.ChainName,
+		seenAt:    now,
+	}
+	if event.Type == chain.EventReverted && event.Reverts != "" {
+		entry.reverts = event.Reverts
+		d.forget(event.Reverts)
+		d.revertedBy[event.Reverts] = event.IdempotencyKey
+	} else if revertKey, ok := d.revertedBy[event.IdempotencyKey]; ok {
+		// Emitted again, it may be reverted again
+		d.forget(revertKey)
+	}
+	d.entries[event.IdempotencyKey] = d.order.PushFront(entry)
+	if d.order.Len() > d.size {
+		d.evict(d.order.Back())
+	}
+	return false
+}
+
+// expire evicts keys seen longer than ttl ago. Both policies keep the order
+// by seenAt, so expired keys are at the back.
+func (d *eventDedup) expire(now time.Time) {
+	if d.ttl <= 0 {
+		return
+	}
+	for el := d.order.Back(); el != nil; el = d.order.Back() {
+		if now.Sub(el.Value.(*dedupEntry).seenAt) < d.ttl {
+			return
+		}
+		d.evict(el)
+	}
+}
+
+func (d *eventDedup) evict(el *list.Element) {
+	entry := d.remove(el)
+	metrics.DedupEvictions.Inc(string(entry.chainName))
+}
+
+// forget removes the key without counting an eviction.
+func (d *eventDedup) forget(key string) {
+	if el, ok := d.entries[key]; ok {
+		d.remove(el)
+	}
+}
+
+func (d *eventDedup) remove(el *list.Element) *dedupEntry {
+	entry := d.order.Remove(el).(*dedupEntry)
+	delete(d.entries, entry.key)
+	if entry.reverts != "" && d.revertedBy[entry.reverts] == entry.key {
+		delete(d.revertedBy, entry.reverts)
+	}
+	return entry
+}
+
+// Len returns the number of remembered keys.
+func (d *eventDedup) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
@@ -0,0 +1,167 @@
+package svc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// dedupEvent returns an event of a chain unique to the test, so that dedup
+// metrics of tests do not interfere.
+func dedupEvent(t *testing.T, key string) *chain.TrackedWalletEvent {
+	return &chain.TrackedWalletEvent{
+		ChainName:      chain.ChainName(t.Name()),
+		IdempotencyKey: key,
+	}
+}
+
+func dedupMetrics(t *testing.T) [3]float64 {
+	return [3]float64{
+		metrics.DedupHits.Value(t.Name()),
+		metrics.DedupMisses.Value(t.Name()),
+		metrics.DedupEvictions.Value(t.Name()),
+	}
+}
+
+func TestEventDedupDuplicates(t *testing.T) {
+	d := newEventDedup(10, 0, dedupLRU)
+
+	assert.False(t, d.Duplicate(dedupEvent(t, "a")))
+	assert.False(t, d.Duplicate(dedupEvent(t, "b")))
+	assert.True(t, d.Duplicate(dedupEvent(t, "a")))
+	assert.True(t, d.Duplicate(dedupEvent(t, "a")))
+	// Events without idempotency key are never deduplicated
+	assert.False(t, d.Duplicate(dedupEvent(t, "")))
+	assert.False(t, d.Duplicate(dedupEvent(t, "")))
+
+	assert.Equal(t, 2, d.Len())
+	// hits, misses, evictions
+	assert.Equal(t, [3]float64{2, 2, 0}, dedupMetrics(t))
+}
+
+func TestEventDedupDisabled(t *testing.T) {
+	d := newEventDedup(0, time.Minute, dedupLRU)
+	assert.Nil(t, d)
+	assert.False(t, d.Duplicate(dedupEvent(t, "a")))
+	assert.False(t, d.Duplicate(dedupEvent(t, "a")))
+}
+
+func TestEventDedupEvictionUnderPressure(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy dedupPolicy
+		// Whether "a", which is seen again before the cache fills up, is
+		// still remembered afterwards
+		wantKept bool
+	}{
+		{name: "lru", policy: dedupLRU, wantKept: true},
+		{name: "ttl", policy: dedupTTL, wantKept: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newEventDedup(3, 0, tc.policy)
+			for _, key := range []string{"a", "b", "c"} {
+				assert.False(t, d.Duplicate(dedupEvent(t, key)))
+			}
+			assert.True(t, d.Duplicate(dedupEvent(t, "a")))
+
+			// Evicts a single key, "b" for lru and "a" for ttl
+			assert.False(t, d.Duplicate(dedupEvent(t, "d")))
+			assert.Equal(t, 3, d.Len())
+			assert.Equal(t, [3]float64{1, 4, 1}, dedupMetrics(t))
+
+			assert.Equal(t, tc.wantKept, d.Duplicate(dedupEvent(t, "a")))
+			assert.True(t, d.Duplicate(dedupEvent(t, "c")))
+			assert.True(t, d.Duplicate(dedupEvent(t, "d")))
+
+			// Sustained pressure of unique keys keeps the cache bounded
+			for i := range 100 {
+				assert.False(t, d.Duplicate(dedupEvent(t, fmt.Sprint("key", i))))
+			}
+			assert.Equal(t, 3, d.Len())
+			for _, key := range []string{"key97", "key98", "key99"} {
+				assert.True(t, d.Duplicate(dedupEvent(t, key)))
+			}
+		})
+	}
+}
+
+func TestEventDedupTTL(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy dedupPolicy
+		// Whether "a", which is seen again halfway through its TTL, is
+		// still remembered after the TTL of its first sighting
+		wantKept bool
+	}{
+		{name: "lru", policy: dedupLRU, wantKept: true},
+		{name: "ttl", policy: dedupTTL, wantKept: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Unix(1_700_000_000, 0)
+			d := newEventDedup(10, time.Minute, tc.policy)
+			d.now = func() time.Time { return now }
+
+			assert.False(t, d.Duplicate(dedupEvent(t, "a")))
+			assert.False(t, d.Duplicate(dedupEvent(t, "b")))
+			now = now.Add(30 * time.Second)
+			assert.True(t, d.Duplicate(dedupEvent(t, "a")))
+
+			now = now.Add(30 * time.Second)
+			assert.False(t, d.Duplicate(dedupEvent(t, "b")), "expired key")
+			assert.Equal(t, tc.wantKept, d.Duplicate(dedupEvent(t, "a")))
+
+			now = now.Add(time.Hour)
+			assert.False(t, d.Duplicate(dedupEvent(t, "c")))
+			assert.Equal(t, 1, d.Len())
+		})
+	}
+}
+
+func TestParseDedupPolicy(t *testing.T) {
+	for _, policy := range []dedupPolicy{dedupLRU, dedupTTL} {
+		p, err := parseDedupPolicy(string(policy))
+		assert.NoError(t, err)
+		assert.Equal(t, policy, p)
+	}
+	_, err := parseDedupPolicy("fifo")
+	assert.ErrorContains(t, err, `"fifo"`)
+}
+
+func TestEventDedupReorgs(t *testing.T) {
+	d := newEventDedup(10, time.Minute, dedupLRU)
+	// The same transaction processed in competing blocks has the same key
+	event := func(block uint64) *chain.TrackedWalletEvent {
+		e := dedupEvent(t, "tx")
+		e.TxHash = "0x01"
+		e.BlockNumber = block
+		return e
+	}
+	reverted := &chain.TrackedWalletEvent{
+		Type:           chain.EventReverted,
+		ChainName:      chain.ChainName(t.Name()),
+		IdempotencyKey: "tx_reverted",
+		Reverts:        "tx",
+	}
+
+	assert.False(t, d.Duplicate(event(100)))
+	assert.True(t, d.Duplicate(event(100)))
+	assert.True(t, d.Duplicate(event(101)))
+
+	// Once reverted, the transaction included in the new chain is emitted
+	// again, but only once
+	assert.False(t, d.Duplicate(reverted))
+	assert.True(t, d.Duplicate(reverted))
+	assert.False(t, d.Duplicate(event(102)))
+	assert.True(t, d.Duplicate(event(103)))
+
+	// And it may be reverted again
+	assert.False(t, d.Duplicate(reverted))
+	assert.False(t, d.Duplicate(event(104)))
+	assert.Equal(t, 1, d.Len())
+}
@@ -0,0 +1,195 @@
+package svc
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// slowConsumerPolicy determines what the hub does when a subscriber's buffer
+// is full.
+type slowConsumerPolicy int
+
+const (
+	// dropOnFull drops the event for the slow subscriber only.
+	dropOnFull slowConsumerPolicy = iota
+	// disconnectOnFull removes the slow subscriber and closes its channel.
+	disconnectOnFull
+	// blockOnFull waits until the subscriber has room for the event, so that
+	// durable consumers hold back the publisher instead of losing events.
+	blockOnFull
+)
+
+// eventHub broadcasts tracked wallet events to all of its subscribers. Each
+// subscriber has its own buffer, so a slow subscriber never blocks other
+// subscribers. Only subscribers with blockOnFull block the publisher.
+type eventHub struct {
+	subs map[*hubSubscriber]bool
+	// subs and closed mutex, never held while waiting for a subscriber
+	mu     sync.Mutex
+	closed bool
+}
+
+type hubSubscriber struct {
+	name   string
+	ch     chan *chain.TrackedWalletEvent
+	policy slowConsumerPolicy
+
+	// ch, closed and dropped mutex, so that ch is not closed while sending.
+	// Acquired after the hub mutex.
+	mu      sync.Mutex
+	closed  bool
+	dropped uint64
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[*hubSubscriber]bool),
+	}
+}
+
+// Subscribe registers a new subscriber with the given buffer size. Events are
+// received from the returned channel, which is closed when the subscriber is
+// unsubscribed, disconnected or the hub is closed. The returned function
+// unsubscribes the subscriber and is safe to call multiple times.
+func (h *eventHub) Subscribe(name string, buffer int, policy slowConsumerPolicy) (<-chan *chain.TrackedWalletEvent, func()) {
+	s := &hubSubscriber{
+		name:   name,
+		ch:     make(chan *chain.TrackedWalletEvent, buffer),
+		policy: policy,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.ch)
+		return s.ch, func() {}
+	}
+	h.subs[s] = true
+
+	return s.ch, func() {
+		h.unsubscribe(s)
+	}
+}
+
+// Broadcast delivers the event to all subscribers. Subscribers with
+// blockOnFull are waited for, until ctx is done, once the event was offered
+// to all other subscribers.
+func (h *eventHub) Broadcast(ctx context.Context, event *chain.TrackedWalletEvent) {
+	h.mu.Lock()
+	subs := make([]*hubSubscriber, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
+
+	full := []*hubSubscriber{}
+	for _, s := range subs {
+		if s.offer(event) {
+			continue
+		}
+		switch s.policy {
+		case blockOnFull:
+			full = append(full, s)
+		case disconnectOnFull:
+			slog.Warn("disconnecting slow event hub subscriber",
+				slog.String("subscriber", s.name),
+			)
+			h.unsubscribe(s)
+		default:
+			s.drop(event, "event hub subscriber buffer is full, dropping event")
+		}
+	}
+	for _, s := range full {
+		s.wait(ctx, event)
+	}
+}
+
+// offer sends the event without blocking. It reports whether the event was
+// sent or the subscriber is already removed.
+func (s *hubSubscriber) offer(event *chain.TrackedWalletEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sends the event once the subscriber has room for it, dropping it if
+// ctx is done first.
+func (s *hubSubscriber) wait(ctx context.Context, event *chain.TrackedWalletEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- event:
+	case <-ctx.Done():
+		s.dropLocked(event, "event hub broadcast cancelled, dropping event")
+	}
+}
+
+func (s *hubSubscriber) drop(event *chain.TrackedWalletEvent, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropLocked(event, msg)
+}
+
+// dropLocked must be called with mu held.
+func (s *hubSubscriber) dropLocked(event *chain.TrackedWalletEvent, msg string) {
+	s.dropped++
+	slog.Warn(msg,
+		slog.String("subscriber", s.name),
+		slog.String("chain", string(event.ChainName)),
+		slog.Uint64("dropped", s.dropped),
+	)
+}
+
+// Close disconnects all subscribers. Subsequent broadcasts are no-ops. It
+// waits for broadcasts blocked on subscribers with blockOnFull.
+func (h *eventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		h.remove(s)
+	}
+	h.closed = true
+}
+
+func (h *eventHub) unsubscribe(s *hubSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// remove must be called with mu held.
+func (h *eventHub) remove(s *hubSubscriber) {
+	if h.subs[s] {
+		delete(h.subs, s)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	}
+}
+
+// hubEventStream exposes the hub to API clients. Slow clients are
+// disconnected, so that they notice missed events.
+type hubEventStream struct {
+	hub    *eventHub
+	buffer int
+}
+
+func (s hubEventStream) Subscribe(name string) (<-chan *chain.TrackedWalletEvent, func()) {
+	return s.hub.Subscribe(name, s.buffer, disconnectOnFull)
+}
@@ -0,0 +1,203 @@
+package svc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func hubEvent(i int) *chain.TrackedWalletEvent {
+	return &chain.TrackedWalletEvent{
+		ChainName: chain.EthereumMainnet,
+		TxHash:    fmt.Sprintf("0x%02x", i),
+	}
+}
+
+func TestEventHubBroadcastsToSubscribersOfDifferentSpeeds(t *testing.T) {
+	hub := newEventHub()
+	const total = 20
+
+	fast, _ := hub.Subscribe("fast", total+1, dropOnFull)
+	// Slow subscriber doesn't consume anything until all events are
+	// broadcast
+	slow, _ := hub.Subscribe("slow", 5, dropOnFull)
+	slowest, _ := hub.Subscribe("slowest", 1, disconnectOnFull)
+
+	var fastGot []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for event := range fast {
+			fastGot = append(fastGot, event.TxHash)
+		}
+	}()
+
+	for i := range total {
+		hub.Broadcast(context.Background(), hubEvent(i))
+	}
+
+	// Slow subscriber keeps the buffered events, the rest are dropped
+	for i := range 5 {
+		select {
+		case event := <-slow:
+			assert.Equal(t, hubEvent(i).TxHash, event.TxHash)
+		case <-time.After(time.Second):
+			t.Fatal("slow subscriber did not receive buffered event")
+		}
+	}
+	select {
+	case event := <-slow:
+		t.Fatalf("unexpected event %s, should have been dropped", event.TxHash)
+	default:
+	}
+
+	// Slowest subscriber receives its single buffered event and is
+	// disconnected
+	event, ok := <-slowest
+	assert.True(t, ok)
+	assert.Equal(t, hubEvent(0).TxHash, event.TxHash)
+	_, ok = <-slowest
+	assert.False(t, ok, "slowest subscriber should be disconnected")
+
+	// Slow subscriber stays connected and receives new events
+	hub.Broadcast(context.Background(), hubEvent(total))
+	select {
+	case event := <-slow:
+		assert.Equal(t, hubEvent(total).TxHash, event.TxHash)
+	case <-time.After(time.Second):
+		t.Fatal("slow subscriber did not receive new event")
+	}
+
+	hub.Close()
+	wg.Wait()
+	assert.Len(t, fastGot, total+1)
+	for i, txHash := range fastGot {
+		assert.Equal(t, hubEvent(i).TxHash, txHash)
+	}
+}
+
+func TestEventHubUnsubscribe(t *testing.T) {
+	hub := newEventHub()
+	events, unsubscribe := hub.Subscribe("a", 1, dropOnFull)
+	unsubscribe()
+	unsubscribe()
+
+	_, ok := <-events
+	assert.False(t, ok)
+	hub.Broadcast(context.Background(), hubEvent(0))
+
+	hub.Close()
+	events, _ = hub.Subscribe("b", 1, dropOnFull)
+	_, ok = <-events
+	assert.False(t, ok, "subscribing to closed hub returns closed channel")
+}
+
+func TestEventHubConcurrentUse(t *testing.T) {
+	hub := newEventHub()
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			events, unsubscribe := hub.Subscribe(fmt.Sprintf("sub-%d", i), 2, slowConsumerPolicy(i%2))
+			defer unsubscribe()
+			for range 5 {
+				select {
+				case <-events:
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 10 {
+				hub.Broadcast(context.Background(), hubEvent(j))
+			}
+		}()
+	}
+	wg.Wait()
+	hub.Close()
+}
+
+func TestEventHubBlockOnFull(t *testing.T) {
+	hub := newEventHub()
+	durable, _ := hub.Subscribe("durable", 1, blockOnFull)
+	hub.Broadcast(context.Background(), hubEvent(0))
+
+	// Broadcast waits until the subscriber has room for the event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.Broadcast(context.Background(), hubEvent(1))
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected broadcast to wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, hubEvent(0).TxHash, (<-durable).TxHash)
+	<-done
+	assert.Equal(t, hubEvent(1).TxHash, (<-durable).TxHash)
+
+	// Waiting stops once ctx is done, dropping the event
+	hub.Broadcast(context.Background(), hubEvent(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	hub.Broadcast(ctx, hubEvent(3))
+	assert.Equal(t, hubEvent(2).TxHash, (<-durable).TxHash)
+	hub.Close()
+	_, ok := <-durable
+	assert.False(t, ok)
+}
+
+func TestEventHubStalledSinkDoesNotBlockSubscribers(t *testing.T) {
+	hub := newEventHub()
+	sink, _ := hub.Subscribe("sink", 1, blockOnFull)
+	client, _ := hub.Subscribe("client", 10, disconnectOnFull)
+	hub.Broadcast(context.Background(), hubEvent(0))
+	<-client
+
+	// The sink is full and not read, the broadcast waits for it
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.Broadcast(ctx, hubEvent(1))
+	}()
+
+	// Other subscribers receive the event and clients keep subscribing and
+	// unsubscribing meanwhile
+	select {
+	case event := <-client:
+		assert.Equal(t, hubEvent(1).TxHash, event.TxHash)
+	case <-time.After(time.Second):
+		t.Fatal("client did not receive the event while the sink is stalled")
+	}
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		_, unsubscribe := hub.Subscribe("late", 1, disconnectOnFull)
+		unsubscribe()
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("subscribing was blocked by the stalled sink")
+	}
+	select {
+	case <-done:
+		t.Fatal("expected broadcast to wait for the sink")
+	default:
+	}
+
+	cancel()
+	<-done
+	assert.Equal(t, hubEvent(0).TxHash, (<-sink).TxHash)
+	hub.Close()
+}
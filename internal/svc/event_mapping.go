@@ -0,0 +1,134 @@
+package svc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// eventMapping reshapes the JSON body of published events, so that consumers
+// can adapt the event shape without code changes. Only top level fields of
+// chain.TrackedWalletEvent are mapped. Fields are dropped first, then renamed,
+// then tags are added.
+type eventMapping struct {
+	// Event field -> published field
+	rename map[string]string
+	// Event fields left out of published events
+	drop map[string]bool
+	// Static fields added to every published event
+	tags map[string]string
+}
+
+// parseEventMapping parses comma separated lists of from:to renames, dropped
+// fields and key:value tags. It returns nil if all lists are empty.
+func parseEventMapping(rename, drop, tags string) (*eventMapping, error) {
+	m := &eventMapping{
+		rename: make(map[string]string),
+		drop:   make(map[string]bool),
+		tags:   make(map[string]string),
+	}
+	fields := eventFields()
+
+	renames, err := parsePairs(rename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid renamed fields: %w", err)
+	}
+	for from, to := range renames {
+		if !fields[from] {
+			return nil, fmt.Errorf("invalid renamed fields: unknown event field %s", from)
+		}
+		m.rename[from] = to
+	}
+	for _, field := range strings.Split(drop, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !fields[field] {
+			return nil, fmt.Errorf("invalid dropped fields: unknown event field %s", field)
+		}
+		m.drop[field] = true
+	}
+	if m.tags, err = parsePairs(tags); err != nil {
+		return nil, fmt.Errorf("invalid tags: %w", err)
+	}
+
+	if len(m.rename) == 0 && len(m.drop) == 0 && len(m.tags) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// Marshal returns the JSON body of event with the mapping applied. Without a
+// mapping, the body is the plain JSON encoding of event.
+func (m *eventMapping) Marshal(event *chain.TrackedWalletEvent) ([]byte, error) {
+	if m == nil {
+		return json.Marshal(event)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[string]json.RawMessage, len(fields)+len(m.tags))
+	for field, value := range fields {
+		if m.drop[field] {
+			continue
+		}
+		if to, ok := m.rename[field]; ok {
+			field = to
+		}
+		mapped[field] = value
+	}
+	for key, value := range m.tags {
+		tag, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		mapped[key] = tag
+	}
+	return json.Marshal(mapped)
+}
+
+// parsePairs parses a comma separated list of key:value pairs.
+func parsePairs(list string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("entry %q is not a key:value pair", entry)
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+// eventFields returns the JSON field names of chain.TrackedWalletEvent.
+func eventFields() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(chain.TrackedWalletEvent{})
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
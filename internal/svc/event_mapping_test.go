@@ -0,0 +1,139 @@
+package svc
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEventMapping(t *testing.T) {
+	m, err := parseEventMapping(" TxHash:tx_hash , ChainName:chain", "Flows,PreBalance", "source:deblock")
+	assert.NoError(t, err)
+	assert.Equal(t, &eventMapping{
+		rename: map[string]string{"TxHash": "tx_hash", "ChainName": "chain"},
+		drop:   map[string]bool{"Flows": true, "PreBalance": true},
+		tags:   map[string]string{"source": "deblock"},
+	}, m)
+
+	// No mapping configured
+	m, err = parseEventMapping("", " ", "")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	tests := []struct {
+		name    string
+		rename  string
+		drop    string
+		tags    string
+		wantErr string
+	}{
+		{name: "unknown renamed field", rename: "Hash:hash", wantErr: "invalid renamed fields: unknown event field Hash"},
+		{name: "rename without target", rename: "TxHash:", wantErr: `invalid renamed fields: entry "TxHash:" is not a key:value pair`},
+		{name: "unknown dropped field", drop: "txhash", wantErr: "invalid dropped fields: unknown event field txhash"},
+		{name: "tag without value", tags: "source", wantErr: `invalid tags: entry "source" is not a key:value pair`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEventMapping(tt.rename, tt.drop, tt.tags)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestEventMappingMarshal(t *testing.T) {
+	event := &chain.TrackedWalletEvent{
+		ChainName:      chain.SolanaMainnet,
+		TxHash:         "sig",
+		Wallet:         "AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW",
+		Amount:         big.NewInt(10),
+		Fees:           big.NewInt(5),
+		IdempotencyKey: "key",
+		PreBalance:     big.NewInt(100),
+	}
+
+	// Without a mapping events are published as they are
+	var none *eventMapping
+	body, err := none.Marshal(event)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(event)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(body))
+
+	m, err := parseEventMapping("TxHash:tx_hash,ChainName:chain", "PreBalance,ObservedAt,BlockTime", "source:deblock,env:test")
+	assert.NoError(t, err)
+	body, err = m.Marshal(event)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"chain": "solana_mainnet",
+		"tx_hash": "sig",
+		"Wallet": "AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW",
+		"Source": "",
+		"Destination": "",
+		"Amount": 10,
+		"Fees": 5,
+		"IdempotencyKey": "key",
+		"BlockNumber": 0,
+		"TxIndex": 0,
+		"source": "deblock",
+		"env": "test"
+	}`, string(body))
+}
+
+func TestEventMappingPublishing(t *testing.T) {
+	m, err := parseEventMapping("TxHash:tx_hash", "Fees", "source:deblock")
+	assert.NoError(t, err)
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	event := &chain.TrackedWalletEvent{
+		ChainName:   chain.EthereumMainnet,
+		TxHash:      "0x01",
+		Wallet:      wallet,
+		Source:      wallet,
+		Destination: "0x0000000000000000000000000000000000000001",
+		Amount:      big.NewInt(1),
+		Fees:        big.NewInt(1),
+	}
+	assertMapped := func(body []byte) {
+		t.Helper()
+		fields := map[string]any{}
+		assert.NoError(t, json.Unmarshal(body, &fields))
+		assert.Equal(t, "0x01", fields["tx_hash"])
+		assert.Equal(t, "deblock", fields["source"])
+		assert.NotContains(t, fields, "TxHash")
+		assert.NotContains(t, fields, "Fees")
+	}
+
+	// Kafka message body, headers are not affected
+	msg, err := kafkaMessage("deblock_tx_tracker", event, m)
+	assert.NoError(t, err)
+	body, err := msg.Value.Encode()
+	assert.NoError(t, err)
+	assertMapped(body)
+	assert.Equal(t, "chain", string(msg.Headers[0].Key))
+	assert.Equal(t, "ethereum_mainnet", string(msg.Headers[0].Value))
+
+	// Webhook body
+	received := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer hook.Close()
+	router := newWebhookRouter()
+	defer router.Close()
+	router.mapping = m
+	assert.NoError(t, router.SetWebhook(0, wallet, chain.EthereumMainnet, hook.URL))
+	router.Dispatch(event)
+	select {
+	case body := <-received:
+		assertMapped(body)
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
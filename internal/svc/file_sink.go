@@ -0,0 +1,173 @@
+package svc
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// fileSinkRotatedLayout is the timestamp suffix of rotated files.
+const fileSinkRotatedLayout = "20060102T150405.000000000Z"
+
+// FileSinkConfig configures a FileSink.
+type FileSinkConfig struct {
+	Path string
+	// Size in bytes the file is rotated at, 0 disables size based rotation
+	MaxSize int64
+	// Age the file is rotated at, 0 disables time based rotation
+	MaxAge time.Duration
+	// Whether rotated files are gzip compressed
+	Gzip bool
+}
+
+// FileSink appends every event as a line of JSON (NDJSON) to a local file,
+// e.g. for environments without Kafka. The file is rotated by renaming it
+// with a timestamp suffix once the next event would exceed MaxSize or the
+// file is older than MaxAge.
+type FileSink struct {
+	cfg FileSinkConfig
+	// Shapes lines, nil writes events as they are
+	mapping *eventMapping
+	now     func() time.Time
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mu       sync.Mutex
+
+	// Compressions of rotated files in progress
+	compressions sync.WaitGroup
+}
+
+var _ EventSink = (*FileSink)(nil)
+
+func NewFileSink(cfg FileSinkConfig, mapping *eventMapping) (*FileSink, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("event file path is empty")
+	}
+	f := &FileSink{
+		cfg:     cfg,
+		mapping: mapping,
+		now:     time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileSink) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening event file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening event file: %w", err)
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *FileSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	line, err := f.mapping.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil && f.rotationDue(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			slog.Error("failed to rotate event file", slog.Any("error", err))
+		}
+	}
+	if f.file == nil {
+		return errors.New("event file is closed")
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+// rotationDue reports whether the file must be rotated before writing n
+// more bytes. Empty files are never rotated.
+func (f *FileSink) rotationDue(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	return (f.cfg.MaxSize > 0 && f.size+n > f.cfg.MaxSize) ||
+		(f.cfg.MaxAge > 0 && f.now().Sub(f.openedAt) >= f.cfg.MaxAge)
+}
+
+// rotate renames the file and opens a new one. If renaming fails, the
+// current file is opened again.
+func (f *FileSink) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return errors.Join(err, f.open())
+	}
+	rotated := f.cfg.Path + "." + f.now().UTC().Format(fileSinkRotatedLayout)
+	if err := os.Rename(f.cfg.Path, rotated); err != nil {
+		return errors.Join(err, f.open())
+	}
+	if f.cfg.Gzip {
+		f.compressions.Add(1)
+		go func() {
+			defer f.compressions.Done()
+			if err := gzipFile(rotated); err != nil {
+				slog.Error("failed to compress rotated event file",
+					slog.String("file", rotated),
+					slog.Any("error", err),
+				)
+			}
+		}()
+	}
+	return f.open()
+}
+
+// Close closes the file and waits for compressions of rotated files.
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.compressions.Wait()
+	return err
+}
+
+// gzipFile replaces the file with its gzip compressed copy with .gz suffix.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), dst.Close())
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,155 @@
+package svc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+// fileTxHashes returns tx hashes of events in the NDJSON file, reading it
+// through gzip if its name ends with .gz.
+func fileTxHashes(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var r *bufio.Scanner
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+		r = bufio.NewScanner(zr)
+	} else {
+		r = bufio.NewScanner(f)
+	}
+
+	hashes := []string{}
+	for r.Scan() {
+		event := chain.TrackedWalletEvent{}
+		assert.NoError(t, json.Unmarshal(r.Bytes(), &event))
+		hashes = append(hashes, event.TxHash)
+	}
+	return hashes
+}
+
+// rotatedFiles returns rotated files of path in rotation order.
+func rotatedFiles(t *testing.T, path string) []string {
+	files, err := filepath.Glob(path + ".*")
+	assert.NoError(t, err)
+	sort.Strings(files)
+	return files
+}
+
+func eventLineSize(t *testing.T, event *chain.TrackedWalletEvent) int64 {
+	line, err := json.Marshal(event)
+	assert.NoError(t, err)
+	return int64(len(line)) + 1
+}
+
+func TestFileSinkWritesEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	// Existing events are appended to
+	assert.NoError(t, os.WriteFile(path, []byte(`{"TxHash":"0xold"}`+"\n"), 0o644))
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path}, nil)
+	assert.NoError(t, err)
+	for i := range 3 {
+		assert.NoError(t, sink.Publish(context.Background(), hubEvent(i)))
+	}
+	assert.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"0xold", hubEvent(0).TxHash, hubEvent(1).TxHash, hubEvent(2).TxHash}, fileTxHashes(t, path))
+	assert.Empty(t, rotatedFiles(t, path))
+	assert.Error(t, sink.Publish(context.Background(), hubEvent(3)))
+}
+
+func TestFileSinkRequiresPath(t *testing.T) {
+	_, err := NewFileSink(FileSinkConfig{}, nil)
+	assert.EqualError(t, err, "event file path is empty")
+}
+
+func TestFileSinkRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	lineSize := eventLineSize(t, hubEvent(0))
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxSize: 2 * lineSize}, nil)
+	assert.NoError(t, err)
+	now := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	// Two events fit exactly, the third one triggers the rotation
+	for i := range 2 {
+		assert.NoError(t, sink.Publish(context.Background(), hubEvent(i)))
+	}
+	assert.Empty(t, rotatedFiles(t, path))
+	for i := 2; i < 5; i++ {
+		assert.NoError(t, sink.Publish(context.Background(), hubEvent(i)))
+	}
+	assert.NoError(t, sink.Close())
+
+	rotated := rotatedFiles(t, path)
+	if assert.Len(t, rotated, 2) {
+		assert.Equal(t, []string{hubEvent(0).TxHash, hubEvent(1).TxHash}, fileTxHashes(t, rotated[0]))
+		assert.Equal(t, []string{hubEvent(2).TxHash, hubEvent(3).TxHash}, fileTxHashes(t, rotated[1]))
+	}
+	assert.Equal(t, []string{hubEvent(4).TxHash}, fileTxHashes(t, path))
+}
+
+func TestFileSinkRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	now := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxAge: time.Hour}, nil)
+	assert.NoError(t, err)
+	sink.now = func() time.Time { return now }
+	sink.openedAt = now
+
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(0)))
+	now = now.Add(59 * time.Minute)
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(1)))
+	assert.Empty(t, rotatedFiles(t, path))
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(2)))
+	assert.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{path + ".20241001T010000.000000000Z"}, rotatedFiles(t, path))
+	assert.Equal(t, []string{hubEvent(0).TxHash, hubEvent(1).TxHash}, fileTxHashes(t, path+".20241001T010000.000000000Z"))
+	assert.Equal(t, []string{hubEvent(2).TxHash}, fileTxHashes(t, path))
+}
+
+func TestFileSinkGzipsRotatedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink, err := NewFileSink(FileSinkConfig{
+		Path:    path,
+		MaxSize: eventLineSize(t, hubEvent(0)),
+		Gzip:    true,
+	}, nil)
+	assert.NoError(t, err)
+	for i := range 2 {
+		assert.NoError(t, sink.Publish(context.Background(), hubEvent(i)))
+	}
+	// Close waits for the compression
+	assert.NoError(t, sink.Close())
+
+	rotated := rotatedFiles(t, path)
+	if assert.Len(t, rotated, 1) {
+		assert.True(t, strings.HasSuffix(rotated[0], ".gz"))
+		assert.Equal(t, []string{hubEvent(0).TxHash}, fileTxHashes(t, rotated[0]))
+	}
+	assert.Equal(t, []string{hubEvent(1).TxHash}, fileTxHashes(t, path))
+}
+
+func TestFileSinkInvalidPath(t *testing.T) {
+	_, err := NewFileSink(FileSinkConfig{Path: filepath.Join(t.TempDir(), "missing", "events.ndjson")}, nil)
+	assert.ErrorContains(t, err, "opening event file")
+}
@@ -0,0 +1,258 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+const (
+	// kafkaSchemaVersion is the version of the JSON event body. It must be
+	// bumped on incompatible changes of chain.TrackedWalletEvent.
+	kafkaSchemaVersion = "1"
+
+	// kafkaTransferEventType is the event_type header value of transfer
+	// events, whose Type is empty.
+	kafkaTransferEventType = "transfer"
+
+	// kafkaBatchEventType is the event_type header value of batch messages,
+	// whose body is a JSON array of events.
+	kafkaBatchEventType = "batch"
+)
+
+// KafkaSinkConfig configures a KafkaSink.
+type KafkaSinkConfig struct {
+	Topic string
+	// Maximum number of events of a partition key produced as a single JSON
+	// array message. 0 or 1 - events are produced individually.
+	BatchSize int
+	// Interval of flushing incomplete batches. 0 - batches are only flushed
+	// once full and on Close.
+	BatchInterval time.Duration
+}
+
+// KafkaSink publishes events to a Kafka topic through an async producer.
+// Delivery failures are reported by the producer asynchronously and logged.
+// With batching enabled, events are accumulated per partition key, so that
+// events of a wallet stay ordered.
+type KafkaSink struct {
+	producer sarama.AsyncProducer
+	cfg      KafkaSinkConfig
+	// Shapes message bodies, nil publishes events as they are
+	mapping *eventMapping
+
+	// Partition key -> buffered events, in order of arrival
+	batches map[string][]*chain.TrackedWalletEvent
+	// batches and closed mutex, held while messages are produced to keep
+	// their order and not to produce to a closed producer
+	mu     sync.Mutex
+	closed bool
+	// Stops the flushing goroutine
+	stop chan struct{}
+	// Closed once the flushing goroutine returns
+	stopped chan struct{}
+}
+
+var _ EventSink = (*KafkaSink)(nil)
+
+// NewKafkaSink creates a sink publishing to cfg.Topic. Closing the sink
+// flushes buffered events and closes the producer.
+func NewKafkaSink(producer sarama.AsyncProducer, cfg KafkaSinkConfig, mapping *eventMapping) *KafkaSink {
+	go func() {
+		for err := range producer.Errors() {
+			slog.Error(
+				"failed to produce message to kafka",
+				slog.Any("error", err),
+			)
+		}
+	}()
+	k := &KafkaSink{
+		producer: producer,
+		cfg:      cfg,
+		mapping:  mapping,
+		batches:  make(map[string][]*chain.TrackedWalletEvent),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if k.batching() && cfg.BatchInterval > 0 {
+		go k.flushPeriodically()
+	} else {
+		close(k.stopped)
+	}
+	return k
+}
+
+func (k *KafkaSink) batching() bool {
+	return k.cfg.BatchSize > 1
+}
+
+// Publish returns an error once the sink is closed.
+func (k *KafkaSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return errors.New("kafka sink is closed")
+	}
+	if !k.batching() {
+		msg, err := kafkaMessage(k.cfg.Topic, event, k.mapping)
+		if err != nil {
+			return err
+		}
+		return k.produce(ctx, msg)
+	}
+
+	key := kafkaMessageKey(event)
+	k.batches[key] = append(k.batches[key], event)
+	if len(k.batches[key]) < k.cfg.BatchSize {
+		return nil
+	}
+	return k.flush(ctx, key)
+}
+
+// flushPeriodically flushes all batches every BatchInterval until the sink
+// is closed.
+func (k *KafkaSink) flushPeriodically() {
+	defer close(k.stopped)
+	ticker := time.NewTicker(k.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			k.mu.Lock()
+			err := k.flushAll(context.Background())
+			k.mu.Unlock()
+			if err != nil {
+				slog.Error(
+					"failed to flush kafka batches",
+					slog.Any("error", err),
+				)
+			}
+		}
+	}
+}
+
+// flushAll produces all buffered batches. It must be called with mu held.
+func (k *KafkaSink) flushAll(ctx context.Context) error {
+	for _, key := range slices.Sorted(maps.Keys(k.batches)) {
+		if err := k.flush(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush produces the batch of key. Events of a batch which can't be encoded
+// are dropped. It must be called with mu held.
+func (k *KafkaSink) flush(ctx context.Context, key string) error {
+	events := k.batches[key]
+	delete(k.batches, key)
+	msg, err := kafkaBatchMessage(k.cfg.Topic, key, events, k.mapping)
+	if err != nil {
+		return err
+	}
+	return k.produce(ctx, msg)
+}
+
+// produce must be called with mu held.
+func (k *KafkaSink) produce(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case k.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes buffered batches before closing the producer, so that no
+// published event is lost. Events published after Close are rejected.
+func (k *KafkaSink) Close() error {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil
+	}
+	k.closed = true
+	k.mu.Unlock()
+
+	close(k.stop)
+	<-k.stopped
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	err := k.flushAll(context.Background())
+	return errors.Join(err, k.producer.Close())
+}
+
+// kafkaMessage returns the message of event to topic, whose body is shaped by
+// mapping. Headers allow consumers to route messages without decoding the
+// body.
+func kafkaMessage(topic string, event *chain.TrackedWalletEvent, mapping *eventMapping) (*sarama.ProducerMessage, error) {
+	eventJson, err := mapping.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := string(event.Type)
+	if eventType == "" {
+		eventType = kafkaTransferEventType
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(kafkaMessageKey(event)),
+		Value: sarama.StringEncoder(eventJson),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("chain"), Value: []byte(event.ChainName)},
+			{Key: []byte("schema_version"), Value: []byte(kafkaSchemaVersion)},
+			{Key: []byte("event_type"), Value: []byte(eventType)},
+		},
+	}, nil
+}
+
+// kafkaBatchMessage returns a single message of events sharing the partition
+// key, whose body is a JSON array of events shaped by mapping.
+func kafkaBatchMessage(topic, key string, events []*chain.TrackedWalletEvent, mapping *eventMapping) (*sarama.ProducerMessage, error) {
+	bodies := make([]json.RawMessage, 0, len(events))
+	for _, event := range events {
+		body, err := mapping.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	batchJson, err := json.Marshal(bodies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.StringEncoder(batchJson),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("chain"), Value: []byte(events[0].ChainName)},
+			{Key: []byte("schema_version"), Value: []byte(kafkaSchemaVersion)},
+			{Key: []byte("event_type"), Value: []byte(kafkaBatchEventType)},
+			{Key: []byte("batch_size"), Value: []byte(strconv.Itoa(len(events)))},
+		},
+	}, nil
+}
+
+// kafkaMessageKey returns the partitioning key of event. Events of a tracked
+// wallet share the key, so that they are consumed in order regardless of
+// their direction.
+func kafkaMessageKey(event *chain.TrackedWalletEvent) string {
+	return string(event.ChainName) + ":" + event.Wallet
+}
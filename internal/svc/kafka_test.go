@@ -0,0 +1,340 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaMessageHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *chain.TrackedWalletEvent
+		headers map[string]string
+	}{
+		{
+			name: "transfer",
+			event: &chain.TrackedWalletEvent{
+				ChainName: chain.EthereumMainnet,
+				TxHash:    "0x01",
+				Amount:    big.NewInt(1),
+			},
+			headers: map[string]string{
+				"chain":          "ethereum_mainnet",
+				"schema_version": "1",
+				"event_type":     "transfer",
+			},
+		},
+		{
+			name: "first activity",
+			event: &chain.TrackedWalletEvent{
+				Type:      chain.EventFirstActivity,
+				ChainName: chain.SolanaMainnet,
+				Wallet:    "AybGqJdVykkRrnQ2pcv5WfXBYDTvYRtTJ6DjPRsJmZjW",
+			},
+			headers: map[string]string{
+				"chain":          "solana_mainnet",
+				"schema_version": "1",
+				"event_type":     "first_activity",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := kafkaMessage("deblock_tx_tracker_staging", tt.event, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "deblock_tx_tracker_staging", msg.Topic)
+
+			headers := map[string]string{}
+			for _, h := range msg.Headers {
+				headers[string(h.Key)] = string(h.Value)
+			}
+			assert.Equal(t, tt.headers, headers)
+
+			// Body is unchanged
+			body, err := msg.Value.Encode()
+			assert.NoError(t, err)
+			expected, err := json.Marshal(tt.event)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(body))
+		})
+	}
+}
+
+func TestKafkaMessageKey(t *testing.T) {
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	outgoing := &chain.TrackedWalletEvent{
+		ChainName:   chain.EthereumMainnet,
+		Wallet:      wallet,
+		Source:      wallet,
+		Destination: "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+	}
+	incoming := &chain.TrackedWalletEvent{
+		ChainName:   chain.EthereumMainnet,
+		Wallet:      wallet,
+		Source:      "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107",
+		Destination: wallet,
+	}
+	assert.Equal(t, "ethereum_mainnet:"+wallet, kafkaMessageKey(outgoing))
+	// Events of the wallet share the partition regardless of direction
+	assert.Equal(t, kafkaMessageKey(outgoing), kafkaMessageKey(incoming))
+	// Same address on another chain is partitioned separately
+	assert.NotEqual(t, kafkaMessageKey(outgoing), kafkaMessageKey(&chain.TrackedWalletEvent{
+		ChainName: chain.PolygonMainnet,
+		Wallet:    wallet,
+	}))
+
+	msg, err := kafkaMessage("deblock_tx_tracker", incoming, nil)
+	assert.NoError(t, err)
+	key, err := msg.Key.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "ethereum_mainnet:"+wallet, string(key))
+}
+
+func TestKafkaSink(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, cfg)
+	event := &chain.TrackedWalletEvent{
+		ChainName: chain.EthereumMainnet,
+		TxHash:    "0x01",
+		Wallet:    "0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+		Amount:    big.NewInt(1),
+	}
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "deblock_tx_tracker_staging", msg.Topic)
+		key, err := msg.Key.Encode()
+		assert.NoError(t, err)
+		assert.Equal(t, kafkaMessageKey(event), string(key))
+		body, err := msg.Value.Encode()
+		assert.NoError(t, err)
+		expected, err := json.Marshal(event)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), string(body))
+		return nil
+	})
+	// Delivery failures are reported asynchronously
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	sink := NewKafkaSink(producer, KafkaSinkConfig{Topic: "deblock_tx_tracker_staging"}, nil)
+	assert.NoError(t, sink.Publish(context.Background(), event))
+	<-producer.Successes()
+	assert.NoError(t, sink.Publish(context.Background(), event))
+
+	// Closing the sink closes the producer and checks all expectations
+	assert.NoError(t, sink.Close())
+}
+
+// blockedProducer is a producer whose input is never consumed, e.g. while
+// brokers are unreachable.
+type blockedProducer struct {
+	sarama.AsyncProducer
+}
+
+func (blockedProducer) Input() chan<- *sarama.ProducerMessage {
+	return make(chan *sarama.ProducerMessage)
+}
+
+func (blockedProducer) Errors() <-chan *sarama.ProducerError {
+	return nil
+}
+
+func TestKafkaSinkPublishCancelled(t *testing.T) {
+	sink := NewKafkaSink(blockedProducer{}, KafkaSinkConfig{Topic: "deblock_tx_tracker"}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := sink.Publish(ctx, &chain.TrackedWalletEvent{ChainName: chain.Bitcoin})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func batchTestEvent(wallet string, i int) *chain.TrackedWalletEvent {
+	return &chain.TrackedWalletEvent{
+		ChainName: chain.EthereumMainnet,
+		TxHash:    fmt.Sprintf("0x%02x", i),
+		Wallet:    wallet,
+		Amount:    big.NewInt(int64(i)),
+	}
+}
+
+// batchTxHashes returns tx hashes of events of a batch message, checking its
+// headers.
+func batchTxHashes(t *testing.T, msg *sarama.ProducerMessage) []string {
+	t.Helper()
+	headers := map[string]string{}
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, "batch", headers["event_type"])
+
+	body, err := msg.Value.Encode()
+	assert.NoError(t, err)
+	events := []chain.TrackedWalletEvent{}
+	assert.NoError(t, json.Unmarshal(body, &events))
+	assert.Equal(t, fmt.Sprint(len(events)), headers["batch_size"])
+	hashes := []string{}
+	for _, event := range events {
+		hashes = append(hashes, event.TxHash)
+	}
+	return hashes
+}
+
+func TestKafkaSinkBatchBySize(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+
+	sink := NewKafkaSink(producer, KafkaSinkConfig{Topic: "deblock_tx_tracker", BatchSize: 3}, nil)
+	w1 := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	w2 := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	for i, wallet := range []string{w1, w2, w1, w1, w2} {
+		assert.NoError(t, sink.Publish(context.Background(), batchTestEvent(wallet, i)))
+	}
+
+	// Full batch of the first wallet, in order of publishing
+	msg := <-producer.Successes()
+	key, err := msg.Key.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "ethereum_mainnet:"+w1, string(key))
+	assert.Equal(t, []string{"0x00", "0x02", "0x03"}, batchTxHashes(t, msg))
+
+	// Incomplete batch of the second wallet is flushed on Close
+	select {
+	case msg := <-producer.Successes():
+		t.Fatalf("unexpected batch %v", batchTxHashes(t, msg))
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NoError(t, sink.Close())
+	msg = <-producer.Successes()
+	key, err = msg.Key.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "ethereum_mainnet:"+w2, string(key))
+	assert.Equal(t, []string{"0x01", "0x04"}, batchTxHashes(t, msg))
+}
+
+func TestKafkaSinkBatchByTime(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+
+	sink := NewKafkaSink(producer, KafkaSinkConfig{
+		Topic:         "deblock_tx_tracker",
+		BatchSize:     100,
+		BatchInterval: 10 * time.Millisecond,
+	}, nil)
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	assert.NoError(t, sink.Publish(context.Background(), batchTestEvent(wallet, 0)))
+	assert.NoError(t, sink.Publish(context.Background(), batchTestEvent(wallet, 1)))
+
+	// Incomplete batch is flushed once the interval elapses
+	select {
+	case msg := <-producer.Successes():
+		assert.Equal(t, []string{"0x00", "0x01"}, batchTxHashes(t, msg))
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed")
+	}
+
+	// Nothing left to flush on Close
+	assert.NoError(t, sink.Close())
+}
+
+func TestKafkaSinkBatchingDisabled(t *testing.T) {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+
+	sink := NewKafkaSink(producer, KafkaSinkConfig{Topic: "deblock_tx_tracker", BatchSize: 1}, nil)
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	for i := range 2 {
+		assert.NoError(t, sink.Publish(context.Background(), batchTestEvent(wallet, i)))
+		// Every event is a message of its own
+		msg := <-producer.Successes()
+		body, err := msg.Value.Encode()
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), fmt.Sprintf(`"TxHash":"0x%02x"`, i))
+	}
+	assert.NoError(t, sink.Close())
+}
+
+// closingProducer buffers produced messages and panics like sarama on input
+// after Close.
+type closingProducer struct {
+	sarama.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func (p closingProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (closingProducer) Errors() <-chan *sarama.ProducerError {
+	return nil
+}
+
+func (p closingProducer) Close() error {
+	close(p.input)
+	return nil
+}
+
+func TestKafkaSinkPublishWhileClosing(t *testing.T) {
+	for _, batchSize := range []int{0, 3} {
+		t.Run(fmt.Sprintf("batch size %d", batchSize), func(t *testing.T) {
+			const total = 200
+			producer := closingProducer{input: make(chan *sarama.ProducerMessage, total)}
+			sink := NewKafkaSink(producer, KafkaSinkConfig{
+				Topic:     "deblock_tx_tracker",
+				BatchSize: batchSize,
+			}, nil)
+
+			var published atomic.Int64
+			wg := sync.WaitGroup{}
+			for i := range total {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := sink.Publish(context.Background(), batchTestEvent("0x9642b23Ed1E01Df1092B92641051881a322F5D4E", i))
+					if err == nil {
+						published.Add(1)
+						return
+					}
+					assert.EqualError(t, err, "kafka sink is closed")
+				}()
+				if i == total/2 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						assert.NoError(t, sink.Close())
+					}()
+				}
+			}
+			wg.Wait()
+
+			// Every accepted event was produced before the producer was
+			// closed
+			produced := 0
+			for msg := range producer.input {
+				produced++
+				if batchSize > 1 {
+					produced += len(batchTxHashes(t, msg)) - 1
+				}
+			}
+			assert.Equal(t, published.Load(), int64(produced))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+)
+
+// ShadowSink publishes events to the primary sink and mirrors them to the
+// secondary sink, e.g. to validate a new transport while migrating
+// consumers. The secondary sink is published to in the background through a
+// buffer of its own, so that its failures and latency never affect the
+// primary sink. Failed and dropped secondary events are only logged and
+// counted.
+type ShadowSink struct {
+	primary   EventSink
+	secondary EventSink
+
+	// Events waiting to be published to the secondary sink
+	events chan *chain.TrackedWalletEvent
+	// Closed once all buffered events were published to the secondary sink
+	mirrored chan struct{}
+	// Guards events from being written to once closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewShadowSink mirrors events of primary to secondary, buffering up to
+// buffer events for the secondary sink.
+func NewShadowSink(primary, secondary EventSink, buffer int) *ShadowSink {
+	s := &ShadowSink{
+		primary:   primary,
+		secondary: secondary,
+		events:    make(chan *chain.TrackedWalletEvent, max(buffer, 1)),
+		mirrored:  make(chan struct{}),
+	}
+	go s.mirror()
+	return s
+}
+
+// Publish returns the result of publishing to the primary sink.
+func (s *ShadowSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	err := s.primary.Publish(ctx, event)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return err
+	}
+	select {
+	case s.events <- event:
+	default:
+		metrics.ShadowSinkFailures.Inc(string(event.ChainName))
+		slog.Warn(
+			"shadow sink buffer is full, dropping event",
+			slog.String("chain", string(event.ChainName)),
+			slog.String("tx_hash", event.TxHash),
+		)
+	}
+	return err
+}
+
+func (s *ShadowSink) mirror() {
+	defer close(s.mirrored)
+	for event := range s.events {
+		if err := s.secondary.Publish(context.Background(), event); err != nil {
+			metrics.ShadowSinkFailures.Inc(string(event.ChainName))
+			slog.Warn(
+				"failed to publish event to shadow sink",
+				slog.String("chain", string(event.ChainName)),
+				slog.String("tx_hash", event.TxHash),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// Close closes the primary sink and, once buffered events were mirrored, the
+// secondary sink. Only the error of the primary sink is returned.
+func (s *ShadowSink) Close() error {
+	err := s.primary.Close()
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	<-s.mirrored
+
+	if err := s.secondary.Close(); err != nil {
+		slog.Warn("failed to close shadow sink", slog.Any("error", err))
+	}
+	return err
+}
+
+// withShadowSink replaces the sink named shadow and the only other sink with
+// a ShadowSink mirroring events of the other sink to the shadow one.
+func withShadowSink(sinks map[string]EventSink, shadow string, buffer int) (map[string]EventSink, error) {
+	secondary, ok := sinks[shadow]
+	if !ok {
+		return nil, fmt.Errorf("shadow sink %q is not configured", shadow)
+	}
+	if len(sinks) != 2 {
+		return nil, errors.New("shadow sink requires exactly one primary sink")
+	}
+
+	primary := ""
+	for name := range sinks {
+		if name != shadow {
+			primary = name
+		}
+	}
+	return map[string]EventSink{
+		primary: NewShadowSink(sinks[primary], secondary, buffer),
+	}, nil
+}
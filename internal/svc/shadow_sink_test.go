@@ -0,0 +1,118 @@
+package svc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/Mantelijo/deblock-backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingSink blocks Publish until release is closed.
+type blockingSink struct {
+	fakeSink
+	release chan struct{}
+}
+
+func (b *blockingSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	<-b.release
+	return b.fakeSink.Publish(ctx, event)
+}
+
+func shadowTestEvent(t *testing.T, i int) *chain.TrackedWalletEvent {
+	event := hubEvent(i)
+	// Failure counters of the test only
+	event.ChainName = chain.ChainName(t.Name())
+	return event
+}
+
+func TestShadowSinkPublishesToBothSinks(t *testing.T) {
+	primary, secondary := &fakeSink{}, &fakeSink{}
+	s := NewShadowSink(primary, secondary, 10)
+
+	for i := range 3 {
+		assert.NoError(t, s.Publish(context.Background(), shadowTestEvent(t, i)))
+	}
+	assert.NoError(t, s.Close())
+
+	want := []string{hubEvent(0).TxHash, hubEvent(1).TxHash, hubEvent(2).TxHash}
+	assert.Equal(t, want, primary.Published())
+	// Close waits for buffered events to be mirrored
+	assert.Equal(t, want, secondary.Published())
+	assert.True(t, primary.closed)
+	assert.True(t, secondary.closed)
+}
+
+func TestShadowSinkSecondaryFailures(t *testing.T) {
+	primary, secondary := &fakeSink{}, &fakeSink{failTx: hubEvent(1).TxHash}
+	s := NewShadowSink(primary, secondary, 10)
+	failures := metrics.ShadowSinkFailures.Value(t.Name())
+
+	for i := range 3 {
+		assert.NoError(t, s.Publish(context.Background(), shadowTestEvent(t, i)))
+	}
+	assert.NoError(t, s.Close())
+
+	assert.Equal(t, []string{hubEvent(0).TxHash, hubEvent(1).TxHash, hubEvent(2).TxHash}, primary.Published())
+	assert.Equal(t, []string{hubEvent(0).TxHash, hubEvent(2).TxHash}, secondary.Published())
+	assert.Equal(t, failures+1, metrics.ShadowSinkFailures.Value(t.Name()))
+}
+
+func TestShadowSinkPrimaryFailures(t *testing.T) {
+	primary, secondary := &fakeSink{failTx: hubEvent(0).TxHash}, &fakeSink{}
+	s := NewShadowSink(primary, secondary, 10)
+
+	assert.ErrorIs(t, s.Publish(context.Background(), shadowTestEvent(t, 0)), assert.AnError)
+	assert.NoError(t, s.Close())
+	// Mirrored regardless of the primary result
+	assert.Equal(t, []string{hubEvent(0).TxHash}, secondary.Published())
+}
+
+func TestShadowSinkSlowSecondary(t *testing.T) {
+	primary := &fakeSink{}
+	secondary := &blockingSink{release: make(chan struct{})}
+	s := NewShadowSink(primary, secondary, 1)
+	failures := metrics.ShadowSinkFailures.Value(t.Name())
+
+	// The secondary sink blocks on the first event, the second one is
+	// buffered and the rest are dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 5 {
+			assert.NoError(t, s.Publish(context.Background(), shadowTestEvent(t, i)))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slow shadow sink blocked the primary sink")
+	}
+	assert.Len(t, primary.Published(), 5)
+
+	close(secondary.release)
+	assert.NoError(t, s.Close())
+	published := len(secondary.Published())
+	assert.True(t, published >= 1 && published <= 2, "published %d", published)
+	assert.Equal(t, failures+float64(5-published), metrics.ShadowSinkFailures.Value(t.Name()))
+}
+
+func TestWithShadowSink(t *testing.T) {
+	kafka, webhook := &fakeSink{}, &fakeSink{}
+	sinks, err := withShadowSink(map[string]EventSink{"kafka": kafka, "webhook": webhook}, "webhook", 10)
+	assert.NoError(t, err)
+	if assert.Contains(t, sinks, "kafka") {
+		shadow := sinks["kafka"].(*ShadowSink)
+		assert.Same(t, kafka, shadow.primary)
+		assert.Same(t, webhook, shadow.secondary)
+		assert.NoError(t, shadow.Close())
+	}
+	assert.Len(t, sinks, 1)
+
+	_, err = withShadowSink(map[string]EventSink{"kafka": kafka}, "webhook", 10)
+	assert.EqualError(t, err, `shadow sink "webhook" is not configured`)
+	_, err = withShadowSink(map[string]EventSink{"webhook": webhook}, "webhook", 10)
+	assert.EqualError(t, err, "shadow sink requires exactly one primary sink")
+}
@@ -0,0 +1,74 @@
+package svc
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// forceExit terminates the process when components hang on shutdown.
+// Replaced in tests.
+var forceExit = os.Exit
+
+// component is a part of the service which is stopped on shutdown.
+type component struct {
+	name string
+	// stop should return once the component is stopped or ctx is done
+	stop func(ctx context.Context) error
+}
+
+// stopComponents stops all components concurrently and waits for them at
+// most timeout. It returns names of components which did not stop in time.
+func stopComponents(timeout time.Duration, components ...component) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make([]chan struct{}, len(components))
+	for i, c := range components {
+		done[i] = make(chan struct{})
+		go func() {
+			defer close(done[i])
+			if err := c.stop(ctx); err != nil {
+				slog.Error(
+					"failed to stop component",
+					slog.String("component", c.name),
+					slog.Any("error", err),
+				)
+			}
+		}()
+	}
+
+	hung := []string{}
+	for i, c := range components {
+		select {
+		case <-done[i]:
+			continue
+		case <-ctx.Done():
+		}
+		// Component may have stopped while waiting for the previous ones
+		select {
+		case <-done[i]:
+		default:
+			hung = append(hung, c.name)
+		}
+	}
+	return hung
+}
+
+// shutdown stops all components and force-exits the process if any of them
+// does not stop within timeout.
+func shutdown(timeout time.Duration, components ...component) {
+	hung := stopComponents(timeout, components...)
+	if len(hung) == 0 {
+		slog.Info("all components stopped")
+		return
+	}
+
+	slog.Error(
+		"components did not stop within the shutdown timeout, forcing exit",
+		slog.Any("components", hung),
+		slog.Duration("timeout", timeout),
+	)
+	forceExit(1)
+}
@@ -0,0 +1,48 @@
+package svc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownForcesExitWhenComponentHangs(t *testing.T) {
+	exitCode := -1
+	defer func(orig func(int)) { forceExit = orig }(forceExit)
+	forceExit = func(code int) { exitCode = code }
+
+	// hang ignores ctx, like an RPC call without cancellation support
+	release := make(chan struct{})
+	defer close(release)
+	hang := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+	stopped := func(ctx context.Context) error { return nil }
+	failed := func(ctx context.Context) error { return assert.AnError }
+
+	start := time.Now()
+	assert.Equal(t,
+		[]string{"subscribers", "kafka"},
+		stopComponents(50*time.Millisecond,
+			component{name: "subscribers", stop: hang},
+			component{name: "api", stop: stopped},
+			component{name: "kafka", stop: hang},
+		),
+	)
+	assert.Less(t, time.Since(start), time.Second)
+
+	shutdown(10*time.Millisecond, component{name: "subscribers", stop: hang})
+	assert.Equal(t, 1, exitCode)
+
+	// Components which stopped in time, even with an error, don't force
+	// the exit
+	exitCode = -1
+	shutdown(time.Second,
+		component{name: "api", stop: stopped},
+		component{name: "kafka", stop: failed},
+	)
+	assert.Equal(t, -1, exitCode)
+}
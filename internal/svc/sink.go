@@ -0,0 +1,127 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// EventSink is the transport tracked wallet events are published to, e.g.
+// Kafka. Adding a transport only requires a new implementation.
+type EventSink interface {
+	// Publish delivers the event or returns an error. It must return once
+	// ctx is done.
+	Publish(ctx context.Context, event *chain.TrackedWalletEvent) error
+	// Close flushes pending events and releases the transport.
+	Close() error
+}
+
+// NoopSink discards all events. It is used when no transport is configured.
+type NoopSink struct{}
+
+func (NoopSink) Publish(context.Context, *chain.TrackedWalletEvent) error {
+	return nil
+}
+
+func (NoopSink) Close() error {
+	return nil
+}
+
+// eventBackends are names of the sinks events can be published to.
+var eventBackends = []string{"kafka", "webhook", "file"}
+
+// parseEventBackends parses a comma separated list of event backends. An
+// empty list returns nil.
+func parseEventBackends(list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	backends := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(eventBackends, name) {
+			return nil, fmt.Errorf("unsupported event backend %q", name)
+		}
+		backends[name] = true
+	}
+	return backends, nil
+}
+
+// publishEvents publishes events to sink until events is closed, so that
+// buffered events are drained on shutdown. Failed events are logged and
+// skipped.
+func publishEvents(ctx context.Context, events <-chan *chain.TrackedWalletEvent, sink EventSink) {
+	for event := range events {
+		if err := sink.Publish(ctx, event); err != nil {
+			slog.Error(
+				"failed to publish event",
+				slog.String("chain", string(event.ChainName)),
+				slog.String("tx_hash", event.TxHash),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// sinkPublishers publishes events of the hub to every sink, each through its
+// own buffer. Sinks are durable, so the hub waits for sinks whose buffer is
+// full instead of dropping their events.
+type sinkPublishers struct {
+	hub   *eventHub
+	sinks map[string]EventSink
+	wg    sync.WaitGroup
+	// Aborts publishes in flight if draining does not finish in time
+	cancel context.CancelFunc
+}
+
+func startSinkPublishers(hub *eventHub, sinks map[string]EventSink, buffer int) *sinkPublishers {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &sinkPublishers{
+		hub:    hub,
+		sinks:  sinks,
+		cancel: cancel,
+	}
+	for name, sink := range sinks {
+		events, _ := hub.Subscribe("sink_"+name, buffer, blockOnFull)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			publishEvents(ctx, events, sink)
+		}()
+	}
+	return p
+}
+
+// Stop closes the hub, waits until the publishers drained the buffered events
+// and closes the sinks. Publishes in flight are aborted once ctx is done.
+// Nothing must be broadcast to the hub after Stop is called.
+func (p *sinkPublishers) Stop(ctx context.Context) error {
+	p.hub.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		p.wg.Wait()
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		p.cancel()
+		<-drained
+	}
+	p.cancel()
+
+	errs := []error{}
+	for name, sink := range p.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s sink: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
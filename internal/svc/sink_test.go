@@ -0,0 +1,139 @@
+package svc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSink records published events and fails events of failTx.
+type fakeSink struct {
+	failTx string
+
+	mu        sync.Mutex
+	published []string
+	closed    bool
+}
+
+func (f *fakeSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	if event.TxHash == f.failTx {
+		return assert.AnError
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, event.TxHash)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeSink) Published() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.published...)
+}
+
+func TestPublishEventsFansEventsToSink(t *testing.T) {
+	hub := newEventHub()
+	sink := &fakeSink{failTx: hubEvent(1).TxHash}
+	events, _ := hub.Subscribe("sink", 10, dropOnFull)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		publishEvents(context.Background(), events, sink)
+	}()
+
+	for i := range 4 {
+		hub.Broadcast(context.Background(), hubEvent(i))
+	}
+	// Failed events don't stop publishing
+	assert.Eventually(t, func() bool {
+		return len(sink.Published()) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{hubEvent(0).TxHash, hubEvent(2).TxHash, hubEvent(3).TxHash}, sink.Published())
+
+	// Publishing stops once the hub is closed
+	hub.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publishing did not stop")
+	}
+}
+
+// stuckSink blocks publishes until ctx is done.
+type stuckSink struct {
+	fakeSink
+}
+
+func (s *stuckSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSinkPublishersDrainOnStop(t *testing.T) {
+	hub := newEventHub()
+	sinks := map[string]EventSink{"a": &fakeSink{}, "b": &fakeSink{}}
+	publishers := startSinkPublishers(hub, sinks, 10)
+
+	for i := range 5 {
+		hub.Broadcast(context.Background(), hubEvent(i))
+	}
+	assert.NoError(t, publishers.Stop(context.Background()))
+
+	// Buffered events are published before the sinks are closed
+	for _, sink := range sinks {
+		assert.Len(t, sink.(*fakeSink).Published(), 5)
+		assert.True(t, sink.(*fakeSink).closed)
+	}
+}
+
+func TestSinkPublishersStopAbortsPublishes(t *testing.T) {
+	hub := newEventHub()
+	sink := &stuckSink{}
+	publishers := startSinkPublishers(hub, map[string]EventSink{"stuck": sink}, 10)
+	hub.Broadcast(context.Background(), hubEvent(0))
+	hub.Broadcast(context.Background(), hubEvent(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, publishers.Stop(ctx))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stop did not abort publishing")
+	}
+	assert.True(t, sink.closed)
+}
+
+func TestNoopSink(t *testing.T) {
+	var sink EventSink = NoopSink{}
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(0)))
+	assert.NoError(t, sink.Close())
+}
+
+func TestParseEventBackends(t *testing.T) {
+	backends, err := parseEventBackends(" file, kafka ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"file": true, "kafka": true}, backends)
+
+	backends, err = parseEventBackends("")
+	assert.NoError(t, err)
+	assert.Nil(t, backends)
+
+	_, err = parseEventBackends("file,s3")
+	assert.EqualError(t, err, `unsupported event backend "s3"`)
+}
@@ -0,0 +1,100 @@
+package svc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// webhookSignatureHeader carries the hex encoded HMAC-SHA256 of the request
+// body, keyed with the shared secret, prefixed with "sha256=".
+const webhookSignatureHeader = "X-Deblock-Signature"
+
+// WebhookSinkConfig configures delivery of a WebhookSink.
+type WebhookSinkConfig struct {
+	URL string
+	// Shared secret of body signatures. Empty - requests are not signed.
+	Secret string
+	// Timeout of a single delivery attempt
+	Timeout time.Duration
+	// Number of retries after a failed attempt
+	Retries int
+	// Exponential backoff bounds between attempts
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// WebhookSink POSTs every event as JSON to a single webhook, e.g. for users
+// without Kafka. Failed deliveries, i.e. transport errors and non 2xx
+// responses, are retried with exponential backoff.
+type WebhookSink struct {
+	cfg    WebhookSinkConfig
+	client *http.Client
+	// Shapes request bodies, nil delivers events as they are
+	mapping *eventMapping
+}
+
+var _ EventSink = (*WebhookSink)(nil)
+
+func NewWebhookSink(cfg WebhookSinkConfig, mapping *eventMapping) (*WebhookSink, error) {
+	u, err := url.ParseRequestURI(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid webhook url %q", cfg.URL)
+	}
+	return &WebhookSink{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		mapping: mapping,
+	}, nil
+}
+
+func (w *WebhookSink) Publish(ctx context.Context, event *chain.TrackedWalletEvent) error {
+	body, err := w.mapping.Marshal(event)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if w.cfg.Secret != "" {
+		header.Set(webhookSignatureHeader, webhookSignature(w.cfg.Secret, body))
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(ctx, w.client, w.cfg.URL, body, header)
+		if err == nil || attempt >= w.cfg.Retries {
+			return err
+		}
+
+		delay := chain.BackoffDelay(attempt, w.cfg.BackoffBase, w.cfg.BackoffMax)
+		slog.Warn("failed to deliver event to webhook, retrying",
+			slog.String("chain", string(event.ChainName)),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (w *WebhookSink) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// webhookSignature returns the webhookSignatureHeader value of body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
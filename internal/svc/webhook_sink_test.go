@@ -0,0 +1,138 @@
+package svc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWebhookSinkConfig(url string) WebhookSinkConfig {
+	return WebhookSinkConfig{
+		URL:         url,
+		Secret:      "s3cret",
+		Timeout:     time.Second,
+		Retries:     3,
+		BackoffBase: time.Millisecond,
+		BackoffMax:  10 * time.Millisecond,
+	}
+}
+
+func TestWebhookSinkDelivers(t *testing.T) {
+	event := &chain.TrackedWalletEvent{
+		ChainName: chain.EthereumMainnet,
+		TxHash:    "0x01",
+		Wallet:    "0x9642b23Ed1E01Df1092B92641051881a322F5D4E",
+		Amount:    big.NewInt(1),
+	}
+	received := make(chan *http.Request, 1)
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer hook.Close()
+
+	sink, err := NewWebhookSink(testWebhookSinkConfig(hook.URL), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish(context.Background(), event))
+
+	r := <-received
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	expected, err := json.Marshal(event)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(body))
+
+	// Receivers verify the body with the shared secret
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(webhookSignatureHeader))
+	assert.NoError(t, sink.Close())
+}
+
+func TestWebhookSinkUnsigned(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer hook.Close()
+
+	cfg := testWebhookSinkConfig(hook.URL)
+	cfg.Secret = ""
+	sink, err := NewWebhookSink(cfg, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(0)))
+	assert.Empty(t, (<-received).Header.Get(webhookSignatureHeader))
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	var attempts atomic.Int32
+	signatures := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Get(webhookSignatureHeader)
+		// Fails twice before accepting the event
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer hook.Close()
+
+	sink, err := NewWebhookSink(testWebhookSinkConfig(hook.URL), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish(context.Background(), hubEvent(0)))
+	assert.Equal(t, int32(3), attempts.Load())
+	// Every attempt is signed the same way
+	close(signatures)
+	first := <-signatures
+	assert.NotEmpty(t, first)
+	for signature := range signatures {
+		assert.Equal(t, first, signature)
+	}
+}
+
+func TestWebhookSinkGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer hook.Close()
+
+	sink, err := NewWebhookSink(testWebhookSinkConfig(hook.URL), nil)
+	assert.NoError(t, err)
+	err = sink.Publish(context.Background(), hubEvent(0))
+	assert.EqualError(t, err, "webhook responded with status 500")
+	// Initial attempt and 3 retries
+	assert.Equal(t, int32(4), attempts.Load())
+
+	// Retries stop once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := testWebhookSinkConfig(hook.URL)
+	cfg.BackoffBase, cfg.BackoffMax = time.Hour, time.Hour
+	sink, err = NewWebhookSink(cfg, nil)
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	assert.ErrorIs(t, sink.Publish(ctx, hubEvent(0)), context.Canceled)
+}
+
+func TestNewWebhookSinkInvalidUrl(t *testing.T) {
+	for _, u := range []string{"", "example.com/hook", "ftp://example.com/hook"} {
+		_, err := NewWebhookSink(testWebhookSinkConfig(u), nil)
+		assert.Error(t, err, u)
+	}
+}
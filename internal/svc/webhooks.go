@@ -0,0 +1,168 @@
+package svc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+)
+
+// webhookWorkers is the number of concurrent wallet webhook deliveries.
+const webhookWorkers = 16
+
+// webhookRouter stores per user wallet webhook urls and delivers events
+// emitted for those wallets and users to their webhooks.
+type webhookRouter struct {
+	// chain -> normalized wallet -> user id -> webhook url
+	hooks map[chain.ChainName]map[string]map[int]string
+	// hooks mutex
+	mu sync.RWMutex
+
+	client *http.Client
+	// Shapes delivered event bodies, nil delivers events as they are
+	mapping *eventMapping
+
+	// Deliveries waiting for a worker
+	deliveries chan webhookDelivery
+	workers    sync.WaitGroup
+}
+
+type webhookDelivery struct {
+	url   string
+	body  []byte
+	chain chain.ChainName
+}
+
+// newWebhookRouter returns a router delivering through webhookWorkers
+// workers, which run until Close.
+func newWebhookRouter() *webhookRouter {
+	w := &webhookRouter{
+		hooks:      make(map[chain.ChainName]map[string]map[int]string),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		deliveries: make(chan webhookDelivery, webhookWorkers),
+	}
+	for range webhookWorkers {
+		w.workers.Add(1)
+		go w.work()
+	}
+	return w
+}
+
+func (w *webhookRouter) SetWebhook(userID int, wallet string, chainName chain.ChainName, webhookUrl string) error {
+	u, err := url.ParseRequestURI(webhookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid webhook url %q", webhookUrl)
+	}
+	normalized, err := chain.NormalizeWallet(chainName, wallet)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.hooks[chainName]; !ok {
+		w.hooks[chainName] = make(map[string]map[int]string)
+	}
+	if _, ok := w.hooks[chainName][normalized]; !ok {
+		w.hooks[chainName][normalized] = make(map[int]string)
+	}
+	w.hooks[chainName][normalized][userID] = webhookUrl
+
+	return nil
+}
+
+func (w *webhookRouter) RemoveWebhook(userID int, wallet string, chainName chain.ChainName) error {
+	normalized, err := chain.NormalizeWallet(chainName, wallet)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.hooks[chainName][normalized], userID)
+	if len(w.hooks[chainName][normalized]) == 0 {
+		delete(w.hooks[chainName], normalized)
+	}
+
+	return nil
+}
+
+// route returns the webhook url of the wallet and user the event was emitted
+// for. Other wallets involved in the event are not routed to, as they may
+// belong to other users.
+func (w *webhookRouter) route(event *chain.TrackedWalletEvent) (string, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	u, ok := w.hooks[event.ChainName][event.Wallet][event.UserID]
+	return u, ok
+}
+
+// Dispatch queues delivery of the event to the webhook of its wallet and
+// user. It waits while all workers are busy.
+func (w *webhookRouter) Dispatch(event *chain.TrackedWalletEvent) {
+	u, ok := w.route(event)
+	if !ok {
+		return
+	}
+
+	body, err := w.mapping.Marshal(event)
+	if err != nil {
+		slog.Error("failed to marshal event for webhook", slog.Any("error", err))
+		return
+	}
+	w.deliveries <- webhookDelivery{url: u, body: body, chain: event.ChainName}
+}
+
+func (w *webhookRouter) work() {
+	defer w.workers.Done()
+	for d := range w.deliveries {
+		if err := w.deliver(context.Background(), d.url, d.body); err != nil {
+			slog.Error("failed to deliver event to wallet webhook",
+				slog.String("chain", string(d.chain)),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// Close waits for queued deliveries. Dispatch must not be called after
+// Close.
+func (w *webhookRouter) Close() {
+	close(w.deliveries)
+	w.workers.Wait()
+}
+
+func (w *webhookRouter) deliver(ctx context.Context, webhookUrl string, body []byte) error {
+	return postWebhook(ctx, w.client, webhookUrl, body, nil)
+}
+
+// postWebhook POSTs the JSON body with additional header to the webhook. Non
+// 2xx responses are errors.
+func postWebhook(ctx context.Context, client *http.Client, webhookUrl string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
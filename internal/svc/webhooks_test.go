@@ -0,0 +1,183 @@
+package svc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mantelijo/deblock-backend/internal/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookRecorder starts webhooks which report name:tx_hash:user_id of
+// received events.
+func webhookRecorder(t *testing.T) (func(name string) string, <-chan string) {
+	received := make(chan string, 10)
+	return func(name string) string {
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			event := &chain.TrackedWalletEvent{}
+			assert.NoError(t, json.Unmarshal(body, event))
+			received <- fmt.Sprintf("%s:%s:%d", name, event.TxHash, event.UserID)
+		}))
+		t.Cleanup(hook.Close)
+		return hook.URL
+	}, received
+}
+
+// receiveWebhooks returns n webhook calls and fails if any more arrive.
+func receiveWebhooks(t *testing.T, received <-chan string, n int) map[string]bool {
+	t.Helper()
+	got := map[string]bool{}
+	for range n {
+		select {
+		case r := <-received:
+			got[r] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook was not called")
+		}
+	}
+	select {
+	case r := <-received:
+		t.Fatalf("unexpected webhook call %s", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return got
+}
+
+func TestWebhookRouterRoutesPerWallet(t *testing.T) {
+	walletA := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	walletB := "0xeEa5b26B94E4e5bA416c9725e51aB755E2ddE107"
+	makeHook, received := webhookRecorder(t)
+
+	router := newWebhookRouter()
+	defer router.Close()
+	// Lowercase input is normalized to the checksummed form used in events
+	assert.NoError(t, router.SetWebhook(1, "0x9642b23ed1e01df1092b92641051881a322f5d4e", chain.EthereumMainnet, makeHook("a")))
+	assert.NoError(t, router.SetWebhook(2, walletB, chain.EthereumMainnet, makeHook("b")))
+
+	// Both tracked wallets are parties of the transaction, each webhook
+	// receives only the event of its own wallet
+	for _, event := range []*chain.TrackedWalletEvent{
+		{Wallet: walletA, UserID: 1},
+		{Wallet: walletB, UserID: 2},
+	} {
+		event.ChainName = chain.EthereumMainnet
+		event.TxHash = "0x01"
+		event.Source = walletA
+		event.Destination = walletB
+		event.Amount, event.Fees = big.NewInt(1), big.NewInt(1)
+		router.Dispatch(event)
+	}
+	assert.Equal(t, map[string]bool{"a:0x01:1": true, "b:0x01:2": true}, receiveWebhooks(t, received, 2))
+
+	// Same wallet on another chain is not routed
+	_, ok := router.route(&chain.TrackedWalletEvent{
+		ChainName: chain.SolanaMainnet,
+		Wallet:    walletA,
+		UserID:    1,
+	})
+	assert.False(t, ok)
+
+	assert.NoError(t, router.RemoveWebhook(1, walletA, chain.EthereumMainnet))
+	_, ok = router.route(&chain.TrackedWalletEvent{
+		ChainName: chain.EthereumMainnet,
+		Wallet:    walletA,
+		UserID:    1,
+	})
+	assert.False(t, ok)
+}
+
+func TestWebhookRouterRoutesPerUser(t *testing.T) {
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	makeHook, received := webhookRecorder(t)
+
+	router := newWebhookRouter()
+	defer router.Close()
+	assert.NoError(t, router.SetWebhook(1, wallet, chain.EthereumMainnet, makeHook("a")))
+	assert.NoError(t, router.SetWebhook(2, wallet, chain.EthereumMainnet, makeHook("b")))
+
+	// Every user's copy of the event is delivered to the user's webhook only
+	dispatch := func(txHash string, users ...int) {
+		for _, userID := range users {
+			router.Dispatch(&chain.TrackedWalletEvent{
+				ChainName: chain.EthereumMainnet,
+				TxHash:    txHash,
+				Wallet:    wallet,
+				UserID:    userID,
+				Amount:    big.NewInt(1),
+				Fees:      big.NewInt(1),
+			})
+		}
+	}
+	dispatch("0x01", 1, 2, 3)
+	assert.Equal(t, map[string]bool{"a:0x01:1": true, "b:0x01:2": true}, receiveWebhooks(t, received, 2))
+
+	// Removing the webhook of a user keeps webhooks of other users
+	assert.NoError(t, router.RemoveWebhook(1, wallet, chain.EthereumMainnet))
+	dispatch("0x02", 1, 2)
+	assert.Equal(t, map[string]bool{"b:0x02:2": true}, receiveWebhooks(t, received, 1))
+}
+
+func TestWebhookRouterBoundsDeliveries(t *testing.T) {
+	wallet := "0x9642b23Ed1E01Df1092B92641051881a322F5D4E"
+	var inFlight, maxInFlight atomic.Int64
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+	}))
+	defer hook.Close()
+
+	router := newWebhookRouter()
+	assert.NoError(t, router.SetWebhook(1, wallet, chain.EthereumMainnet, hook.URL))
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for i := range 3 * webhookWorkers {
+			router.Dispatch(&chain.TrackedWalletEvent{
+				ChainName: chain.EthereumMainnet,
+				TxHash:    fmt.Sprintf("0x%02x", i),
+				Wallet:    wallet,
+				UserID:    1,
+				Amount:    big.NewInt(1),
+				Fees:      big.NewInt(1),
+			})
+		}
+	}()
+
+	// Dispatch waits once workers and the queue are busy
+	assert.Eventually(t, func() bool {
+		return inFlight.Load() == webhookWorkers
+	}, 2*time.Second, 5*time.Millisecond)
+	select {
+	case <-dispatched:
+		t.Fatal("expected dispatch to wait for busy workers")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-dispatched
+	router.Close()
+	assert.Equal(t, int64(webhookWorkers), maxInFlight.Load())
+}
+
+func TestWebhookRouterRejectsInvalidInput(t *testing.T) {
+	router := newWebhookRouter()
+	defer router.Close()
+	assert.Error(t, router.SetWebhook(1, "0x9642b23Ed1E01Df1092B92641051881a322F5D4E", chain.EthereumMainnet, "ftp://nope"))
+	assert.Error(t, router.SetWebhook(1, "not-a-wallet", chain.EthereumMainnet, "https://example.com"))
+}